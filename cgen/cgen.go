@@ -0,0 +1,304 @@
+package cgen
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+type generator struct {
+    p *ir.Program
+    info *check.Info
+    types map[string]*cType // by core.TypeString of the erased type
+    variants []*cType
+    reachable []*ir.Function // from main, the others are left out
+    names map[*ir.Function]string
+    printers map[string]string // by C type
+
+    typedefs strings.Builder
+    structs strings.Builder
+    protos strings.Builder
+    funcs strings.Builder
+    prints strings.Builder
+}
+
+// Generate translates a lowered program to C99 that includes the runtime
+// header by the name RuntimeHeader. Its main prints the result of fn
+// main formatted like interp.Format.
+func Generate(p *ir.Program, info *check.Info) (string, error) {
+    main := p.Lookup("main")
+    if main == nil {
+        return "", errors.New("No fn main")
+    }
+    if len(main.Params) > 0 {
+        return "", errors.New("fn main must not take parameters")
+    }
+
+    g := &generator{
+        p: p,
+        info: info,
+        types: make(map[string]*cType),
+        names: make(map[*ir.Function]string),
+        printers: make(map[string]string),
+    }
+    g.reachable = ir.Reachable(p, main)
+    used := make(map[string]bool)
+    for _, f := range g.reachable {
+        name := "fn_" + mangle(f.Name)
+        for used[name] {
+            name += "_"
+        }
+        used[name] = true
+        g.names[f] = name
+    }
+
+    for _, f := range g.reachable {
+        g.function(f)
+    }
+    print := g.printer(ir.ReturnOf(main.Signature))
+    for i := 0; i < len(g.variants); i++ {
+        g.defineVariant(g.variants[i])
+    }
+
+    var out strings.Builder
+    fmt.Fprintf(&out, "#include \"%s\"\n\n", RuntimeHeader)
+    for _, section := range []*strings.Builder{&g.typedefs, &g.structs, &g.protos, &g.funcs, &g.prints} {
+        if section.Len() > 0 {
+            out.WriteString(strings.TrimRight(section.String(), "\n") + "\n\n")
+        }
+    }
+    fmt.Fprintf(&out, "int main(void) {\n    %s(%s());\n    putchar('\\n');\n    return 0;\n}\n",
+        print, g.names[main])
+    return out.String(), nil
+}
+
+// a C identifier for the name of a function, instances like id[Int]
+// become id_Int_
+func mangle(name string) string {
+    return strings.Map(func(r rune) rune {
+        if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+            return r
+        }
+        return '_'
+    }, name)
+}
+
+func local(v *ir.Value) string {
+    return v.Name()
+}
+
+// the C type of the value v, the representation if it was not lowered
+// from a checked type
+func (g *generator) valueType(v *ir.Value) string {
+    if v.Source != nil {
+        return g.cType(v.Source)
+    }
+    switch v.Type {
+    case ir.Int:
+        return "int64_t"
+    case ir.F64:
+        return "double"
+    case ir.Bool:
+        return "bool"
+    }
+    return "ibex_unit"
+}
+
+func (g *generator) function(f *ir.Function) {
+    params := g.cTypes(ir.Flatten(f.Signature.Argument))
+    ret := g.cType(ir.ReturnOf(f.Signature))
+    decls := make([]string, len(params))
+    for i, p := range params {
+        decls[i] = fmt.Sprintf("%s p%d", p, i)
+    }
+    header := fmt.Sprintf("static %s %s(%s)", ret, g.names[f], paramList(decls))
+    fmt.Fprintf(&g.protos, "%s;\n", header)
+
+    w := &g.funcs
+    fmt.Fprintf(w, "/* fn %s */\n%s {\n", f.Name, header)
+    for _, b := range f.Blocks {
+        for _, v := range b.Values {
+            fmt.Fprintf(w, "    %s %s;\n", g.valueType(v), local(v))
+        }
+    }
+    for _, b := range f.Blocks {
+        if len(b.Preds) > 0 {
+            fmt.Fprintf(w, "%s:\n", b.Name())
+        }
+        for _, v := range b.Values {
+            if v.Op != ir.OpPhi {
+                g.value(w, v)
+            }
+        }
+        g.terminator(w, b)
+    }
+    w.WriteString("}\n\n")
+}
+
+func position(v *ir.Value) string {
+    return quote(v.Pos.String())
+}
+
+func (g *generator) value(w *strings.Builder, v *ir.Value) {
+    args := make([]string, len(v.Args))
+    for i, arg := range v.Args {
+        args[i] = local(arg)
+    }
+    set := func(format string, a ...interface{}) {
+        fmt.Fprintf(w, "    %s = %s;\n", local(v), fmt.Sprintf(format, a...))
+    }
+
+    switch v.Op {
+    case ir.OpParam:
+        set("p%d", v.Aux.(int))
+    case ir.OpConst:
+        set("%s", constant(v.Aux))
+    case ir.OpUnit:
+        set("0")
+    case ir.OpString:
+        s := v.Aux.(string)
+        set("ibex_str(%s, %d)", quote(s), len(s))
+    case ir.OpFunc:
+        set("&%s", g.names[g.p.Lookup(v.Aux.(string))])
+
+    case ir.OpAdd, ir.OpSub, ir.OpMul, ir.OpNeg:
+        if v.Type == ir.F64 {
+            op := map[ir.Op]string{ir.OpAdd: "+", ir.OpSub: "-", ir.OpMul: "*"}[v.Op]
+            if v.Op == ir.OpNeg {
+                set("-%s", args[0])
+            } else {
+                set("%s %s %s", args[0], op, args[1])
+            }
+            return
+        }
+        set("ibex_%s(%s)", v.Op, strings.Join(args, ", "))
+    case ir.OpDiv, ir.OpMod:
+        if v.Type == ir.F64 {
+            set("%s / %s", args[0], args[1])
+            return
+        }
+        set("ibex_%s(%s, %s, %s)", v.Op, args[0], args[1], position(v))
+    case ir.OpNot:
+        set("!%s", args[0])
+    case ir.OpEq:
+        switch v.Args[0].Type {
+        case ir.Ptr:
+            set("ibex_str_eq(%s, %s)", args[0], args[1])
+        case ir.Unit:
+            set("true")
+        default:
+            set("%s == %s", args[0], args[1])
+        }
+
+    case ir.OpTuple:
+        set("(%s){%s}", g.valueType(v), strings.Join(args, ", "))
+    case ir.OpArray:
+        elem := g.cType(v.Source.(core.IbexArrayType).Elem())
+        set("(%s){%d, ibex_alloc(%d * sizeof(%s))}", g.valueType(v), len(args), len(args), elem)
+        for i, arg := range args {
+            fmt.Fprintf(w, "    %s.data[%d] = %s;\n", local(v), i, arg)
+        }
+    case ir.OpVariant:
+        set("ibex_alloc(sizeof *%s)", local(v))
+        fmt.Fprintf(w, "    %s->tag = %d;\n", local(v), v.Aux.(int))
+        if len(args) > 0 {
+            fmt.Fprintf(w, "    %s->payload.c%d = %s;\n", local(v), v.Aux.(int), args[0])
+        }
+    case ir.OpElem:
+        set("%s.%s", args[0], g.fieldName(v.Args[0].Source, v.Aux.(int)))
+    case ir.OpIndex:
+        fmt.Fprintf(w, "    ibex_check_index(%s, %s.len, %s);\n", args[1], args[0], position(v))
+        set("%s.data[%s]", args[0], args[1])
+    case ir.OpTag:
+        set("%s->tag", args[0])
+    case ir.OpPayload:
+        set("%s->payload.c%d", args[0], v.Aux.(int))
+
+    case ir.OpCall:
+        set("%s(%s)", g.names[g.p.Lookup(v.Aux.(string))], strings.Join(args, ", "))
+    case ir.OpCallInd:
+        set("%s(%s)", args[0], strings.Join(args[1:], ", "))
+    }
+}
+
+func constant(aux interface{}) string {
+    switch c := aux.(type) {
+    case int64:
+        if c == math.MinInt64 {
+            return "INT64_MIN"
+        }
+        return fmt.Sprintf("INT64_C(%d)", c)
+    case bool:
+        return strconv.FormatBool(c)
+    case float64:
+        return strconv.FormatFloat(c, 'e', -1, 64)
+    }
+    return "0"
+}
+
+// a C string literal, octal escapes keep it portable
+func quote(s string) string {
+    var b strings.Builder
+    b.WriteString("\"")
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '?' {
+            fmt.Fprintf(&b, "\\%03o", c)
+        } else {
+            b.WriteByte(c)
+        }
+    }
+    b.WriteString("\"")
+    return b.String()
+}
+
+// the copies into the phis of b.Succs[i] on that edge
+func (g *generator) edge(w *strings.Builder, b *ir.Block, i int, indent string) {
+    s := b.Succs[i]
+    nth := 0
+    for _, other := range b.Succs[:i] {
+        if other == s {
+            nth++
+        }
+    }
+    for j, p := range s.Preds {
+        if p != b {
+            continue
+        }
+        if nth > 0 {
+            nth--
+            continue
+        }
+        for _, v := range s.Values {
+            if v.Op == ir.OpPhi {
+                fmt.Fprintf(w, "%s%s = %s;\n", indent, local(v), local(v.Args[j]))
+            }
+        }
+        break
+    }
+    fmt.Fprintf(w, "%sgoto %s;\n", indent, s.Name())
+}
+
+func (g *generator) terminator(w *strings.Builder, b *ir.Block) {
+    switch b.Kind {
+    case ir.BlockJump:
+        g.edge(w, b, 0, "    ")
+    case ir.BlockIf:
+        fmt.Fprintf(w, "    if (%s) {\n", local(b.Control))
+        g.edge(w, b, 0, "        ")
+        w.WriteString("    } else {\n")
+        g.edge(w, b, 1, "        ")
+        w.WriteString("    }\n")
+    case ir.BlockReturn:
+        fmt.Fprintf(w, "    return %s;\n", local(b.Control))
+    case ir.BlockTrap:
+        // exit is only there for compilers that warn about a missing return
+        fmt.Fprintf(w, "    ibex_trap(%s, %s);\n    exit(1);\n", quote(b.Message), quote(b.Pos.String()))
+    }
+}
@@ -0,0 +1,68 @@
+package cgen
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/internal/backendtest"
+)
+
+func generateSource(t *testing.T, src string, level int) string {
+	return generate(t, backendtest.Lower(t, src, level))
+}
+
+func generate(t *testing.T, l *backendtest.Lowered) string {
+	c, err := Generate(l.Program, l.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// compiles c with the local C compiler and runs it
+func compileAndRun(t *testing.T, c string) (string, error) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, RuntimeHeader), []byte(Runtime), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "main.c"), []byte(c), 0644))
+	out, err := exec.Command(cc, "-std=c99", "-pedantic-errors", "-Wall", "-Werror",
+		"-Wno-unused-but-set-variable", "-o", filepath.Join(dir, "main"),
+		filepath.Join(dir, "main.c")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s\n%s", err, out, c)
+	}
+	out, err = exec.Command(filepath.Join(dir, "main")).CombinedOutput()
+	return string(out), err
+}
+
+func run(t *testing.T, l *backendtest.Lowered) (string, error) {
+	return compileAndRun(t, generate(t, l))
+}
+
+func TestGenerateMatchesInterpreter(t *testing.T) {
+	backendtest.MatchesInterpreter(t, run)
+}
+
+func TestGenerateTraps(t *testing.T) {
+	backendtest.FailsOnTraps(t, run, func(message string, pos string) string {
+		return "Runtime error: " + message + "\n    at " + pos + "\n"
+	})
+}
+
+func TestGenerateNames(t *testing.T) {
+	assert.Equal(t, "id_Int_", mangle("id[Int]"))
+	c := generateSource(t, `fn id[T] x: T -> T
+    x
+fn int -> Int
+    7 -> id
+fn main -> (Int, String)
+    (() -> int, "s" -> id)`, 0)
+	assert.Contains(t, c, "id_Int_(")
+	assert.Contains(t, c, "id_String_(")
+}
@@ -0,0 +1,93 @@
+package cgen
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// the name of a C function printing a value of type ty like
+// interp.Format, generated on first use
+func (g *generator) printer(ty core.IbexType) string {
+    c := g.cType(ty)
+    switch c {
+    case "int64_t":
+        return "ibex_print_int"
+    case "bool":
+        return "ibex_print_bool"
+    case "ibex_string":
+        return "ibex_print_string"
+    case "ibex_unit":
+        return "ibex_print_unit"
+    }
+    if name, ok := g.printers[c]; ok {
+        return name
+    }
+    name := "ibex_print_" + strings.TrimPrefix(c, "ibex_")
+    g.printers[c] = name
+    fmt.Fprintf(&g.protos, "static void %s(%s v);\n", name, c)
+
+    var body strings.Builder
+    switch t := ir.Erase(ty).(type) {
+    case core.IbexTupleType:
+        body.WriteString("    putchar('(');\n")
+        for i, elem := range t.ElementTypes {
+            if i > 0 {
+                body.WriteString("    fputs(\", \", stdout);\n")
+            }
+            fmt.Fprintf(&body, "    %s(v._%d);\n", g.printer(elem), i)
+        }
+        body.WriteString("    putchar(')');\n")
+    case core.IbexNamedTupleType:
+        body.WriteString("    putchar('(');\n")
+        for i, entry := range t.Types {
+            sep := ", "
+            if i == 0 {
+                sep = ""
+            }
+            fmt.Fprintf(&body, "    fputs(\"%s%s: \", stdout);\n", sep, entry.Name)
+            fmt.Fprintf(&body, "    %s(v.%s);\n", g.printer(entry.Type), field(entry.Name))
+        }
+        body.WriteString("    putchar(')');\n")
+    case core.IbexArrayType:
+        fmt.Fprintf(&body, `    int64_t i;
+    putchar('[');
+    for (i = 0; i < v.len; i++) {
+        if (i > 0) {
+            fputs(", ", stdout);
+        }
+        %s(v.data[i]);
+    }
+    putchar(']');
+`, g.printer(t.Elem()))
+    case core.IbexSimpleType:
+        body.WriteString("    switch (v->tag) {\n")
+        for i, cs := range g.info.Cases(t) {
+            fmt.Fprintf(&body, "    case %d:\n        fputs(\"%s\", stdout);\n", i, cs.Tag)
+            switch cs.Payload.(type) {
+            case nil:
+            case core.IbexTupleType, core.IbexNamedTupleType:
+                fmt.Fprintf(&body, "        putchar(' ');\n        %s(v->payload.c%d);\n",
+                    g.printer(cs.Payload), i)
+            default:
+                fmt.Fprintf(&body, "        fputs(\" (\", stdout);\n        %s(v->payload.c%d);\n        putchar(')');\n",
+                    g.printer(cs.Payload), i)
+            }
+            body.WriteString("        break;\n")
+        }
+        body.WriteString("    }\n")
+    case core.IbexFunctionType:
+        for _, f := range g.reachable {
+            name := f.Name
+            if i := strings.Index(name, "["); i >= 0 {
+                name = name[:i]
+            }
+            fmt.Fprintf(&body, "    if (v == (%s)&%s) {\n        fputs(\"fn %s\", stdout);\n    }\n",
+                c, g.names[f], name)
+        }
+    }
+    fmt.Fprintf(&g.prints, "static void %s(%s v) {\n%s}\n\n", name, c, body.String())
+    return name
+}
@@ -0,0 +1,125 @@
+package cgen
+
+// the name the generated code includes the runtime header by
+const RuntimeHeader = "ibex.h"
+
+// Runtime is the header every generated program includes. Arithmetic
+// wraps around like in the interpreter, aggregates are never freed.
+const Runtime = `#ifndef IBEX_H
+#define IBEX_H
+
+#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef char ibex_unit;
+
+typedef struct {
+    int64_t len;
+    const char *data;
+} ibex_string;
+
+static void ibex_trap(const char *message, const char *pos) {
+    fprintf(stderr, "Runtime error: %s\n    at %s\n", message, pos);
+    exit(1);
+}
+
+static inline void *ibex_alloc(size_t size) {
+    void *p = malloc(size > 0 ? size : 1);
+    if (p == NULL) {
+        fputs("Out of memory\n", stderr);
+        exit(1);
+    }
+    return p;
+}
+
+static inline ibex_string ibex_str(const char *data, int64_t len) {
+    ibex_string s;
+    s.len = len;
+    s.data = data;
+    return s;
+}
+
+static inline bool ibex_str_eq(ibex_string a, ibex_string b) {
+    return a.len == b.len && memcmp(a.data, b.data, (size_t)a.len) == 0;
+}
+
+static inline int64_t ibex_add(int64_t x, int64_t y) {
+    return (int64_t)((uint64_t)x + (uint64_t)y);
+}
+
+static inline int64_t ibex_sub(int64_t x, int64_t y) {
+    return (int64_t)((uint64_t)x - (uint64_t)y);
+}
+
+static inline int64_t ibex_mul(int64_t x, int64_t y) {
+    return (int64_t)((uint64_t)x * (uint64_t)y);
+}
+
+static inline int64_t ibex_neg(int64_t x) {
+    return (int64_t)(0 - (uint64_t)x);
+}
+
+static inline int64_t ibex_div(int64_t x, int64_t y, const char *pos) {
+    if (y == 0) {
+        ibex_trap("Division by zero", pos);
+    }
+    return y == -1 ? ibex_neg(x) : x / y;
+}
+
+static inline int64_t ibex_mod(int64_t x, int64_t y, const char *pos) {
+    if (y == 0) {
+        ibex_trap("Division by zero", pos);
+    }
+    return y == -1 ? 0 : x % y;
+}
+
+static inline void ibex_check_index(int64_t i, int64_t len, const char *pos) {
+    char message[96];
+    if (i < 0 || i >= len) {
+        sprintf(message, "Index %lld is out of range for an array of length %lld",
+            (long long)i, (long long)len);
+        ibex_trap(message, pos);
+    }
+}
+
+static inline void ibex_print_int(int64_t x) {
+    printf("%lld", (long long)x);
+}
+
+static inline void ibex_print_bool(bool x) {
+    fputs(x ? "true" : "false", stdout);
+}
+
+static inline void ibex_print_unit(ibex_unit x) {
+    (void)x;
+    fputs("()", stdout);
+}
+
+/* quoted like Go's strconv.Quote for ASCII */
+static inline void ibex_print_string(ibex_string s) {
+    int64_t i;
+    putchar('"');
+    for (i = 0; i < s.len; i++) {
+        unsigned char c = (unsigned char)s.data[i];
+        switch (c) {
+        case '"': fputs("\\\"", stdout); break;
+        case '\\': fputs("\\\\", stdout); break;
+        case '\n': fputs("\\n", stdout); break;
+        case '\t': fputs("\\t", stdout); break;
+        case '\r': fputs("\\r", stdout); break;
+        default:
+            if (c < 0x20 || c == 0x7f) {
+                printf("\\x%02x", c);
+            } else {
+                putchar(c);
+            }
+        }
+    }
+    putchar('"');
+}
+
+#endif
+`
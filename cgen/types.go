@@ -0,0 +1,148 @@
+package cgen
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// Tuples and named tuples become structs passed by value, arrays a
+// struct of their length and a pointer to the elements. Variants may be
+// recursive, so they are pointers to a struct of the tag and a union of
+// the payloads. Function values are function pointers taking the
+// parameters flattened as in the IR.
+type cType struct {
+    name string
+    ty core.IbexType
+}
+
+var keywords = map[string]bool{
+    "auto": true, "break": true, "case": true, "char": true, "const": true,
+    "continue": true, "default": true, "do": true, "double": true,
+    "else": true, "enum": true, "extern": true, "float": true, "for": true,
+    "goto": true, "if": true, "inline": true, "int": true, "long": true,
+    "register": true, "restrict": true, "return": true, "short": true,
+    "signed": true, "sizeof": true, "static": true, "struct": true,
+    "switch": true, "typedef": true, "union": true, "unsigned": true,
+    "void": true, "volatile": true, "while": true, "bool": true,
+    "true": true, "false": true,
+}
+
+// a C identifier for an Ibex one
+func field(name string) string {
+    if keywords[name] {
+        return name + "_"
+    }
+    return name
+}
+
+// the C type of an Ibex type, declaring it on first use
+func (g *generator) cType(ty core.IbexType) string {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        switch t.Name {
+        case "Int":
+            return "int64_t"
+        case "F64":
+            return "double"
+        case "Bool":
+            return "bool"
+        case "String":
+            return "ibex_string"
+        }
+    case core.IbexTupleType:
+        if len(t.ElementTypes) == 0 {
+            return "ibex_unit"
+        }
+    }
+
+    ty = ir.Erase(ty)
+    key := core.TypeString(ty)
+    if c, ok := g.types[key]; ok {
+        return c.name
+    }
+    c := &cType{name: fmt.Sprintf("ibex_t%d", len(g.types)), ty: ty}
+    g.types[key] = c
+
+    switch t := ty.(type) {
+    case core.IbexFunctionType:
+        params := g.cTypes(ir.Flatten(t.Argument))
+        ret := g.cType(ir.ReturnOf(t))
+        fmt.Fprintf(&g.typedefs, "typedef %s (*%s)(%s); /* %s */\n",
+            ret, c.name, paramList(params), key)
+    case core.IbexSimpleType:
+        fmt.Fprintf(&g.typedefs, "typedef struct %s *%s; /* %s */\n", c.name, c.name, key)
+        g.variants = append(g.variants, c)
+    default:
+        fmt.Fprintf(&g.typedefs, "typedef struct %s %s; /* %s */\n", c.name, c.name, key)
+        g.defineStruct(c)
+    }
+    return c.name
+}
+
+func (g *generator) cTypes(types []core.IbexType) []string {
+    names := make([]string, len(types))
+    for i, ty := range types {
+        names[i] = g.cType(ty)
+    }
+    return names
+}
+
+func paramList(params []string) string {
+    if len(params) == 0 {
+        return "void"
+    }
+    return strings.Join(params, ", ")
+}
+
+// Fields of a struct are defined before it unless they are pointers.
+// Variants are defined last as their payloads may be any of the others.
+func (g *generator) defineStruct(c *cType) {
+    var fields []string
+    switch t := c.ty.(type) {
+    case core.IbexTupleType:
+        for i, elem := range t.ElementTypes {
+            fields = append(fields, fmt.Sprintf("%s _%d;", g.cType(elem), i))
+        }
+    case core.IbexNamedTupleType:
+        for _, entry := range t.Types {
+            fields = append(fields, fmt.Sprintf("%s %s;", g.cType(entry.Type), field(entry.Name)))
+        }
+    case core.IbexArrayType:
+        fields = append(fields, "int64_t len;",
+            fmt.Sprintf("%s *data;", g.cType(t.Elem())))
+    }
+    fmt.Fprintf(&g.structs, "struct %s {\n", c.name)
+    for _, f := range fields {
+        fmt.Fprintf(&g.structs, "    %s\n", f)
+    }
+    g.structs.WriteString("};\n\n")
+}
+
+func (g *generator) defineVariant(c *cType) {
+    payloads := make([]string, 0)
+    for i, cs := range g.info.Cases(c.ty) {
+        if cs.Payload != nil {
+            payloads = append(payloads, fmt.Sprintf("%s c%d;", g.cType(cs.Payload), i))
+        }
+    }
+    fmt.Fprintf(&g.structs, "struct %s {\n    int64_t tag;\n", c.name)
+    if len(payloads) > 0 {
+        g.structs.WriteString("    union {\n")
+        for _, p := range payloads {
+            fmt.Fprintf(&g.structs, "        %s\n", p)
+        }
+        g.structs.WriteString("    } payload;\n")
+    }
+    g.structs.WriteString("};\n\n")
+}
+
+// the name of the C field holding element i of a tuple or named tuple
+func (g *generator) fieldName(ty core.IbexType, i int) string {
+    if t, ok := ty.(core.IbexNamedTupleType); ok {
+        return field(t.Types[i].Name)
+    }
+    return fmt.Sprintf("_%d", i)
+}
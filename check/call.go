@@ -0,0 +1,106 @@
+package check
+
+import (
+    "github.com/ibex-lang/ibex/core"
+)
+
+// how the argument at a call site is matched to the parameters, see
+// argumentType for the calling convention
+type CallArgs int
+
+const (
+    ArgsDirect CallArgs = iota // passed as is
+    ArgsPositional             // a tuple, element i is parameter i
+    ArgsNamed                  // a named tuple in another order, see Call.Order
+)
+
+type Call struct {
+    Args CallArgs
+    // for ArgsNamed, Order[i] is the index in the argument of parameter i
+    Order []int
+}
+
+func (c *Checker) checkArgument(input, param core.IbexType) (*Call, error) {
+    params, ok := prune(param).(core.IbexNamedTupleType)
+    if !ok {
+        return &Call{Args: ArgsDirect}, c.expect(input, param)
+    }
+
+    switch arg := prune(input).(type) {
+    case core.IbexTupleType:
+        if len(arg.ElementTypes) != len(params.Types) {
+            return nil, c.errorf("Expected %d arguments, found %d",
+                len(params.Types), len(arg.ElementTypes))
+        }
+        for i, entry := range params.Types {
+            if err := c.expect(arg.ElementTypes[i], entry.Type); err != nil {
+                return nil, err
+            }
+        }
+        return &Call{Args: ArgsPositional}, nil
+
+    case core.IbexNamedTupleType:
+        for _, entry := range arg.Types {
+            if lookupField(params, entry.Name) == nil {
+                return nil, c.errorf("Unknown argument %s", entry.Name)
+            }
+        }
+
+        order := make([]int, len(params.Types))
+        inOrder := true
+        for i, entry := range params.Types {
+            order[i] = fieldIndex(arg, entry.Name)
+            if order[i] < 0 {
+                return nil, c.errorf("Missing argument %s", entry.Name)
+            }
+            inOrder = inOrder && order[i] == i
+            if err := c.expect(arg.Types[order[i]].Type, entry.Type); err != nil {
+                return nil, err
+            }
+        }
+        if inOrder {
+            return &Call{Args: ArgsDirect}, nil
+        }
+        return &Call{Args: ArgsNamed, Order: order}, nil
+    }
+
+    return &Call{Args: ArgsDirect}, c.expect(input, param)
+}
+
+func fieldIndex(tuple core.IbexNamedTupleType, name string) int {
+    for i, entry := range tuple.Types {
+        if entry.Name == name {
+            return i
+        }
+    }
+    return -1
+}
+
+// function values are interchangeable when their parameters only differ
+// in being passed by position or by tag
+func unifyArgument(a, b core.IbexType) bool {
+    a, b = prune(a), prune(b)
+    if x, ok := a.(core.IbexTupleType); ok {
+        if y, ok := b.(core.IbexNamedTupleType); ok {
+            return unifyPositional(x, y)
+        }
+    }
+    if x, ok := a.(core.IbexNamedTupleType); ok {
+        if y, ok := b.(core.IbexTupleType); ok {
+            return unifyPositional(y, x)
+        }
+    }
+    return unify(a, b)
+}
+
+func unifyPositional(tuple core.IbexTupleType, named core.IbexNamedTupleType) bool {
+    if len(tuple.ElementTypes) != len(named.Types) {
+        return false
+    }
+    for i, entry := range named.Types {
+        if !unify(tuple.ElementTypes[i], entry.Type) {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,390 @@
+package check
+
+import (
+    "fmt"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type TypeError struct {
+    pos parser.Pos // zero for the prelude, which is in no file
+    fn string
+    message string
+}
+
+func (e *TypeError) Error() string {
+    message := e.message
+    if e.fn != "" {
+        message = fmt.Sprintf("In fn %s: %s", e.fn, message)
+    }
+    if e.pos.Line == 0 {
+        return message
+    }
+    return fmt.Sprintf("%s: %s", e.pos, message)
+}
+
+// the position of the expression, pattern or declaration the error is
+// about
+func (e *TypeError) Pos() parser.Pos {
+    return e.pos
+}
+
+func (e *TypeError) Message() string {
+    return e.message
+}
+
+// result of checking a compilation unit
+type Info struct {
+    Types map[string]core.IbexType // resolved type declarations
+    TypeParams map[string][]string // of the generic ones
+    Functions map[string]core.IbexFunctionType
+    // types of the bodies of the functions declared without a return type
+    Inferred map[string]core.IbexType
+    Instances []*Instance // see instances.go
+    Calls map[parser.Pos]*Call // keyed by the position of the arrow
+    Symbols map[parser.Pos]*Symbol // keyed by the position of the identifier
+    // types of identifiers, constructors and array literals, which are
+    // all a backend needs to know the type of every expression
+    ExprTypes map[parser.Pos]core.IbexType
+    // type arguments of references to generic functions, in terms of the
+    // type parameters of the function they appear in
+    TypeArgs map[parser.Pos][]core.IbexType
+    Warnings []*Warning
+}
+
+// the cases of the variant type ty with its type arguments in place of
+// the type parameters, nil if ty is no variant
+func (info *Info) Cases(ty core.IbexType) []*core.IbexVariantCase {
+    t, ok := ty.(core.IbexSimpleType)
+    if !ok {
+        return nil
+    }
+    variant, ok := info.Types[t.Name].(core.IbexVariantType)
+    if !ok {
+        return nil
+    }
+    m := Bind(info.TypeParams[t.Name], t.Args)
+    cases := make([]*core.IbexVariantCase, len(variant.Cases))
+    for i, c := range variant.Cases {
+        cases[i] = &core.IbexVariantCase{Tag: c.Tag}
+        if c.Payload != nil {
+            cases[i].Payload = Substitute(c.Payload, m)
+        }
+    }
+    return cases
+}
+
+// a problem that does not stop compilation
+type Warning struct {
+    Pos parser.Pos
+    Message string
+}
+
+func (w *Warning) String() string {
+    return fmt.Sprintf("%s: %s", w.Pos, w.Message)
+}
+
+type typeDecl struct {
+    name string // canonical, see names.go
+    mod *moduleScope
+    decl *parser.ASTTypeDeclaration
+    def core.IbexType // resolved alias
+    variant *core.IbexVariantType // resolved cases, nil for aliases
+    resolving bool
+}
+
+type constructor struct {
+    decl *typeDecl
+    c *core.IbexVariantCase
+}
+
+type funcDecl struct {
+    name string
+    mod *moduleScope
+    fn *parser.ASTFunction
+    params []core.IbexType
+    ty core.IbexFunctionType
+}
+
+func (f *funcDecl) generic() bool {
+    return len(f.fn.TypeParams) > 0
+}
+
+type Checker struct {
+    types map[string]*typeDecl // by canonical name
+    ctors map[string]*constructor
+    funcs map[string]*funcDecl
+    decls []*typeDecl
+    order []*funcDecl
+    nextVar int
+
+    scopes map[*loader.Module]*moduleScope
+    mod *moduleScope // module being checked
+    fn *funcDecl // function being checked
+    pos parser.Pos // of what is being checked, see at
+    uses []*use
+    calls map[parser.Pos]*Call
+    symbols map[parser.Pos]*Symbol
+    named map[string]bool // functions named outside their own body
+    exprTypes map[parser.Pos]core.IbexType
+    inferred map[string]core.IbexType
+    warnings []*Warning
+}
+
+func Check(unit *parser.ASTCompilationUnit) (*Info, error) {
+    return CheckModules([]*loader.Module{{Unit: unit}})
+}
+
+// checks a program, mods must list every module after the ones it uses
+// as loader.Loader.Modules does. A function body that does not check
+// leaves the others to be: with the first such error comes an Info of
+// what they tell, for tools like the language server, which must not be
+// compiled or run.
+func CheckModules(mods []*loader.Module) (*Info, error) {
+    c := &Checker{
+        types: make(map[string]*typeDecl),
+        ctors: make(map[string]*constructor),
+        funcs: make(map[string]*funcDecl),
+        scopes: make(map[*loader.Module]*moduleScope),
+        calls: make(map[parser.Pos]*Call),
+        symbols: make(map[parser.Pos]*Symbol),
+        named: make(map[string]bool),
+        exprTypes: make(map[parser.Pos]core.IbexType),
+        inferred: make(map[string]core.IbexType),
+        warnings: make([]*Warning, 0),
+    }
+    return c.check(mods)
+}
+
+// declarations every unit starts out with
+var prelude = &loader.Module{
+    Name: "prelude",
+    Unit: &parser.ASTCompilationUnit{
+        Declarations: []parser.ASTMemberDeclaration{
+            &parser.ASTTypeDeclaration{
+                Name: "Option",
+                Params: []string{"T"},
+                Type: core.IbexVariantType{[]*core.IbexVariantCase{
+                    {Tag: "None"},
+                    {Tag: "Some", Payload: core.IbexSimpleType{Name: "T"}},
+                }},
+            },
+        },
+    },
+}
+
+func (c *Checker) check(mods []*loader.Module) (*Info, error) {
+    preludeScope, err := c.declare(prelude, nil)
+    if err != nil {
+        return nil, err
+    }
+    for _, m := range mods {
+        if _, err := c.declare(m, preludeScope); err != nil {
+            return nil, err
+        }
+    }
+
+    info := &Info{
+        Types: make(map[string]core.IbexType),
+        TypeParams: make(map[string][]string),
+        Functions: make(map[string]core.IbexFunctionType),
+    }
+
+    for _, td := range c.decls {
+        if err := c.resolveDecl(td); err != nil {
+            return nil, err
+        }
+        if len(td.decl.Params) > 0 {
+            info.TypeParams[td.name] = td.decl.Params
+        }
+        if td.variant != nil {
+            info.Types[td.name] = *td.variant
+        } else {
+            info.Types[td.name] = td.def
+        }
+    }
+
+    for _, f := range c.order {
+        if err := c.resolveSignature(f); err != nil {
+            return nil, err
+        }
+        info.Functions[f.name] = f.ty
+    }
+
+    // the types of the expressions of a function that fails are left out
+    var failed error
+    exprTypes := c.exprTypes
+    for _, f := range c.order {
+        c.exprTypes = make(map[parser.Pos]core.IbexType)
+        if err := c.checkFunction(f); err != nil {
+            if failed == nil {
+                failed = err
+            }
+            continue
+        }
+        for pos, ty := range c.exprTypes {
+            exprTypes[pos] = ty
+        }
+    }
+    c.exprTypes = exprTypes
+
+    for _, m := range mods {
+        c.warnings = append(c.warnings, c.unusedImports(c.scopes[m])...)
+    }
+
+    // a failed body may not have named all it uses
+    if failed == nil {
+        c.warnings = append(c.warnings, c.unusedFunctions()...)
+        instances, err := c.instances()
+        if err != nil {
+            return nil, err
+        }
+        info.Instances = instances
+    }
+
+    info.ExprTypes = make(map[parser.Pos]core.IbexType)
+    for pos, ty := range c.exprTypes {
+        info.ExprTypes[pos] = settle(ty)
+    }
+    info.Inferred = make(map[string]core.IbexType)
+    for name, ty := range c.inferred {
+        info.Inferred[name] = settle(ty)
+    }
+    info.TypeArgs = make(map[parser.Pos][]core.IbexType)
+    for _, u := range c.uses {
+        args := make([]core.IbexType, len(u.args))
+        for i, arg := range u.args {
+            args[i] = settle(arg)
+        }
+        info.TypeArgs[u.pos] = args
+    }
+    info.Calls = c.calls
+    info.Symbols = c.symbols
+    info.Warnings = c.warnings
+
+    return info, failed
+}
+
+// an error at what is being checked
+func (c *Checker) errorf(format string, args ...interface{}) *TypeError {
+    return c.errorAt(parser.Pos{}, format, args...)
+}
+
+// an error at pos, or at what is being checked if pos is zero
+func (c *Checker) errorAt(pos parser.Pos, format string, args ...interface{}) *TypeError {
+    name := ""
+    if c.fn != nil {
+        name = c.fn.name
+    }
+    if pos.Line == 0 {
+        pos = c.pos
+    }
+    return &TypeError{pos, name, fmt.Sprintf(format, args...)}
+}
+
+// makes pos, unless it is zero, the position of the errors raised until
+// the returned function restores the one before:
+//     defer c.at(pos)()
+func (c *Checker) at(pos parser.Pos) func() {
+    outer := c.pos
+    if pos.Line > 0 {
+        c.pos = pos
+    }
+    return func() { c.pos = outer }
+}
+
+// the position of the last line of body, the value of the body
+func lastPos(body *parser.ASTBody) parser.Pos {
+    if len(body.Children) == 0 {
+        return parser.Pos{}
+    }
+    return parser.NodePos(body.Children[len(body.Children) - 1])
+}
+
+func (c *Checker) resolveSignature(f *funcDecl) error {
+    c.fn, c.mod = f, f.mod
+    defer func() { c.fn, c.mod = nil, nil }()
+    defer c.at(f.fn.Pos)()
+
+    params := paramSet(f.fn.TypeParams)
+    if len(params) != len(f.fn.TypeParams) {
+        return c.errorf("Duplicate type parameter")
+    }
+
+    seen := make(map[string]bool)
+    f.params = make([]core.IbexType, len(f.fn.Parameters))
+    for i, p := range f.fn.Parameters {
+        if seen[p.Name] {
+            return c.errorAt(p.Pos, "Parameter %s declared twice", p.Name)
+        }
+        seen[p.Name] = true
+
+        ty, err := c.resolveType(p.Type, params)
+        if err != nil {
+            return err
+        }
+        f.params[i] = ty
+    }
+
+    var ret core.IbexType = nil
+    if f.fn.Return != nil {
+        ty, err := c.resolveType(f.fn.Return, params)
+        if err != nil {
+            return err
+        }
+        ret = ty
+    }
+
+    f.ty = core.IbexFunctionType{Argument: argumentType(f.fn, f.params), Return: ret}
+    return nil
+}
+
+// The calling convention: a function without parameters takes (), one
+// with a single parameter takes its value as is and one with several
+// takes a named tuple with a tag per parameter. Call sites may pass that
+// named tuple with the tags in any order, or a positional tuple.
+func argumentType(fn *parser.ASTFunction, params []core.IbexType) core.IbexType {
+    if len(params) == 1 {
+        return params[0]
+    }
+    entries := make([]*core.IbexNamedTupleEntry, len(params))
+    for i, p := range fn.Parameters {
+        entries[i] = &core.IbexNamedTupleEntry{p.Name, params[i]}
+    }
+    if len(entries) == 0 {
+        return Unit
+    }
+    return core.IbexNamedTupleType{entries}
+}
+
+func (c *Checker) checkFunction(f *funcDecl) error {
+    if f.fn.Body == nil {
+        return nil
+    }
+
+    c.fn, c.mod = f, f.mod
+    defer func() { c.fn, c.mod = nil, nil }()
+    defer c.at(f.fn.Pos)()
+
+    if err := c.resolveFunction(f); err != nil {
+        return err
+    }
+
+    env := newScope(nil)
+    for i, p := range f.fn.Parameters {
+        env.vars[p.Name] = f.params[i]
+    }
+
+    ty, err := c.checkBody(f.fn.Body, env)
+    if err != nil {
+        return err
+    }
+    if f.ty.Return != nil {
+        defer c.at(lastPos(f.fn.Body))()
+        return c.expect(ty, f.ty.Return)
+    }
+    c.inferred[f.name] = ty
+    return nil
+}
@@ -0,0 +1,451 @@
+package check
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/core"
+	"github.com/ibex-lang/ibex/loader"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+func checkSource(src string) (*Info, error) {
+	parser.InitExpressionParsing()
+
+	body, err := parser.Blockify(src)
+	if err != nil {
+		return nil, err
+	}
+	unit, err := parser.Parse(parser.NewStructure(body))
+	if err != nil {
+		return nil, err
+	}
+	return Check(unit)
+}
+
+func TestCheckVariants(t *testing.T) {
+	info, err := checkSource(`type Shape = Circle (r: Int) | Rect (w: Int, h: Int) | Empty
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Rect (w: w, h: h) => w * h
+        Empty => 0
+fn unit -> Int
+    Rect (w: 2, h: 3) -> area`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fn Shape -> Int", core.TypeString(info.Functions["area"]))
+}
+
+func TestCheckNonExhaustive(t *testing.T) {
+	_, err := checkSource(`type Shape = Circle (r: Int) | Empty
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r`)
+
+	assert.EqualError(t, err, "3:5: In fn area: Match on Shape does not cover Empty")
+}
+
+func TestCheckBarePayload(t *testing.T) {
+	info, err := checkSource(`type Shape = Circle Int | Empty
+fn area s: Shape -> Int
+    match s
+        Circle r => r * r * 3
+        Empty => 0
+        Circle 2 => 1
+        Empty => 1
+        _ => 2
+fn main -> Int
+    Circle 2 -> area`)
+
+	assert.Nil(t, err)
+	assert.Len(t, info.Warnings, 3)
+	assert.Equal(t, "6:9: Unreachable match arm", info.Warnings[0].String())
+	assert.Equal(t, "7:9: Unreachable match arm", info.Warnings[1].String())
+	assert.Equal(t, "8:9: Unreachable match arm", info.Warnings[2].String())
+
+	info, err = checkSource(`pub fn f x: Int -> Int
+    match x
+        0 => 1
+        -1 => 2
+        0 => 3
+        _ => 4`)
+
+	assert.Nil(t, err)
+	assert.Len(t, info.Warnings, 1)
+	assert.Equal(t, "5:9: Unreachable match arm", info.Warnings[0].String())
+
+	_, err = checkSource(`type Shape = Circle Int | Circle (r: Int)`)
+	assert.EqualError(t, err, "1:6: Case Circle declared twice in Shape")
+}
+
+func TestCheckCaseAsType(t *testing.T) {
+	_, err := checkSource(`type Switch = On | Off
+type X = On`)
+
+	assert.EqualError(t, err, "2:6: On is a case of type Switch, not a type")
+}
+
+func TestCheckMismatch(t *testing.T) {
+	_, err := checkSource(`fn f x: Int -> String
+    x + 1`)
+
+	assert.EqualError(t, err, "2:7: In fn f: Type mismatch: expected String, found Int")
+}
+
+func TestCheckPartial(t *testing.T) {
+	info, err := checkSource(`fn f y: Int -> String
+    y
+fn g x: Int -> Int
+    x + 1`)
+
+	assert.EqualError(t, err, "2:5: In fn f: Type mismatch: expected String, found Int")
+	assert.NotNil(t, info)
+	assert.Equal(t, "Int", core.TypeString(info.ExprTypes[parser.Pos{Line: 4, Col: 5}]))
+	_, found := info.ExprTypes[parser.Pos{Line: 2, Col: 5}]
+	assert.False(t, found)
+}
+
+func TestCheckGenerics(t *testing.T) {
+	info, err := checkSource(`type List[T] = Nil | Cons (head: T, tail: List[T])
+type Box[T] = (value: T)
+fn head[T] (xs: List[T], default: T) -> T
+    match xs
+        Cons (head: x, tail: _) => x
+        Nil => default
+fn nested[T] (xs: List[T], d: T) -> List[T]
+    (Cons (head: xs, tail: Nil), Cons (head: d, tail: Nil)) -> head
+fn unbox[T] b: Box[T] -> T
+    match b
+        (value: v) => v
+fn main -> Int
+    (Cons (head: (value: 1) -> unbox, tail: Nil), 2) -> nested
+    (Cons (head: "a", tail: Nil), "b") -> head
+    0`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fn (xs: List[T], default: T) -> T", core.TypeString(info.Functions["head"]))
+
+	insts := []string{}
+	for _, inst := range info.Instances {
+		insts = append(insts, inst.String())
+	}
+	assert.Equal(t, []string{
+		"unbox[Int]", "nested[Int]", "head[String]", "head[List[Int]]"}, insts)
+}
+
+func TestCheckUninferable(t *testing.T) {
+	_, err := checkSource(`type List[T] = Nil | Cons (head: T, tail: List[T])
+fn empty[T] xs: List[T] -> Int
+    0
+fn main -> Int
+    Nil -> empty`)
+
+	assert.EqualError(t, err, "5:12: In fn main: Cannot infer type arguments of empty")
+}
+
+func TestCheckTypeArity(t *testing.T) {
+	_, err := checkSource(`type List[T] = Nil | Cons (head: T, tail: List[T])
+fn f xs: List -> Int
+    0`)
+
+	assert.EqualError(t, err, "2:4: In fn f: Type List expects 1 type arguments, got 0")
+}
+
+func TestCheckOption(t *testing.T) {
+	_, err := checkSource(`fn first xs: []?Int -> Int
+    xs[0]! + (xs[1] ? 0)
+fn wrap x: Int -> ?Int
+    match x
+        0 => None
+        n => Some (n)`)
+
+	assert.Nil(t, err)
+
+	_, err = checkSource(`fn f x: Int -> Int
+    x!`)
+
+	assert.EqualError(t, err, "2:6: In fn f: '!' expects an Option, found Int")
+
+	_, err = checkSource(`fn f x: Int -> Int
+    1 + (x ? 0)`)
+
+	assert.EqualError(t, err, "2:12: In fn f: '?' expects an Option, found Int")
+
+	_, err = checkSource(`fn f x: ?Int -> Int
+    x ? "zero"`)
+
+	assert.EqualError(t, err, "2:7: In fn f: Type mismatch: expected Int, found String")
+}
+
+func TestCheckInferred(t *testing.T) {
+	info, err := checkSource(`fn pair x: Int
+    (x, [x])
+fn none
+    None
+fn one -> Int
+    1`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "(Int, [1]Int)", core.TypeString(info.Inferred["pair"]))
+	assert.Equal(t, "Option[()]", core.TypeString(info.Inferred["none"]))
+	_, declared := info.Inferred["one"]
+	assert.False(t, declared)
+}
+
+func TestCheckArrays(t *testing.T) {
+	info, err := checkSource(`fn matrix -> [2][3]Int
+    [[1, 2, 3], [4, 5, 6]]
+fn corner m: [][]Int -> Int
+    m[0, 0] + m[1][2]
+fn row m: [2][3]Int -> []Int
+    m[1]
+fn main -> Int
+    () -> matrix -> corner`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fn [2][3]Int -> []Int", core.TypeString(info.Functions["row"]))
+
+	info, err = checkSource(`fn f -> [][]Int
+    [[1, 2], [3]]
+fn g n: Int -> []Int
+    match n
+        0 => [1]
+        _ => [1, 2]
+fn h n: Int -> [2][]Int
+    [[n], [n, n]]`)
+	assert.Nil(t, err)
+	assert.Equal(t, "[]Int", core.TypeString(info.Functions["g"].Return))
+
+	_, err = checkSource(`fn f -> [][]Int
+    [[1, 2], ["a"]]`)
+	assert.EqualError(t, err, "2:14: In fn f: Type mismatch: expected [2]Int, found [1]String")
+
+	_, err = checkSource(`fn f xs: [3]Int -> Int
+    xs[2]
+fn g xs: []Int -> Int
+    xs -> f`)
+	assert.EqualError(t, err, "4:8: In fn g: Type mismatch: expected [3]Int, found []Int")
+
+	_, err = checkSource(`fn f xs: [3]Int -> Int
+    xs[2]
+fn apply g: fn []Int -> Int -> Int
+    [1] -> g
+fn main -> Int
+    f -> apply`)
+	assert.EqualError(t, err, "6:7: In fn main: Type mismatch: expected fn []Int -> Int, found fn [3]Int -> Int")
+
+	_, err = checkSource(`fn f m: [2][3]Int -> Int
+    m[1, 3]`)
+	assert.EqualError(t, err, "2:6: In fn f: Index 3 is out of range for [3]Int")
+}
+
+func TestCheckCallingConvention(t *testing.T) {
+	info, err := checkSource(`fn sub (a: Int, b: Int) -> Int
+    a - b
+fn apply (f: fn (Int, Int) -> Int, x: Int) -> Int
+    (x, 1) -> f
+fn main -> Int
+    (5, 3) -> sub
+    (a: 5, b: 3) -> sub
+    (b: 3, a: 5) -> sub
+    (f: sub, x: 2) -> apply`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "fn (a: Int, b: Int) -> Int", core.TypeString(info.Functions["sub"]))
+	assert.Equal(t, &Call{Args: ArgsPositional}, info.Calls[parser.Pos{Line: 6, Col: 12}])
+	assert.Equal(t, &Call{Args: ArgsDirect}, info.Calls[parser.Pos{Line: 7, Col: 18}])
+	assert.Equal(t, &Call{Args: ArgsNamed, Order: []int{1, 0}},
+		info.Calls[parser.Pos{Line: 8, Col: 18}])
+
+	_, err = checkSource(`fn sub (a: Int, b: Int) -> Int
+    a - b
+fn main -> Int
+    (a: 5, c: 3) -> sub`)
+	assert.EqualError(t, err, "4:18: In fn main: Unknown argument c")
+
+	_, err = checkSource(`fn sub (a: Int, b: Int) -> Int
+    a - b
+fn main -> Int
+    (1, 2, 3) -> sub`)
+	assert.EqualError(t, err, "4:15: In fn main: Expected 2 arguments, found 3")
+}
+
+func TestCheckModules(t *testing.T) {
+	parse := func(src string) *parser.ASTCompilationUnit {
+		unit, err := parser.ParseFile("test.ibex", src)
+		assert.Nil(t, err)
+		return unit
+	}
+
+	shapes := &loader.Module{Name: "geo::shapes", Unit: parse(
+		`pub type Shape = Circle (r: Int) | Square (side: Int)
+pub fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a -> double
+fn double x: Int -> Int
+    x * 2`)}
+	main := &loader.Module{Unit: parse(`use geo::shapes
+fn main -> Int
+    match shapes::Circle (r: 2)
+        shapes::Circle (r: r) => r
+        _ => shapes::Square (side: 1) -> shapes::area
+fn unwrap s: shapes::Shape -> Int
+    s -> shapes::area`)}
+	main.Imports = []*loader.Import{{main.Unit.Uses[0], shapes}}
+
+	info, err := CheckModules([]*loader.Module{shapes, main})
+	assert.Nil(t, err)
+	assert.Equal(t, "fn geo::shapes::Shape -> Int",
+		core.TypeString(info.Functions["geo::shapes::area"]))
+	assert.Equal(t, "fn geo::shapes::Shape -> Int",
+		core.TypeString(info.Functions["unwrap"]))
+
+	main.Unit = parse(`use geo::shapes
+fn main -> Int
+    () -> shapes::perimeter`)
+	_, err = CheckModules([]*loader.Module{shapes, main})
+	assert.EqualError(t, err, "test.ibex:3:11: In fn main: Module shapes has no perimeter")
+
+	main.Unit = parse(`use geo::shapes
+fn main -> Int
+    2 -> shapes::double`)
+	_, err = CheckModules([]*loader.Module{shapes, main})
+	assert.EqualError(t, err,
+		"test.ibex:3:10: In fn main: Function geo::shapes::double is private, declared at test.ibex:6:4")
+}
+
+func TestCheckImports(t *testing.T) {
+	parse := func(src string) *parser.ASTCompilationUnit {
+		unit, err := parser.ParseFile("test.ibex", src)
+		assert.Nil(t, err)
+		return unit
+	}
+
+	shapes := &loader.Module{Name: "geo::shapes", Unit: parse(
+		`pub type Shape = Circle (r: Int) | Square (side: Int)
+pub fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a
+fn double x: Int -> Int
+    x * 2`)}
+	util := &loader.Module{Name: "util", Unit: parse(`pub fn area x: Int -> Int
+    x`)}
+
+	check := func(src string) (*Info, error) {
+		main := &loader.Module{Unit: parse(src)}
+		for _, use := range main.Unit.Uses {
+			imported := shapes
+			if use.Path[0] == "util" {
+				imported = util
+			}
+			main.Imports = append(main.Imports, &loader.Import{use, imported})
+		}
+		return CheckModules([]*loader.Module{shapes, util, main})
+	}
+
+	info, err := check(`use geo::shapes::{Shape, area as size}
+fn main s: Shape -> Int
+    Circle (r: 2) -> size`)
+	assert.Nil(t, err)
+	assert.Equal(t, "fn geo::shapes::Shape -> Int", core.TypeString(info.Functions["main"]))
+
+	_, err = check(`use geo::shapes::*
+fn main -> Int
+    Square (side: 2) -> area`)
+	assert.Nil(t, err)
+
+	info, err = check(`use geo::shapes::{Shape, area}
+use util
+fn main s: Shape -> Shape
+    s`)
+	assert.Nil(t, err)
+	assert.Len(t, info.Warnings, 3)
+	assert.Equal(t, "test.ibex:1:26: Unused import area", info.Warnings[0].String())
+	assert.Equal(t, "test.ibex:2:1: Unused import util", info.Warnings[1].String())
+	assert.Equal(t, "test.ibex:6:4: Unused function double", info.Warnings[2].String())
+
+	_, err = check(`use geo::shapes as s
+fn main -> Int
+    s::Square (side: 2) -> s::area`)
+	assert.Nil(t, err)
+
+	_, err = check(`use geo::shapes::{perimeter}`)
+	assert.EqualError(t, err, "test.ibex:1:19: Module geo::shapes has no perimeter")
+
+	_, err = check(`use geo::shapes::{double}`)
+	assert.EqualError(t, err,
+		"test.ibex:1:19: Function geo::shapes::double is private, declared at test.ibex:6:4")
+
+	_, err = check(`use geo::shapes::*
+use util::{area}`)
+	assert.EqualError(t, err,
+		"test.ibex:2:12: Imported fn area collides with the one imported at test.ibex:1:1")
+
+	_, err = check(`use geo::shapes::{area, area}`)
+	assert.EqualError(t, err,
+		"test.ibex:1:25: Imported name area collides with the one imported at test.ibex:1:19")
+
+	_, err = check(`use geo::shapes::{Shape as S, Shape as S}`)
+	assert.EqualError(t, err,
+		"test.ibex:1:31: Imported name S collides with the one imported at test.ibex:1:19")
+
+	_, err = check(`use geo::shapes::{Shape}
+type Shape = Int`)
+	assert.EqualError(t, err,
+		"test.ibex:1:19: Imported type Shape collides with a declaration of this module")
+
+	_, err = check(`use geo::shapes
+use util as shapes`)
+	assert.EqualError(t, err,
+		"test.ibex:2:1: Module shapes already imported at test.ibex:1:1")
+}
+
+func TestCheckResolve(t *testing.T) {
+	info, err := checkSource(`fn double x: Int -> Int
+    x * 2
+fn f (x: Int, unused: Int, _ignored: Int) -> Int
+    match Some (x)
+        Some (double) => double
+        None => x -> double`)
+	assert.Nil(t, err)
+
+	symbol := func(line, col int) Symbol {
+		return *info.Symbols[parser.Pos{Line: line, Col: col}]
+	}
+	assert.Equal(t, Symbol{SymbolParameter, "x", parser.Pos{Line: 1, Col: 11}, true},
+		symbol(2, 5))
+	assert.Equal(t, Symbol{SymbolLocal, "double", parser.Pos{Line: 5, Col: 15}, true},
+		symbol(5, 26))
+	assert.Equal(t, Symbol{SymbolFunction, "double", parser.Pos{Line: 1, Col: 4}, false},
+		symbol(6, 22))
+
+	assert.Len(t, info.Warnings, 2)
+	assert.Equal(t, "3:15: Unused parameter unused", info.Warnings[0].String())
+	assert.Equal(t, "3:4: Unused function f", info.Warnings[1].String())
+
+	info, err = checkSource(`fn main -> Int
+    1 -> used
+fn used x: Int -> Int
+    x
+fn helper x: Int -> Int
+    x
+fn loop x: Int -> Int
+    x -> loop
+fn _spare x: Int -> Int
+    x
+pub fn api x: Int -> Int
+    x`)
+	assert.Nil(t, err)
+	assert.Len(t, info.Warnings, 2)
+	assert.Equal(t, "5:4: Unused function helper", info.Warnings[0].String())
+	assert.Equal(t, "7:4: Unused function loop", info.Warnings[1].String())
+
+	_, err = checkSource(`fn f x: Int -> Int
+    match x
+        y => y
+        _ => y`)
+	assert.EqualError(t, err, "4:14: In fn f: Undefined name y")
+}
@@ -0,0 +1,311 @@
+package check
+
+import (
+    "strconv"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type scope struct {
+    vars map[string]core.IbexType
+    parent *scope
+}
+
+func newScope(parent *scope) *scope {
+    return &scope{make(map[string]core.IbexType), parent}
+}
+
+func (s *scope) lookup(name string) (core.IbexType, bool) {
+    for ; s != nil; s = s.parent {
+        if ty, ok := s.vars[name]; ok {
+            return ty, true
+        }
+    }
+    return nil, false
+}
+
+// the value of a body is the value of its last line
+func (c *Checker) checkBody(body *parser.ASTBody, env *scope) (core.IbexType, error) {
+    var ty core.IbexType = Unit
+    for _, node := range body.Children {
+        t, err := c.checkExpr(node, env)
+        if err != nil {
+            return nil, err
+        }
+        ty = t
+    }
+    return ty, nil
+}
+
+func (c *Checker) checkExpr(expr parser.Expression,
+    env *scope) (core.IbexType, error) {
+
+    defer c.at(parser.NodePos(expr))()
+    switch e := expr.(type) {
+    case parser.IdentExpr:
+        sym := c.symbols[e.Pos] // see resolve.go
+        if sym.Kind == SymbolFunction {
+            return c.record(e.Pos, c.instantiate(c.funcs[sym.Name], e.Pos)), nil
+        }
+        ty, _ := env.lookup(e.Ident)
+        return c.record(e.Pos, ty), nil
+
+    case parser.StringExpr:
+        return String, nil
+
+    case parser.NumberExpr:
+        return Int, nil
+
+    case parser.NotExpr:
+        ty, err := c.checkExpr(e.Expr, env)
+        if err != nil {
+            return nil, err
+        }
+        return Bool, c.expect(ty, Bool)
+
+    case parser.NegateExpr:
+        ty, err := c.checkExpr(e.Expr, env)
+        if err != nil {
+            return nil, err
+        }
+        return ty, c.expectNumeric(ty)
+
+    case parser.AddExpr:
+        return c.checkArithmetic(e.Left, e.Right, env)
+    case parser.SubExpr:
+        return c.checkArithmetic(e.Left, e.Right, env)
+    case parser.MulExpr:
+        return c.checkArithmetic(e.Left, e.Right, env)
+    case parser.DivExpr:
+        return c.checkArithmetic(e.Left, e.Right, env)
+    case parser.ModExpr:
+        return c.checkArithmetic(e.Left, e.Right, env)
+
+    case parser.FunctionCallExpr:
+        return c.checkCall(e, env)
+
+    case parser.ArrayAccessExpr:
+        return c.checkArrayAccess(e, env)
+
+    case parser.ArrayExpr:
+        ty, err := c.checkArrayLiteral(e, env)
+        return c.record(e.Pos, ty), err
+
+    case parser.TupleExpr:
+        elems := make([]core.IbexType, len(e.Elements))
+        for i, elem := range e.Elements {
+            ty, err := c.checkExpr(elem, env)
+            if err != nil {
+                return nil, err
+            }
+            elems[i] = ty
+        }
+        return core.IbexTupleType{elems}, nil
+
+    case parser.NamedTupleExpr:
+        seen := make(map[string]bool)
+        entries := make([]*core.IbexNamedTupleEntry, len(e.Elements))
+        for i, elem := range e.Elements {
+            if seen[elem.Tag] {
+                return nil, c.errorf("Duplicate tag %s in named tuple", elem.Tag)
+            }
+            seen[elem.Tag] = true
+            ty, err := c.checkExpr(elem.Expr, env)
+            if err != nil {
+                return nil, err
+            }
+            entries[i] = &core.IbexNamedTupleEntry{elem.Tag, ty}
+        }
+        return core.IbexNamedTupleType{entries}, nil
+
+    case parser.ConstructorExpr:
+        ty, err := c.checkConstructor(e, env)
+        return c.record(e.Pos, ty), err
+
+    case parser.MatchExpr:
+        return c.checkMatch(e, env)
+
+    case parser.UnsafeAccessExpr:
+        ty, err := c.checkExpr(e.Expr, env)
+        if err != nil {
+            return nil, err
+        }
+        elem := c.fresh()
+        if !unify(option(elem), ty) {
+            return nil, c.errorf("'!' expects an Option, found %s",
+                core.TypeString(zonk(ty)))
+        }
+        return elem, nil
+
+    case parser.DefaultExpr:
+        ty, err := c.checkExpr(e.Expr, env)
+        if err != nil {
+            return nil, err
+        }
+        elem := c.fresh()
+        if !unify(option(elem), ty) {
+            return nil, c.errorf("'?' expects an Option, found %s",
+                core.TypeString(zonk(ty)))
+        }
+        def, err := c.checkExpr(e.Default, env)
+        if err != nil {
+            return nil, err
+        }
+        return elem, c.expect(def, elem)
+    }
+
+    return nil, c.errorf("Unsupported expression %T", expr)
+}
+
+// the types in Info.ExprTypes are only known once the whole program is
+// checked, see settle
+func (c *Checker) record(pos parser.Pos, ty core.IbexType) core.IbexType {
+    if ty != nil {
+        c.exprTypes[pos] = ty
+    }
+    return ty
+}
+
+func (c *Checker) expectNumeric(ty core.IbexType) error {
+    switch t := prune(ty).(type) {
+    case *typeVar:
+        return nil
+    case core.IbexSimpleType:
+        if t.Name == "Int" || t.Name == "F64" {
+            return nil
+        }
+    }
+    return c.errorf("Expected a number, found %s", core.TypeString(zonk(ty)))
+}
+
+// both operands share one numeric type
+func (c *Checker) checkArithmetic(left, right parser.Expression,
+    env *scope) (core.IbexType, error) {
+
+    l, err := c.checkExpr(left, env)
+    if err != nil {
+        return nil, err
+    }
+    r, err := c.checkExpr(right, env)
+    if err != nil {
+        return nil, err
+    }
+    if err = c.expect(r, l); err != nil {
+        return nil, err
+    }
+    return l, c.expectNumeric(l)
+}
+
+// input -> target
+func (c *Checker) checkCall(e parser.FunctionCallExpr,
+    env *scope) (core.IbexType, error) {
+
+    input, err := c.checkExpr(e.Input, env)
+    if err != nil {
+        return nil, err
+    }
+    target, err := c.checkExpr(e.Target, env)
+    if err != nil {
+        return nil, err
+    }
+
+    switch fn := prune(target).(type) {
+    case core.IbexFunctionType:
+        call, err := c.checkArgument(input, fn.Argument)
+        if err != nil {
+            return nil, err
+        }
+        c.calls[e.Pos] = call
+        return returnType(fn), nil
+    case *typeVar:
+        ret := c.fresh()
+        c.calls[e.Pos] = &Call{Args: ArgsDirect}
+        return ret, c.expect(target, core.IbexFunctionType{input, ret})
+    }
+    return nil, c.errorf("Cannot call value of type %s",
+        core.TypeString(zonk(target)))
+}
+
+func (c *Checker) checkArrayAccess(e parser.ArrayAccessExpr,
+    env *scope) (core.IbexType, error) {
+
+    target, err := c.checkExpr(e.Target, env)
+    if err != nil {
+        return nil, err
+    }
+    index, err := c.checkExpr(e.Index, env)
+    if err != nil {
+        return nil, err
+    }
+    if err = c.expect(index, Int); err != nil {
+        return nil, err
+    }
+
+    arr, ok := prune(target).(core.IbexArrayType)
+    if !ok {
+        return nil, c.errorf("Cannot index value of type %s",
+            core.TypeString(zonk(target)))
+    }
+    arr = core.NewArrayType(prune(arr.ElementType), sizesOf(arr))
+
+    if num, ok := e.Index.(parser.NumberExpr); ok && arr.Size(0) > 0 {
+        if i, err := strconv.Atoi(num.Number); err == nil && i >= arr.Size(0) {
+            return nil, c.errorf("Index %d is out of range for %s",
+                i, core.TypeString(zonk(arr)))
+        }
+    }
+
+    return arr.Elem(), nil
+}
+
+// the length of a literal is part of its type, [1, 2] is a [2]Int, and
+// that of its elements if they all have the same, [[1], [2, 3]] is a
+// [2][]Int
+func (c *Checker) checkArrayLiteral(e parser.ArrayExpr,
+    env *scope) (core.IbexType, error) {
+
+    var elem core.IbexType = c.fresh()
+    for _, expr := range e.Elements {
+        ty, err := c.checkExpr(expr, env)
+        if err != nil {
+            return nil, err
+        }
+        restore := c.at(parser.NodePos(expr))
+        elem, err = c.join(elem, ty)
+        restore()
+        if err != nil {
+            return nil, err
+        }
+    }
+    return core.NewArrayType(prune(elem), []int{len(e.Elements)}), nil
+}
+
+func (c *Checker) checkConstructor(e parser.ConstructorExpr,
+    env *scope) (core.IbexType, error) {
+
+    ctor, err := c.lookupConstructor(e.Tag)
+    if err != nil {
+        return nil, err
+    }
+    args, m := c.freshArgs(ctor.decl.decl.Params)
+
+    if ctor.c.Payload == nil && e.Payload != nil {
+        return nil, c.errorf("Constructor %s takes no payload", e.Tag)
+    } else if ctor.c.Payload != nil {
+        expected := Substitute(ctor.c.Payload, m)
+        if e.Payload == nil {
+            return nil, c.errorf("Constructor %s expects a payload of type %s",
+                e.Tag, core.TypeString(zonk(expected)))
+        }
+        ty, err := c.checkExpr(e.Payload, env)
+        if err != nil {
+            return nil, err
+        }
+        if err = c.expect(ty, expected); err != nil {
+            return nil, err
+        }
+    }
+
+    return core.IbexSimpleType{Name: ctor.decl.name, Args: args}, nil
+}
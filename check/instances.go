@@ -0,0 +1,122 @@
+package check
+
+import (
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// Generic functions are compiled by monomorphization: a backend emits one
+// copy of a generic function for every distinct list of type arguments it
+// is instantiated with, as listed in Info.Instances. The list is closed
+// under the calls generic functions make to each other, so backends never
+// have to substitute type parameters themselves beyond the body of the
+// instance they are emitting.
+
+const maxInstances = 1000
+
+type Instance struct {
+    Function string
+    TypeArgs []core.IbexType
+}
+
+func (i *Instance) String() string {
+    return core.TypeString(core.IbexSimpleType{Name: i.Function, Args: i.TypeArgs})
+}
+
+// one instantiation of a generic function, found while checking caller
+type use struct {
+    caller *funcDecl
+    callee *funcDecl
+    args []core.IbexType
+    pos parser.Pos
+}
+
+func (c *Checker) instances() ([]*Instance, error) {
+    seen := make(map[string]bool)
+    result := make([]*Instance, 0)
+    work := make([]*Instance, 0)
+
+    add := func(u *use, m map[string]core.IbexType) error {
+        args := make([]core.IbexType, len(u.args))
+        for i, arg := range u.args {
+            args[i] = Substitute(zonk(arg), m)
+            if hasVars(args[i]) {
+                c.fn = u.caller
+                defer func() { c.fn = nil }()
+                return c.errorAt(u.pos, "Cannot infer type arguments of %s", u.callee.name)
+            }
+        }
+
+        inst := &Instance{u.callee.name, args}
+        if seen[inst.String()] {
+            return nil
+        }
+        if len(result) == maxInstances {
+            return c.errorAt(u.pos, "Too many instantiations of %s", inst.Function)
+        }
+        seen[inst.String()] = true
+        result = append(result, inst)
+        work = append(work, inst)
+        return nil
+    }
+
+    for _, u := range c.uses {
+        if u.caller.generic() {
+            continue
+        }
+        if err := add(u, nil); err != nil {
+            return nil, err
+        }
+    }
+
+    for len(work) > 0 {
+        inst := work[0]
+        work = work[1:]
+
+        caller := c.funcs[inst.Function]
+        m := Bind(caller.fn.TypeParams, inst.TypeArgs)
+        for _, u := range c.uses {
+            if u.caller != caller {
+                continue
+            }
+            if err := add(u, m); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    return result, nil
+}
+
+// Type variables left unbound in a checked program, like the one of a
+// None that is never compared with anything else, default to ().
+func settle(ty core.IbexType) core.IbexType {
+    bindUnit(ty)
+    return zonk(ty)
+}
+
+func bindUnit(ty core.IbexType) {
+    switch t := prune(ty).(type) {
+    case *typeVar:
+        t.ref = Unit
+    case core.IbexSimpleType:
+        for _, arg := range t.Args {
+            bindUnit(arg)
+        }
+    case core.IbexTupleType:
+        for _, elem := range t.ElementTypes {
+            bindUnit(elem)
+        }
+    case core.IbexNamedTupleType:
+        for _, entry := range t.Types {
+            bindUnit(entry.Type)
+        }
+    case core.IbexArrayType:
+        bindUnit(t.ElementType)
+    case core.IbexFunctionType:
+        bindUnit(t.Argument)
+        if t.Return != nil {
+            bindUnit(t.Return)
+        }
+    }
+}
@@ -0,0 +1,258 @@
+package check
+
+import (
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// all arms share one type, which is the type of the match, with the
+// array sizes they differ in dynamic
+func (c *Checker) checkMatch(e parser.MatchExpr,
+    env *scope) (core.IbexType, error) {
+
+    subject, err := c.checkExpr(e.Subject, env)
+    if err != nil {
+        return nil, err
+    }
+
+    var result core.IbexType = c.fresh()
+    for _, arm := range e.Arms {
+        armEnv := newScope(env)
+        if err = c.checkPattern(arm.Pattern, subject, armEnv); err != nil {
+            return nil, err
+        }
+        ty, err := c.checkBody(arm.Body, armEnv)
+        if err != nil {
+            return nil, err
+        }
+        restore := c.at(lastPos(arm.Body))
+        result, err = c.join(result, ty)
+        restore()
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    c.unreachableArms(subject, e.Arms)
+    return result, c.checkExhaustive(subject, e.Arms)
+}
+
+func (c *Checker) checkPattern(p parser.Pattern, ty core.IbexType,
+    env *scope) error {
+
+    defer c.at(parser.NodePos(p))()
+    switch p := p.(type) {
+    case parser.WildcardPattern:
+        return nil
+
+    case parser.BindingPattern:
+        if _, exists := env.vars[p.Name]; exists {
+            return c.errorf("Name %s bound twice in pattern", p.Name)
+        }
+        env.vars[p.Name] = ty
+        return nil
+
+    case parser.LiteralPattern:
+        lit, err := c.checkExpr(p.Literal, env)
+        if err != nil {
+            return err
+        }
+        return c.expect(lit, ty)
+
+    case parser.ConstructorPattern:
+        ctor, err := c.lookupConstructor(p.Tag)
+        if err != nil {
+            return err
+        }
+        args, m := c.freshArgs(ctor.decl.decl.Params)
+        named := core.IbexSimpleType{Name: ctor.decl.name, Args: args}
+        if err := c.expect(named, ty); err != nil {
+            return err
+        }
+
+        if ctor.c.Payload == nil {
+            if p.Payload != nil {
+                return c.errorf("Constructor %s takes no payload", p.Tag)
+            }
+            return nil
+        }
+        if p.Payload == nil {
+            return c.errorf("Constructor %s expects a payload", p.Tag)
+        }
+        return c.checkPattern(p.Payload, Substitute(ctor.c.Payload, m), env)
+
+    case parser.TuplePattern:
+        return c.checkTuplePattern(p, ty, env)
+
+    case parser.NamedTuplePattern:
+        tuple, ok := prune(ty).(core.IbexNamedTupleType)
+        if !ok {
+            return c.errorf("Named tuple pattern cannot match %s",
+                core.TypeString(zonk(ty)))
+        }
+        for _, entry := range p.Elements {
+            field := lookupField(tuple, entry.Tag)
+            if field == nil {
+                return c.errorf("%s has no field %s",
+                    core.TypeString(zonk(ty)), entry.Tag)
+            }
+            if err := c.checkPattern(entry.Pattern, field.Type, env); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    return c.errorf("Unsupported pattern %T", p)
+}
+
+// tuple patterns also match named tuples by position
+func (c *Checker) checkTuplePattern(p parser.TuplePattern, ty core.IbexType,
+    env *scope) error {
+
+    var elems []core.IbexType
+    switch t := prune(ty).(type) {
+    case *typeVar:
+        for range p.Elements {
+            elems = append(elems, c.fresh())
+        }
+        unify(t, core.IbexTupleType{elems})
+    case core.IbexTupleType:
+        elems = t.ElementTypes
+    case core.IbexNamedTupleType:
+        for _, entry := range t.Types {
+            elems = append(elems, entry.Type)
+        }
+    default:
+        return c.errorf("Tuple pattern cannot match %s", core.TypeString(zonk(ty)))
+    }
+
+    if len(elems) != len(p.Elements) {
+        return c.errorf("Tuple pattern has %d elements, %s has %d",
+            len(p.Elements), core.TypeString(zonk(ty)), len(elems))
+    }
+    for i, elem := range p.Elements {
+        if err := c.checkPattern(elem, elems[i], env); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func lookupField(tuple core.IbexNamedTupleType, name string) *core.IbexNamedTupleEntry {
+    for _, entry := range tuple.Types {
+        if entry.Name == name {
+            return entry
+        }
+    }
+    return nil
+}
+
+// matches on variants must cover every case, either with an irrefutable
+// arm or one arm per tag whose payload pattern is irrefutable
+func (c *Checker) checkExhaustive(subject core.IbexType, arms []*parser.MatchArm) error {
+    named, ok := prune(subject).(core.IbexSimpleType)
+    if !ok {
+        return nil
+    }
+    td, ok := c.types[named.Name]
+    if !ok || td.variant == nil {
+        return nil
+    }
+
+    covered := make(map[*core.IbexVariantCase]bool)
+    for _, arm := range arms {
+        switch p := arm.Pattern.(type) {
+        case parser.WildcardPattern, parser.BindingPattern:
+            return nil
+        case parser.ConstructorPattern:
+            ctor, err := c.lookupConstructor(p.Tag)
+            if err == nil && irrefutable(p.Payload) {
+                covered[ctor.c] = true
+            }
+        }
+    }
+
+    for _, vc := range td.variant.Cases {
+        if !covered[vc] {
+            return c.errorf("Match on %s does not cover %s",
+                core.TypeString(zonk(subject)), vc.Tag)
+        }
+    }
+    return nil
+}
+
+// warns of the arms no value reaches as the arms above match them all:
+// those after a catch-all, a repeated literal or case, or any after all
+// cases of a variant
+func (c *Checker) unreachableArms(subject core.IbexType, arms []*parser.MatchArm) {
+    var cases []*core.IbexVariantCase
+    if named, ok := prune(subject).(core.IbexSimpleType); ok {
+        if td, ok := c.types[named.Name]; ok && td.variant != nil {
+            cases = td.variant.Cases
+        }
+    }
+    covered := make(map[*core.IbexVariantCase]bool)
+    literals := make(map[string]bool)
+    all := false
+    for _, arm := range arms {
+        reached := !all
+        switch p := arm.Pattern.(type) {
+        case parser.LiteralPattern:
+            key := literalKey(p.Literal)
+            reached = reached && !literals[key]
+            literals[key] = true
+        case parser.ConstructorPattern:
+            if ctor, err := c.lookupConstructor(p.Tag); err == nil {
+                reached = reached && !covered[ctor.c]
+                if irrefutable(p.Payload) {
+                    covered[ctor.c] = true
+                }
+            }
+        }
+        if !reached {
+            c.warnings = append(c.warnings,
+                &Warning{parser.NodePos(arm.Pattern), "Unreachable match arm"})
+        }
+
+        all = all || irrefutable(arm.Pattern)
+        if len(cases) > 0 && len(covered) == len(cases) {
+            all = true
+        }
+    }
+}
+
+// the same for literals of the same value
+func literalKey(e parser.Expression) string {
+    switch e := e.(type) {
+    case parser.NumberExpr:
+        return e.Number
+    case parser.NegateExpr:
+        return "-" + literalKey(e.Expr)
+    case parser.StringExpr:
+        return "string " + e.String
+    }
+    return ""
+}
+
+func irrefutable(p parser.Pattern) bool {
+    switch p := p.(type) {
+    case nil, parser.WildcardPattern, parser.BindingPattern:
+        return true
+    case parser.TuplePattern:
+        for _, elem := range p.Elements {
+            if !irrefutable(elem) {
+                return false
+            }
+        }
+        return true
+    case parser.NamedTuplePattern:
+        for _, entry := range p.Elements {
+            if !irrefutable(entry.Pattern) {
+                return false
+            }
+        }
+        return true
+    }
+    return false
+}
@@ -0,0 +1,344 @@
+package check
+
+import (
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// Declarations are known program wide by their canonical name, the name
+// of their module and their own joined by ::, a::b::Shape. Declarations
+// of the root module keep their plain name.
+func Canonical(mod *loader.Module, name string) string {
+    if mod.Name == "" || mod == prelude {
+        return name
+    }
+    return mod.Name + "::" + name
+}
+
+// one table per namespace, mapping names to canonical names
+type names struct {
+    types map[string]string
+    ctors map[string]string
+    funcs map[string]string
+}
+
+func newNames() names {
+    return names{
+        make(map[string]string),
+        make(map[string]string),
+        make(map[string]string),
+    }
+}
+
+// kind is one of type, constructor or fn
+func (n names) table(kind string) map[string]string {
+    switch kind {
+    case "type":
+        return n.types
+    case "constructor":
+        return n.ctors
+    }
+    return n.funcs
+}
+
+// the names visible inside one module
+type moduleScope struct {
+    module *loader.Module
+    own names // declared here, reachable from other modules as qualifier::name
+    imported names // brought in unqualified by use
+    origins map[string]parser.Pos // where an imported name came from, by kind and name
+    used map[parser.Pos]bool // use statements and items looked up through
+
+    imports map[string]*moduleScope // by qualifier
+    importedAt map[string]parser.Pos
+    prelude *moduleScope
+}
+
+func (c *Checker) declare(m *loader.Module, prelude *moduleScope) (*moduleScope, error) {
+    scope := &moduleScope{
+        module: m,
+        own: newNames(),
+        imported: newNames(),
+        origins: make(map[string]parser.Pos),
+        used: make(map[parser.Pos]bool),
+        imports: make(map[string]*moduleScope),
+        importedAt: make(map[string]parser.Pos),
+        prelude: prelude,
+    }
+    c.scopes[m] = scope
+
+    for _, d := range m.Unit.Declarations {
+        switch d.(type) {
+        case *parser.ASTTypeDeclaration:
+            decl := d.(*parser.ASTTypeDeclaration)
+            name := Canonical(m, decl.Name)
+            if _, exists := c.types[name]; exists || isBuiltin(decl.Name) {
+                return nil, c.errorAt(decl.Pos, "Type %s declared twice", name)
+            }
+            td := &typeDecl{name: name, mod: scope, decl: decl}
+            c.types[name] = td
+            c.decls = append(c.decls, td)
+            scope.own.types[decl.Name] = name
+
+            if variant, ok := decl.Type.(core.IbexVariantType); ok {
+                for _, vc := range variant.Cases {
+                    tag := Canonical(m, vc.Tag)
+                    if other, exists := c.ctors[tag]; exists && other.decl == td {
+                        return nil, c.errorAt(decl.Pos, "Case %s declared twice in %s", vc.Tag, name)
+                    } else if exists {
+                        return nil, c.errorAt(decl.Pos, "Constructor %s declared in both %s and %s",
+                            tag, other.decl.name, name)
+                    }
+                    c.ctors[tag] = &constructor{decl: td}
+                    scope.own.ctors[vc.Tag] = tag
+                }
+            }
+
+        case *parser.ASTFunction:
+            fn := d.(*parser.ASTFunction)
+            name := Canonical(m, fn.Name)
+            if _, exists := c.funcs[name]; exists {
+                return nil, c.errorAt(fn.Pos, "Function %s declared twice", name)
+            }
+            f := &funcDecl{name: name, mod: scope, fn: fn}
+            c.funcs[name] = f
+            c.order = append(c.order, f)
+            scope.own.funcs[fn.Name] = name
+        }
+    }
+
+    for _, imp := range m.Imports {
+        if err := c.declareImport(scope, imp); err != nil {
+            return nil, err
+        }
+    }
+
+    return scope, nil
+}
+
+func (c *Checker) declareImport(scope *moduleScope, imp *loader.Import) error {
+    use := imp.Use
+    from := c.scopes[imp.Module]
+
+    if use.Glob {
+        for _, d := range from.module.Unit.Declarations {
+            var err error
+            switch d.(type) {
+            case *parser.ASTTypeDeclaration:
+                if decl := d.(*parser.ASTTypeDeclaration); decl.Public {
+                    err = c.importType(scope, from, decl.Name, decl.Name, use.Pos)
+                }
+            case *parser.ASTFunction:
+                if fn := d.(*parser.ASTFunction); fn.Public {
+                    err = c.importName(scope, "fn", fn.Name, from.own.funcs[fn.Name], use.Pos)
+                }
+            }
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    if use.Items != nil {
+        // importName lets the same declaration be imported twice, but
+        // not within one list
+        selected := make(map[parser.UseItem]parser.Pos)
+        for _, item := range use.Items {
+            key := parser.UseItem{Name: item.Name, Alias: item.Alias}
+            if pos, exists := selected[key]; exists {
+                return c.errorAt(item.Pos, "Imported name %s collides with the one imported at %s",
+                    item.Alias, pos)
+            }
+            selected[key] = item.Pos
+            if err := c.importItem(scope, from, item); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    if pos, exists := scope.importedAt[use.Alias]; exists {
+        return c.errorAt(use.Pos, "Module %s already imported at %s", use.Alias, pos)
+    }
+    scope.imports[use.Alias] = from
+    scope.importedAt[use.Alias] = use.Pos
+    return nil
+}
+
+// a selected item names a type, a function or both
+func (c *Checker) importItem(scope *moduleScope, from *moduleScope,
+    item *parser.UseItem) error {
+
+    full, isType := from.own.types[item.Name]
+    if isType {
+        if td := c.types[full]; !td.decl.Public {
+            return c.privateError(item.Pos, "Type", full, td.decl.Pos)
+        }
+        if err := c.importType(scope, from, item.Name, item.Alias, item.Pos); err != nil {
+            return err
+        }
+    }
+
+    full, isFunc := from.own.funcs[item.Name]
+    if isFunc {
+        if f := c.funcs[full]; !f.fn.Public {
+            return c.privateError(item.Pos, "Function", full, f.fn.Pos)
+        }
+        if err := c.importName(scope, "fn", item.Alias, full, item.Pos); err != nil {
+            return err
+        }
+    }
+
+    if !isType && !isFunc {
+        return c.errorAt(item.Pos, "Module %s has no %s", from.module, item.Name)
+    }
+    return nil
+}
+
+// a type comes with its constructors
+func (c *Checker) importType(scope *moduleScope, from *moduleScope,
+    name string, alias string, pos parser.Pos) error {
+
+    full := from.own.types[name]
+    if err := c.importName(scope, "type", alias, full, pos); err != nil {
+        return err
+    }
+    if variant, ok := c.types[full].decl.Type.(core.IbexVariantType); ok {
+        for _, vc := range variant.Cases {
+            err := c.importName(scope, "constructor", vc.Tag, from.own.ctors[vc.Tag], pos)
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (c *Checker) importName(scope *moduleScope, kind string,
+    name string, full string, pos parser.Pos) error {
+
+    own, imported := scope.own.table(kind), scope.imported.table(kind)
+
+    if _, exists := own[name]; exists {
+        return c.errorAt(pos, "Imported %s %s collides with a declaration of this module",
+            kind, name)
+    }
+    key := kind + " " + name
+    if prev, exists := imported[name]; exists && prev != full {
+        return c.errorAt(pos, "Imported %s %s collides with the one imported at %s",
+            kind, name, scope.origins[key])
+    }
+    imported[name] = full
+    scope.origins[key] = pos
+    return nil
+}
+
+// finds name, possibly qualified as module::name, in the kind table of
+// the current module
+func (c *Checker) lookup(kind string, name string) (string, error) {
+    if i := strings.LastIndex(name, "::"); i >= 0 {
+        imported, ok := c.mod.imports[name[:i]]
+        if !ok {
+            return "", c.errorf("Unknown module %s", name[:i])
+        }
+        c.mod.used[c.mod.importedAt[name[:i]]] = true
+        if full, ok := imported.own.table(kind)[name[i + 2:]]; ok {
+            return full, nil
+        }
+        return "", c.errorf("Module %s has no %s", name[:i], name[i + 2:])
+    }
+
+    for s := c.mod; s != nil; s = s.prelude {
+        if full, ok := s.own.table(kind)[name]; ok {
+            return full, nil
+        }
+        if full, ok := s.imported.table(kind)[name]; ok {
+            s.used[s.origins[kind + " " + name]] = true
+            return full, nil
+        }
+    }
+    return "", nil
+}
+
+// a module import counts as used when anything is looked up through it,
+// a selected item when it is looked up itself
+func (c *Checker) unusedImports(scope *moduleScope) []*Warning {
+    warnings := make([]*Warning, 0)
+    for _, use := range scope.module.Unit.Uses {
+        if use.Items == nil {
+            if !scope.used[use.Pos] {
+                warnings = append(warnings, &Warning{use.Pos,
+                    "Unused import " + strings.Join(use.Path, "::")})
+            }
+            continue
+        }
+        for _, item := range use.Items {
+            if !scope.used[item.Pos] {
+                warnings = append(warnings, &Warning{item.Pos, "Unused import " + item.Name})
+            }
+        }
+    }
+    return warnings
+}
+
+// declarations are private to their module unless marked pub
+func (c *Checker) visible(mod *moduleScope, public bool) bool {
+    return public || mod == c.mod || mod.module == prelude
+}
+
+// an error at pos, or at what is being checked if pos is zero
+func (c *Checker) privateError(pos parser.Pos, kind string, name string, decl parser.Pos) *TypeError {
+    return c.errorAt(pos, "%s %s is private, declared at %s", kind, name, decl)
+}
+
+func (c *Checker) lookupType(name string) (*typeDecl, error) {
+    full, err := c.lookup("type", name)
+    if err != nil {
+        return nil, err
+    }
+    td, ok := c.types[full]
+    if !ok {
+        // as in type X = On, which declares no variant of one case
+        if ctor, err := c.lookup("constructor", name); err == nil && c.ctors[ctor] != nil {
+            return nil, c.errorf("%s is a case of type %s, not a type", name, c.ctors[ctor].decl.decl.Name)
+        }
+        return nil, c.errorf("Unknown type %s", name)
+    }
+    if !c.visible(td.mod, td.decl.Public) {
+        return nil, c.privateError(parser.Pos{}, "Type", full, td.decl.Pos)
+    }
+    return td, nil
+}
+
+// constructors are as visible as their type
+func (c *Checker) lookupConstructor(tag string) (*constructor, error) {
+    full, err := c.lookup("constructor", tag)
+    if err != nil {
+        return nil, err
+    }
+    ctor, ok := c.ctors[full]
+    if !ok {
+        return nil, c.errorf("Unknown constructor %s", tag)
+    }
+    if !c.visible(ctor.decl.mod, ctor.decl.decl.Public) {
+        return nil, c.privateError(parser.Pos{}, "Constructor", full, ctor.decl.decl.Pos)
+    }
+    return ctor, nil
+}
+
+// nil without error when there is no such function
+func (c *Checker) lookupFunction(name string) (*funcDecl, error) {
+    full, err := c.lookup("fn", name)
+    if err != nil {
+        return nil, err
+    }
+    f, ok := c.funcs[full]
+    if ok && !c.visible(f.mod, f.fn.Public) {
+        return nil, c.privateError(parser.Pos{}, "Function", full, f.fn.Pos)
+    }
+    return f, nil
+}
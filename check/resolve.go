@@ -0,0 +1,217 @@
+package check
+
+import (
+    "strings"
+
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type SymbolKind int
+
+const (
+    SymbolParameter SymbolKind = iota
+    SymbolLocal // bound by a pattern
+    SymbolFunction
+)
+
+// what an identifier refers to
+type Symbol struct {
+    Kind SymbolKind
+    Name string // canonical for functions
+    Pos parser.Pos // of the declaration
+    used bool
+}
+
+// Names are resolved in nested blocks, one for the parameters of a
+// function and one per match arm, before falling back to the functions
+// of the module and its imports.
+type block struct {
+    names map[string]*Symbol
+    declared []*Symbol // in order, for reporting unused ones
+    parent *block
+}
+
+func newBlock(parent *block) *block {
+    return &block{make(map[string]*Symbol), make([]*Symbol, 0), parent}
+}
+
+func (b *block) declare(sym *Symbol) {
+    b.names[sym.Name] = sym
+    b.declared = append(b.declared, sym)
+}
+
+func (b *block) lookup(name string) *Symbol {
+    for ; b != nil; b = b.parent {
+        if sym, ok := b.names[name]; ok {
+            return sym
+        }
+    }
+    return nil
+}
+
+// names starting with _ are allowed to go unused
+func (c *Checker) reportUnused(b *block) {
+    for _, sym := range b.declared {
+        if !sym.used && !strings.HasPrefix(sym.Name, "_") {
+            kind := "parameter"
+            if sym.Kind == SymbolLocal {
+                kind = "variable"
+            }
+            c.warnings = append(c.warnings,
+                &Warning{sym.Pos, "Unused " + kind + " " + sym.Name})
+        }
+    }
+}
+
+// links every identifier in the body of f to its declaration in
+// c.symbols
+func (c *Checker) resolveFunction(f *funcDecl) error {
+    params := newBlock(nil)
+    for _, p := range f.fn.Parameters {
+        params.declare(&Symbol{Kind: SymbolParameter, Name: p.Name, Pos: p.Pos})
+    }
+    if err := c.resolveBody(f.fn.Body, params); err != nil {
+        return err
+    }
+    c.reportUnused(params)
+    return nil
+}
+
+func (c *Checker) resolveBody(body *parser.ASTBody, b *block) error {
+    for _, node := range body.Children {
+        if err := c.resolveExpr(node, b); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *Checker) resolveExpr(expr parser.Expression, b *block) error {
+    defer c.at(parser.NodePos(expr))()
+    switch e := expr.(type) {
+    case parser.IdentExpr:
+        return c.resolveIdent(e, b)
+
+    case parser.StringExpr, parser.NumberExpr:
+        return nil
+
+    case parser.NotExpr:
+        return c.resolveExpr(e.Expr, b)
+    case parser.NegateExpr:
+        return c.resolveExpr(e.Expr, b)
+    case parser.UnsafeAccessExpr:
+        return c.resolveExpr(e.Expr, b)
+
+    case parser.AddExpr:
+        return c.resolveAll(b, e.Left, e.Right)
+    case parser.SubExpr:
+        return c.resolveAll(b, e.Left, e.Right)
+    case parser.MulExpr:
+        return c.resolveAll(b, e.Left, e.Right)
+    case parser.DivExpr:
+        return c.resolveAll(b, e.Left, e.Right)
+    case parser.ModExpr:
+        return c.resolveAll(b, e.Left, e.Right)
+    case parser.FunctionCallExpr:
+        return c.resolveAll(b, e.Input, e.Target)
+    case parser.ArrayAccessExpr:
+        return c.resolveAll(b, e.Target, e.Index)
+    case parser.DefaultExpr:
+        return c.resolveAll(b, e.Expr, e.Default)
+
+    case parser.ArrayExpr:
+        return c.resolveAll(b, e.Elements...)
+    case parser.TupleExpr:
+        return c.resolveAll(b, e.Elements...)
+    case parser.NamedTupleExpr:
+        for _, elem := range e.Elements {
+            if err := c.resolveExpr(elem.Expr, b); err != nil {
+                return err
+            }
+        }
+        return nil
+
+    case parser.ConstructorExpr:
+        if e.Payload == nil {
+            return nil
+        }
+        return c.resolveExpr(e.Payload, b)
+
+    case parser.MatchExpr:
+        if err := c.resolveExpr(e.Subject, b); err != nil {
+            return err
+        }
+        for _, arm := range e.Arms {
+            inner := newBlock(b)
+            c.resolvePattern(arm.Pattern, inner)
+            if err := c.resolveBody(arm.Body, inner); err != nil {
+                return err
+            }
+            c.reportUnused(inner)
+        }
+        return nil
+    }
+
+    return c.errorf("Unsupported expression %T", expr)
+}
+
+func (c *Checker) resolveAll(b *block, exprs ...parser.Expression) error {
+    for _, expr := range exprs {
+        if err := c.resolveExpr(expr, b); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// locals shadow functions, qualified names always refer to functions
+func (c *Checker) resolveIdent(e parser.IdentExpr, b *block) error {
+    if sym := b.lookup(e.Ident); sym != nil {
+        sym.used = true
+        c.symbols[e.Pos] = sym
+        return nil
+    }
+
+    f, err := c.lookupFunction(e.Ident)
+    if err != nil {
+        return err
+    }
+    if f == nil {
+        return c.errorf("Undefined name %s", e.Ident)
+    }
+    c.symbols[e.Pos] = &Symbol{Kind: SymbolFunction, Name: f.name, Pos: f.fn.Pos}
+    if f != c.fn {
+        c.named[f.name] = true
+    }
+    return nil
+}
+
+// a private function counts as used when named outside its own body,
+// main when run
+func (c *Checker) unusedFunctions() []*Warning {
+    warnings := make([]*Warning, 0)
+    for _, f := range c.order {
+        name := f.fn.Name
+        if !f.fn.Public && !c.named[f.name] && name != "main" && !strings.HasPrefix(name, "_") {
+            warnings = append(warnings, &Warning{f.fn.Pos, "Unused function " + name})
+        }
+    }
+    return warnings
+}
+
+func (c *Checker) resolvePattern(p parser.Pattern, b *block) {
+    switch p := p.(type) {
+    case parser.BindingPattern:
+        b.declare(&Symbol{Kind: SymbolLocal, Name: p.Name, Pos: p.Pos})
+    case parser.ConstructorPattern:
+        c.resolvePattern(p.Payload, b)
+    case parser.TuplePattern:
+        for _, elem := range p.Elements {
+            c.resolvePattern(elem, b)
+        }
+    case parser.NamedTuplePattern:
+        for _, elem := range p.Elements {
+            c.resolvePattern(elem.Pattern, b)
+        }
+    }
+}
@@ -0,0 +1,270 @@
+package check
+
+import (
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+var (
+    Int = core.IbexSimpleType{Name: "Int"}
+    F64 = core.IbexSimpleType{Name: "F64"}
+    Bool = core.IbexSimpleType{Name: "Bool"}
+    String = core.IbexSimpleType{Name: "String"}
+
+    Unit = core.IbexTupleType{[]core.IbexType{}}
+)
+
+func option(elem core.IbexType) core.IbexType {
+    return core.IbexSimpleType{Name: "Option", Args: []core.IbexType{elem}}
+}
+
+func sizesOf(arr core.IbexArrayType) []int {
+    sizes := make([]int, arr.Dimensions)
+    for i := range sizes {
+        sizes[i] = arr.Size(i)
+    }
+    return sizes
+}
+
+func isBuiltin(name string) bool {
+    switch name {
+    case "Int", "F64", "Bool", "String":
+        return true
+    }
+    return false
+}
+
+func paramSet(params []string) map[string]bool {
+    set := make(map[string]bool)
+    for _, p := range params {
+        set[p] = true
+    }
+    return set
+}
+
+func isVariantDecl(td *typeDecl) bool {
+    _, ok := td.decl.Type.(core.IbexVariantType)
+    return ok
+}
+
+func (c *Checker) resolveDecl(td *typeDecl) error {
+    if td.def != nil || td.variant != nil {
+        return nil
+    }
+    if td.resolving {
+        return c.errorAt(td.decl.Pos, "Type alias %s refers to itself", td.name)
+    }
+    td.resolving = true
+    mod := c.mod
+    c.mod = td.mod
+    defer func() { td.resolving, c.mod = false, mod }()
+    defer c.at(td.decl.Pos)()
+
+    params := paramSet(td.decl.Params)
+    if len(params) != len(td.decl.Params) {
+        return c.errorf("Duplicate type parameter in type %s", td.name)
+    }
+
+    variant, ok := td.decl.Type.(core.IbexVariantType)
+    if !ok {
+        def, err := c.resolveType(td.decl.Type, params)
+        if err != nil {
+            return err
+        }
+        td.def = def
+        return nil
+    }
+
+    cases := make([]*core.IbexVariantCase, len(variant.Cases))
+    for i, vc := range variant.Cases {
+        var payload core.IbexType = nil
+        if vc.Payload != nil {
+            ty, err := c.resolveType(vc.Payload, params)
+            if err != nil {
+                return err
+            }
+            payload = ty
+        }
+        cases[i] = &core.IbexVariantCase{Tag: vc.Tag, Payload: payload}
+        c.ctors[Canonical(td.mod.module, vc.Tag)].c = cases[i]
+    }
+    td.variant = &core.IbexVariantType{cases}
+    return nil
+}
+
+// turns a type as written into its checked form: aliases are expanded,
+// names of type parameters become core.IbexTypeParameter
+func (c *Checker) resolveType(ty core.IbexType,
+    params map[string]bool) (core.IbexType, error) {
+
+    switch ty.(type) {
+    case core.IbexSimpleType:
+        t := ty.(core.IbexSimpleType)
+        if params[t.Name] {
+            if len(t.Args) > 0 {
+                return nil, c.errorf("Type parameter %s takes no type arguments", t.Name)
+            }
+            return core.IbexTypeParameter{t.Name}, nil
+        }
+
+        var args []core.IbexType = nil
+        for _, arg := range t.Args {
+            a, err := c.resolveType(arg, params)
+            if err != nil {
+                return nil, err
+            }
+            args = append(args, a)
+        }
+
+        if isBuiltin(t.Name) {
+            if len(args) > 0 {
+                return nil, c.errorf("Type %s takes no type arguments", t.Name)
+            }
+            return core.IbexSimpleType{Name: t.Name}, nil
+        }
+
+        td, err := c.lookupType(t.Name)
+        if err != nil {
+            return nil, err
+        }
+        if len(args) != len(td.decl.Params) {
+            return nil, c.errorf("Type %s expects %d type arguments, got %d",
+                t.Name, len(td.decl.Params), len(args))
+        }
+        if isVariantDecl(td) {
+            return core.IbexSimpleType{Name: td.name, Args: args}, nil
+        }
+        if err := c.resolveDecl(td); err != nil {
+            return nil, err
+        }
+        return Substitute(td.def, Bind(td.decl.Params, args)), nil
+
+    case core.IbexTupleType:
+        t := ty.(core.IbexTupleType)
+        elems := make([]core.IbexType, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            e, err := c.resolveType(elem, params)
+            if err != nil {
+                return nil, err
+            }
+            elems[i] = e
+        }
+        return core.IbexTupleType{elems}, nil
+
+    case core.IbexNamedTupleType:
+        t := ty.(core.IbexNamedTupleType)
+        seen := make(map[string]bool)
+        entries := make([]*core.IbexNamedTupleEntry, len(t.Types))
+        for i, entry := range t.Types {
+            if seen[entry.Name] {
+                return nil, c.errorf("Duplicate tag %s in named tuple", entry.Name)
+            }
+            seen[entry.Name] = true
+            e, err := c.resolveType(entry.Type, params)
+            if err != nil {
+                return nil, err
+            }
+            entries[i] = &core.IbexNamedTupleEntry{entry.Name, e}
+        }
+        return core.IbexNamedTupleType{entries}, nil
+
+    case core.IbexArrayType:
+        t := ty.(core.IbexArrayType)
+        elem, err := c.resolveType(t.ElementType, params)
+        if err != nil {
+            return nil, err
+        }
+        return core.NewArrayType(elem, sizesOf(t)), nil
+
+    case core.IbexFunctionType:
+        t := ty.(core.IbexFunctionType)
+        arg, err := c.resolveType(t.Argument, params)
+        if err != nil {
+            return nil, err
+        }
+        var ret core.IbexType = nil
+        if t.Return != nil {
+            ret, err = c.resolveType(t.Return, params)
+            if err != nil {
+                return nil, err
+            }
+        }
+        return core.IbexFunctionType{arg, ret}, nil
+
+    case core.IbexVariantType:
+        return nil, c.errorf("Variant types may only appear in type declarations")
+    }
+
+    return nil, c.errorf("Unknown type %s", core.TypeString(ty))
+}
+
+// Bind maps the type parameters params to the type arguments args, as
+// Substitute takes them.
+func Bind(params []string, args []core.IbexType) map[string]core.IbexType {
+    m := make(map[string]core.IbexType)
+    for i, p := range params {
+        m[p] = args[i]
+    }
+    return m
+}
+
+// Substitute replaces the type parameters in ty according to m.
+func Substitute(ty core.IbexType, m map[string]core.IbexType) core.IbexType {
+    switch t := prune(ty).(type) {
+    case core.IbexTypeParameter:
+        if r, ok := m[t.Name]; ok {
+            return r
+        }
+        return t
+    case core.IbexSimpleType:
+        if len(t.Args) == 0 {
+            return t
+        }
+        args := make([]core.IbexType, len(t.Args))
+        for i, arg := range t.Args {
+            args[i] = Substitute(arg, m)
+        }
+        return core.IbexSimpleType{Name: t.Name, Args: args}
+    case core.IbexTupleType:
+        elems := make([]core.IbexType, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            elems[i] = Substitute(elem, m)
+        }
+        return core.IbexTupleType{elems}
+    case core.IbexNamedTupleType:
+        entries := make([]*core.IbexNamedTupleEntry, len(t.Types))
+        for i, entry := range t.Types {
+            entries[i] = &core.IbexNamedTupleEntry{entry.Name, Substitute(entry.Type, m)}
+        }
+        return core.IbexNamedTupleType{entries}
+    case core.IbexArrayType:
+        return core.NewArrayType(Substitute(t.ElementType, m), sizesOf(t))
+    case core.IbexFunctionType:
+        var ret core.IbexType = nil
+        if t.Return != nil {
+            ret = Substitute(t.Return, m)
+        }
+        return core.IbexFunctionType{Substitute(t.Argument, m), ret}
+    default:
+        return t
+    }
+}
+
+// fresh type variables for the parameters of a generic declaration
+func (c *Checker) freshArgs(params []string) ([]core.IbexType, map[string]core.IbexType) {
+    var args []core.IbexType = nil
+    for range params {
+        args = append(args, c.fresh())
+    }
+    return args, Bind(params, args)
+}
+
+// pos is the position of the identifier naming f
+func (c *Checker) instantiate(f *funcDecl, pos parser.Pos) core.IbexType {
+    if !f.generic() {
+        return f.ty
+    }
+    args, m := c.freshArgs(f.fn.TypeParams)
+    c.uses = append(c.uses, &use{caller: c.fn, callee: f, args: args, pos: pos})
+    return Substitute(f.ty, m)
+}
@@ -0,0 +1,249 @@
+package check
+
+import (
+    "fmt"
+
+    "github.com/ibex-lang/ibex/core"
+)
+
+// placeholder for a type that is not known yet, e.g. the type arguments
+// of an instantiated generic function
+type typeVar struct {
+    id int
+    ref core.IbexType
+}
+
+func (v *typeVar) String() string {
+    if v.ref != nil {
+        return core.TypeString(v.ref)
+    }
+    return fmt.Sprintf("'%d", v.id)
+}
+
+func (c *Checker) fresh() *typeVar {
+    c.nextVar++
+    return &typeVar{id: c.nextVar}
+}
+
+func prune(ty core.IbexType) core.IbexType {
+    for {
+        v, ok := ty.(*typeVar)
+        if !ok || v.ref == nil {
+            return ty
+        }
+        ty = v.ref
+    }
+}
+
+// replaces all bound type variables in ty
+func zonk(ty core.IbexType) core.IbexType {
+    return Substitute(ty, nil)
+}
+
+func hasVars(ty core.IbexType) bool {
+    switch t := prune(ty).(type) {
+    case *typeVar:
+        return true
+    case core.IbexSimpleType:
+        for _, arg := range t.Args {
+            if hasVars(arg) {
+                return true
+            }
+        }
+    case core.IbexTupleType:
+        for _, elem := range t.ElementTypes {
+            if hasVars(elem) {
+                return true
+            }
+        }
+    case core.IbexNamedTupleType:
+        for _, entry := range t.Types {
+            if hasVars(entry.Type) {
+                return true
+            }
+        }
+    case core.IbexArrayType:
+        return hasVars(t.ElementType)
+    case core.IbexFunctionType:
+        return hasVars(t.Argument) || (t.Return != nil && hasVars(t.Return))
+    }
+    return false
+}
+
+func occurs(v *typeVar, ty core.IbexType) bool {
+    switch t := prune(ty).(type) {
+    case *typeVar:
+        return t == v
+    case core.IbexSimpleType:
+        for _, arg := range t.Args {
+            if occurs(v, arg) {
+                return true
+            }
+        }
+    case core.IbexTupleType:
+        for _, elem := range t.ElementTypes {
+            if occurs(v, elem) {
+                return true
+            }
+        }
+    case core.IbexNamedTupleType:
+        for _, entry := range t.Types {
+            if occurs(v, entry.Type) {
+                return true
+            }
+        }
+    case core.IbexArrayType:
+        return occurs(v, t.ElementType)
+    case core.IbexFunctionType:
+        return occurs(v, t.Argument) || (t.Return != nil && occurs(v, t.Return))
+    }
+    return false
+}
+
+// functions without a declared return type produce ()
+func returnType(ty core.IbexFunctionType) core.IbexType {
+    if ty.Return == nil {
+        return Unit
+    }
+    return ty.Return
+}
+
+func unify(a, b core.IbexType) bool {
+    a, b = prune(a), prune(b)
+
+    if v, ok := a.(*typeVar); ok {
+        if w, ok := b.(*typeVar); ok && v == w {
+            return true
+        }
+        if occurs(v, b) {
+            return false
+        }
+        v.ref = b
+        return true
+    }
+    if _, ok := b.(*typeVar); ok {
+        return unify(b, a)
+    }
+
+    switch x := a.(type) {
+    case core.IbexSimpleType:
+        y, ok := b.(core.IbexSimpleType)
+        if !ok || x.Name != y.Name || len(x.Args) != len(y.Args) {
+            return false
+        }
+        for i := range x.Args {
+            if !unify(x.Args[i], y.Args[i]) {
+                return false
+            }
+        }
+        return true
+
+    case core.IbexTypeParameter:
+        y, ok := b.(core.IbexTypeParameter)
+        return ok && x.Name == y.Name
+
+    case core.IbexTupleType:
+        y, ok := b.(core.IbexTupleType)
+        if !ok || len(x.ElementTypes) != len(y.ElementTypes) {
+            return false
+        }
+        for i := range x.ElementTypes {
+            if !unify(x.ElementTypes[i], y.ElementTypes[i]) {
+                return false
+            }
+        }
+        return true
+
+    case core.IbexNamedTupleType:
+        y, ok := b.(core.IbexNamedTupleType)
+        if !ok || len(x.Types) != len(y.Types) {
+            return false
+        }
+        for i := range x.Types {
+            if x.Types[i].Name != y.Types[i].Name ||
+                !unify(x.Types[i].Type, y.Types[i].Type) {
+                return false
+            }
+        }
+        return true
+
+    case core.IbexArrayType:
+        y, ok := b.(core.IbexArrayType)
+        if !ok {
+            return false
+        }
+        // the element may have turned out to be an array itself
+        x = core.NewArrayType(prune(x.ElementType), sizesOf(x))
+        y = core.NewArrayType(prune(y.ElementType), sizesOf(y))
+        if x.Dimensions != y.Dimensions {
+            return false
+        }
+        // a [3]Int is a []Int, but a []Int may not be a [3]Int
+        for i := 0; i < x.Dimensions; i++ {
+            if x.Size(i) > 0 && x.Size(i) != y.Size(i) {
+                return false
+            }
+        }
+        return unify(x.ElementType, y.ElementType)
+
+    case core.IbexFunctionType:
+        y, ok := b.(core.IbexFunctionType)
+        // the expected function is passed what b takes, the other way
+        return ok && unifyArgument(y.Argument, x.Argument) &&
+            unify(returnType(x), returnType(y))
+    }
+
+    return false
+}
+
+// the type of values of both have and next, as of the elements of an
+// array literal or the arms of a match: [1] and [1, 2] make a []Int
+func (c *Checker) join(have, next core.IbexType) (core.IbexType, error) {
+    if unify(have, next) {
+        return have, nil
+    }
+    if wide := widen(zonk(have)); unify(wide, next) {
+        return wide, nil
+    }
+    return nil, c.errorf("Type mismatch: expected %s, found %s",
+        core.TypeString(zonk(have)), core.TypeString(zonk(next)))
+}
+
+// ty with the fixed sizes of its arrays dynamic, but for those of
+// function types
+func widen(ty core.IbexType) core.IbexType {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        if len(t.Args) == 0 {
+            return t
+        }
+        args := make([]core.IbexType, len(t.Args))
+        for i, arg := range t.Args {
+            args[i] = widen(arg)
+        }
+        return core.IbexSimpleType{Name: t.Name, Args: args}
+    case core.IbexTupleType:
+        elems := make([]core.IbexType, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            elems[i] = widen(elem)
+        }
+        return core.IbexTupleType{elems}
+    case core.IbexNamedTupleType:
+        entries := make([]*core.IbexNamedTupleEntry, len(t.Types))
+        for i, entry := range t.Types {
+            entries[i] = &core.IbexNamedTupleEntry{entry.Name, widen(entry.Type)}
+        }
+        return core.IbexNamedTupleType{entries}
+    case core.IbexArrayType:
+        return core.NewArrayType(widen(t.ElementType), make([]int, t.Dimensions))
+    }
+    return ty
+}
+
+func (c *Checker) expect(actual, expected core.IbexType) error {
+    if !unify(expected, actual) {
+        return c.errorf("Type mismatch: expected %s, found %s",
+            core.TypeString(zonk(expected)), core.TypeString(zonk(actual)))
+    }
+    return nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/cgen"
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/dump"
+    "github.com/ibex-lang/ibex/format"
+    "github.com/ibex-lang/ibex/gogen"
+    "github.com/ibex-lang/ibex/highlight"
+    "github.com/ibex-lang/ibex/interp"
+    "github.com/ibex-lang/ibex/ir"
+    "github.com/ibex-lang/ibex/llvm"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/lsp"
+    "github.com/ibex-lang/ibex/parser"
+    "github.com/ibex-lang/ibex/repl"
+    "github.com/ibex-lang/ibex/vm"
+    "github.com/ibex-lang/ibex/wasm"
+)
+
+// opens the file named by the -o flag, stdout if it is empty or -
+func (c *cli) create(name string) (io.Writer, func() error, error) {
+    if name == "" || name == "-" {
+        return c.stdout, func() error { return nil }, nil
+    }
+    f, err := os.Create(name)
+    if err != nil {
+        return nil, nil, err
+    }
+    return f, f.Close, nil
+}
+
+// runs fn on the source of every file, writing to the file named out,
+// and gives the exit status. A file failing does not stop the others.
+func (c *cli) eachSource(files []string, out string,
+    fn func(w io.Writer, file string, src string) error) int {
+
+    w, close, err := c.create(out)
+    if err != nil {
+        return c.fail("write", out, err)
+    }
+    status := exitOK
+    for _, file := range files {
+        src, err := os.ReadFile(file)
+        if err != nil {
+            status = c.fail("read", file, err)
+            continue
+        }
+        if err := fn(w, file, string(src)); err != nil {
+            status = c.fail("syntax", file, err)
+        }
+    }
+    if err := close(); err != nil {
+        status = c.fail("write", out, err)
+    }
+    return status
+}
+
+// loads and checks the program whose root module is file, reporting
+// the warnings; nil if it failed
+func (c *cli) load(file string) ([]*loader.Module, *check.Info) {
+    l := loader.NewLoader(searchRoots(file))
+    if _, err := l.LoadFile(file); err != nil {
+        c.fail("import", file, err)
+        return nil, nil
+    }
+    info, err := check.CheckModules(l.Modules())
+    if err != nil {
+        c.fail("type", file, err)
+        return nil, nil
+    }
+    for _, w := range info.Warnings {
+        c.warn(w)
+    }
+    return l.Modules(), info
+}
+
+func outputFlag(fs *flag.FlagSet) *string {
+    return fs.String("o", "", "write the output to this file instead of stdout")
+}
+
+func lexFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    out := outputFlag(fs)
+    form := fs.String("format", "text", "how to print the tokens: text, a line per token, or json, see package dump")
+    return func(c *cli, files []string) int {
+        if *form != "text" && *form != "json" {
+            fmt.Fprintf(c.stderr, "ibex lex: unknown format %s\n", *form)
+            return exitUsage
+        }
+        return c.eachSource(files, *out, func(w io.Writer, file string, src string) error {
+            tokens, err := parser.LexFile(file, src)
+            if err != nil {
+                return err
+            }
+            if *form == "json" {
+                data, err := dump.TokensJSON(file, tokens)
+                if err != nil {
+                    return err
+                }
+                fmt.Fprintf(w, "%s\n", data)
+                return nil
+            }
+            for _, tok := range tokens {
+                fmt.Fprintf(w, "%s\t%s\t%s\n", tok.Pos(), tok.Ty, strconv.Quote(tok.Value))
+            }
+            return nil
+        })
+    }
+}
+
+func parseFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    out := outputFlag(fs)
+    form := fs.String("format", "go", "how to print the trees: go, as Go values, ibex, as source without comments, " +
+        "or json or sexp, see package dump")
+    return func(c *cli, files []string) int {
+        switch *form {
+        case "go", "ibex", "json", "sexp":
+        default:
+            fmt.Fprintf(c.stderr, "ibex parse: unknown format %s\n", *form)
+            return exitUsage
+        }
+        return c.eachSource(files, *out, func(w io.Writer, file string, src string) error {
+            unit, err := parser.ParseFile(file, src)
+            if err != nil {
+                return err
+            }
+            var text string
+            switch *form {
+            case "go":
+                text = fmt.Sprintf("%#v", unit)
+            case "ibex":
+                text, err = format.Node(unit)
+            case "json":
+                var data []byte
+                data, err = dump.JSON(file, unit)
+                text = string(data)
+            case "sexp":
+                text, err = dump.Sexp(file, unit)
+            }
+            if err != nil {
+                return err
+            }
+            fmt.Fprintln(w, text)
+            return nil
+        })
+    }
+}
+
+func checkFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    return func(c *cli, files []string) int {
+        status := exitOK
+        for _, file := range files {
+            if mods, _ := c.load(file); mods == nil {
+                status = exitFailed
+            }
+        }
+        return status
+    }
+}
+
+func runFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    engine := fs.String("engine", "interp", "what runs the program: interp, the interpreter, or vm, the bytecode VM")
+    return func(c *cli, files []string) int {
+        if *engine != "interp" && *engine != "vm" {
+            fmt.Fprintf(c.stderr, "ibex run: unknown engine %s\n", *engine)
+            return exitUsage
+        }
+        status := exitOK
+        for _, file := range files {
+            mods, info := c.load(file)
+            if mods == nil {
+                status = exitFailed
+                continue
+            }
+            var value interp.Value
+            var err error
+            if *engine == "vm" {
+                var p *vm.Program
+                if p, err = vm.Compile(mods, info); err == nil {
+                    value, err = vm.Run(p)
+                }
+            } else {
+                value, err = interp.RunModules(mods, info)
+            }
+            if err != nil {
+                status = c.fail("runtime", file, err)
+                continue
+            }
+            fmt.Fprintln(c.stdout, interp.Format(value))
+        }
+        return status
+    }
+}
+
+type buildOptions struct {
+    target string
+    out string
+    level int
+    goModule string
+    goImport string
+    goPackage string
+}
+
+// the extensions of the files targets write, directories for none
+var targets = map[string]string{"ir": ".ir", "c": ".c", "llvm": ".ll", "wasm": ".wasm", "wat": ".wat", "go": ""}
+
+func buildFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    o := &buildOptions{}
+    fs.StringVar(&o.target, "target", "c", "backend to compile with: c, go, llvm, wasm, wat or ir")
+    fs.StringVar(&o.out, "o", "",
+        "file, or directory for go, to write to, named after the compiled file if empty and stdout if - for text")
+    fs.IntVar(&o.level, "O", 1, "optimization level: 0 for none, 1 to fold constants and eliminate common " +
+        "subexpressions and dead code, 2 to also inline small functions")
+    fs.StringVar(&o.goModule, "go-module", "",
+        "path of the Go module written with the packages, named after the directory if empty and no -go-import")
+    fs.StringVar(&o.goImport, "go-import", "",
+        "import path of the Go package of the compiled file, inside a module written elsewhere")
+    fs.StringVar(&o.goPackage, "go-package", "main", "name of the Go package of the compiled file")
+    return func(c *cli, files []string) int {
+        if _, ok := targets[o.target]; !ok {
+            fmt.Fprintf(c.stderr, "ibex build: unknown target %s\n", o.target)
+            return exitUsage
+        }
+        if o.level < 0 || o.level > 2 {
+            fmt.Fprintf(c.stderr, "ibex build: no optimization level %d\n", o.level)
+            return exitUsage
+        }
+        if o.goModule != "" && o.goImport != "" {
+            fmt.Fprintf(c.stderr, "ibex build: -go-module with -go-import\n")
+            return exitUsage
+        }
+        if o.out != "" && len(files) > 1 {
+            fmt.Fprintf(c.stderr, "ibex build: -o with several files\n")
+            return exitUsage
+        }
+        status := exitOK
+        for _, file := range files {
+            if c.build(file, o) != exitOK {
+                status = exitFailed
+            }
+        }
+        return status
+    }
+}
+
+func (c *cli) build(file string, o *buildOptions) int {
+    mods, info := c.load(file)
+    if mods == nil {
+        return exitFailed
+    }
+    p, err := ir.Lower(mods, info)
+    if err == nil {
+        err = ir.Optimize(p, o.level)
+    }
+    if err != nil {
+        return c.fail("compile", file, err)
+    }
+    out := o.out
+    if out == "" {
+        out = strings.TrimSuffix(file, loader.Extension) + targets[o.target]
+    }
+
+    // files next to the output, as the runtime of C and LLVM
+    type extra struct {
+        name string
+        content string
+    }
+    var text string
+    var extras []extra
+    switch o.target {
+    case "ir":
+        text = p.String()
+    case "c":
+        text, err = cgen.Generate(p, info)
+        extras = append(extras, extra{cgen.RuntimeHeader, cgen.Runtime})
+    case "llvm":
+        text, err = llvm.Generate(p, info)
+        extras = append(extras, extra{llvm.RuntimeFile, llvm.Runtime})
+    case "wasm", "wat":
+        var m *wasm.Module
+        if m, err = wasm.Generate(p); err == nil {
+            if text = m.String(); o.target == "wasm" {
+                text = string(m.Binary())
+            }
+        }
+    case "go":
+        if out == "-" {
+            err = errors.New("Go packages cannot be written to stdout")
+            break
+        }
+        return c.writeGo(file, out, mods, p, info, o)
+    }
+    if err != nil {
+        return c.fail("compile", file, err)
+    }
+
+    if out == "-" {
+        if o.target == "wasm" {
+            return c.fail("compile", file, errors.New("a binary module cannot be written to stdout"))
+        }
+        fmt.Fprint(c.stdout, text)
+        return exitOK
+    }
+    for _, e := range extras {
+        if err := os.WriteFile(filepath.Join(filepath.Dir(out), e.name), []byte(e.content), 0644); err != nil {
+            return c.fail("write", file, err)
+        }
+    }
+    if err := os.WriteFile(out, []byte(text), 0644); err != nil {
+        return c.fail("write", file, err)
+    }
+    return exitOK
+}
+
+func (c *cli) writeGo(file string, dir string, mods []*loader.Module, p *ir.Program,
+    info *check.Info, o *buildOptions) int {
+
+    opts := gogen.Options{Module: o.goModule, ImportPath: o.goImport, Package: o.goPackage}
+    if opts.Module == "" && opts.ImportPath == "" {
+        abs, err := filepath.Abs(dir)
+        if err != nil {
+            return c.fail("write", file, err)
+        }
+        opts.Module = filepath.Base(abs)
+    }
+    files, err := gogen.Generate(mods, p, info, opts)
+    if err != nil {
+        return c.fail("compile", file, err)
+    }
+    for _, f := range files {
+        name := filepath.Join(dir, filepath.FromSlash(f.Path))
+        err := os.MkdirAll(filepath.Dir(name), 0755)
+        if err == nil {
+            err = os.WriteFile(name, f.Source, 0644)
+        }
+        if err != nil {
+            return c.fail("write", file, err)
+        }
+    }
+    return exitOK
+}
+
+func fmtFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    check := fs.Bool("check", false, "only list the files that are not formatted, with a failing status if any is not")
+    return func(c *cli, files []string) int {
+        status := exitOK
+        for _, file := range files {
+            src, err := os.ReadFile(file)
+            if err != nil {
+                status = c.fail("read", file, err)
+                continue
+            }
+            formatted, err := format.Source(file, string(src))
+            if err != nil {
+                status = c.fail("syntax", file, err)
+                continue
+            }
+            if formatted == string(src) {
+                continue
+            }
+            if *check {
+                fmt.Fprintln(c.stdout, file)
+                status = exitFailed
+            } else if err := os.WriteFile(file, []byte(formatted), 0644); err != nil {
+                status = c.fail("write", file, err)
+            }
+        }
+        return status
+    }
+}
+
+const replHelp = `Enter an expression to print its value and type, or use statements and
+fn and type declarations to keep for the later entries. A line opening a
+block, as a fn declaration or a match, continues until an empty line.
+
+    :history  list the entries so far
+    :help     print this
+    :quit     leave, as does the end of the input
+`
+
+func replFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    return func(c *cli, files []string) int {
+        if len(files) > 0 {
+            fmt.Fprintf(c.stderr, "ibex repl: takes no files\n")
+            return exitUsage
+        }
+        s := repl.NewSession(searchRoots("."))
+        var e repl.Entry
+        prompt := func() {
+            if e.Empty() {
+                fmt.Fprint(c.stdout, "> ")
+            } else {
+                fmt.Fprint(c.stdout, "... ")
+            }
+        }
+
+        in := bufio.NewScanner(c.stdin)
+        for prompt(); in.Scan(); prompt() {
+            line := in.Text()
+            if e.Empty() && strings.HasPrefix(line, ":") {
+                switch strings.TrimSpace(line) {
+                case ":quit":
+                    return exitOK
+                case ":help":
+                    fmt.Fprint(c.stdout, replHelp)
+                case ":history":
+                    for i, src := range s.History() {
+                        fmt.Fprintf(c.stdout, "%d\t%s\n", i + 1, strings.ReplaceAll(src, "\n", "\n\t"))
+                    }
+                default:
+                    fmt.Fprintf(c.stderr, "Unknown command %s, :help lists them\n", line)
+                }
+                continue
+            }
+            done, err := e.Add(line)
+            if err != nil {
+                c.fail("syntax", "", err)
+            } else if done {
+                c.eval(s, e.Source())
+                e.Reset()
+            }
+        }
+        if !e.Empty() {
+            c.eval(s, e.Source())
+        }
+        fmt.Fprintln(c.stdout)
+        if err := in.Err(); err != nil {
+            return c.fail("read", "", err)
+        }
+        return exitOK
+    }
+}
+
+func lspFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    return func(c *cli, files []string) int {
+        if len(files) > 0 {
+            fmt.Fprintf(c.stderr, "ibex lsp: takes no files\n")
+            return exitUsage
+        }
+        s := lsp.NewServer(c.stdin, c.stdout, filepath.SplitList(os.Getenv("IBEXPATH")))
+        if err := s.Run(); err != nil {
+            return c.fail("read", "", err)
+        }
+        return exitOK
+    }
+}
+
+func grammarFlags(fs *flag.FlagSet) func(c *cli, files []string) int {
+    out := outputFlag(fs)
+    return func(c *cli, files []string) int {
+        if len(files) > 0 {
+            fmt.Fprintf(c.stderr, "ibex grammar: takes no files\n")
+            return exitUsage
+        }
+        grammar, err := highlight.TextMate()
+        if err != nil {
+            return c.fail("write", *out, err)
+        }
+        w, close, err := c.create(*out)
+        if err == nil {
+            _, err = w.Write(grammar)
+            if cerr := close(); err == nil {
+                err = cerr
+            }
+        }
+        if err != nil {
+            return c.fail("write", *out, err)
+        }
+        return exitOK
+    }
+}
+
+// evaluates an entry of the session, printing the result
+func (c *cli) eval(s *repl.Session, src string) {
+    r, err := s.Eval(src)
+    if err != nil {
+        // syntax, type and runtime errors tell their kind, what else
+        // fails is loading the modules used
+        c.fail("import", "", err)
+        return
+    }
+    for _, w := range r.Warnings {
+        c.warn(w)
+    }
+    if text := r.String(); text != "" {
+        fmt.Fprintln(c.stdout, text)
+    }
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+func TypeString(ty IbexType) string {
+    if ty == nil {
+        return "()"
+    }
+    return fmt.Sprint(ty)
+}
+
+func (t IbexTupleType) String() string {
+    elems := make([]string, len(t.ElementTypes))
+    for i, ty := range t.ElementTypes {
+        elems[i] = TypeString(ty)
+    }
+    return "(" + strings.Join(elems, ", ") + ")"
+}
+
+func (t IbexArrayType) String() string {
+    dims := ""
+    for i := 0; i < t.Dimensions; i++ {
+        if size := t.Size(i); size > 0 {
+            dims += "[" + strconv.Itoa(size) + "]"
+        } else {
+            dims += "[]"
+        }
+    }
+    return dims + TypeString(t.ElementType)
+}
+
+func (t IbexNamedTupleType) String() string {
+    elems := make([]string, len(t.Types))
+    for i, entry := range t.Types {
+        elems[i] = entry.Name + ": " + TypeString(entry.Type)
+    }
+    return "(" + strings.Join(elems, ", ") + ")"
+}
+
+func (t IbexFunctionType) String() string {
+    if t.Return == nil {
+        return "fn " + TypeString(t.Argument)
+    }
+    return "fn " + TypeString(t.Argument) + " -> " + TypeString(t.Return)
+}
+
+func (t IbexSimpleType) String() string {
+    if len(t.Args) == 0 {
+        return t.Name
+    }
+    args := make([]string, len(t.Args))
+    for i, ty := range t.Args {
+        args[i] = TypeString(ty)
+    }
+    return t.Name + "[" + strings.Join(args, ", ") + "]"
+}
+
+func (t IbexTypeParameter) String() string {
+    return t.Name
+}
+
+func (t IbexVariantType) String() string {
+    cases := make([]string, len(t.Cases))
+    for i, c := range t.Cases {
+        if c.Payload == nil {
+            cases[i] = c.Tag
+        } else {
+            cases[i] = c.Tag + " " + TypeString(c.Payload)
+        }
+    }
+    return strings.Join(cases, " | ")
+}
@@ -9,6 +9,47 @@ type IbexTupleType struct {
 type IbexArrayType struct {
     ElementType IbexType
     Dimensions int
+    Sizes []int // fixed length per dimension, 0 where dynamic; nil if none is fixed
+}
+
+// sizes has one entry per dimension, arrays of arrays are flattened so
+// that [2]([3]Int) becomes [2][3]Int
+func NewArrayType(elem IbexType, sizes []int) IbexArrayType {
+    all := append([]int{}, sizes...)
+    if inner, ok := elem.(IbexArrayType); ok {
+        for i := 0; i < inner.Dimensions; i++ {
+            all = append(all, inner.Size(i))
+        }
+        elem = inner.ElementType
+    }
+
+    ty := IbexArrayType{ElementType: elem, Dimensions: len(all)}
+    for _, size := range all {
+        if size > 0 {
+            ty.Sizes = all
+        }
+    }
+    return ty
+}
+
+// fixed length of dimension dim, 0 if dynamic
+func (t IbexArrayType) Size(dim int) int {
+    if t.Sizes == nil {
+        return 0
+    }
+    return t.Sizes[dim]
+}
+
+// the type of an element after one index
+func (t IbexArrayType) Elem() IbexType {
+    if t.Dimensions == 1 {
+        return t.ElementType
+    }
+    sizes := make([]int, t.Dimensions - 1)
+    for i := range sizes {
+        sizes[i] = t.Size(i + 1)
+    }
+    return NewArrayType(t.ElementType, sizes)
 }
 
 type IbexNamedTupleEntry struct {
@@ -26,4 +67,18 @@ type IbexFunctionType struct {
 
 type IbexSimpleType struct {
     Name string
+    Args []IbexType // type arguments, List[T]
+}
+
+// type parameter of a generic declaration, only produced by the checker
+type IbexTypeParameter struct {
+    Name string
+}
+
+type IbexVariantCase struct {
+    Tag string
+    Payload IbexType // nil for cases without a payload
+}
+type IbexVariantType struct {
+    Cases []*IbexVariantCase
 }
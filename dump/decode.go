@@ -0,0 +1,434 @@
+package dump
+
+import (
+    "encoding/json"
+    "fmt"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// The kinds of nodes and their fields, besides kind and pos, which all
+// but wildcard and literal patterns have:
+//     Unit            uses, declarations, comments
+//     Comment         text
+//     Use             path, alias, items, glob
+//     UseItem         name, alias
+//     Function        public, name, typeParams, parameters, return, body
+//     Parameter       name, type
+//     TypeDeclaration public, name, params, type
+// Expressions:
+//     Ident name; String value; Number value; Not expr; Negate expr;
+//     Add, Sub, Mul, Div, Mod left, right; Call input, target;
+//     Unwrap expr; Default expr, default; Index target, index;
+//     Array elements; Tuple elements; NamedTuple entries of tag, expr;
+//     Constructor tag, payload; Match subject, arms of pattern, body
+// Patterns:
+//     WildcardPattern; BindingPattern name; LiteralPattern literal;
+//     ConstructorPattern tag, payload; TuplePattern elements;
+//     NamedTuplePattern entries of tag, pattern
+// Types, which have no position:
+//     SimpleType name, args; TupleType elements; NamedTupleType entries
+//     of name, type; ArrayType element, dimensions, sizes; FunctionType
+//     argument, return; TypeParameter name; VariantType cases of tag,
+//     payload
+// A null list reads as an empty one. Empty items, type args, sizes and
+// bodies read as none, which is how the parser leaves them.
+
+type decoder struct {
+    file string // of the positions
+    err error // the first node that could not be decoded
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+    if d.err == nil {
+        d.err = fmt.Errorf(format, args...)
+    }
+}
+
+// Decode gives back the tree of a document JSON gave. The positions are
+// in the file of the document.
+func Decode(data []byte) (*parser.ASTCompilationUnit, error) {
+    var doc interface{}
+    if err := json.Unmarshal(data, &doc); err != nil {
+        return nil, err
+    }
+    d := &decoder{}
+    o := d.object(doc, "document")
+    if d.err != nil {
+        return nil, d.err
+    }
+    if version := d.integer(o, "version"); d.err == nil && version != Version {
+        return nil, fmt.Errorf("Unsupported schema version %d, expected %d", version, Version)
+    }
+    d.file = d.str(o, "file")
+    unit := d.unit(d.node(o["unit"], "Unit"))
+    if d.err != nil {
+        return nil, d.err
+    }
+    return unit, nil
+}
+
+func (d *decoder) object(v interface{}, what string) object {
+    o, ok := v.(map[string]interface{})
+    if !ok {
+        d.fail("Expected an object for %s", what)
+        return object{}
+    }
+    return o
+}
+
+// the node v, which must be of kind
+func (d *decoder) node(v interface{}, kind string) object {
+    o := d.object(v, kind)
+    if k, _ := o["kind"].(string); k != kind && d.err == nil {
+        d.fail("Expected a %s node, found %q", kind, k)
+    }
+    return o
+}
+
+func (d *decoder) kind(o object) string {
+    k, ok := o["kind"].(string)
+    if !ok {
+        d.fail("Expected a kind for a node")
+    }
+    return k
+}
+
+func (d *decoder) str(o object, key string) string {
+    s, ok := o[key].(string)
+    if !ok {
+        d.fail("Expected a string for %s", key)
+    }
+    return s
+}
+
+func (d *decoder) boolean(o object, key string) bool {
+    b, ok := o[key].(bool)
+    if !ok {
+        d.fail("Expected a boolean for %s", key)
+    }
+    return b
+}
+
+func (d *decoder) integer(o object, key string) int {
+    return d.number(o[key], key)
+}
+
+func (d *decoder) number(v interface{}, what string) int {
+    f, ok := v.(float64)
+    if !ok || f != float64(int(f)) {
+        d.fail("Expected an integer for %s", what)
+    }
+    return int(f)
+}
+
+// the list at key, empty for null
+func (d *decoder) list(o object, key string) []interface{} {
+    v, present := o[key]
+    if !present {
+        d.fail("Expected a list for %s", key)
+        return nil
+    }
+    if v == nil {
+        return []interface{}{}
+    }
+    values, ok := v.([]interface{})
+    if !ok {
+        d.fail("Expected a list for %s", key)
+    }
+    return values
+}
+
+func (d *decoder) strings(o object, key string) []string {
+    values := d.list(o, key)
+    list := make([]string, len(values))
+    for i, v := range values {
+        s, ok := v.(string)
+        if !ok {
+            d.fail("Expected strings for %s", key)
+        }
+        list[i] = s
+    }
+    return list
+}
+
+// the position of o, none if it has none
+func (d *decoder) pos(o object) parser.Pos {
+    v, present := o["pos"]
+    if !present {
+        return parser.Pos{}
+    }
+    p := d.object(v, "pos")
+    return parser.Pos{File: d.file, Line: d.integer(p, "line"), Col: d.integer(p, "col")}
+}
+
+func (d *decoder) unit(o object) *parser.ASTCompilationUnit {
+    unit := &parser.ASTCompilationUnit{}
+    uses := d.list(o, "uses")
+    unit.Uses = make([]*parser.ASTUseStmt, len(uses))
+    for i, v := range uses {
+        unit.Uses[i] = d.use(d.node(v, "Use"))
+    }
+    decls := d.list(o, "declarations")
+    unit.Declarations = make([]parser.ASTMemberDeclaration, len(decls))
+    for i, v := range decls {
+        unit.Declarations[i] = d.declaration(d.object(v, "declaration"))
+    }
+    comments := d.list(o, "comments")
+    unit.Comments = make([]*parser.Comment, len(comments))
+    for i, v := range comments {
+        c := d.node(v, "Comment")
+        unit.Comments[i] = &parser.Comment{Pos: d.pos(c), Text: d.str(c, "text")}
+    }
+    return unit
+}
+
+func (d *decoder) use(o object) *parser.ASTUseStmt {
+    use := &parser.ASTUseStmt{
+        Pos: d.pos(o),
+        Path: d.strings(o, "path"),
+        Alias: d.str(o, "alias"),
+        Glob: d.boolean(o, "glob"),
+    }
+    // a use without braces has none
+    if items := d.list(o, "items"); len(items) > 0 {
+        use.Items = make([]*parser.UseItem, len(items))
+        for i, v := range items {
+            item := d.node(v, "UseItem")
+            use.Items[i] = &parser.UseItem{Pos: d.pos(item), Name: d.str(item, "name"), Alias: d.str(item, "alias")}
+        }
+    }
+    return use
+}
+
+func (d *decoder) declaration(o object) parser.ASTMemberDeclaration {
+    switch kind := d.kind(o); kind {
+    case "Function":
+        fn := &parser.ASTFunction{
+            Public: d.boolean(o, "public"),
+            Pos: d.pos(o),
+            Name: d.str(o, "name"),
+            TypeParams: d.strings(o, "typeParams"),
+            Return: d.typ(o["return"]),
+            Body: d.body(o, "body"),
+        }
+        params := d.list(o, "parameters")
+        fn.Parameters = make([]*parser.FunctionParameter, len(params))
+        for i, v := range params {
+            p := d.node(v, "Parameter")
+            fn.Parameters[i] = &parser.FunctionParameter{Name: d.str(p, "name"), Type: d.typ(p["type"]), Pos: d.pos(p)}
+        }
+        return fn
+    case "TypeDeclaration":
+        return &parser.ASTTypeDeclaration{
+            Public: d.boolean(o, "public"),
+            Pos: d.pos(o),
+            Name: d.str(o, "name"),
+            Params: d.strings(o, "params"),
+            Type: d.typ(o["type"]),
+        }
+    default:
+        d.fail("Unknown declaration kind %q", kind)
+        return nil
+    }
+}
+
+// the body at key, nil for none, as a body is never empty
+func (d *decoder) body(o object, key string) *parser.ASTBody {
+    children := d.list(o, key)
+    if len(children) == 0 {
+        return nil
+    }
+    body := &parser.ASTBody{Children: make([]parser.ASTNode, len(children))}
+    for i, v := range children {
+        body.Children[i] = d.expr(v)
+    }
+    return body
+}
+
+func (d *decoder) exprs(o object, key string) []parser.Expression {
+    values := d.list(o, key)
+    exprs := make([]parser.Expression, len(values))
+    for i, v := range values {
+        exprs[i] = d.expr(v)
+    }
+    return exprs
+}
+
+func (d *decoder) expr(v interface{}) parser.Expression {
+    o := d.object(v, "expression")
+    if d.err != nil {
+        return nil
+    }
+    p := d.pos(o)
+    switch kind := d.kind(o); kind {
+    case "Ident":
+        return parser.IdentExpr{Ident: d.str(o, "name"), Pos: p}
+    case "String":
+        return parser.StringExpr{String: d.str(o, "value"), Pos: p}
+    case "Number":
+        return parser.NumberExpr{Number: d.str(o, "value"), Pos: p}
+    case "Not":
+        return parser.NotExpr{Expr: d.expr(o["expr"]), Pos: p}
+    case "Negate":
+        return parser.NegateExpr{Expr: d.expr(o["expr"]), Pos: p}
+    case "Add":
+        return parser.AddExpr{Left: d.expr(o["left"]), Right: d.expr(o["right"]), Pos: p}
+    case "Sub":
+        return parser.SubExpr{Left: d.expr(o["left"]), Right: d.expr(o["right"]), Pos: p}
+    case "Mul":
+        return parser.MulExpr{Left: d.expr(o["left"]), Right: d.expr(o["right"]), Pos: p}
+    case "Div":
+        return parser.DivExpr{Left: d.expr(o["left"]), Right: d.expr(o["right"]), Pos: p}
+    case "Mod":
+        return parser.ModExpr{Left: d.expr(o["left"]), Right: d.expr(o["right"]), Pos: p}
+    case "Call":
+        return parser.FunctionCallExpr{Input: d.expr(o["input"]), Target: d.expr(o["target"]), Pos: p}
+    case "Unwrap":
+        return parser.UnsafeAccessExpr{Expr: d.expr(o["expr"]), Pos: p}
+    case "Default":
+        return parser.DefaultExpr{Expr: d.expr(o["expr"]), Default: d.expr(o["default"]), Pos: p}
+    case "Index":
+        return parser.ArrayAccessExpr{Target: d.expr(o["target"]), Index: d.expr(o["index"]), Pos: p}
+    case "Array":
+        return parser.ArrayExpr{Elements: d.exprs(o, "elements"), Pos: p}
+    case "Tuple":
+        return parser.TupleExpr{Elements: d.exprs(o, "elements"), Pos: p}
+    case "NamedTuple":
+        tuple := parser.NamedTupleExpr{Pos: p}
+        entries := d.list(o, "entries")
+        tuple.Elements = make([]*parser.NamedTupleEntry, len(entries))
+        for i, v := range entries {
+            entry := d.object(v, "entry")
+            tuple.Elements[i] = &parser.NamedTupleEntry{Tag: d.str(entry, "tag"), Expr: d.expr(entry["expr"])}
+        }
+        return tuple
+    case "Constructor":
+        c := parser.ConstructorExpr{Tag: d.str(o, "tag"), Pos: p}
+        if o["payload"] != nil {
+            c.Payload = d.expr(o["payload"])
+        }
+        return c
+    case "Match":
+        m := parser.MatchExpr{Subject: d.expr(o["subject"]), Pos: p}
+        arms := d.list(o, "arms")
+        m.Arms = make([]*parser.MatchArm, len(arms))
+        for i, v := range arms {
+            arm := d.object(v, "arm")
+            m.Arms[i] = &parser.MatchArm{Pattern: d.pattern(arm["pattern"]), Body: d.body(arm, "body")}
+        }
+        return m
+    default:
+        d.fail("Unknown expression kind %q", kind)
+        return nil
+    }
+}
+
+func (d *decoder) pattern(v interface{}) parser.Pattern {
+    o := d.object(v, "pattern")
+    if d.err != nil {
+        return nil
+    }
+    p := d.pos(o)
+    switch kind := d.kind(o); kind {
+    case "WildcardPattern":
+        return parser.WildcardPattern{Pos: p}
+    case "BindingPattern":
+        return parser.BindingPattern{Name: d.str(o, "name"), Pos: p}
+    case "LiteralPattern":
+        return parser.LiteralPattern{Literal: d.expr(o["literal"])}
+    case "ConstructorPattern":
+        c := parser.ConstructorPattern{Tag: d.str(o, "tag"), Pos: p}
+        if o["payload"] != nil {
+            c.Payload = d.pattern(o["payload"])
+        }
+        return c
+    case "TuplePattern":
+        tuple := parser.TuplePattern{Pos: p}
+        elements := d.list(o, "elements")
+        tuple.Elements = make([]parser.Pattern, len(elements))
+        for i, v := range elements {
+            tuple.Elements[i] = d.pattern(v)
+        }
+        return tuple
+    case "NamedTuplePattern":
+        tuple := parser.NamedTuplePattern{Pos: p}
+        entries := d.list(o, "entries")
+        tuple.Elements = make([]*parser.NamedTuplePatternEntry, len(entries))
+        for i, v := range entries {
+            entry := d.object(v, "entry")
+            tuple.Elements[i] = &parser.NamedTuplePatternEntry{Tag: d.str(entry, "tag"),
+                Pattern: d.pattern(entry["pattern"])}
+        }
+        return tuple
+    default:
+        d.fail("Unknown pattern kind %q", kind)
+        return nil
+    }
+}
+
+func (d *decoder) types(o object, key string) []core.IbexType {
+    values := d.list(o, key)
+    types := make([]core.IbexType, len(values))
+    for i, v := range values {
+        types[i] = d.typ(v)
+    }
+    return types
+}
+
+// nil for null
+func (d *decoder) typ(v interface{}) core.IbexType {
+    if v == nil {
+        return nil
+    }
+    o := d.object(v, "type")
+    if d.err != nil {
+        return nil
+    }
+    switch kind := d.kind(o); kind {
+    case "SimpleType":
+        ty := core.IbexSimpleType{Name: d.str(o, "name"), Args: d.types(o, "args")}
+        if len(ty.Args) == 0 {
+            ty.Args = nil // not applied
+        }
+        return ty
+    case "TupleType":
+        return core.IbexTupleType{ElementTypes: d.types(o, "elements")}
+    case "NamedTupleType":
+        tuple := core.IbexNamedTupleType{}
+        entries := d.list(o, "entries")
+        tuple.Types = make([]*core.IbexNamedTupleEntry, len(entries))
+        for i, v := range entries {
+            entry := d.object(v, "entry")
+            tuple.Types[i] = &core.IbexNamedTupleEntry{Name: d.str(entry, "name"), Type: d.typ(entry["type"])}
+        }
+        return tuple
+    case "ArrayType":
+        array := core.IbexArrayType{ElementType: d.typ(o["element"]), Dimensions: d.integer(o, "dimensions")}
+        // all dimensions dynamic without any
+        if sizes := d.list(o, "sizes"); len(sizes) > 0 {
+            array.Sizes = make([]int, len(sizes))
+            for i, v := range sizes {
+                array.Sizes[i] = d.number(v, "sizes")
+            }
+        }
+        return array
+    case "FunctionType":
+        return core.IbexFunctionType{Argument: d.typ(o["argument"]), Return: d.typ(o["return"])}
+    case "TypeParameter":
+        return core.IbexTypeParameter{Name: d.str(o, "name")}
+    case "VariantType":
+        variant := core.IbexVariantType{}
+        cases := d.list(o, "cases")
+        variant.Cases = make([]*core.IbexVariantCase, len(cases))
+        for i, v := range cases {
+            c := d.object(v, "case")
+            variant.Cases[i] = &core.IbexVariantCase{Tag: d.str(c, "tag"), Payload: d.typ(c["payload"])}
+        }
+        return variant
+    default:
+        d.fail("Unknown type kind %q", kind)
+        return nil
+    }
+}
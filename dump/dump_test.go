@@ -0,0 +1,167 @@
+package dump
+
+import (
+	"encoding/json"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/core"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+// every kind of node
+const program = `// all of it
+use util
+use geo::{area as a, Shape}
+use shapes::*
+type Shape[T] = Circle(r: T) | Square (side: T) | None
+pub type Grid = [2][]Int
+type Flat = []Int
+type Pair = (Int, ?String)
+type Op = fn Int -> fn Int
+fn main -> Int
+    a
+    "two" -> print
+    a -> util::f
+    !a
+    -1 + 2 - 3 * 4 / 5 % 6
+    xs[0]! ? 7
+    [1, 2]
+    ()
+    (a: 1, b: (2, 3))
+    Circle (r: 1)
+    None
+    match s // which
+        Circle (r: r) => r
+        (a, _) => 0
+        (x: -1) =>
+            1
+        "s" => 2
+        n => n
+pub fn id[T] x: T -> T
+    x
+fn g f: fn Int -> Int
+    f`
+
+func TestRoundTrip(t *testing.T) {
+	unit, err := parser.ParseFile("all.ibex", program)
+	assert.Nil(t, err)
+	data, err := JSON("all.ibex", unit)
+	assert.Nil(t, err)
+	again, err := Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, unit, again)
+}
+
+func TestJSON(t *testing.T) {
+	unit, err := parser.ParseFile("a.ibex", "fn main -> Int\n    1 + x")
+	assert.Nil(t, err)
+	data, err := JSON("a.ibex", unit)
+	assert.Nil(t, err)
+	var doc interface{}
+	assert.Nil(t, json.Unmarshal(data, &doc))
+	var expected interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"version": 1, "file": "a.ibex", "unit": {
+		"kind": "Unit", "uses": [], "comments": [],
+		"declarations": [{"kind": "Function", "pos": {"line": 1, "col": 4}, "public": false, "name": "main",
+			"typeParams": [], "parameters": [], "return": {"kind": "SimpleType", "name": "Int", "args": []},
+			"body": [{"kind": "Add", "pos": {"line": 2, "col": 7},
+				"left": {"kind": "Number", "pos": {"line": 2, "col": 5}, "value": "1"},
+				"right": {"kind": "Ident", "pos": {"line": 2, "col": 9}, "name": "x"}}]}]}}`), &expected))
+	assert.Equal(t, expected, doc)
+}
+
+func TestSexp(t *testing.T) {
+	unit, err := parser.ParseFile("a.ibex", "fn main -> Int\n    1 + x")
+	assert.Nil(t, err)
+	text, err := Sexp("a.ibex", unit)
+	assert.Nil(t, err)
+	assert.Equal(t, `(ibex
+ :file "a.ibex"
+ :unit (Unit
+        :comments ()
+        :declarations ((Function
+                        :pos (1 4)
+                        :body ((Add
+                                :pos (2 7)
+                                :left (Number :pos (2 5) :value "1")
+                                :right (Ident :pos (2 9) :name "x")))
+                        :name "main"
+                        :parameters ()
+                        :public false
+                        :return (SimpleType :args () :name "Int")
+                        :typeParams ()))
+        :uses ())
+ :version 1)`, text)
+
+	unit, err = parser.ParseFile("b.ibex", "")
+	assert.Nil(t, err)
+	text, err = Sexp("b.ibex", unit)
+	assert.Nil(t, err)
+	assert.Equal(t, `(ibex :file "b.ibex" :unit (Unit :comments () :declarations () :uses ()) :version 1)`, text)
+}
+
+func TestTokensJSON(t *testing.T) {
+	tokens, err := parser.LexFile("a.ibex", "fn f")
+	assert.Nil(t, err)
+	data, err := TokensJSON("a.ibex", tokens)
+	assert.Nil(t, err)
+	var doc interface{}
+	assert.Nil(t, json.Unmarshal(data, &doc))
+	var expected interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"version": 1, "file": "a.ibex", "tokens": [
+		{"kind": "fn", "value": "fn", "pos": {"line": 1, "col": 1}, "endCol": 3},
+		{"kind": "ident", "value": "f", "pos": {"line": 1, "col": 4}, "endCol": 5},
+		{"kind": "EOF", "value": "", "pos": {"line": 1, "col": 1}, "endCol": 1}]}`), &expected))
+	assert.Equal(t, expected, doc)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	cases := map[string]string{
+		`[1]`: "Expected an object for document",
+		`{"version": 2, "file": "a", "unit": null}`: "Unsupported schema version 2, expected 1",
+		`{"version": 1, "file": "a", "unit": {"kind": "Use"}}`: `Expected a Unit node, found "Use"`,
+		`{"version": 1, "file": "a", "unit": {"kind": "Unit", "uses": null, "comments": null,
+			"declarations": [{"kind": "Macro"}]}}`: `Unknown declaration kind "Macro"`,
+		`{"version": 1, "file": "a", "unit": {"kind": "Unit", "uses": null, "comments": null,
+			"declarations": [{"kind": "TypeDeclaration", "public": false, "name": "T", "params": null,
+			"type": {"kind": "ArrayType", "element": null, "dimensions": 1.5, "sizes": null}}]}}`:
+			"Expected an integer for dimensions",
+	}
+	for data, message := range cases {
+		_, err := Decode([]byte(data))
+		if assert.NotNil(t, err, data) {
+			assert.Equal(t, message, err.Error())
+		}
+	}
+}
+
+func TestEmptyLists(t *testing.T) {
+	unit, err := parser.ParseFile("a.ibex", "use util\ntype Row = []Int\nfn f -> ()")
+	assert.Nil(t, err)
+	data, err := JSON("a.ibex", unit)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), `"args":null`)
+	assert.NotContains(t, string(data), `"items":null`)
+	assert.NotContains(t, string(data), `"sizes":null`)
+	assert.NotContains(t, string(data), `"body":null`)
+	again, err := Decode(data)
+	assert.Nil(t, err)
+	assert.Equal(t, unit, again)
+
+	text, err := Sexp("a.ibex", unit)
+	assert.Nil(t, err)
+	assert.NotContains(t, text, " nil")
+
+	// null reads as empty
+	withNull, err := Decode([]byte(`{"version": 1, "file": "a", "unit": {"kind": "Unit", "uses": null,
+		"comments": [], "declarations": [{"kind": "TypeDeclaration", "public": false, "name": "T",
+		"params": null, "type": {"kind": "SimpleType", "name": "Int", "args": null}}]}}`))
+	assert.Nil(t, err)
+	withEmpty, err := Decode([]byte(`{"version": 1, "file": "a", "unit": {"kind": "Unit", "uses": [],
+		"comments": [], "declarations": [{"kind": "TypeDeclaration", "public": false, "name": "T",
+		"params": [], "type": {"kind": "SimpleType", "name": "Int", "args": []}}]}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, withEmpty, withNull)
+	assert.Nil(t, withNull.Declarations[0].(*parser.ASTTypeDeclaration).Type.(core.IbexSimpleType).Args)
+}
@@ -0,0 +1,343 @@
+package dump
+
+import (
+    "encoding/json"
+    "fmt"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// Version of the schema, raised whenever a change is more than an
+// addition
+const Version = 1
+
+// A document is an object with the schema version, the file and, for a
+// tree, the unit:
+//     {"version": 1, "file": "a.ibex", "unit": {"kind": "Unit", ...}}
+// Every node of the tree is an object with its kind, its fields and,
+// when known, its position as {"line": 1, "col": 4}, in the file of the
+// document. Lists are never null: one that is absent, as the items of a
+// use without braces, is empty. See decode.go for every kind.
+type object = map[string]interface{}
+
+type encoder struct {
+    err error // the first node that could not be encoded
+}
+
+func (e *encoder) fail(format string, args ...interface{}) {
+    if e.err == nil {
+        e.err = fmt.Errorf(format, args...)
+    }
+}
+
+// JSON gives the document for the tree parsed from file
+func JSON(file string, unit *parser.ASTCompilationUnit) ([]byte, error) {
+    doc, err := document(file, unit)
+    if err != nil {
+        return nil, err
+    }
+    return json.MarshalIndent(doc, "", "  ")
+}
+
+func document(file string, unit *parser.ASTCompilationUnit) (object, error) {
+    e := &encoder{}
+    u := e.unit(unit)
+    if e.err != nil {
+        return nil, e.err
+    }
+    return object{"version": Version, "file": file, "unit": u}, nil
+}
+
+// TokensJSON gives the document for the tokens of file, as
+// parser.LexFile gives them:
+//     {"version": 1, "file": "a.ibex", "tokens": [{"kind": "fn", "value": "fn",
+//         "pos": {"line": 1, "col": 1}, "endCol": 3}, ...]}
+// kind is the name of the type of the token, see parser.TokenType, and
+// endCol the column after it.
+func TokensJSON(file string, tokens []*parser.Token) ([]byte, error) {
+    list := make([]interface{}, len(tokens))
+    for i, tok := range tokens {
+        list[i] = object{
+            "kind": tok.Ty.String(),
+            "value": tok.Value,
+            "pos": position(tok.Pos()),
+            "endCol": tok.End + 1,
+        }
+    }
+    return json.MarshalIndent(object{"version": Version, "file": file, "tokens": list}, "", "  ")
+}
+
+func position(p parser.Pos) object {
+    return object{"line": p.Line, "col": p.Col}
+}
+
+func node(kind string, p parser.Pos) object {
+    o := object{"kind": kind}
+    if p.Line != 0 {
+        o["pos"] = position(p)
+    }
+    return o
+}
+
+func stringList(list []string) []interface{} {
+    values := make([]interface{}, len(list))
+    for i, s := range list {
+        values[i] = s
+    }
+    return values
+}
+
+func (e *encoder) unit(unit *parser.ASTCompilationUnit) object {
+    o := node("Unit", parser.Pos{})
+    uses := make([]interface{}, len(unit.Uses))
+    for i, use := range unit.Uses {
+        uses[i] = e.use(use)
+    }
+    decls := make([]interface{}, len(unit.Declarations))
+    for i, d := range unit.Declarations {
+        decls[i] = e.declaration(d)
+    }
+    comments := make([]interface{}, len(unit.Comments))
+    for i, c := range unit.Comments {
+        comment := node("Comment", c.Pos)
+        comment["text"] = c.Text
+        comments[i] = comment
+    }
+    o["uses"], o["declarations"], o["comments"] = uses, decls, comments
+    return o
+}
+
+func (e *encoder) use(use *parser.ASTUseStmt) object {
+    o := node("Use", use.Pos)
+    o["path"], o["alias"], o["glob"] = stringList(use.Path), use.Alias, use.Glob
+    items := make([]interface{}, len(use.Items))
+    for i, item := range use.Items {
+        it := node("UseItem", item.Pos)
+        it["name"], it["alias"] = item.Name, item.Alias
+        items[i] = it
+    }
+    o["items"] = items
+    return o
+}
+
+func (e *encoder) declaration(d parser.ASTMemberDeclaration) interface{} {
+    switch d := d.(type) {
+    case *parser.ASTFunction:
+        o := node("Function", d.Pos)
+        o["public"], o["name"], o["typeParams"] = d.Public, d.Name, stringList(d.TypeParams)
+        params := make([]interface{}, len(d.Parameters))
+        for i, p := range d.Parameters {
+            param := node("Parameter", p.Pos)
+            param["name"], param["type"] = p.Name, e.typ(p.Type)
+            params[i] = param
+        }
+        o["parameters"], o["return"], o["body"] = params, e.typ(d.Return), e.body(d.Body)
+        return o
+    case *parser.ASTTypeDeclaration:
+        o := node("TypeDeclaration", d.Pos)
+        o["public"], o["name"], o["params"], o["type"] = d.Public, d.Name, stringList(d.Params), e.typ(d.Type)
+        return o
+    }
+    e.fail("Unsupported declaration %T", d)
+    return nil
+}
+
+// the children of body, empty for none
+func (e *encoder) body(body *parser.ASTBody) []interface{} {
+    if body == nil {
+        return []interface{}{}
+    }
+    values := make([]interface{}, len(body.Children))
+    for i, x := range body.Children {
+        values[i] = e.expr(x)
+    }
+    return values
+}
+
+func (e *encoder) exprs(exprs []parser.Expression) []interface{} {
+    values := make([]interface{}, len(exprs))
+    for i, x := range exprs {
+        values[i] = e.expr(x)
+    }
+    return values
+}
+
+func (e *encoder) binary(kind string, left parser.Expression, right parser.Expression, p parser.Pos) object {
+    o := node(kind, p)
+    o["left"], o["right"] = e.expr(left), e.expr(right)
+    return o
+}
+
+func (e *encoder) expr(x parser.Expression) interface{} {
+    switch x := x.(type) {
+    case parser.IdentExpr:
+        o := node("Ident", x.Pos)
+        o["name"] = x.Ident
+        return o
+    case parser.StringExpr:
+        o := node("String", x.Pos)
+        o["value"] = x.String
+        return o
+    case parser.NumberExpr:
+        o := node("Number", x.Pos)
+        o["value"] = x.Number
+        return o
+    case parser.NotExpr:
+        o := node("Not", x.Pos)
+        o["expr"] = e.expr(x.Expr)
+        return o
+    case parser.NegateExpr:
+        o := node("Negate", x.Pos)
+        o["expr"] = e.expr(x.Expr)
+        return o
+    case parser.AddExpr:
+        return e.binary("Add", x.Left, x.Right, x.Pos)
+    case parser.SubExpr:
+        return e.binary("Sub", x.Left, x.Right, x.Pos)
+    case parser.MulExpr:
+        return e.binary("Mul", x.Left, x.Right, x.Pos)
+    case parser.DivExpr:
+        return e.binary("Div", x.Left, x.Right, x.Pos)
+    case parser.ModExpr:
+        return e.binary("Mod", x.Left, x.Right, x.Pos)
+    case parser.FunctionCallExpr:
+        o := node("Call", x.Pos)
+        o["input"], o["target"] = e.expr(x.Input), e.expr(x.Target)
+        return o
+    case parser.UnsafeAccessExpr:
+        o := node("Unwrap", x.Pos)
+        o["expr"] = e.expr(x.Expr)
+        return o
+    case parser.DefaultExpr:
+        o := node("Default", x.Pos)
+        o["expr"], o["default"] = e.expr(x.Expr), e.expr(x.Default)
+        return o
+    case parser.ArrayAccessExpr:
+        o := node("Index", x.Pos)
+        o["target"], o["index"] = e.expr(x.Target), e.expr(x.Index)
+        return o
+    case parser.ArrayExpr:
+        o := node("Array", x.Pos)
+        o["elements"] = e.exprs(x.Elements)
+        return o
+    case parser.TupleExpr:
+        o := node("Tuple", x.Pos)
+        o["elements"] = e.exprs(x.Elements)
+        return o
+    case parser.NamedTupleExpr:
+        o := node("NamedTuple", x.Pos)
+        entries := make([]interface{}, len(x.Elements))
+        for i, entry := range x.Elements {
+            entries[i] = object{"tag": entry.Tag, "expr": e.expr(entry.Expr)}
+        }
+        o["entries"] = entries
+        return o
+    case parser.ConstructorExpr:
+        o := node("Constructor", x.Pos)
+        o["tag"], o["payload"] = x.Tag, nil
+        if x.Payload != nil {
+            o["payload"] = e.expr(x.Payload)
+        }
+        return o
+    case parser.MatchExpr:
+        o := node("Match", x.Pos)
+        arms := make([]interface{}, len(x.Arms))
+        for i, arm := range x.Arms {
+            arms[i] = object{"pattern": e.pattern(arm.Pattern), "body": e.body(arm.Body)}
+        }
+        o["subject"], o["arms"] = e.expr(x.Subject), arms
+        return o
+    }
+    e.fail("Unsupported expression %T", x)
+    return nil
+}
+
+func (e *encoder) patterns(pats []parser.Pattern) []interface{} {
+    values := make([]interface{}, len(pats))
+    for i, p := range pats {
+        values[i] = e.pattern(p)
+    }
+    return values
+}
+
+func (e *encoder) pattern(p parser.Pattern) interface{} {
+    switch p := p.(type) {
+    case parser.WildcardPattern:
+        return node("WildcardPattern", p.Pos)
+    case parser.BindingPattern:
+        o := node("BindingPattern", p.Pos)
+        o["name"] = p.Name
+        return o
+    case parser.LiteralPattern:
+        o := node("LiteralPattern", parser.Pos{})
+        o["literal"] = e.expr(p.Literal)
+        return o
+    case parser.ConstructorPattern:
+        o := node("ConstructorPattern", p.Pos)
+        o["tag"], o["payload"] = p.Tag, nil
+        if p.Payload != nil {
+            o["payload"] = e.pattern(p.Payload)
+        }
+        return o
+    case parser.TuplePattern:
+        o := node("TuplePattern", p.Pos)
+        o["elements"] = e.patterns(p.Elements)
+        return o
+    case parser.NamedTuplePattern:
+        o := node("NamedTuplePattern", p.Pos)
+        entries := make([]interface{}, len(p.Elements))
+        for i, entry := range p.Elements {
+            entries[i] = object{"tag": entry.Tag, "pattern": e.pattern(entry.Pattern)}
+        }
+        o["entries"] = entries
+        return o
+    }
+    e.fail("Unsupported pattern %T", p)
+    return nil
+}
+
+func (e *encoder) types(types []core.IbexType) []interface{} {
+    values := make([]interface{}, len(types))
+    for i, ty := range types {
+        values[i] = e.typ(ty)
+    }
+    return values
+}
+
+// null for none, as the return type of a function without one
+func (e *encoder) typ(ty core.IbexType) interface{} {
+    switch t := ty.(type) {
+    case nil:
+        return nil
+    case core.IbexSimpleType:
+        return object{"kind": "SimpleType", "name": t.Name, "args": e.types(t.Args)}
+    case core.IbexTupleType:
+        return object{"kind": "TupleType", "elements": e.types(t.ElementTypes)}
+    case core.IbexNamedTupleType:
+        entries := make([]interface{}, len(t.Types))
+        for i, entry := range t.Types {
+            entries[i] = object{"name": entry.Name, "type": e.typ(entry.Type)}
+        }
+        return object{"kind": "NamedTupleType", "entries": entries}
+    case core.IbexArrayType:
+        sizes := make([]interface{}, len(t.Sizes))
+        for i, size := range t.Sizes {
+            sizes[i] = size
+        }
+        return object{"kind": "ArrayType", "element": e.typ(t.ElementType), "dimensions": t.Dimensions,
+            "sizes": sizes}
+    case core.IbexFunctionType:
+        return object{"kind": "FunctionType", "argument": e.typ(t.Argument), "return": e.typ(t.Return)}
+    case core.IbexTypeParameter:
+        return object{"kind": "TypeParameter", "name": t.Name}
+    case core.IbexVariantType:
+        cases := make([]interface{}, len(t.Cases))
+        for i, c := range t.Cases {
+            cases[i] = object{"tag": c.Tag, "payload": e.typ(c.Payload)}
+        }
+        return object{"kind": "VariantType", "cases": cases}
+    }
+    e.fail("Unsupported type %T", ty)
+    return nil
+}
@@ -0,0 +1,112 @@
+package dump
+
+import (
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// the width up to which a list is kept on one line
+const sexpWidth = 100
+
+// Sexp gives the document for the tree parsed from file as an
+// S-expression, with the kinds and fields of JSON:
+//     (ibex :version 1 :file "a.ibex" :unit (Unit :comments nil ...))
+// A node is a list of its kind then its fields as :name value, sorted by
+// name with pos first, and a position is (line col). Null is nil, and
+// strings are quoted as in Go. A list too long for a line is broken with
+// an element per line.
+func Sexp(file string, unit *parser.ASTCompilationUnit) (string, error) {
+    doc, err := document(file, unit)
+    if err != nil {
+        return "", err
+    }
+    doc["kind"] = "ibex"
+    return sexp(doc, 0), nil
+}
+
+// v written at column indent
+func sexp(v interface{}, indent int) string {
+    flat := sexpLine(v)
+    if indent + len(flat) <= sexpWidth {
+        return flat
+    }
+    margin := "\n" + strings.Repeat(" ", indent + 1)
+    switch v := v.(type) {
+    case []interface{}:
+        parts := make([]string, len(v))
+        for i, x := range v {
+            parts[i] = sexp(x, indent + 1)
+        }
+        return "(" + strings.Join(parts, margin) + ")"
+    case object:
+        head, keys := sexpFields(v)
+        parts := make([]string, 0, len(keys) + 1)
+        if head != "" {
+            parts = append(parts, head)
+        }
+        for _, k := range keys {
+            field := ":" + k + " "
+            parts = append(parts, field + sexp(sexpValue(k, v[k]), indent + 1 + len(field)))
+        }
+        return "(" + strings.Join(parts, margin) + ")"
+    }
+    return flat
+}
+
+// v on one line
+func sexpLine(v interface{}) string {
+    switch v := v.(type) {
+    case nil:
+        return "nil"
+    case bool:
+        return strconv.FormatBool(v)
+    case int:
+        return strconv.Itoa(v)
+    case string:
+        return strconv.Quote(v)
+    case []interface{}:
+        parts := make([]string, len(v))
+        for i, x := range v {
+            parts[i] = sexpLine(x)
+        }
+        return "(" + strings.Join(parts, " ") + ")"
+    case object:
+        head, keys := sexpFields(v)
+        parts := make([]string, 0, len(keys) + 1)
+        if head != "" {
+            parts = append(parts, head)
+        }
+        for _, k := range keys {
+            parts = append(parts, ":" + k + " " + sexpLine(sexpValue(k, v[k])))
+        }
+        return "(" + strings.Join(parts, " ") + ")"
+    }
+    panic("unexpected value in document")
+}
+
+// the kind of o, empty for an entry, and its other fields in order
+func sexpFields(o object) (string, []string) {
+    head, _ := o["kind"].(string)
+    keys := make([]string, 0, len(o))
+    for k := range o {
+        if k != "kind" && k != "pos" {
+            keys = append(keys, k)
+        }
+    }
+    sort.Strings(keys)
+    if _, ok := o["pos"]; ok {
+        keys = append([]string{"pos"}, keys...)
+    }
+    return head, keys
+}
+
+// the value of the field key, a position as (line col)
+func sexpValue(key string, v interface{}) interface{} {
+    if p, ok := v.(object); ok && key == "pos" {
+        return []interface{}{p["line"], p["col"]}
+    }
+    return v
+}
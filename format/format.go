@@ -0,0 +1,149 @@
+package format
+
+import (
+    "fmt"
+    "reflect"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// Source formats src, the content of file. The result is checked to
+// parse to the same tree with the same comments and to format to
+// itself, so that it is safe to write back.
+func Source(file string, src string) (string, error) {
+    unit, err := parser.ParseFile(file, src)
+    if err != nil {
+        return "", err
+    }
+    formatted, err := printUnit(unit, src)
+    if err != nil {
+        return "", fmt.Errorf("%s: %s", file, err)
+    }
+
+    again, err := parser.ParseFile(file, formatted)
+    if err != nil {
+        return "", fmt.Errorf("%s: formatted source does not parse: %s", file, err)
+    }
+    if !sameTree(reflect.ValueOf(unit.Uses), reflect.ValueOf(again.Uses)) ||
+        !sameTree(reflect.ValueOf(unit.Declarations), reflect.ValueOf(again.Declarations)) {
+        return "", fmt.Errorf("%s: formatting changes the program", file)
+    }
+    if !sameComments(unit.Comments, again.Comments) {
+        return "", fmt.Errorf("%s: formatting loses comments", file)
+    }
+    if twice, _ := printUnit(again, formatted); twice != formatted {
+        return "", fmt.Errorf("%s: formatting is not stable", file)
+    }
+    return formatted, nil
+}
+
+func printUnit(unit *parser.ASTCompilationUnit, src string) (string, error) {
+    p := &printer{src: newSource(src, unit.Comments)}
+    p.unit(unit)
+    return p.b.String(), p.err
+}
+
+// Node gives the source of a tree, parsed or built by hand: a
+// *parser.ASTCompilationUnit, a declaration, a *parser.ASTUseStmt, a
+// *parser.ASTBody, a *parser.MatchArm, an expression or a pattern.
+// Expressions get parentheses only where the precedences of
+// parser/expr.go need them, and blocks are indented below their line.
+// Comments need the source to be placed, see Source. The text ends
+// without a line break, and is an error if some part of the tree cannot
+// be written.
+func Node(node parser.ASTNode) (string, error) {
+    p := &printer{}
+    switch n := node.(type) {
+    case *parser.ASTCompilationUnit:
+        p.unit(n)
+    case *parser.ASTFunction:
+        p.function(n)
+    case *parser.ASTTypeDeclaration:
+        p.typeDecl(n)
+    case *parser.ASTUseStmt:
+        p.line(0, useString(n), 0)
+    case *parser.ASTBody:
+        p.body(n, 0)
+    case *parser.MatchArm:
+        p.arm(n, 0)
+    case parser.WildcardPattern, parser.BindingPattern, parser.LiteralPattern, parser.ConstructorPattern,
+        parser.TuplePattern, parser.NamedTuplePattern:
+        p.line(0, p.pattern(n), 0)
+    default:
+        text, matches := p.exprLine(n)
+        p.line(0, text, 0)
+        p.arms(matches, 1)
+    }
+    if p.err != nil {
+        return "", p.err
+    }
+    return strings.TrimSuffix(p.b.String(), "\n"), nil
+}
+
+// Type gives the source of a type, an error if it cannot be written
+func Type(ty core.IbexType) (string, error) {
+    p := &printer{}
+    text := p.typ(ty)
+    return text, p.err
+}
+
+var posType = reflect.TypeOf(parser.Pos{})
+
+// whether a and b are the same trees but for positions
+func sameTree(a reflect.Value, b reflect.Value) bool {
+    if !a.IsValid() || !b.IsValid() {
+        return a.IsValid() == b.IsValid()
+    }
+    if a.Type() != b.Type() {
+        return false
+    }
+    switch a.Kind() {
+    case reflect.Ptr, reflect.Interface:
+        if a.IsNil() || b.IsNil() {
+            return a.IsNil() == b.IsNil()
+        }
+        return sameTree(a.Elem(), b.Elem())
+    case reflect.Struct:
+        if a.Type() == posType {
+            return true
+        }
+        for i := 0; i < a.NumField(); i++ {
+            if !sameTree(a.Field(i), b.Field(i)) {
+                return false
+            }
+        }
+        return true
+    case reflect.Slice:
+        // nil and empty alike
+        if a.Len() != b.Len() {
+            return false
+        }
+        for i := 0; i < a.Len(); i++ {
+            if !sameTree(a.Index(i), b.Index(i)) {
+                return false
+            }
+        }
+        return true
+    case reflect.String:
+        return a.String() == b.String()
+    case reflect.Bool:
+        return a.Bool() == b.Bool()
+    case reflect.Int:
+        return a.Int() == b.Int()
+    }
+    panic("unexpected " + a.Kind().String() + " in tree")
+}
+
+func sameComments(a []*parser.Comment, b []*parser.Comment) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i].Text != b[i].Text {
+            return false
+        }
+    }
+    return true
+}
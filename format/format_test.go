@@ -0,0 +1,278 @@
+package format
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/core"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+func TestSource(t *testing.T) {
+	src := `// shapes and their areas
+use   util::{double,  half as h}
+type Shape = Circle(r:Int)|Square ( side : Int )
+type Unit = | Unit
+
+
+fn area  s :Shape->Int   // in square units
+    match s
+        Circle (r: r) =>    r*r*3
+        Square (side: a) =>
+            a*a
+        Unit =>
+            // nothing to measure
+            0
+fn main->  (Int,?Int)
+    ((Circle (r:2)->area) ,  None)
+// the end`
+	expected := `// shapes and their areas
+use util::{double, half as h}
+type Shape = Circle (r: Int) | Square (side: Int)
+type Unit = | Unit
+
+fn area s: Shape -> Int // in square units
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a
+        Unit =>
+            // nothing to measure
+            0
+fn main -> (Int, ?Int)
+    (Circle (r: 2) -> area, None)
+// the end
+`
+	formatted, err := Source("shapes.ibex", src)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, formatted)
+
+	again, err := Source("shapes.ibex", formatted)
+	assert.Nil(t, err)
+	assert.Equal(t, formatted, again)
+}
+
+// expressions come back with the parentheses their meaning needs only
+func TestSourceParentheses(t *testing.T) {
+	for _, c := range []struct {
+		src string
+		expected string
+	}{
+		{"(1 + 2) + 3", "1 + 2 + 3"},
+		{"1 + (2 + 3)", "1 + (2 + 3)"},
+		{"(1 * 2) + (3 % 4)", "1 * 2 + 3 % 4"},
+		{"(1 - 2) * 3", "(1 - 2) * 3"},
+		{"(-x) + 1", "(-x) + 1"},
+		{"1 + (-x)", "1 + -x"},
+		{"-(x + 1)", "-x + 1"},
+		{"(!x) -> f", "(!x) -> f"},
+		{"(x -> f) -> g", "x -> f -> g"},
+		{"x -> (f -> g)", "x -> (f -> g)"},
+		{"(a ? b) ? c", "(a ? b) ? c"},
+		{"a ? (b ? c)", "a ? b ? c"},
+		{"(a -> f) ? 0", "a -> f ? 0"},
+		{"(xs[0])!", "xs[0]!"},
+		{"(a + b)[1, 2]", "(a + b)[1][2]"},
+		{"(x!)[0]", "x![0]"},
+		{"Some ((1, 2))", "Some (1, 2)"},
+		{"[(1), (a: 2, b: [])]", "[1, (a: 2, b: [])]"},
+	} {
+		formatted, err := Source("e.ibex", "fn f -> Int\n    " + c.src)
+		assert.Nil(t, err, c.src)
+		assert.Equal(t, "fn f -> Int\n    " + c.expected + "\n", formatted, c.src)
+	}
+}
+
+func TestSourceWrapping(t *testing.T) {
+	long := strings.Repeat("x + ", 24) + "x"
+	src := "type Digit = Zero | One | Two | Three | Four | Five | Six | Seven | Eight | Nine | Ten | Eleven | Twelve\n" +
+		"fn f x: Int -> Int\n    match x\n        0 => " + long + "\n        _ =>\n            1\n" +
+		"type Pair =\n    | Left\n    | Right // the other one"
+	expected := `type Digit =
+    | Zero
+    | One
+    | Two
+    | Three
+    | Four
+    | Five
+    | Six
+    | Seven
+    | Eight
+    | Nine
+    | Ten
+    | Eleven
+    | Twelve
+fn f x: Int -> Int
+    match x
+        0 =>
+            ` + long + `
+        _ => 1
+type Pair =
+    | Left
+    | Right // the other one
+`
+	formatted, err := Source("w.ibex", src)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, formatted)
+
+	again, err := Source("w.ibex", formatted)
+	assert.Nil(t, err)
+	assert.Equal(t, formatted, again)
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("bad.ibex", "fn f -> Int\n    (1")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "bad.ibex:2")
+
+	// lines nothing parses are errors rather than left out of the output
+	for src, msg := range map[string]string{
+		"type Shape = Circle (r: Int)\n    | Square (side: Int)\nfn main -> Int\n    1":
+			"Error at bad.ibex:2:1...5: Unexpected indentation",
+		"fn main -> Int\n    1\n        2\nfn other -> Int\n    3":
+			"Error at bad.ibex:3:1...9: Unexpected indentation",
+		"fn main -> Int\n    match 1\n        1 => 5\n            6\n        _ => 0":
+			"Error at bad.ibex:4:1...13: Unexpected indentation",
+		"zz qq\nfn main -> Int\n    1":
+			"Error at bad.ibex:1:1...3: Expected 'fn', 'type' or 'use'",
+		"fn main = 1":
+			"Error at bad.ibex:1:9...10: Unexpected token",
+	} {
+		_, err := Source("bad.ibex", src)
+		assert.EqualError(t, err, msg, src)
+	}
+}
+
+func ident(name string) parser.IdentExpr {
+	return parser.IdentExpr{Ident: name}
+}
+
+func num(n string) parser.NumberExpr {
+	return parser.NumberExpr{Number: n}
+}
+
+// trees built by hand print as source parsing back to them
+func TestNodeExpressions(t *testing.T) {
+	match := parser.MatchExpr{Subject: ident("x"), Arms: []*parser.MatchArm{
+		{Pattern: parser.ConstructorPattern{Tag: "Some", Payload: parser.BindingPattern{Name: "y"}},
+			Body: &parser.ASTBody{Children: []parser.ASTNode{ident("y")}}},
+		{Pattern: parser.LiteralPattern{Literal: parser.NegateExpr{Expr: num("1")}},
+			Body: &parser.ASTBody{Children: []parser.ASTNode{num("1"), num("2")}}},
+		{Pattern: parser.NamedTuplePattern{Elements: []*parser.NamedTuplePatternEntry{
+			{Tag: "a", Pattern: parser.TuplePattern{Elements: []parser.Pattern{parser.WildcardPattern{},
+				parser.LiteralPattern{Literal: parser.StringExpr{String: "s"}}}}}}},
+			Body: &parser.ASTBody{Children: []parser.ASTNode{num("0")}}},
+	}}
+	for _, c := range []struct {
+		expr parser.Expression
+		expected string
+	}{
+		{parser.AddExpr{Left: parser.NegateExpr{Expr: ident("x")}, Right: num("1")}, "(-x) + 1"},
+		{parser.AddExpr{Left: num("1"), Right: parser.NegateExpr{Expr: ident("x")}}, "1 + -x"},
+		{parser.MulExpr{Left: parser.AddExpr{Left: num("1"), Right: num("2")},
+			Right: parser.SubExpr{Left: num("3"), Right: num("4")}}, "(1 + 2) * (3 - 4)"},
+		{parser.SubExpr{Left: num("1"), Right: parser.SubExpr{Left: num("2"), Right: num("3")}}, "1 - (2 - 3)"},
+		{parser.ModExpr{Left: parser.DivExpr{Left: ident("a"), Right: ident("b")}, Right: ident("c")}, "a / b % c"},
+		{parser.FunctionCallExpr{Input: parser.TupleExpr{Elements: []parser.Expression{num("1"), num("2")}},
+			Target: ident("f")}, "(1, 2) -> f"},
+		{parser.DefaultExpr{
+			Expr: parser.UnsafeAccessExpr{Expr: parser.ArrayAccessExpr{Target: ident("xs"), Index: num("0")}},
+			Default: parser.DefaultExpr{Expr: ident("y"), Default: num("0")}}, "xs[0]! ? y ? 0"},
+		{parser.NotExpr{Expr: parser.FunctionCallExpr{Input: ident("x"), Target: ident("f")}}, "!x -> f"},
+		{parser.ArrayExpr{Elements: []parser.Expression{
+			parser.NamedTupleExpr{Elements: []*parser.NamedTupleEntry{{Tag: "a", Expr: parser.StringExpr{String: "hi"}}}},
+			parser.ConstructorExpr{Tag: "Some", Payload: num("1")},
+			parser.ConstructorExpr{Tag: "Pair", Payload: parser.TupleExpr{Elements: []parser.Expression{num("1"), num("2")}}},
+			parser.ConstructorExpr{Tag: "None"},
+			parser.TupleExpr{Elements: []parser.Expression{}},
+		}}, `[(a: "hi"), Some 1, Pair (1, 2), None, ()]`},
+		{parser.AddExpr{Left: match, Right: num("1")}, `(match x) + 1
+    Some y => y
+    -1 =>
+        1
+        2
+    (a: (_, "s")) => 0`},
+	} {
+		text, err := Node(c.expr)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, text)
+
+		body, err := parser.ParseBody("e.ibex", text)
+		assert.Nil(t, err, text)
+		assert.True(t, sameTree(reflect.ValueOf(c.expr), reflect.ValueOf(body.Children[0])), text)
+	}
+}
+
+func TestNodeDeclarations(t *testing.T) {
+	intType := core.IbexSimpleType{Name: "Int"}
+	unit := &parser.ASTCompilationUnit{
+		Uses: []*parser.ASTUseStmt{{Path: []string{"a", "b"}, Alias: "c"}},
+		Declarations: []parser.ASTMemberDeclaration{
+			&parser.ASTTypeDeclaration{Public: true, Name: "List", Params: []string{"T"},
+				Type: core.IbexVariantType{Cases: []*core.IbexVariantCase{
+					{Tag: "Cons", Payload: core.IbexNamedTupleType{Types: []*core.IbexNamedTupleEntry{
+						{Name: "head", Type: core.IbexSimpleType{Name: "T"}},
+						{Name: "tail", Type: core.IbexSimpleType{Name: "List", Args: []core.IbexType{core.IbexSimpleType{Name: "T"}}}},
+					}}},
+					{Tag: "Nil"},
+				}}},
+			&parser.ASTTypeDeclaration{Name: "Grid", Type: core.NewArrayType(core.IbexSimpleType{Name: "Option",
+				Args: []core.IbexType{intType}}, []int{2, 0})},
+			&parser.ASTFunction{Name: "apply",
+				Parameters: []*parser.FunctionParameter{{Name: "f", Type: core.IbexFunctionType{Argument: intType}}},
+				Return: intType,
+				Body: &parser.ASTBody{Children: []parser.ASTNode{num("1")}}},
+			&parser.ASTFunction{Name: "extern", TypeParams: []string{"T"},
+				Parameters: []*parser.FunctionParameter{
+					{Name: "x", Type: core.IbexSimpleType{Name: "T"}},
+					{Name: "f", Type: core.IbexFunctionType{Argument: core.IbexTupleType{}, Return: intType}},
+				}},
+		},
+	}
+	text, err := Node(unit)
+	assert.Nil(t, err)
+	assert.Equal(t, `use a::b as c
+
+pub type List[T] = Cons (head: T, tail: List[T]) | Nil
+
+type Grid = [2][]?Int
+
+fn apply (f: fn Int) -> Int
+    1
+
+fn extern[T] (x: T, f: fn () -> Int)`, text)
+
+	parsed, err := parser.ParseFile("d.ibex", text)
+	assert.Nil(t, err)
+	assert.True(t, sameTree(reflect.ValueOf(unit.Declarations), reflect.ValueOf(parsed.Declarations)))
+	assert.True(t, sameTree(reflect.ValueOf(unit.Uses), reflect.ValueOf(parsed.Uses)))
+
+	ty, err := Type(core.IbexFunctionType{Argument: core.IbexTypeParameter{Name: "T"},
+		Return: core.IbexFunctionType{Argument: intType}})
+	assert.Nil(t, err)
+	assert.Equal(t, "fn T -> fn Int", ty)
+}
+
+func TestNodeErrors(t *testing.T) {
+	match := parser.MatchExpr{Subject: ident("x"), Arms: []*parser.MatchArm{
+		{Pattern: parser.WildcardPattern{}, Body: &parser.ASTBody{Children: []parser.ASTNode{num("1")}}}}}
+	for _, c := range []struct {
+		node parser.ASTNode
+		message string
+	}{
+		{parser.TupleExpr{Elements: []parser.Expression{num("1")}}, "A tuple of one element cannot be written"},
+		{parser.TupleExpr{Elements: []parser.Expression{match, match}}, "Only one match can have its arms below a line"},
+		{parser.StringExpr{String: "say \"hi\""}, "A string with a quote or a line break cannot be written"},
+		{parser.ASTBody{}, "Unsupported expression parser.ASTBody"},
+		{parser.LiteralPattern{Literal: ident("x")}, "Unsupported literal pattern parser.IdentExpr"},
+		{&parser.ASTFunction{Name: "f", Body: &parser.ASTBody{}}, "fn f has an empty body"},
+		{&parser.ASTTypeDeclaration{Name: "F", Type: core.IbexFunctionType{
+			Argument: core.IbexFunctionType{Argument: core.IbexTupleType{}},
+			Return: core.IbexTupleType{}}},
+			"A fn type taking a fn type without a return type cannot be written"},
+	} {
+		_, err := Node(c.node)
+		assert.EqualError(t, err, c.message)
+	}
+}
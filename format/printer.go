@@ -0,0 +1,580 @@
+package format
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// lines longer than this are wrapped where the syntax allows it: the
+// body of a match arm and the cases of a variant type move to a block
+// below
+const lineWidth = 100
+
+type printer struct {
+    b strings.Builder
+    src *source // nil when printing a tree without its source
+    open bool // nothing was printed in the current block yet
+    pending []parser.MatchExpr // whose arms follow the line being printed
+    err error // the first part of the tree that cannot be written
+}
+
+func (p *printer) fail(format string, args ...interface{}) {
+    if p.err == nil {
+        p.err = fmt.Errorf(format, args...)
+    }
+}
+
+// the source a tree was parsed from, walked line by line as the printer
+// reaches the code of each line to put back comments and blank lines
+type source struct {
+    code []int // numbers of the lines with code, in order
+    text map[int]string // code of those lines, without the comment
+    comments []*parser.Comment
+    next int // index into code
+    comment int // index into comments
+    last int // number of the last line printed
+}
+
+func newSource(src string, comments []*parser.Comment) *source {
+    s := &source{text: make(map[int]string), comments: comments}
+    for i, line := range strings.Split(src, "\n") {
+        if at := parser.CommentStart(line); at >= 0 {
+            line = line[:at]
+        }
+        if line = strings.TrimSpace(line); line != "" {
+            s.code = append(s.code, i + 1)
+            s.text[i + 1] = line
+        }
+    }
+    return s
+}
+
+// the number of the next line with code, taking it if take, 0 if there
+// is none or no source
+func (s *source) line(take bool) int {
+    if s == nil || s.next >= len(s.code) {
+        return 0
+    }
+    n := s.code[s.next]
+    if take {
+        s.next++
+    }
+    return n
+}
+
+// the number of the line with code k lines after the next one
+func (s *source) ahead(k int) int {
+    if s == nil || s.next + k >= len(s.code) {
+        return 0
+    }
+    return s.code[s.next + k]
+}
+
+// whether any comment is on the lines from to to
+func (s *source) commented(from int, to int) bool {
+    if s == nil {
+        return false
+    }
+    for _, c := range s.comments[s.comment:] {
+        if c.Pos.Line >= from && c.Pos.Line <= to {
+            return true
+        }
+    }
+    return false
+}
+
+func (s *source) formedAsBlock(line int) bool {
+    return s != nil && (strings.HasSuffix(s.text[line], "=>") || strings.HasSuffix(s.text[line], "="))
+}
+
+// writes text at indent as the code of source line n, 0 if it has none,
+// after the comments above it
+func (p *printer) line(indent int, text string, n int) {
+    if n > 0 {
+        for p.src.comment < len(p.src.comments) {
+            c := p.src.comments[p.src.comment]
+            if c.Pos.Line >= n {
+                break
+            }
+            p.write(indent, c.Text, c.Pos.Line)
+            p.src.comment++
+        }
+        if p.src.comment < len(p.src.comments) && p.src.comments[p.src.comment].Pos.Line == n {
+            text += " " + p.src.comments[p.src.comment].Text
+            p.src.comment++
+        }
+    }
+    p.write(indent, text, n)
+}
+
+// keeps one blank line of those above source line n
+func (p *printer) write(indent int, text string, n int) {
+    if n > 0 {
+        if n > p.src.last + 1 && p.src.last > 0 && !p.open {
+            p.b.WriteString("\n")
+        }
+        p.src.last = n
+    }
+    p.open = false
+    p.b.WriteString(strings.Repeat(" ", indent * parser.IndentWidth) + text + "\n")
+}
+
+// the comments left after the last line with code
+func (p *printer) flush() {
+    if p.src == nil {
+        return
+    }
+    for _, c := range p.src.comments[p.src.comment:] {
+        p.write(0, c.Text, c.Pos.Line)
+    }
+    p.src.comment = len(p.src.comments)
+}
+
+func fits(indent int, text string) bool {
+    return indent * parser.IndentWidth + len(text) <= lineWidth
+}
+
+func (p *printer) unit(unit *parser.ASTCompilationUnit) {
+    // uses may come between declarations
+    type item struct {
+        line int
+        node parser.ASTNode
+    }
+    items := make([]item, 0, len(unit.Uses) + len(unit.Declarations))
+    for _, use := range unit.Uses {
+        items = append(items, item{use.Pos.Line, use})
+    }
+    for _, d := range unit.Declarations {
+        switch d := d.(type) {
+        case *parser.ASTFunction:
+            items = append(items, item{d.Pos.Line, d})
+        case *parser.ASTTypeDeclaration:
+            items = append(items, item{d.Pos.Line, d})
+        }
+    }
+    sort.SliceStable(items, func(i, j int) bool { return items[i].line < items[j].line })
+
+    for i, it := range items {
+        // without the source to tell, declarations are set apart
+        if _, use := it.node.(*parser.ASTUseStmt); p.src == nil && i > 0 && !use {
+            p.b.WriteString("\n")
+        }
+        switch n := it.node.(type) {
+        case *parser.ASTUseStmt:
+            p.line(0, useString(n), p.src.line(true))
+        case *parser.ASTFunction:
+            p.function(n)
+        case *parser.ASTTypeDeclaration:
+            p.typeDecl(n)
+        }
+    }
+    p.flush()
+}
+
+func useString(use *parser.ASTUseStmt) string {
+    text := "use " + strings.Join(use.Path, "::")
+    switch {
+    case use.Glob:
+        text += "::*"
+    case use.Items != nil:
+        items := make([]string, len(use.Items))
+        for i, item := range use.Items {
+            items[i] = item.Name
+            if item.Alias != item.Name {
+                items[i] += " as " + item.Alias
+            }
+        }
+        text += "::{" + strings.Join(items, ", ") + "}"
+    case use.Alias != use.Path[len(use.Path) - 1]:
+        text += " as " + use.Alias
+    }
+    return text
+}
+
+func typeParams(params []string) string {
+    if len(params) == 0 {
+        return ""
+    }
+    return "[" + strings.Join(params, ", ") + "]"
+}
+
+func (p *printer) signature(fn *parser.ASTFunction) string {
+    text := "fn " + fn.Name + typeParams(fn.TypeParams)
+    if fn.Public {
+        text = "pub " + text
+    }
+    params := make([]string, len(fn.Parameters))
+    for i, param := range fn.Parameters {
+        params[i] = param.Name + ": " + p.typ(param.Type)
+    }
+    switch {
+    case len(params) == 0:
+    // the return type would be taken for that of a parameter of type fn T
+    case len(params) == 1 && !(fn.Return != nil && dangles(fn.Parameters[0].Type)):
+        text += " " + params[0]
+    default:
+        text += " (" + strings.Join(params, ", ") + ")"
+    }
+    if fn.Return != nil {
+        text += " -> " + p.typ(fn.Return)
+    }
+    return text
+}
+
+func (p *printer) function(fn *parser.ASTFunction) {
+    p.line(0, p.signature(fn), p.src.line(true))
+    if fn.Body != nil && len(fn.Body.Children) == 0 {
+        p.fail("fn %s has an empty body", fn.Name)
+    }
+    if fn.Body != nil {
+        p.body(fn.Body, 1)
+    }
+}
+
+func (p *printer) body(body *parser.ASTBody, indent int) {
+    p.open = true
+    for _, child := range body.Children {
+        n := p.src.line(true)
+        text, matches := p.exprLine(child)
+        p.line(indent, text, n)
+        p.arms(matches, indent + 1)
+    }
+}
+
+// the text of an expression filling a line, and the matches whose arms
+// follow it
+func (p *printer) exprLine(e parser.Expression) (string, []parser.MatchExpr) {
+    saved := p.pending
+    p.pending = nil
+    text := p.expr(e, 0, true)
+    matches := p.pending
+    p.pending = saved
+    if len(matches) > 1 {
+        p.fail("Only one match can have its arms below a line")
+    }
+    return text, matches
+}
+
+func (p *printer) arms(matches []parser.MatchExpr, indent int) {
+    for _, m := range matches {
+        p.open = true
+        if len(m.Arms) == 0 {
+            p.fail("A match without arms cannot be written")
+        }
+        for _, arm := range m.Arms {
+            p.arm(arm, indent)
+        }
+    }
+}
+
+// an arm with a single expression goes on one line when it fits, and
+// when the source gave it a block, no comment is in the way
+func (p *printer) arm(arm *parser.MatchArm, indent int) {
+    n := p.src.line(true)
+    head := p.pattern(arm.Pattern) + " =>"
+    block := p.src.formedAsBlock(n)
+    if len(arm.Body.Children) == 0 {
+        p.fail("A match arm with an empty body cannot be written")
+    }
+
+    if len(arm.Body.Children) == 1 && !(block && p.src.commented(n + 1, p.src.line(false))) {
+        text, matches := p.exprLine(arm.Body.Children[0])
+        if fits(indent, head + " " + text) {
+            p.line(indent, head + " " + text, n)
+            if block {
+                p.src.last = p.src.line(true)
+            }
+            p.arms(matches, indent + 1)
+            return
+        }
+        if !block {
+            p.line(indent, head, n)
+            p.open = true
+            p.line(indent + 1, text, 0)
+            p.arms(matches, indent + 2)
+            return
+        }
+    }
+    p.line(indent, head, n)
+    p.body(arm.Body, indent + 1)
+}
+
+// the cases of a variant go on one line when they fit, and when the
+// source gave them a block, no comment is in the way
+func (p *printer) typeDecl(d *parser.ASTTypeDeclaration) {
+    n := p.src.line(true)
+    head := "type " + d.Name + typeParams(d.Params) + " ="
+    if d.Public {
+        head = "pub " + head
+    }
+    variant, ok := d.Type.(core.IbexVariantType)
+    if !ok {
+        p.line(0, head + " " + p.typ(d.Type), n)
+        return
+    }
+
+    block := p.src.formedAsBlock(n)
+    if len(variant.Cases) == 0 {
+        p.fail("type %s has no cases", d.Name)
+    }
+    cases := make([]string, len(variant.Cases))
+    for i, c := range variant.Cases {
+        cases[i] = p.variantCase(c)
+    }
+    text := head + " " + strings.Join(cases, " | ")
+    // a lone tag would be taken for an alias
+    if len(cases) == 1 && variant.Cases[0].Payload == nil {
+        text = head + " | " + cases[0]
+    }
+    if fits(0, text) && !(block && p.src.commented(n + 1, p.src.ahead(len(cases) - 1))) {
+        p.line(0, text, n)
+        if block {
+            for range cases {
+                p.src.last = p.src.line(true)
+            }
+        }
+        return
+    }
+
+    p.line(0, head, n)
+    p.open = true
+    for _, c := range cases {
+        m := 0
+        if block {
+            m = p.src.line(true)
+        }
+        p.line(1, "| " + c, m)
+    }
+}
+
+func (p *printer) variantCase(c *core.IbexVariantCase) string {
+    if c.Payload == nil {
+        return c.Tag
+    }
+    return c.Tag + " " + p.typ(c.Payload)
+}
+
+func (p *printer) typ(ty core.IbexType) string {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        if t.Name == "Option" && len(t.Args) == 1 {
+            return "?" + p.typ(t.Args[0])
+        }
+        if len(t.Args) == 0 {
+            return t.Name
+        }
+        return t.Name + "[" + p.typeList(t.Args) + "]"
+    case core.IbexTupleType:
+        return "(" + p.typeList(t.ElementTypes) + ")"
+    case core.IbexNamedTupleType:
+        entries := make([]string, len(t.Types))
+        for i, entry := range t.Types {
+            entries[i] = entry.Name + ": " + p.typ(entry.Type)
+        }
+        return "(" + strings.Join(entries, ", ") + ")"
+    case core.IbexArrayType:
+        dims := ""
+        for i := 0; i < t.Dimensions; i++ {
+            if size := t.Size(i); size > 0 {
+                dims += "[" + strconv.Itoa(size) + "]"
+            } else {
+                dims += "[]"
+            }
+        }
+        return dims + p.typ(t.ElementType)
+    case core.IbexFunctionType:
+        if t.Return == nil {
+            return "fn " + p.typ(t.Argument)
+        }
+        if dangles(t.Argument) {
+            p.fail("A fn type taking a fn type without a return type cannot be written")
+        }
+        return "fn " + p.typ(t.Argument) + " -> " + p.typ(t.Return)
+    case core.IbexTypeParameter:
+        return t.Name
+    case core.IbexVariantType:
+        cases := make([]string, len(t.Cases))
+        for i, c := range t.Cases {
+            cases[i] = p.variantCase(c)
+        }
+        return strings.Join(cases, " | ")
+    }
+    p.fail("Unsupported type %T", ty)
+    return ""
+}
+
+// whether the text of ty ends in a fn type without a return type, which
+// would take a following -> as its own
+func dangles(ty core.IbexType) bool {
+    switch t := ty.(type) {
+    case core.IbexFunctionType:
+        return t.Return == nil || dangles(t.Return)
+    case core.IbexArrayType:
+        return dangles(t.ElementType)
+    case core.IbexSimpleType:
+        return t.Name == "Option" && len(t.Args) == 1 && dangles(t.Args[0])
+    }
+    return false
+}
+
+func (p *printer) typeList(types []core.IbexType) string {
+    elems := make([]string, len(types))
+    for i, ty := range types {
+        elems[i] = p.typ(ty)
+    }
+    return strings.Join(elems, ", ")
+}
+
+// the text of e where the context needs precedence prec, see
+// parser/expr.go, to do without parentheses. last is whether nothing but
+// a closing delimiter or the end of the line follows e: ! and - take
+// all of the expression after them, and match all of the line.
+func (p *printer) expr(e parser.Expression, prec int, last bool) string {
+    switch e := e.(type) {
+    case parser.IdentExpr:
+        return e.Ident
+    case parser.StringExpr:
+        if strings.ContainsAny(e.String, "\"\n") {
+            p.fail("A string with a quote or a line break cannot be written")
+        }
+        return "\"" + e.String + "\""
+    case parser.NumberExpr:
+        return e.Number
+    case parser.TupleExpr:
+        if len(e.Elements) == 1 {
+            p.fail("A tuple of one element cannot be written")
+        }
+        return "(" + p.exprList(e.Elements) + ")"
+    case parser.NamedTupleExpr:
+        entries := make([]string, len(e.Elements))
+        for i, entry := range e.Elements {
+            entries[i] = entry.Tag + ": " + p.expr(entry.Expr, 0, true)
+        }
+        return "(" + strings.Join(entries, ", ") + ")"
+    case parser.ArrayExpr:
+        return "[" + p.exprList(e.Elements) + "]"
+    case parser.ConstructorExpr:
+        switch e.Payload.(type) {
+        case nil:
+            return e.Tag
+        case parser.TupleExpr, parser.NamedTupleExpr, parser.IdentExpr, parser.NumberExpr,
+            parser.StringExpr, parser.ArrayExpr:
+            return e.Tag + " " + p.expr(e.Payload, 0, true)
+        }
+        return e.Tag + " (" + p.expr(e.Payload, 0, true) + ")"
+
+    case parser.UnsafeAccessExpr:
+        return p.expr(e.Expr, parser.PostfixPrecedence, false) + "!"
+    case parser.ArrayAccessExpr:
+        return p.expr(e.Target, parser.PostfixPrecedence, false) + "[" + p.expr(e.Index, 0, true) + "]"
+
+    case parser.NotExpr:
+        return p.prefix("!", e.Expr, e, last)
+    case parser.NegateExpr:
+        return p.prefix("-", e.Expr, e, last)
+    case parser.MatchExpr:
+        if !last {
+            return "(" + p.expr(e, 0, true) + ")"
+        }
+        p.pending = append(p.pending, e)
+        return "match " + p.expr(e.Subject, 0, true)
+
+    case parser.AddExpr:
+        return p.infix(e, e.Left, " + ", e.Right, parser.AdditivePrecedence, prec, last)
+    case parser.SubExpr:
+        return p.infix(e, e.Left, " - ", e.Right, parser.AdditivePrecedence, prec, last)
+    case parser.MulExpr:
+        return p.infix(e, e.Left, " * ", e.Right, parser.MultiplicativePrecedence, prec, last)
+    case parser.DivExpr:
+        return p.infix(e, e.Left, " / ", e.Right, parser.MultiplicativePrecedence, prec, last)
+    case parser.ModExpr:
+        return p.infix(e, e.Left, " % ", e.Right, parser.MultiplicativePrecedence, prec, last)
+    case parser.FunctionCallExpr:
+        return p.infix(e, e.Input, " -> ", e.Target, parser.FunctionCallPrecedence, prec, last)
+    case parser.DefaultExpr:
+        // right associative
+        if parser.DefaultPrecedence < prec {
+            return "(" + p.expr(e, 0, true) + ")"
+        }
+        return p.expr(e.Expr, parser.DefaultPrecedence + 1, false) + " ? " +
+            p.expr(e.Default, parser.DefaultPrecedence, last)
+    }
+    p.fail("Unsupported expression %T", e)
+    return ""
+}
+
+func (p *printer) exprList(exprs []parser.Expression) string {
+    elems := make([]string, len(exprs))
+    for i, e := range exprs {
+        elems[i] = p.expr(e, 0, true)
+    }
+    return strings.Join(elems, ", ")
+}
+
+func (p *printer) prefix(op string, operand parser.Expression, e parser.Expression, last bool) string {
+    if !last {
+        return "(" + p.expr(e, 0, true) + ")"
+    }
+    return op + p.expr(operand, 0, true)
+}
+
+// a left associative operator of precedence level
+func (p *printer) infix(e parser.Expression, left parser.Expression, op string, right parser.Expression,
+    level int, prec int, last bool) string {
+
+    if level < prec {
+        return "(" + p.expr(e, 0, true) + ")"
+    }
+    return p.expr(left, level, false) + op + p.expr(right, level + 1, last)
+}
+
+func (p *printer) pattern(pat parser.Pattern) string {
+    switch pat := pat.(type) {
+    case parser.WildcardPattern:
+        return "_"
+    case parser.BindingPattern:
+        return pat.Name
+    case parser.LiteralPattern:
+        switch lit := pat.Literal.(type) {
+        case parser.NumberExpr, parser.StringExpr:
+            return p.expr(lit, 0, true)
+        case parser.NegateExpr:
+            if _, ok := lit.Expr.(parser.NumberExpr); ok {
+                return p.expr(lit, 0, true)
+            }
+        }
+        p.fail("Unsupported literal pattern %T", pat.Literal)
+        return ""
+    case parser.ConstructorPattern:
+        switch pat.Payload.(type) {
+        case nil:
+            return pat.Tag
+        case parser.TuplePattern, parser.NamedTuplePattern, parser.WildcardPattern,
+            parser.BindingPattern, parser.LiteralPattern:
+            return pat.Tag + " " + p.pattern(pat.Payload)
+        }
+        return pat.Tag + " (" + p.pattern(pat.Payload) + ")"
+    case parser.TuplePattern:
+        if len(pat.Elements) == 1 {
+            p.fail("A tuple pattern of one element cannot be written")
+        }
+        elems := make([]string, len(pat.Elements))
+        for i, elem := range pat.Elements {
+            elems[i] = p.pattern(elem)
+        }
+        return "(" + strings.Join(elems, ", ") + ")"
+    case parser.NamedTuplePattern:
+        entries := make([]string, len(pat.Elements))
+        for i, entry := range pat.Elements {
+            entries[i] = entry.Tag + ": " + p.pattern(entry.Pattern)
+        }
+        return "(" + strings.Join(entries, ", ") + ")"
+    }
+    p.fail("Unsupported pattern %T", pat)
+    return ""
+}
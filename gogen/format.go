@@ -0,0 +1,160 @@
+package gogen
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// the name of the function checking the operands of op, generated on
+// first use. Traps panic with their message and position.
+func (p *pkg) helper(op ir.Op) string {
+    name := map[ir.Op]string{ir.OpDiv: "ibexDiv", ir.OpMod: "ibexMod", ir.OpIndex: "ibexCheckIndex"}[op]
+    if p.helpers[name] {
+        return name
+    }
+    p.helpers[name] = true
+    switch op {
+    case ir.OpDiv, ir.OpMod:
+        fmt.Fprintf(&p.extra, `func %s(x, y int64, pos string) int64 {
+	if y == 0 {
+		panic("Division by zero at " + pos)
+	}
+	return x %s y
+}
+
+`, name, map[ir.Op]string{ir.OpDiv: "/", ir.OpMod: "%"}[op])
+    case ir.OpIndex:
+        fmt.Fprintf(&p.extra, `func %s(i int64, n int, pos string) {
+	if i < 0 || i >= int64(n) {
+		panic(%s.Sprintf("Index %%d is out of range for an array of length %%d at %%s", i, n, pos))
+	}
+}
+
+`, name, p.std("fmt"))
+    }
+    return name
+}
+
+// the name of a function formatting a value of type ty like
+// interp.Format, generated on first use
+func (p *pkg) formatter(ty core.IbexType) string {
+    key := core.TypeString(ty)
+    if name, ok := p.formatters[key]; ok {
+        return name
+    }
+    name := fmt.Sprintf("format%d", p.counts["format"])
+    p.counts["format"]++
+    p.formatters[key] = name
+
+    var body strings.Builder
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        switch t.Name {
+        case "Int":
+            fmt.Fprintf(&body, "\treturn %s.FormatInt(v0, 10)\n", p.std("strconv"))
+        case "F64":
+            fmt.Fprintf(&body, "\treturn %s.Sprint(v0)\n", p.std("fmt"))
+        case "Bool":
+            fmt.Fprintf(&body, "\treturn %s.FormatBool(v0)\n", p.std("strconv"))
+        case "String":
+            fmt.Fprintf(&body, "\treturn %s.Quote(v0)\n", p.std("strconv"))
+        default:
+            cases := p.g.info.Cases(t)
+            body.WriteString("\tswitch v0.Tag {\n")
+            for i, cs := range cases {
+                if i == len(cases) - 1 {
+                    body.WriteString("\tdefault:\n")
+                } else {
+                    fmt.Fprintf(&body, "\tcase %d:\n", i)
+                }
+                switch cs.Payload.(type) {
+                case nil:
+                    fmt.Fprintf(&body, "\t\treturn %s\n", strconv.Quote(cs.Tag))
+                case core.IbexTupleType, core.IbexNamedTupleType:
+                    fmt.Fprintf(&body, "\t\treturn %s + %s(v0.Payload.(%s))\n", strconv.Quote(cs.Tag + " "),
+                        p.formatter(cs.Payload), p.goType(cs.Payload))
+                default:
+                    fmt.Fprintf(&body, "\t\treturn %s + %s(v0.Payload.(%s)) + \")\"\n", strconv.Quote(cs.Tag + " ("),
+                        p.formatter(cs.Payload), p.goType(cs.Payload))
+                }
+            }
+            body.WriteString("\t}\n")
+        }
+    case core.IbexTupleType:
+        parts := make([]string, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            parts[i] = fmt.Sprintf("%s(v0.F%d)", p.formatter(elem), i)
+        }
+        fmt.Fprintf(&body, "\treturn \"(\" + %s\")\"\n", joinParts(parts, `", "`))
+    case core.IbexNamedTupleType:
+        parts := make([]string, len(t.Types))
+        for i, entry := range t.Types {
+            label := entry.Name + ": "
+            if i > 0 {
+                label = ", " + label
+            }
+            parts[i] = fmt.Sprintf("%s + %s(v0.%s)", strconv.Quote(label), p.formatter(entry.Type), exportedName(entry.Name))
+        }
+        fmt.Fprintf(&body, "\treturn \"(\" + %s\")\"\n", joinParts(parts, ""))
+    case core.IbexArrayType:
+        fmt.Fprintf(&body, `	v1 := make([]string, len(v0))
+	for v2, v3 := range v0 {
+		v1[v2] = %s(v3)
+	}
+	return "[" + %s.Join(v1, ", ") + "]"
+`, p.formatter(t.Elem()), p.std("strings"))
+    case core.IbexFunctionType:
+        // functions only compare by their code pointers
+        reflect := p.std("reflect")
+        fmt.Fprintf(&body, "\tswitch %s.ValueOf(v0).Pointer() {\n", reflect)
+        ret := p.goType(ty)
+        for _, f := range p.g.p.Functions {
+            gf := p.g.funcs[f]
+            if gf.pkg != p && !isExported(gf.name) || p.goType(f.Signature) != ret {
+                continue
+            }
+            fmt.Fprintf(&body, "\tcase %s.ValueOf(%s).Pointer():\n\t\treturn %s\n",
+                reflect, p.ref(f), strconv.Quote("fn " + baseName(f.Name)))
+        }
+        body.WriteString("\t}\n\treturn \"fn\"\n")
+    }
+    fmt.Fprintf(&p.extra, "func %s(v0 %s) string {\n%s}\n\n", name, p.goType(ty), body.String())
+    return name
+}
+
+// the parts joined by sep, each followed by a +
+func joinParts(parts []string, sep string) string {
+    var b strings.Builder
+    for i, part := range parts {
+        if i > 0 && sep != "" {
+            b.WriteString(sep + " + ")
+        }
+        b.WriteString(part + " + ")
+    }
+    return b.String()
+}
+
+func isExported(name string) bool {
+    return name[0] >= 'A' && name[0] <= 'Z'
+}
+
+// prints the result of fn main, or the message of a trap to stderr
+func (p *pkg) mainFunc(main *ir.Function) {
+    format := p.formatter(ir.ReturnOf(main.Signature))
+    fmtPkg, os := p.std("fmt"), p.std("os")
+    fmt.Fprintf(&p.funcs, `func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			%s.Fprintf(%s.Stderr, "Runtime error: %%v\n", r)
+			%s.Exit(1)
+		}
+	}()
+	%s.Println(%s(%s()))
+}
+
+`, fmtPkg, os, os, fmtPkg, format, p.g.funcs[main].name)
+}
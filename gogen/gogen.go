@@ -0,0 +1,633 @@
+package gogen
+
+import (
+    "errors"
+    "fmt"
+    "go/format"
+    "math"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/ir"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type Options struct {
+    // the path of the Go module the packages make up, if they make up
+    // their own: Generate then adds its go.mod and ImportPath defaults to
+    // it
+    Module string
+    // the import path of the package of the root module, module a::b
+    // becomes the package at ImportPath/a/b
+    ImportPath string
+    // the name of the package of the root module, the last element of
+    // ImportPath if empty. A main package also gets a func main printing
+    // the result of fn main like interp.Format.
+    Package string
+}
+
+type File struct {
+    Path string // relative to the directory of the root package
+    Source []byte
+}
+
+// the Go version generated modules declare
+const goVersion = "1.18"
+
+type generator struct {
+    p *ir.Program
+    info *check.Info
+    pkgs map[string]*pkg // by module name
+    order []*pkg
+    funcs map[*ir.Function]*goFunc
+    decls map[string]*parser.ASTFunction // by canonical name
+}
+
+type goFunc struct {
+    pkg *pkg
+    name string
+}
+
+// one Go package per module
+type pkg struct {
+    g *generator
+    name string
+    path string // import path
+    file string
+    names map[string]bool // taken at package level
+    imports map[string]string // names by import path
+    packages map[string]string // package names by import path
+    aliases map[string]string // by Go type
+    variants map[string]string // names of the pub variant types, by canonical name
+    counts map[string]int // of aliases and formatters, by kind
+    helpers map[string]bool
+    formatters map[string]string // by core.TypeString
+    params []string // of the function being generated
+
+    types strings.Builder
+    funcs strings.Builder
+    extra strings.Builder // helpers and formatters
+}
+
+// Generate translates a lowered program to Go, one package per module.
+// A function is exported if it is pub or used by another package, which
+// inlining may do for private ones, and keeps the names of its
+// parameters. Packages import each other for the functions they refer
+// to rather than for their use statements, which may name modules no
+// code is left from.
+func Generate(mods []*loader.Module, p *ir.Program, info *check.Info, opts Options) ([]*File, error) {
+    if opts.ImportPath == "" {
+        opts.ImportPath = opts.Module
+    }
+    if opts.ImportPath == "" {
+        return nil, errors.New("No import path for the Go packages")
+    }
+    if opts.Package == "" {
+        opts.Package = opts.ImportPath[strings.LastIndex(opts.ImportPath, "/") + 1:]
+    }
+    g := &generator{
+        p: p,
+        info: info,
+        pkgs: make(map[string]*pkg),
+        funcs: make(map[*ir.Function]*goFunc),
+        decls: make(map[string]*parser.ASTFunction),
+    }
+    public := make(map[string]bool)
+    for _, m := range mods {
+        g.newPackage(m.Name, opts)
+        for _, d := range m.Unit.Declarations {
+            if fn, ok := d.(*parser.ASTFunction); ok {
+                g.decls[check.Canonical(m, fn.Name)] = fn
+                public[check.Canonical(m, fn.Name)] = fn.Public
+            }
+        }
+    }
+    if g.pkgs[""] == nil {
+        return nil, errors.New("No root module")
+    }
+    // named before the functions, which give way to them
+    for _, m := range mods {
+        for _, d := range m.Unit.Declarations {
+            if td, ok := d.(*parser.ASTTypeDeclaration); ok && td.Public && len(td.Params) == 0 {
+                g.pkgs[m.Name].namedType(check.Canonical(m, td.Name), td.Name)
+            }
+        }
+    }
+
+    exported := make(map[*ir.Function]bool)
+    for _, f := range p.Functions {
+        if public[baseName(f.Name)] {
+            exported[f] = true
+        }
+        for _, b := range f.Blocks {
+            for _, v := range b.Values {
+                if v.Op != ir.OpCall && v.Op != ir.OpFunc {
+                    continue
+                }
+                if callee := p.Lookup(v.Aux.(string)); moduleOf(callee.Name) != moduleOf(f.Name) {
+                    exported[callee] = true
+                }
+            }
+        }
+    }
+    for _, f := range p.Functions {
+        mod := moduleOf(f.Name)
+        pk := g.pkgs[mod]
+        if pk == nil {
+            return nil, fmt.Errorf("No module %s for fn %s", mod, f.Name)
+        }
+        name := mangle(strings.TrimPrefix(f.Name, mod + "::"))
+        if exported[f] {
+            name = exportedName(name)
+        } else if reserved(name) {
+            name += "_"
+        }
+        for pk.names[name] {
+            name += "_"
+        }
+        pk.names[name] = true
+        g.funcs[f] = &goFunc{pk, name}
+    }
+
+    var main *ir.Function
+    if opts.Package == "main" {
+        if main = p.Lookup("main"); main == nil {
+            return nil, errors.New("No fn main")
+        }
+        if len(main.Params) > 0 {
+            return nil, errors.New("fn main must not take parameters")
+        }
+    }
+    for _, f := range p.Functions {
+        g.funcs[f].pkg.function(f)
+    }
+    if main != nil {
+        g.pkgs[""].mainFunc(main)
+    }
+
+    files := make([]*File, len(g.order))
+    for i, pk := range g.order {
+        src, err := pk.source()
+        if err != nil {
+            return nil, err
+        }
+        files[i] = &File{pk.file, src}
+    }
+    if opts.Module != "" {
+        files = append(files, &File{"go.mod", []byte(fmt.Sprintf("module %s\n\ngo %s\n", opts.Module, goVersion))})
+    }
+    return files, nil
+}
+
+func (g *generator) newPackage(mod string, opts Options) {
+    pk := &pkg{
+        g: g,
+        name: opts.Package,
+        path: opts.ImportPath,
+        file: opts.Package + ".go",
+        names: make(map[string]bool),
+        imports: make(map[string]string),
+        packages: make(map[string]string),
+        aliases: make(map[string]string),
+        variants: make(map[string]string),
+        counts: make(map[string]int),
+        helpers: make(map[string]bool),
+        formatters: make(map[string]string),
+    }
+    if mod != "" {
+        elems := strings.Split(mod, "::")
+        pk.name = elems[len(elems) - 1]
+        if reserved(pk.name) || pk.name == "main" {
+            pk.name += "_"
+        }
+        dir := strings.Join(elems, "/")
+        pk.path = opts.ImportPath + "/" + dir
+        pk.file = dir + "/" + pk.name + ".go"
+    }
+    g.pkgs[mod] = pk
+    g.order = append(g.order, pk)
+}
+
+// the canonical name of the generic function an instance like a::id[Int]
+// is of, the name itself for other functions
+func baseName(name string) string {
+    if i := strings.Index(name, "["); i >= 0 {
+        return name[:i]
+    }
+    return name
+}
+
+// the module a function is declared in, a for a::id[b::Shape]
+func moduleOf(name string) string {
+    name = baseName(name)
+    if i := strings.LastIndex(name, "::"); i >= 0 {
+        return name[:i]
+    }
+    return ""
+}
+
+var nonIdent = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// a Go identifier for the name of a function, instances like
+// id[(Int, Int)] become id_Int_Int
+func mangle(name string) string {
+    return strings.TrimSuffix(nonIdent.ReplaceAllString(name, "_"), "_")
+}
+
+func exportedName(name string) string {
+    if name[0] == '_' {
+        return "X" + name
+    }
+    return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// keywords, predeclared identifiers and the names generated code uses
+var goNames = map[string]bool{
+    "break": true, "case": true, "chan": true, "const": true, "continue": true,
+    "default": true, "defer": true, "else": true, "fallthrough": true,
+    "for": true, "func": true, "go": true, "goto": true, "if": true,
+    "import": true, "interface": true, "map": true, "package": true,
+    "range": true, "return": true, "select": true, "struct": true,
+    "switch": true, "type": true, "var": true,
+
+    "any": true, "bool": true, "byte": true, "comparable": true,
+    "complex64": true, "complex128": true, "error": true, "float32": true,
+    "float64": true, "int": true, "int8": true, "int16": true, "int32": true,
+    "int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+    "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+    "true": true, "false": true, "iota": true, "nil": true,
+    "append": true, "cap": true, "clear": true, "close": true, "complex": true,
+    "copy": true, "delete": true, "imag": true, "len": true, "make": true,
+    "max": true, "min": true, "new": true, "panic": true, "print": true,
+    "println": true, "real": true, "recover": true,
+
+    "init": true, "main": true, "variant": true,
+}
+
+var generatedName = regexp.MustCompile(`^(([vp]|tuple|record|fn|format)[0-9]+|ibex.*)$`)
+
+func reserved(name string) bool {
+    return goNames[name] || generatedName.MatchString(name)
+}
+
+// the name package p refers to the package at path by, importing it on
+// first use
+func (p *pkg) use(path string, name string) string {
+    if local, ok := p.imports[path]; ok {
+        return local
+    }
+    local := name
+    for p.names[local] || reserved(local) {
+        local += "_"
+    }
+    p.names[local] = true
+    p.imports[path] = local
+    p.packages[path] = name
+    return local
+}
+
+func (p *pkg) std(path string) string {
+    return p.use(path, path[strings.LastIndex(path, "/") + 1:])
+}
+
+// how package p refers to the function f
+func (p *pkg) ref(f *ir.Function) string {
+    gf := p.g.funcs[f]
+    if gf.pkg == p {
+        return gf.name
+    }
+    return p.use(gf.pkg.path, gf.pkg.name) + "." + gf.name
+}
+
+func (p *pkg) source() ([]byte, error) {
+    var out strings.Builder
+    fmt.Fprintf(&out, "// Code generated by ibex. DO NOT EDIT.\n\npackage %s\n\n", p.name)
+    if len(p.imports) > 0 {
+        paths := make([]string, 0, len(p.imports))
+        for path := range p.imports {
+            paths = append(paths, path)
+        }
+        sort.Strings(paths)
+        out.WriteString("import (\n")
+        for _, path := range paths {
+            if local := p.imports[path]; local != p.packages[path] {
+                fmt.Fprintf(&out, "\t%s %q\n", local, path)
+            } else {
+                fmt.Fprintf(&out, "\t%q\n", path)
+            }
+        }
+        out.WriteString(")\n\n")
+    }
+    for _, section := range []*strings.Builder{&p.types, &p.funcs, &p.extra} {
+        out.WriteString(section.String())
+    }
+    src, err := format.Source([]byte(out.String()))
+    if err != nil {
+        return nil, fmt.Errorf("Generated invalid Go for %s: %s", p.file, err)
+    }
+    return src, nil
+}
+
+// the Go type of the value v, by its representation if it was not
+// lowered from a checked type
+func (p *pkg) valueType(v *ir.Value) string {
+    if v.Source != nil {
+        return p.goType(v.Source)
+    }
+    switch v.Type {
+    case ir.Int:
+        return "int64"
+    case ir.F64:
+        return "float64"
+    case ir.Bool:
+        return "bool"
+    }
+    return "struct{}"
+}
+
+// Values are only read through variables, which Go does not allow to go
+// unread. A value is needed if a terminator or a needed value or one
+// with an effect reads it; the others are left out.
+func hasEffect(v *ir.Value) bool {
+    switch v.Op {
+    case ir.OpCall, ir.OpCallInd, ir.OpIndex:
+        return true
+    case ir.OpDiv, ir.OpMod:
+        return v.Type == ir.Int
+    }
+    return false
+}
+
+func neededValues(f *ir.Function) map[*ir.Value]bool {
+    needed := make(map[*ir.Value]bool)
+    work := make([]*ir.Value, 0)
+    mark := func(v *ir.Value) {
+        if !needed[v] {
+            needed[v] = true
+            work = append(work, v)
+        }
+    }
+    for _, b := range f.Blocks {
+        if b.Control != nil {
+            mark(b.Control)
+        }
+        for _, v := range b.Values {
+            if hasEffect(v) {
+                for _, arg := range v.Args {
+                    mark(arg)
+                }
+            }
+        }
+    }
+    for len(work) > 0 {
+        v := work[len(work) - 1]
+        work = work[:len(work) - 1]
+        for _, arg := range v.Args {
+            mark(arg)
+        }
+    }
+    return needed
+}
+
+// the names of the parameters of f as flattened, those of its
+// declaration where they are not taken: a parameter of a tuple type
+// flattened to several gives name_0, name_1 and so on
+func (p *pkg) paramNames(f *ir.Function) []string {
+    params := ir.Flatten(f.Signature.Argument)
+    names := make([]string, len(params))
+    for i := range names {
+        names[i] = fmt.Sprintf("p%d", i)
+    }
+    decl := p.g.decls[baseName(f.Name)]
+    if decl == nil {
+        return names
+    }
+    switch {
+    case len(decl.Parameters) == len(params):
+        for i, param := range decl.Parameters {
+            names[i] = param.Name
+        }
+    case len(decl.Parameters) == 1:
+        for i := range names {
+            names[i] = fmt.Sprintf("%s_%d", decl.Parameters[0].Name, i)
+        }
+    default:
+        return names
+    }
+    for i, name := range names {
+        for reserved(name) || p.names[name] || p.g.packageName(name) {
+            name += "_"
+        }
+        names[i] = name
+    }
+    return names
+}
+
+// whether a package the generated code may refer to is called name
+func (g *generator) packageName(name string) bool {
+    switch name {
+    case "fmt", "math", "os", "reflect", "strconv", "strings":
+        return true
+    }
+    for _, pk := range g.order {
+        if pk.name == name {
+            return true
+        }
+    }
+    return false
+}
+
+func (p *pkg) function(f *ir.Function) {
+    params := ir.Flatten(f.Signature.Argument)
+    p.params = p.paramNames(f)
+    decls := make([]string, len(params))
+    for i, param := range params {
+        decls[i] = fmt.Sprintf("%s %s", p.params[i], p.goType(param))
+    }
+    name := p.g.funcs[f].name
+    w := &p.funcs
+    fmt.Fprintf(w, "// %s is fn %s.\nfunc %s(%s) %s {\n", name, f.Name, name,
+        strings.Join(decls, ", "), p.goType(ir.ReturnOf(f.Signature)))
+    if len(f.Blocks) == 0 {
+        fmt.Fprintf(w, "\tpanic(%s)\n}\n\n", strconv.Quote("fn " + f.Name + " has no body"))
+        return
+    }
+
+    needed := neededValues(f)
+    for _, b := range f.Blocks {
+        for _, v := range b.Values {
+            if needed[v] {
+                fmt.Fprintf(w, "\tvar %s %s\n", v.Name(), p.valueType(v))
+            }
+        }
+    }
+    for _, b := range f.Blocks {
+        if len(b.Preds) > 0 {
+            fmt.Fprintf(w, "%s:\n", b.Name())
+        }
+        for _, v := range b.Values {
+            if v.Op != ir.OpPhi && (needed[v] || hasEffect(v)) {
+                p.value(w, v, needed[v])
+            }
+        }
+        p.terminator(w, b, needed)
+    }
+    w.WriteString("}\n\n")
+}
+
+func position(v *ir.Value) string {
+    return strconv.Quote(v.Pos.String())
+}
+
+func (p *pkg) value(w *strings.Builder, v *ir.Value, needed bool) {
+    args := make([]string, len(v.Args))
+    for i, arg := range v.Args {
+        args[i] = arg.Name()
+    }
+
+    var expr string
+    switch v.Op {
+    case ir.OpParam:
+        expr = p.params[v.Aux.(int)]
+    case ir.OpConst:
+        expr = p.constant(v.Aux)
+    case ir.OpUnit:
+        expr = "struct{}{}"
+    case ir.OpString:
+        expr = strconv.Quote(v.Aux.(string))
+    case ir.OpFunc:
+        expr = p.ref(p.g.p.Lookup(v.Aux.(string)))
+
+    case ir.OpAdd:
+        expr = args[0] + " + " + args[1]
+    case ir.OpSub:
+        expr = args[0] + " - " + args[1]
+    case ir.OpMul:
+        expr = args[0] + " * " + args[1]
+    case ir.OpDiv, ir.OpMod:
+        switch {
+        case v.Type == ir.Int:
+            expr = fmt.Sprintf("%s(%s, %s, %s)", p.helper(v.Op), args[0], args[1], position(v))
+        case v.Op == ir.OpDiv:
+            expr = args[0] + " / " + args[1]
+        default:
+            expr = fmt.Sprintf("%s.Mod(%s, %s)", p.std("math"), args[0], args[1])
+        }
+    case ir.OpNeg:
+        expr = "-" + args[0]
+    case ir.OpNot:
+        expr = "!" + args[0]
+    case ir.OpEq:
+        expr = args[0] + " == " + args[1]
+
+    case ir.OpTuple:
+        if len(args) == 0 {
+            expr = "struct{}{}"
+        } else {
+            expr = fmt.Sprintf("%s{%s}", p.valueType(v), strings.Join(args, ", "))
+        }
+    case ir.OpArray:
+        expr = fmt.Sprintf("%s{%s}", p.valueType(v), strings.Join(args, ", "))
+    case ir.OpVariant:
+        expr = fmt.Sprintf("%s{Tag: %d", p.valueType(v), v.Aux.(int))
+        if len(args) > 0 {
+            expr += ", Payload: " + args[0]
+        }
+        expr += "}"
+    case ir.OpElem:
+        expr = args[0] + "." + fieldName(v.Args[0].Source, v.Aux.(int))
+    case ir.OpIndex:
+        fmt.Fprintf(w, "\t%s(%s, len(%s), %s)\n", p.helper(ir.OpIndex), args[1], args[0], position(v))
+        expr = fmt.Sprintf("%s[%s]", args[0], args[1])
+    case ir.OpTag:
+        expr = args[0] + ".Tag"
+    case ir.OpPayload:
+        expr = fmt.Sprintf("%s.Payload.(%s)", args[0], p.valueType(v))
+
+    case ir.OpCall:
+        expr = fmt.Sprintf("%s(%s)", p.ref(p.g.p.Lookup(v.Aux.(string))), strings.Join(args, ", "))
+    case ir.OpCallInd:
+        expr = fmt.Sprintf("%s(%s)", args[0], strings.Join(args[1:], ", "))
+    }
+
+    switch {
+    case needed:
+        fmt.Fprintf(w, "\t%s = %s\n", v.Name(), expr)
+    case v.Op == ir.OpCall || v.Op == ir.OpCallInd:
+        fmt.Fprintf(w, "\t%s\n", expr)
+    case v.Op == ir.OpDiv || v.Op == ir.OpMod:
+        fmt.Fprintf(w, "\t_ = %s\n", expr)
+    }
+}
+
+func (p *pkg) constant(aux interface{}) string {
+    switch c := aux.(type) {
+    case int64:
+        return strconv.FormatInt(c, 10)
+    case bool:
+        return strconv.FormatBool(c)
+    case float64:
+        switch {
+        case math.IsNaN(c):
+            return p.std("math") + ".NaN()"
+        case math.IsInf(c, 0):
+            return fmt.Sprintf("%s.Inf(%d)", p.std("math"), int(math.Copysign(1, c)))
+        }
+        return strconv.FormatFloat(c, 'g', -1, 64)
+    }
+    return "struct{}{}"
+}
+
+// the copies into the phis of b.Succs[i] on that edge, at once as the
+// phis may read each other
+func (p *pkg) edge(w *strings.Builder, b *ir.Block, i int, needed map[*ir.Value]bool, indent string) {
+    s := b.Succs[i]
+    nth := 0
+    for _, other := range b.Succs[:i] {
+        if other == s {
+            nth++
+        }
+    }
+    for j, pred := range s.Preds {
+        if pred != b {
+            continue
+        }
+        if nth > 0 {
+            nth--
+            continue
+        }
+        phis, args := make([]string, 0), make([]string, 0)
+        for _, v := range s.Values {
+            if v.Op == ir.OpPhi && needed[v] {
+                phis = append(phis, v.Name())
+                args = append(args, v.Args[j].Name())
+            }
+        }
+        if len(phis) > 0 {
+            fmt.Fprintf(w, "%s%s = %s\n", indent, strings.Join(phis, ", "), strings.Join(args, ", "))
+        }
+        break
+    }
+    fmt.Fprintf(w, "%sgoto %s\n", indent, s.Name())
+}
+
+func (p *pkg) terminator(w *strings.Builder, b *ir.Block, needed map[*ir.Value]bool) {
+    switch b.Kind {
+    case ir.BlockJump:
+        p.edge(w, b, 0, needed, "\t")
+    case ir.BlockIf:
+        fmt.Fprintf(w, "\tif %s {\n", b.Control.Name())
+        p.edge(w, b, 0, needed, "\t\t")
+        w.WriteString("\t} else {\n")
+        p.edge(w, b, 1, needed, "\t\t")
+        w.WriteString("\t}\n")
+    case ir.BlockReturn:
+        fmt.Fprintf(w, "\treturn %s\n", b.Control.Name())
+    case ir.BlockTrap:
+        fmt.Fprintf(w, "\tpanic(%s)\n", strconv.Quote(b.Message + " at " + b.Pos.String()))
+    }
+}
@@ -0,0 +1,270 @@
+package gogen
+
+import (
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/check"
+	"github.com/ibex-lang/ibex/internal/backendtest"
+	"github.com/ibex-lang/ibex/interp"
+	"github.com/ibex-lang/ibex/ir"
+	"github.com/ibex-lang/ibex/loader"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+const importPath = "example.com/ibexout"
+
+func parse(t *testing.T, name string, src string) *parser.ASTCompilationUnit {
+	unit, err := parser.ParseFile(name, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return unit
+}
+
+func generateModules(t *testing.T, mods []*loader.Module, level int, opts Options) (*check.Info, []*File) {
+	info, err := check.CheckModules(mods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ir.Lower(mods, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ir.Optimize(p, level); err != nil {
+		t.Fatal(err)
+	}
+	files, err := Generate(mods, p, info, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info, files
+}
+
+func generateSource(t *testing.T, src string, level int) []*File {
+	return generate(t, backendtest.Lower(t, src, level))
+}
+
+func generate(t *testing.T, l *backendtest.Lowered) []*File {
+	files, err := Generate(l.Modules, l.Program, l.Info, Options{Module: importPath, Package: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// writes the files of a Go module and runs its root package
+func goRun(t *testing.T, files []*File) (string, error) {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool")
+	}
+	dir := t.TempDir()
+	for _, f := range files {
+		file := filepath.Join(dir, f.Path)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.Nil(t, os.WriteFile(file, f.Source, 0644))
+	}
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off", "GOPROXY=off")
+	out, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); ok && len(out) > 0 && out[0] == '#' {
+		for _, f := range files {
+			t.Logf("%s:\n%s", f.Path, f.Source)
+		}
+		t.Fatalf("%s", out)
+	}
+	return string(out), err
+}
+
+func assertFormatted(t *testing.T, files []*File) {
+	for _, f := range files {
+		if f.Path == "go.mod" {
+			continue
+		}
+		formatted, err := format.Source(f.Source)
+		assert.Nil(t, err)
+		assert.Equal(t, string(formatted), string(f.Source), f.Path)
+	}
+}
+
+func run(t *testing.T, l *backendtest.Lowered) (string, error) {
+	files := generate(t, l)
+	assertFormatted(t, files)
+	return goRun(t, files)
+}
+
+func TestGenerateMatchesInterpreter(t *testing.T) {
+	backendtest.MatchesInterpreter(t, run)
+}
+
+func TestGenerateTraps(t *testing.T) {
+	backendtest.FailsOnTraps(t, run, func(message string, pos string) string {
+		return "Runtime error: " + message + " at " + pos + "\nexit status 1\n"
+	})
+}
+
+func TestGeneratePackages(t *testing.T) {
+	shapes := &loader.Module{Name: "geo::shapes", Unit: parse(t, "geo/shapes.ibex",
+		`pub type Shape = Circle (r: Int) | Square (side: Int)
+pub type Size = (w: Int, h: Int)
+pub fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a -> double
+fn double x: Int -> Int
+    x * 2
+pub fn depth n: Int -> Int
+    n -> count
+fn count n: Int -> Int
+    match n
+        0 => 0
+        1 => 1
+        _ => (n - 1 -> count) + (n - 2 -> count) * 2 - (n / 2 -> count)`)}
+	root := &loader.Module{Unit: parse(t, "main.ibex", `use geo::shapes
+fn len s: shapes::Shape -> Int
+    s -> shapes::area
+fn main -> (Int, Int, Int)
+    (shapes::Circle (r: 2) -> len, shapes::Square (side: 3) -> shapes::area, 6 -> shapes::depth)`)}
+	root.Imports = []*loader.Import{{root.Unit.Uses[0], shapes}}
+	mods := []*loader.Module{shapes, root}
+
+	for level := 0; level <= 2; level++ {
+		info, files := generateModules(t, mods, level, Options{Module: importPath, Package: "main"})
+		assertFormatted(t, files)
+		assert.Equal(t, "geo/shapes/shapes.go", files[0].Path)
+		assert.Equal(t, "main.go", files[1].Path)
+		assert.Equal(t, "go.mod", files[2].Path)
+		assert.Equal(t, "module example.com/ibexout\n\ngo 1.18\n", string(files[2].Source))
+		assert.Contains(t, string(files[0].Source), "package shapes\n")
+		assert.Contains(t, string(files[0].Source), "// Shape is type Shape, its Tag is 0 for Circle, 1 for Square\n" +
+			"type Shape = struct {\n")
+		assert.Contains(t, string(files[0].Source), "type Size = struct {\n\tW int64\n\tH int64\n}\n")
+		assert.Contains(t, string(files[0].Source), "func Area(s Shape) int64 {")
+		assert.Contains(t, string(files[1].Source), "\"example.com/ibexout/geo/shapes\"")
+		assert.Contains(t, string(files[1].Source), "func len_(s variant) int64 {")
+
+		expected, err := interp.RunModules(mods, info)
+		assert.Nil(t, err)
+		out, err := goRun(t, files)
+		assert.Nil(t, err)
+		assert.Equal(t, interp.Format(expected) + "\n", out)
+	}
+
+	_, files := generateModules(t, mods, 2, Options{ImportPath: importPath + "/geo"})
+	assert.Len(t, files, 2, "no go.mod for packages inside another module")
+	assert.Contains(t, string(files[0].Source), "func Count(n int64) int64 {",
+		"private functions called from inlined ones are exported")
+	assert.Contains(t, string(files[1].Source), "shapes.Count(")
+	assert.Equal(t, "geo.go", files[1].Path)
+	assert.Contains(t, string(files[1].Source), "package geo\n")
+	assert.NotContains(t, string(files[1].Source), "func main()")
+}
+
+func TestGenerateSource(t *testing.T) {
+	files := generateSource(t, `fn pick (xs: [](Int, Int), i: Int) -> Int
+    match xs[i]
+        (x, 0) => x / i
+        (x, _) => x
+fn main -> Int
+    ([(4, 0)], 0) -> pick`, 1)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "main.go", files[0].Path)
+	assert.Equal(t, `// Code generated by ibex. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type tuple0 = struct {
+	F0 int64
+	F1 int64
+}
+
+// pick is fn pick.
+func pick(xs []tuple0, i int64) int64 {
+	var v0 []tuple0
+	var v1 int64
+	var v2 tuple0
+	var v3 int64
+	var v4 int64
+	var v5 int64
+	var v6 bool
+	var v7 int64
+	var v8 int64
+	v0 = xs
+	v1 = i
+	ibexCheckIndex(v1, len(v0), "test.ibex:2:13")
+	v2 = v0[v1]
+	v3 = v2.F0
+	v4 = v2.F1
+	v5 = 0
+	v6 = v4 == v5
+	if v6 {
+		goto b2
+	} else {
+		goto b1
+	}
+b1:
+	v8 = v3
+	goto b3
+b2:
+	v7 = ibexDiv(v3, v1, "test.ibex:3:21")
+	v8 = v7
+	goto b3
+b3:
+	return v8
+}
+
+// main_ is fn main.
+func main_() int64 {
+	var v0 int64
+	var v1 int64
+	var v2 tuple0
+	var v3 []tuple0
+	var v4 int64
+	v0 = 4
+	v1 = 0
+	v2 = tuple0{v0, v1}
+	v3 = []tuple0{v2}
+	v4 = pick(v3, v1)
+	return v4
+}
+
+func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "Runtime error: %v\n", r)
+			os.Exit(1)
+		}
+	}()
+	fmt.Println(format0(main_()))
+}
+
+func ibexCheckIndex(i int64, n int, pos string) {
+	if i < 0 || i >= int64(n) {
+		panic(fmt.Sprintf("Index %d is out of range for an array of length %d at %s", i, n, pos))
+	}
+}
+
+func ibexDiv(x, y int64, pos string) int64 {
+	if y == 0 {
+		panic("Division by zero at " + pos)
+	}
+	return x / y
+}
+
+func format0(v0 int64) string {
+	return strconv.FormatInt(v0, 10)
+}
+`, string(files[0].Source))
+}
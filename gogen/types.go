@@ -0,0 +1,138 @@
+package gogen
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// Every type maps to a Go type without a name, so values may pass
+// between the generated packages without conversions: tuples become
+// structs with the fields F0, F1, ..., named tuples structs with the
+// names capitalized, arrays slices and function types func types taking
+// the parameters flattened as in the IR. Variants, which may be
+// recursive, are a struct of the index of the tag and the payload as an
+// interface{}. Each package gives the struct and func types aliases,
+// named after the pub types it declares where there are any.
+const variantType = "struct {\n\tTag     int64\n\tPayload interface{}\n}"
+
+// the name of a field of a tuple or named tuple type
+func fieldName(ty core.IbexType, i int) string {
+    if t, ok := ty.(core.IbexNamedTupleType); ok {
+        return exportedName(t.Types[i].Name)
+    }
+    return fmt.Sprintf("F%d", i)
+}
+
+// the Go type of an Ibex type in package p
+func (p *pkg) goType(ty core.IbexType) string {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        switch t.Name {
+        case "Int":
+            return "int64"
+        case "F64":
+            return "float64"
+        case "Bool":
+            return "bool"
+        case "String":
+            return "string"
+        }
+        if name, ok := p.variants[t.Name]; ok {
+            return name
+        }
+        return p.alias("variant", variantType)
+    case core.IbexTupleType:
+        if len(t.ElementTypes) == 0 {
+            return "struct{}"
+        }
+    case core.IbexArrayType:
+        return "[]" + p.goType(t.Elem())
+    }
+    if kind, body := p.structure(ty); kind != "" {
+        return p.alias(kind, body)
+    }
+    return "interface{}"
+}
+
+// the kind of alias and the Go type of a tuple, named tuple or function
+// type, "" for other types
+func (p *pkg) structure(ty core.IbexType) (string, string) {
+    switch t := ty.(type) {
+    case core.IbexTupleType:
+        if len(t.ElementTypes) == 0 {
+            return "", ""
+        }
+        fields := make([]string, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            fields[i] = fmt.Sprintf("\tF%d %s\n", i, p.goType(elem))
+        }
+        return "tuple", "struct {\n" + strings.Join(fields, "") + "}"
+    case core.IbexNamedTupleType:
+        fields := make([]string, len(t.Types))
+        for i, entry := range t.Types {
+            fields[i] = fmt.Sprintf("\t%s %s\n", exportedName(entry.Name), p.goType(entry.Type))
+        }
+        return "record", "struct {\n" + strings.Join(fields, "") + "}"
+    case core.IbexFunctionType:
+        params := ir.Flatten(t.Argument)
+        types := make([]string, len(params))
+        for i, param := range params {
+            types[i] = p.goType(param)
+        }
+        return "fn", fmt.Sprintf("func(%s) %s",
+            strings.Join(types, ", "), p.goType(ir.ReturnOf(t)))
+    }
+    return "", ""
+}
+
+// names the Go type of the pub type declared as canonical after it if
+// it is a variant or an alias of a struct or func type the package has
+// no alias for yet
+func (p *pkg) namedType(canonical string, decl string) {
+    var body, doc string
+    switch t := p.g.info.Types[canonical].(type) {
+    case core.IbexVariantType:
+        body = variantType
+        tags := make([]string, len(t.Cases))
+        for i, c := range t.Cases {
+            tags[i] = fmt.Sprintf("%d for %s", i, c.Tag)
+        }
+        doc = fmt.Sprintf("its Tag is %s", strings.Join(tags, ", "))
+    default:
+        kind, ty := p.structure(t)
+        if _, ok := p.aliases[ty]; kind == "" || ok {
+            return
+        }
+        body = ty
+        doc = "an alias of " + core.TypeString(t)
+    }
+    name := exportedName(decl)
+    for reserved(name) || p.names[name] {
+        name += "_"
+    }
+    p.names[name] = true
+    if body == variantType {
+        p.variants[canonical] = name
+    } else {
+        p.aliases[body] = name
+    }
+    fmt.Fprintf(&p.types, "// %s is type %s, %s\ntype %s = %s\n\n", name, decl, doc, name, body)
+}
+
+// the alias of a struct or func type, declaring it on first use
+func (p *pkg) alias(kind string, ty string) string {
+    if name, ok := p.aliases[ty]; ok {
+        return name
+    }
+    name := kind
+    if kind != "variant" {
+        name = fmt.Sprintf("%s%d", kind, p.counts[kind])
+        p.counts[kind]++
+    }
+    p.aliases[ty] = name
+    fmt.Fprintf(&p.types, "type %s = %s\n\n", name, ty)
+    return name
+}
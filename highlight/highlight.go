@@ -0,0 +1,375 @@
+package highlight
+
+import (
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/parser"
+    "github.com/ibex-lang/ibex/util"
+)
+
+type Class int
+
+const (
+    Keyword Class = iota
+    Type
+    Function
+    Parameter
+    Variable // bound by a pattern
+    Constructor
+    Module // a qualifier or the path of a use
+    Number
+    String
+    Operator
+    Comment
+)
+
+var classNames = [...]string{
+    "keyword", "type", "function", "parameter", "variable", "constructor",
+    "module", "number", "string", "operator", "comment",
+}
+
+func (c Class) String() string {
+    return classNames[c]
+}
+
+// Classes lists every class in order
+func Classes() []Class {
+    classes := make([]Class, len(classNames))
+    for i := range classes {
+        classes[i] = Class(i)
+    }
+    return classes
+}
+
+// Span is a classified range of one line
+type Span struct {
+    Line int
+    Col int // in bytes, 1-based as parser.Pos
+    End int // the column after the span
+    Class Class
+}
+
+// what a line is part of, told by the first token of its declaration
+type context int
+
+const (
+    inUse context = iota
+    inSignature // the line of a fn
+    inBody
+    inType // a type declaration without cases
+    inVariant // a type declaration with cases
+)
+
+// Classify gives the spans of src in order. Tokens are classified by
+// their type and their place on the line, as a name before :: is a
+// module. unit and info, which are nil if src does not parse or check,
+// tell what the other names are: functions, parameters or variables
+// bound by patterns. Punctuation and the tags of named tuples are left
+// out.
+func Classify(src string, unit *parser.ASTCompilationUnit, info *check.Info) []Span {
+    lines := strings.Split(src, "\n")
+    names := resolved(unit, info)
+    tokens := make([][]*parser.Token, len(lines))
+    for i, line := range lines {
+        tokens[i] = lexLine(line)
+    }
+    contexts := lineContexts(tokens)
+
+    spans := make([]Span, 0)
+    for i, line := range lines {
+        n := i + 1
+        toks := tokens[i]
+        chain := 0 // the column of the first name of a qualified name
+        braces := false // within the items of a use
+        for j, tok := range toks {
+            span := Span{n, tok.Start + 1, tok.End + 1, 0}
+            switch {
+            case tok.Ty == parser.TokenError:
+                if strings.HasPrefix(tok.Value, "Unterminated") {
+                    span.Class, span.End = String, len(line) + 1
+                    spans = append(spans, span)
+                }
+                continue
+            case tok.Ty >= parser.TokenFunction && tok.Ty <= parser.TokenAs:
+                span.Class = Keyword
+            case tok.Ty == parser.TokenNumber:
+                span.Class = Number
+            case tok.Ty == parser.TokenString:
+                span.Class = String
+            case tok.Ty.IsOperator():
+                span.Class = Operator
+            case tok.Ty == parser.TokenLBrace:
+                braces = true
+                continue
+            case tok.Ty == parser.TokenIdent:
+                if j < 2 || toks[j - 1].Ty != parser.TokenModSep || toks[j - 2].Ty != parser.TokenIdent {
+                    chain = span.Col
+                }
+                if j + 1 < len(toks) && toks[j + 1].Ty == parser.TokenModSep {
+                    span.Class = Module
+                } else if class, ok := names[parser.Pos{Line: n, Col: chain}]; ok {
+                    span.Class = class
+                } else if class, ok := guess(contexts[i], toks, j, braces); ok {
+                    span.Class = class
+                } else {
+                    continue
+                }
+            default:
+                continue
+            }
+            spans = append(spans, span)
+        }
+        if start := parser.CommentStart(line); start >= 0 {
+            spans = append(spans, Span{n, start + 1, len(strings.TrimRight(line, " \t\r")) + 1, Comment})
+        }
+    }
+    return spans
+}
+
+// the tokens of a line as far as it lexes, with its error if it does not
+func lexLine(line string) []*parser.Token {
+    toks := make([]*parser.Token, 0)
+    lex := parser.NewLexer(line)
+    lex.Run()
+    for tok := lex.NextToken(); tok != nil && tok.Ty != parser.TokenEOF; tok = lex.NextToken() {
+        toks = append(toks, tok)
+        if tok.Ty == parser.TokenError {
+            break
+        }
+    }
+    return toks
+}
+
+// the context of every line: a line not indented starts a declaration,
+// which runs until the next one
+func lineContexts(tokens [][]*parser.Token) []context {
+    contexts := make([]context, len(tokens))
+    start := 0
+    for start < len(tokens) {
+        end := start + 1
+        for end < len(tokens) && (len(tokens[end]) == 0 || tokens[end][0].Start > 0) {
+            end++
+        }
+        decl := tokens[start]
+        if len(decl) > 1 && decl[0].Ty == parser.TokenPub {
+            decl = decl[1:]
+        }
+        first, rest := inBody, inBody
+        if len(decl) > 0 {
+            switch decl[0].Ty {
+            case parser.TokenUse:
+                first, rest = inUse, inUse
+            case parser.TokenFunction:
+                first = inSignature
+            case parser.TokenTypeKW:
+                first = inType
+                for _, toks := range tokens[start:end] {
+                    for _, tok := range toks {
+                        if tok.Ty == parser.TokenPipe {
+                            first = inVariant
+                        }
+                    }
+                }
+                rest = first
+            }
+        }
+        contexts[start] = first
+        for i := start + 1; i < end; i++ {
+            contexts[i] = rest
+        }
+        start = end
+    }
+    return contexts
+}
+
+// the class of the name toks[j] which is not resolved, by where it is
+func guess(ctx context, toks []*parser.Token, j int, braces bool) (Class, bool) {
+    tok := toks[j]
+    upper := util.IsUpper(rune(tok.Value[0]))
+    prev := parser.TokenEOF
+    if j > 0 {
+        prev = toks[j - 1].Ty
+    }
+    next := parser.TokenEOF
+    if j + 1 < len(toks) {
+        next = toks[j + 1].Ty
+    }
+    switch ctx {
+    case inUse:
+        if !braces {
+            return Module, true
+        }
+        if upper {
+            return Type, true
+        }
+        return Function, true
+    case inSignature:
+        if upper {
+            return Type, true
+        }
+        if prev == parser.TokenFunction {
+            return Function, true
+        }
+        return Parameter, true
+    case inType, inVariant:
+        if !upper {
+            return 0, false // a tag
+        }
+        if ctx == inVariant && (prev == parser.TokenAssign || prev == parser.TokenPipe) {
+            return Constructor, true
+        }
+        return Type, true
+    }
+    if upper {
+        return Constructor, true
+    }
+    if next == parser.TokenColon {
+        return 0, false // a tag
+    }
+    return Variable, true
+}
+
+// the classes of the names unit declares and uses, by the position of
+// their first segment
+func resolved(unit *parser.ASTCompilationUnit, info *check.Info) map[parser.Pos]Class {
+    names := make(map[parser.Pos]Class)
+    if unit == nil {
+        return names
+    }
+    key := func(p parser.Pos) parser.Pos {
+        return parser.Pos{Line: p.Line, Col: p.Col}
+    }
+    functions := make(map[string]bool)
+    for _, decl := range unit.Declarations {
+        switch d := decl.(type) {
+        case *parser.ASTFunction:
+            functions[d.Name] = true
+            names[key(d.Pos)] = Function
+            for _, p := range d.Parameters {
+                names[key(p.Pos)] = Parameter
+            }
+        case *parser.ASTTypeDeclaration:
+            names[key(d.Pos)] = Type
+        }
+    }
+    for _, decl := range unit.Declarations {
+        fn, ok := decl.(*parser.ASTFunction)
+        if !ok || fn.Body == nil {
+            continue
+        }
+        params := make(map[string]bool)
+        for _, p := range fn.Parameters {
+            params[p.Name] = true
+        }
+        for _, x := range fn.Body.Children {
+            walk(x, func(node interface{}) {
+                switch n := node.(type) {
+                case parser.IdentExpr:
+                    names[key(n.Pos)] = identClass(n, info, functions, params)
+                case parser.ConstructorExpr:
+                    names[key(n.Pos)] = Constructor
+                case parser.BindingPattern:
+                    names[key(n.Pos)] = Variable
+                }
+            })
+        }
+    }
+    return names
+}
+
+// what the identifier refers to as the checker resolved it, or else as
+// the names of the unit suggest
+func identClass(e parser.IdentExpr, info *check.Info, functions map[string]bool, params map[string]bool) Class {
+    if info != nil {
+        if sym, ok := info.Symbols[e.Pos]; ok {
+            switch sym.Kind {
+            case check.SymbolFunction:
+                return Function
+            case check.SymbolParameter:
+                return Parameter
+            }
+            return Variable
+        }
+    }
+    switch {
+    case strings.Contains(e.Ident, "::"), functions[e.Ident] && !params[e.Ident]:
+        return Function
+    case params[e.Ident]:
+        return Parameter
+    }
+    return Variable
+}
+
+// calls fn on the expressions and patterns of x
+func walk(x interface{}, fn func(interface{})) {
+    fn(x)
+    switch x := x.(type) {
+    case parser.NotExpr:
+        walk(x.Expr, fn)
+    case parser.NegateExpr:
+        walk(x.Expr, fn)
+    case parser.AddExpr:
+        walk(x.Left, fn)
+        walk(x.Right, fn)
+    case parser.SubExpr:
+        walk(x.Left, fn)
+        walk(x.Right, fn)
+    case parser.MulExpr:
+        walk(x.Left, fn)
+        walk(x.Right, fn)
+    case parser.DivExpr:
+        walk(x.Left, fn)
+        walk(x.Right, fn)
+    case parser.ModExpr:
+        walk(x.Left, fn)
+        walk(x.Right, fn)
+    case parser.FunctionCallExpr:
+        walk(x.Input, fn)
+        walk(x.Target, fn)
+    case parser.UnsafeAccessExpr:
+        walk(x.Expr, fn)
+    case parser.DefaultExpr:
+        walk(x.Expr, fn)
+        walk(x.Default, fn)
+    case parser.ArrayAccessExpr:
+        walk(x.Target, fn)
+        walk(x.Index, fn)
+    case parser.ArrayExpr:
+        for _, elem := range x.Elements {
+            walk(elem, fn)
+        }
+    case parser.TupleExpr:
+        for _, elem := range x.Elements {
+            walk(elem, fn)
+        }
+    case parser.NamedTupleExpr:
+        for _, entry := range x.Elements {
+            walk(entry.Expr, fn)
+        }
+    case parser.ConstructorExpr:
+        if x.Payload != nil {
+            walk(x.Payload, fn)
+        }
+    case parser.MatchExpr:
+        walk(x.Subject, fn)
+        for _, arm := range x.Arms {
+            walk(arm.Pattern, fn)
+            for _, child := range arm.Body.Children {
+                walk(child, fn)
+            }
+        }
+    case parser.ConstructorPattern:
+        if x.Payload != nil {
+            walk(x.Payload, fn)
+        }
+    case parser.TuplePattern:
+        for _, elem := range x.Elements {
+            walk(elem, fn)
+        }
+    case parser.NamedTuplePattern:
+        for _, entry := range x.Elements {
+            walk(entry.Pattern, fn)
+        }
+    }
+}
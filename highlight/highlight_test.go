@@ -0,0 +1,106 @@
+package highlight
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/check"
+	"github.com/ibex-lang/ibex/loader"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+// the spans of src as "line text class"
+func spans(src string, unit *parser.ASTCompilationUnit, info *check.Info) []string {
+	lines := strings.Split(src, "\n")
+	out := make([]string, 0)
+	for _, s := range Classify(src, unit, info) {
+		out = append(out, fmt.Sprintf("%d %s %s", s.Line, lines[s.Line - 1][s.Col - 1:s.End - 1], s.Class))
+	}
+	return out
+}
+
+func TestClassifyLexical(t *testing.T) {
+	src := "use util::{double, Shape}\n" +
+		"type Shape[T] = Circle (r: T) | Dot\n" +
+		"fn area s: Shape[Int] -> Int // area\n" +
+		"    match s\n" +
+		"        Dot => \"x\" -> util::len\n" +
+		"    \"unterminated"
+	assert.Equal(t, []string{
+		"1 use keyword", "1 util module", "1 double function", "1 Shape type",
+		"2 type keyword", "2 Shape type", "2 T type", "2 = operator", "2 Circle constructor", "2 T type",
+		"2 | operator", "2 Dot constructor",
+		"3 fn keyword", "3 area function", "3 s parameter", "3 Shape type", "3 Int type", "3 -> operator",
+		"3 Int type", "3 // area comment",
+		"4 match keyword", "4 s variable",
+		"5 Dot constructor", "5 => operator", "5 \"x\" string", "5 -> operator", "5 util module", "5 len variable",
+		"6 \"unterminated string",
+	}, spans(src, nil, nil))
+}
+
+func TestClassifyResolved(t *testing.T) {
+	src := "fn double x: Int -> Int\n" +
+		"    x * 2\n" +
+		"fn apply double: Int -> Int\n" +
+		"    match double\n" +
+		"        n => n -> twice\n" +
+		"fn twice x: Int -> Int\n" +
+		"    x -> double"
+	unit, err := parser.ParseFile("a.ibex", src)
+	assert.Nil(t, err)
+	l := loader.NewLoader(nil)
+	_, err = l.LoadUnit("a.ibex", unit)
+	assert.Nil(t, err)
+	info, err := check.CheckModules(l.Modules())
+	assert.Nil(t, err)
+
+	classes := spans(src, unit, info)
+	assert.Contains(t, classes, "2 x parameter")
+	assert.Contains(t, classes, "4 double parameter")
+	assert.Contains(t, classes, "5 n variable")
+	assert.Contains(t, classes, "5 twice function")
+	assert.Contains(t, classes, "7 double function")
+	assert.Contains(t, classes, "2 2 number")
+	// without info the unit still tells parameters from functions
+	assert.Equal(t, classes, spans(src, unit, nil))
+}
+
+func TestTextMate(t *testing.T) {
+	b, err := TextMate()
+	assert.Nil(t, err)
+	var grammar struct {
+		ScopeName string
+		Patterns []rule
+	}
+	assert.Nil(t, json.Unmarshal(b, &grammar))
+	assert.Equal(t, "source.ibex", grammar.ScopeName)
+	for _, r := range grammar.Patterns {
+		_, err := regexp.Compile(r.Match)
+		assert.Nil(t, err, r.Match)
+	}
+	assert.Contains(t, string(b), `"match": "!=|->|`)
+	assert.Len(t, scopes, len(Classes()))
+
+	// a rule has a match or a name, captures only the name
+	var shape struct {
+		Patterns []map[string]interface{}
+	}
+	assert.Nil(t, json.Unmarshal(b, &shape))
+	for _, r := range shape.Patterns {
+		_, match := r["match"]
+		_, name := r["name"]
+		assert.True(t, match || name, r)
+		if captures, ok := r["captures"].(map[string]interface{}); ok {
+			for _, c := range captures {
+				capture := c.(map[string]interface{})
+				assert.Len(t, capture, 1, r)
+				assert.Contains(t, capture, "name", r)
+			}
+		}
+	}
+	assert.NotContains(t, string(b), `"match": ""`)
+}
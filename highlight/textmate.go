@@ -0,0 +1,104 @@
+package highlight
+
+import (
+    "bytes"
+    "encoding/json"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// the TextMate scopes of the classes, in order
+var scopes = [...]string{
+    "keyword.other.ibex",
+    "entity.name.type.ibex",
+    "entity.name.function.ibex",
+    "variable.parameter.ibex",
+    "variable.other.ibex",
+    "entity.name.constant.ibex",
+    "entity.name.namespace.ibex",
+    "constant.numeric.ibex",
+    "string.quoted.double.ibex",
+    "keyword.operator.ibex",
+    "comment.line.double-slash.ibex",
+}
+
+// the TextMate scope of c
+func (c Class) Scope() string {
+    return scopes[c]
+}
+
+const (
+    ident = `[A-Za-z_][A-Za-z0-9_]*`
+    upperIdent = `[A-Z][A-Za-z0-9_]*`
+)
+
+type rule struct {
+    Name string `json:"name,omitempty"`
+    Match string `json:"match,omitempty"`
+    Captures map[string]rule `json:"captures,omitempty"`
+}
+
+// the rule giving the groups of match the scopes of classes
+func captures(match string, classes ...Class) rule {
+    r := rule{Match: match, Captures: make(map[string]rule)}
+    for i, c := range classes {
+        r.Captures[strconv.Itoa(i + 1)] = rule{Name: c.Scope()}
+    }
+    return r
+}
+
+// TextMate gives a grammar for static highlighters, which see a line at
+// a time and cannot resolve names: they tell declared names by the fn or
+// type before them, modules by the :: after them and types from
+// constructors by neither, so all capitalized names are types. The
+// keywords and operators are those of the lexer.
+func TextMate() ([]byte, error) {
+    operators := make([]string, 0)
+    for t := parser.TokenType(0); t <= parser.TokenRBrace; t++ {
+        if t.IsOperator() {
+            operators = append(operators, t.String())
+        }
+    }
+    // longest first so that -> is not read as -
+    sort.Slice(operators, func(i, j int) bool {
+        if len(operators[i]) != len(operators[j]) {
+            return len(operators[i]) > len(operators[j])
+        }
+        return operators[i] < operators[j]
+    })
+    for i, op := range operators {
+        operators[i] = regexp.QuoteMeta(op)
+    }
+    keywords := `\b(?:` + strings.Join(parser.Keywords(), "|") + `)\b`
+
+    grammar := map[string]interface{}{
+        "name": "Ibex",
+        "scopeName": "source.ibex",
+        "fileTypes": []string{"ibex"},
+        "patterns": []rule{
+            {Name: Comment.Scope(), Match: `//.*$`},
+            {Name: String.Scope(), Match: `"[^"]*"`},
+            captures(`\b(fn)\s+(` + ident + `)`, Keyword, Function),
+            captures(`\b(type)\s+(` + upperIdent + `)`, Keyword, Type),
+            captures(`\b(use)\s+((?:` + ident + `::)*` + ident + `)`, Keyword, Module),
+            {Name: Keyword.Scope(), Match: keywords},
+            {Name: Number.Scope(), Match: `\b[0-9]+\b`},
+            captures(`\b(` + ident + `)::`, Module),
+            {Name: Type.Scope(), Match: `\b` + upperIdent + `\b`},
+            {Name: Operator.Scope(), Match: strings.Join(operators, "|")},
+        },
+    }
+    // as the patterns are written, without escaping < and >
+    var b bytes.Buffer
+    enc := json.NewEncoder(&b)
+    enc.SetEscapeHTML(false)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(grammar); err != nil {
+        return nil, err
+    }
+    return b.Bytes(), nil
+}
@@ -0,0 +1,143 @@
+// Package backendtest has the programs every backend is tested on, run
+// by the backend and by the interpreter, which must agree.
+package backendtest
+
+import (
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/interp"
+    "github.com/ibex-lang/ibex/ir"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// the file programs are parsed as, which positions of traps are in
+const File = "test.ibex"
+
+type Program struct {
+    Name string // of golden files
+    Source string
+}
+
+var Programs = []Program{
+    {"fib", `fn fib n: Int -> Int
+    match n
+        0 => 0
+        1 => 1
+        _ => (n - 1 -> fib) + (n - 2 -> fib)
+fn main -> Int
+    20 -> fib`},
+    {"shapes", `type Shape = Circle (r: Int) | Square (side: Int) | Empty
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a
+        Empty => 0
+fn first xs: []?Int -> Int
+    xs[0] ? xs[1]!
+fn main -> ([]Int, []Shape, ?Int)
+    ([Circle (r: 2) -> area, Square (side: 3) -> area, Empty -> area, [None, Some (7)] -> first], [Empty, Circle (r: 1)], None)`},
+    {"tuples", `fn sub (a: Int, b: Int) -> Int
+    a - b
+fn swap p: (Int, Int) -> (Int, Int)
+    match p
+        (x, y) => (y, x)
+fn first p: (Int, Int) -> Int
+    match p -> swap
+        (a, _) => a
+fn apply (f: fn (Int, Int) -> Int, x: Int) -> Int
+    (x, 10) -> f
+fn main -> (Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)
+    ((3, 1) -> sub, (b: 3, a: 1) -> sub, (x: 1, y: 2), (1, 2) -> first, sub, (f: sub, x: 4) -> apply)`},
+    {"list", `type List[T] = Cons (head: T, tail: List[T]) | Nil
+fn id[T] x: T -> T
+    x
+fn len[T] xs: List[T] -> Int
+    match xs
+        Cons (head: _, tail: rest) => 1 + (rest -> len)
+        Nil => 0
+fn greet name: String -> String
+    match name
+        "world" => "hello, world?"
+        _ => name
+fn main -> (List[String], Int, [][]Int, Int, ((), String))
+    (Cons (head: "world" -> greet, tail: Cons (head: "x" -> id, tail: Nil)), 7 -> id, [[1, 4], [2, 3]], Cons (head: 1, tail: Nil) -> len, ((), "a" -> greet))`},
+}
+
+// Trap is a program failing at run time with Message at Pos
+type Trap struct {
+    Source string
+    Level int // of optimization
+    Message string
+    Pos string
+}
+
+var Traps = []Trap{
+    {`fn get (xs: []Int, i: Int) -> Int
+    xs[i]
+fn main -> Int
+    ([1, 2, 3], 5) -> get`, 0, "Index 5 is out of range for an array of length 3", File + ":2:7"},
+    {`fn main -> Int
+    1 / (1 - 1)`, 2, "Division by zero", File + ":2:7"},
+}
+
+// Lowered is a program as backends take it
+type Lowered struct {
+    Modules []*loader.Module
+    Info *check.Info
+    Program *ir.Program
+}
+
+// Lower parses src as File, checks it, lowers it and optimizes it at
+// level
+func Lower(t *testing.T, src string, level int) *Lowered {
+    unit, err := parser.ParseFile(File, src)
+    if err != nil {
+        t.Fatal(err)
+    }
+    mods := []*loader.Module{{Unit: unit}}
+    info, err := check.CheckModules(mods)
+    if err != nil {
+        t.Fatal(err)
+    }
+    p, err := ir.Lower(mods, info)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := ir.Optimize(p, level); err != nil {
+        t.Fatal(err)
+    }
+    return &Lowered{mods, info, p}
+}
+
+// Run generates code for a program and runs it, giving what it prints,
+// with the error it fails with
+type Run func(t *testing.T, l *Lowered) (string, error)
+
+// MatchesInterpreter runs every program at every level of optimization,
+// it must print the value of main as interp.Format does on a line
+func MatchesInterpreter(t *testing.T, run Run) {
+    for _, prog := range Programs {
+        for level := 0; level <= 2; level++ {
+            l := Lower(t, prog.Source, level)
+            expected, err := interp.RunModules(l.Modules, l.Info)
+            assert.Nil(t, err)
+            out, err := run(t, l)
+            assert.Nil(t, err, prog.Name)
+            assert.Equal(t, interp.Format(expected) + "\n", out, "%s at level %d", prog.Name, level)
+        }
+    }
+}
+
+// FailsOnTraps runs every trap, it must fail printing what report gives
+// for the message and position of the trap
+func FailsOnTraps(t *testing.T, run Run, report func(message string, pos string) string) {
+    for _, trap := range Traps {
+        out, err := run(t, Lower(t, trap.Source, trap.Level))
+        assert.NotNil(t, err)
+        assert.Equal(t, report(trap.Message, trap.Pos), out)
+    }
+}
@@ -0,0 +1,367 @@
+package interp
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// a call deeper than this is reported as a stack overflow
+const maxDepth = 10000
+
+type RuntimeError struct {
+    Message string
+    Trace []Frame // innermost call first
+}
+
+// Pos is where the function was when the error happened, the trapping
+// expression for the innermost frame and the call for the others
+type Frame struct {
+    Function string
+    Pos parser.Pos
+    Repeats int // further frames like this one below it, see Collapse
+}
+
+func (e *RuntimeError) Error() string {
+    var b strings.Builder
+    b.WriteString("Runtime error: " + e.Message)
+    for _, f := range e.Trace {
+        fmt.Fprintf(&b, "\n    in fn %s at %s", f.Function, f.Pos)
+        if f.Repeats > 0 {
+            fmt.Fprintf(&b, "\n    ... %d more calls to %s", f.Repeats, f.Function)
+        }
+    }
+    return b.String()
+}
+
+// trace with each run of frames of one function at one position, as
+// recursion leaves them, counted in the Repeats of its first frame, so
+// a stack overflow takes a line or two instead of thousands
+func Collapse(trace []Frame) []Frame {
+    collapsed := make([]Frame, 0, len(trace))
+    for _, f := range trace {
+        if n := len(collapsed); n > 0 && collapsed[n - 1].Function == f.Function &&
+            collapsed[n - 1].Pos == f.Pos {
+            collapsed[n - 1].Repeats += 1 + f.Repeats
+            continue
+        }
+        collapsed = append(collapsed, f)
+    }
+    return collapsed
+}
+
+type env struct {
+    vars map[string]Value
+    parent *env
+}
+
+func newEnv(parent *env) *env {
+    return &env{make(map[string]Value), parent}
+}
+
+func (e *env) lookup(name string) Value {
+    for ; e != nil; e = e.parent {
+        if v, ok := e.vars[name]; ok {
+            return v
+        }
+    }
+    return nil
+}
+
+// Interpreter evaluates checked programs directly on their AST
+type Interpreter struct {
+    funcs map[string]*parser.ASTFunction // by canonical name
+    info *check.Info
+    stack []*Frame
+}
+
+func New(mods []*loader.Module, info *check.Info) *Interpreter {
+    funcs := make(map[string]*parser.ASTFunction)
+    for _, m := range mods {
+        for _, d := range m.Unit.Declarations {
+            if fn, ok := d.(*parser.ASTFunction); ok {
+                funcs[check.Canonical(m, fn.Name)] = fn
+            }
+        }
+    }
+    return &Interpreter{funcs: funcs, info: info}
+}
+
+// checks and runs a single unit
+func Run(unit *parser.ASTCompilationUnit) (Value, error) {
+    info, err := check.Check(unit)
+    if err != nil {
+        return nil, err
+    }
+    return RunModules([]*loader.Module{{Unit: unit}}, info)
+}
+
+// runs fn main of a checked program, the value of main is the result
+func RunModules(mods []*loader.Module, info *check.Info) (Value, error) {
+    i := New(mods, info)
+    main, ok := i.funcs["main"]
+    if !ok {
+        return nil, fmt.Errorf("No fn main")
+    }
+    if len(main.Parameters) != 0 {
+        return nil, fmt.Errorf("fn main must not take parameters")
+    }
+    return i.Call("main", Unit)
+}
+
+// calls the function with canonical name with an argument following
+// the calling convention, see check.argumentType
+func (i *Interpreter) Call(name string, arg Value) (Value, error) {
+    i.stack = i.stack[:0]
+    return i.call(Function{name}, arg)
+}
+
+func (i *Interpreter) call(f Function, arg Value) (Value, error) {
+    fn, ok := i.funcs[f.Name]
+    if !ok {
+        return nil, i.fail(parser.Pos{}, "Unknown fn %s", f.Name)
+    }
+    if fn.Body == nil {
+        return nil, i.fail(parser.Pos{}, "fn %s has no body", f.Name)
+    }
+    if len(i.stack) == maxDepth {
+        return nil, i.fail(parser.Pos{}, "Stack overflow")
+    }
+
+    i.stack = append(i.stack, &Frame{Function: f.Name, Pos: fn.Pos})
+    vars := newEnv(nil)
+    bindArguments(fn, arg, vars)
+
+    v, err := i.evalBody(fn.Body, vars)
+    if err != nil {
+        return nil, err
+    }
+    i.stack = i.stack[:len(i.stack) - 1]
+    return v, nil
+}
+
+// several parameters arrive as a positional or a named tuple
+func bindArguments(fn *parser.ASTFunction, arg Value, vars *env) {
+    switch len(fn.Parameters) {
+    case 0:
+    case 1:
+        vars.vars[fn.Parameters[0].Name] = arg
+    default:
+        for j, p := range fn.Parameters {
+            switch a := arg.(type) {
+            case Tuple:
+                vars.vars[p.Name] = a[j]
+            case NamedTuple:
+                vars.vars[p.Name], _ = a.Field(p.Name)
+            }
+        }
+    }
+}
+
+// the position of an empty pos is the one of the current frame
+func (i *Interpreter) fail(pos parser.Pos, format string, args ...interface{}) *RuntimeError {
+    if len(i.stack) > 0 && pos != (parser.Pos{}) {
+        i.stack[len(i.stack) - 1].Pos = pos
+    }
+    trace := make([]Frame, len(i.stack))
+    for j, f := range i.stack {
+        trace[len(i.stack) - 1 - j] = *f
+    }
+    return &RuntimeError{fmt.Sprintf(format, args...), Collapse(trace)}
+}
+
+// the value of a body is the value of its last line
+func (i *Interpreter) evalBody(body *parser.ASTBody, vars *env) (Value, error) {
+    var v Value = Unit
+    for _, node := range body.Children {
+        result, err := i.eval(node, vars)
+        if err != nil {
+            return nil, err
+        }
+        v = result
+    }
+    return v, nil
+}
+
+func (i *Interpreter) eval(expr parser.Expression, vars *env) (Value, error) {
+    switch e := expr.(type) {
+    case parser.IdentExpr:
+        if sym := i.info.Symbols[e.Pos]; sym.Kind == check.SymbolFunction {
+            return Function{sym.Name}, nil
+        }
+        return vars.lookup(e.Ident), nil
+
+    case parser.StringExpr:
+        return e.String, nil
+
+    case parser.NumberExpr:
+        n, err := strconv.ParseInt(e.Number, 10, 64)
+        if err != nil {
+            return nil, i.fail(parser.Pos{}, "Invalid number %s", e.Number)
+        }
+        return n, nil
+
+    case parser.NotExpr:
+        v, err := i.eval(e.Expr, vars)
+        if err != nil {
+            return nil, err
+        }
+        return !v.(bool), nil
+
+    case parser.NegateExpr:
+        v, err := i.eval(e.Expr, vars)
+        if err != nil {
+            return nil, err
+        }
+        return -v.(int64), nil
+
+    case parser.AddExpr:
+        return i.arithmetic(e.Left, e.Right, vars, func(a, b int64) int64 { return a + b })
+    case parser.SubExpr:
+        return i.arithmetic(e.Left, e.Right, vars, func(a, b int64) int64 { return a - b })
+    case parser.MulExpr:
+        return i.arithmetic(e.Left, e.Right, vars, func(a, b int64) int64 { return a * b })
+    case parser.DivExpr:
+        return i.division(e.Left, e.Right, e.Pos, vars, func(a, b int64) int64 { return a / b })
+    case parser.ModExpr:
+        return i.division(e.Left, e.Right, e.Pos, vars, func(a, b int64) int64 { return a % b })
+
+    case parser.FunctionCallExpr:
+        arg, err := i.eval(e.Input, vars)
+        if err != nil {
+            return nil, err
+        }
+        target, err := i.eval(e.Target, vars)
+        if err != nil {
+            return nil, err
+        }
+        i.stack[len(i.stack) - 1].Pos = e.Pos
+        return i.call(target.(Function), arg)
+
+    case parser.ArrayAccessExpr:
+        target, err := i.eval(e.Target, vars)
+        if err != nil {
+            return nil, err
+        }
+        index, err := i.eval(e.Index, vars)
+        if err != nil {
+            return nil, err
+        }
+        array, n := target.(Array), index.(int64)
+        if n < 0 || n >= int64(len(array)) {
+            return nil, i.fail(e.Pos, "Index %d is out of range for an array of length %d",
+                n, len(array))
+        }
+        return array[n], nil
+
+    case parser.ArrayExpr:
+        elems, err := i.evalAll(e.Elements, vars)
+        return Array(elems), err
+
+    case parser.TupleExpr:
+        elems, err := i.evalAll(e.Elements, vars)
+        return Tuple(elems), err
+
+    case parser.NamedTupleExpr:
+        tuple := NamedTuple{make([]string, len(e.Elements)), make([]Value, len(e.Elements))}
+        for j, elem := range e.Elements {
+            v, err := i.eval(elem.Expr, vars)
+            if err != nil {
+                return nil, err
+            }
+            tuple.Tags[j], tuple.Values[j] = elem.Tag, v
+        }
+        return tuple, nil
+
+    case parser.ConstructorExpr:
+        variant := Variant{Tag: unqualified(e.Tag)}
+        if e.Payload != nil {
+            v, err := i.eval(e.Payload, vars)
+            if err != nil {
+                return nil, err
+            }
+            variant.Payload = v
+        }
+        return variant, nil
+
+    case parser.MatchExpr:
+        return i.evalMatch(e, vars)
+
+    case parser.UnsafeAccessExpr:
+        v, err := i.eval(e.Expr, vars)
+        if err != nil {
+            return nil, err
+        }
+        opt := v.(Variant)
+        if opt.Tag == "None" {
+            return nil, i.fail(e.Pos, "Unwrapped None")
+        }
+        return opt.Payload, nil
+
+    case parser.DefaultExpr:
+        v, err := i.eval(e.Expr, vars)
+        if err != nil {
+            return nil, err
+        }
+        if opt := v.(Variant); opt.Tag == "Some" {
+            return opt.Payload, nil
+        }
+        return i.eval(e.Default, vars)
+    }
+
+    return nil, i.fail(parser.Pos{}, "Unsupported expression %T", expr)
+}
+
+func (i *Interpreter) evalAll(exprs []parser.Expression, vars *env) ([]Value, error) {
+    values := make([]Value, len(exprs))
+    for j, expr := range exprs {
+        v, err := i.eval(expr, vars)
+        if err != nil {
+            return nil, err
+        }
+        values[j] = v
+    }
+    return values, nil
+}
+
+func (i *Interpreter) arithmetic(left, right parser.Expression, vars *env,
+    op func(a, b int64) int64) (Value, error) {
+
+    l, err := i.eval(left, vars)
+    if err != nil {
+        return nil, err
+    }
+    r, err := i.eval(right, vars)
+    if err != nil {
+        return nil, err
+    }
+    return op(l.(int64), r.(int64)), nil
+}
+
+func (i *Interpreter) division(left, right parser.Expression, pos parser.Pos,
+    vars *env, op func(a, b int64) int64) (Value, error) {
+
+    l, err := i.eval(left, vars)
+    if err != nil {
+        return nil, err
+    }
+    r, err := i.eval(right, vars)
+    if err != nil {
+        return nil, err
+    }
+    if r.(int64) == 0 {
+        return nil, i.fail(pos, "Division by zero")
+    }
+    return op(l.(int64), r.(int64)), nil
+}
+
+func unqualified(tag string) string {
+    if j := strings.LastIndex(tag, "::"); j >= 0 {
+        return tag[j + 2:]
+    }
+    return tag
+}
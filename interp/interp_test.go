@@ -0,0 +1,93 @@
+package interp
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/parser"
+)
+
+func runSource(t *testing.T, src string) (string, error) {
+	unit, err := parser.ParseFile("test.ibex", src)
+	if err != nil {
+		return "", err
+	}
+	v, err := Run(unit)
+	if err != nil {
+		return "", err
+	}
+	return Format(v), nil
+}
+
+func TestRunArithmetic(t *testing.T) {
+	out, err := runSource(t, `fn fact n: Int -> Int
+    match n
+        0 => 1
+        _ => n * (n - 1 -> fact)
+fn main -> Int
+    (5 -> fact) - 100 / 7 % 4`)
+	assert.Nil(t, err)
+	assert.Equal(t, "118", out)
+}
+
+func TestRunTuples(t *testing.T) {
+	out, err := runSource(t, `fn sub (a: Int, b: Int) -> Int
+    a - b
+fn swap p: (Int, Int) -> (Int, Int)
+    match p
+        (x, y) => (y, x)
+fn first p: (Int, Int) -> Int
+    match p -> swap
+        (a, _) => a
+fn main -> (Int, Int, (x: Int, y: Int), Int)
+    ((3, 1) -> sub, (b: 3, a: 1) -> sub, (x: 1, y: 2), (1, 2) -> first)`)
+	assert.Nil(t, err)
+	assert.Equal(t, "(2, -2, (x: 1, y: 2), 2)", out)
+}
+
+func TestRunArraysAndVariants(t *testing.T) {
+	out, err := runSource(t, `type Shape = Circle (r: Int) | Square (side: Int) | Empty
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a
+        Empty => 0
+fn first xs: []?Int -> Int
+    xs[0] ? xs[1]!
+fn main -> []Int
+    [Circle (r: 2) -> area, Square (side: 3) -> area, Empty -> area, [None, Some (7)] -> first]`)
+	assert.Nil(t, err)
+	assert.Equal(t, "[12, 9, 0, 7]", out)
+}
+
+func TestRunTrace(t *testing.T) {
+	_, err := runSource(t, `fn get (xs: []Int, i: Int) -> Int
+    xs[i]
+fn main -> Int
+    ([1, 2, 3], 5) -> get`)
+	assert.EqualError(t, err, `Runtime error: Index 5 is out of range for an array of length 3
+    in fn get at test.ibex:2:7
+    in fn main at test.ibex:4:20`)
+
+	_, err = runSource(t, `fn main -> Int
+    1 / (1 - 1)`)
+	assert.EqualError(t, err, `Runtime error: Division by zero
+    in fn main at test.ibex:2:7`)
+
+	_, err = runSource(t, `fn unwrap x: ?Int -> Int
+    x!
+fn main -> Int
+    None -> unwrap`)
+	assert.EqualError(t, err, `Runtime error: Unwrapped None
+    in fn unwrap at test.ibex:2:6
+    in fn main at test.ibex:4:10`)
+
+	_, err = runSource(t, `fn loop n: Int -> Int
+    n + 1 -> loop
+fn main -> Int
+    0 -> loop`)
+	assert.EqualError(t, err, `Runtime error: Stack overflow
+    in fn loop at test.ibex:2:11
+    ... 9998 more calls to loop
+    in fn main at test.ibex:4:7`)
+}
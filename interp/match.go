@@ -0,0 +1,82 @@
+package interp
+
+import "github.com/ibex-lang/ibex/parser"
+
+// the first arm whose pattern matches is taken
+func (i *Interpreter) evalMatch(e parser.MatchExpr, vars *env) (Value, error) {
+    subject, err := i.eval(e.Subject, vars)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, arm := range e.Arms {
+        armVars := newEnv(vars)
+        matches, err := i.match(arm.Pattern, subject, armVars)
+        if err != nil {
+            return nil, err
+        }
+        if matches {
+            return i.evalBody(arm.Body, armVars)
+        }
+    }
+
+    return nil, i.fail(e.Pos, "No arm matches %s", Format(subject))
+}
+
+// binds the names of p in vars, which are discarded when it does not match
+func (i *Interpreter) match(p parser.Pattern, v Value, vars *env) (bool, error) {
+    switch p := p.(type) {
+    case parser.WildcardPattern:
+        return true, nil
+
+    case parser.BindingPattern:
+        vars.vars[p.Name] = v
+        return true, nil
+
+    case parser.LiteralPattern:
+        lit, err := i.eval(p.Literal, vars)
+        if err != nil {
+            return false, err
+        }
+        return lit == v, nil
+
+    case parser.ConstructorPattern:
+        variant := v.(Variant)
+        if variant.Tag != unqualified(p.Tag) {
+            return false, nil
+        }
+        if p.Payload == nil {
+            return true, nil
+        }
+        return i.match(p.Payload, variant.Payload, vars)
+
+    case parser.TuplePattern:
+        var elems []Value
+        switch t := v.(type) {
+        case Tuple:
+            elems = t
+        case NamedTuple:
+            elems = t.Values
+        }
+        for j, elem := range p.Elements {
+            matches, err := i.match(elem, elems[j], vars)
+            if err != nil || !matches {
+                return false, err
+            }
+        }
+        return true, nil
+
+    case parser.NamedTuplePattern:
+        tuple := v.(NamedTuple)
+        for _, entry := range p.Elements {
+            field, _ := tuple.Field(entry.Tag)
+            matches, err := i.match(entry.Pattern, field, vars)
+            if err != nil || !matches {
+                return false, err
+            }
+        }
+        return true, nil
+    }
+
+    return false, i.fail(parser.Pos{}, "Unsupported pattern %T", p)
+}
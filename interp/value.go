@@ -0,0 +1,86 @@
+package interp
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Value is one of int64, string, bool, Tuple, NamedTuple, Array, Variant
+// or Function
+type Value interface{}
+
+// () is the empty tuple
+type Tuple []Value
+
+var Unit = Tuple{}
+
+type NamedTuple struct {
+    Tags []string
+    Values []Value
+}
+
+func (t NamedTuple) Field(tag string) (Value, bool) {
+    for i, name := range t.Tags {
+        if name == tag {
+            return t.Values[i], true
+        }
+    }
+    return nil, false
+}
+
+type Array []Value
+
+// Tag is unqualified, a match only ever compares tags of one type
+type Variant struct {
+    Tag string
+    Payload Value // nil when absent
+}
+
+// Name is canonical, see check.Canonical
+type Function struct {
+    Name string
+}
+
+func Format(v Value) string {
+    switch v := v.(type) {
+    case int64:
+        return strconv.FormatInt(v, 10)
+    case string:
+        return strconv.Quote(v)
+    case bool:
+        return strconv.FormatBool(v)
+    case Tuple:
+        return "(" + formatAll(v) + ")"
+    case NamedTuple:
+        fields := make([]string, len(v.Tags))
+        for i, tag := range v.Tags {
+            fields[i] = tag + ": " + Format(v.Values[i])
+        }
+        return "(" + strings.Join(fields, ", ") + ")"
+    case Array:
+        return "[" + formatAll(v) + "]"
+    case Variant:
+        if v.Payload == nil {
+            return v.Tag
+        }
+        if _, ok := v.Payload.(Tuple); ok {
+            return v.Tag + " " + Format(v.Payload)
+        }
+        if _, ok := v.Payload.(NamedTuple); ok {
+            return v.Tag + " " + Format(v.Payload)
+        }
+        return v.Tag + " (" + Format(v.Payload) + ")"
+    case Function:
+        return "fn " + v.Name
+    }
+    return fmt.Sprintf("%v", v)
+}
+
+func formatAll(values []Value) string {
+    elems := make([]string, len(values))
+    for i, v := range values {
+        elems[i] = Format(v)
+    }
+    return strings.Join(elems, ", ")
+}
@@ -0,0 +1,66 @@
+package ir
+
+import (
+    "fmt"
+    "sort"
+
+    "github.com/ibex-lang/ibex/core"
+)
+
+type cseKey struct {
+    op Op
+    ty Type
+    source string // values of checked types sharing a representation differ
+    aux interface{}
+    args string // IDs
+}
+
+func commutative(op Op) bool {
+    return op == OpAdd || op == OpMul || op == OpEq
+}
+
+func keyOf(v *Value) cseKey {
+    args := make([]int, len(v.Args))
+    for i, arg := range v.Args {
+        args[i] = arg.ID
+    }
+    if commutative(v.Op) {
+        sort.Ints(args)
+    }
+    source := ""
+    if v.Source != nil {
+        source = core.TypeString(v.Source)
+    }
+    return cseKey{v.Op, v.Type, source, v.Aux, fmt.Sprint(args)}
+}
+
+// Common subexpression elimination replaces a value by an equal one that
+// dominates it. Ibex values are immutable, so only the calls, which may
+// not terminate, and the phis, which depend on the path taken, are kept.
+func cse(f *Function) {
+    dom := f.Dominators()
+    m := make(map[*Value]*Value)
+    seen := make(map[cseKey][]*Value)
+    for _, b := range f.Blocks {
+        for _, v := range b.Values {
+            for i, arg := range v.Args {
+                v.Args[i] = resolve(m, arg)
+            }
+            if v.Op == OpCall || v.Op == OpCallInd || v.Op == OpPhi {
+                continue
+            }
+            key := keyOf(v)
+            for _, other := range seen[key] {
+                if dom.Dominates(other.Block, b) {
+                    m[v] = other
+                    break
+                }
+            }
+            if m[v] == nil {
+                seen[key] = append(seen[key], v)
+            }
+        }
+    }
+    f.replace(m)
+    f.Renumber()
+}
@@ -0,0 +1,82 @@
+package ir
+
+// the value has no effect besides its result
+func (v *Value) pure() bool {
+    return !v.Op.Traps() && v.Op != OpCall && v.Op != OpCallInd
+}
+
+// Dead code elimination removes the pure values nothing uses and merges
+// each block into its predecessor when it is the only successor of its
+// only predecessor.
+func dce(f *Function) {
+    uses := make(map[*Value]int)
+    for _, b := range f.Blocks {
+        for _, v := range b.Values {
+            for _, arg := range v.Args {
+                uses[arg]++
+            }
+        }
+        if b.Control != nil {
+            uses[b.Control]++
+        }
+    }
+    dead := make(map[*Value]bool)
+    var kill func(v *Value)
+    kill = func(v *Value) {
+        dead[v] = true
+        for _, arg := range v.Args {
+            if uses[arg]--; uses[arg] == 0 && arg.pure() {
+                kill(arg)
+            }
+        }
+    }
+    for _, b := range f.Blocks {
+        for _, v := range b.Values {
+            if uses[v] == 0 && v.pure() && !dead[v] {
+                kill(v)
+            }
+        }
+    }
+    for _, b := range f.Blocks {
+        values := b.Values[:0]
+        for _, v := range b.Values {
+            if !dead[v] {
+                values = append(values, v)
+            }
+        }
+        b.Values = values
+    }
+
+    m := make(map[*Value]*Value)
+    merged := make(map[*Block]bool)
+    for _, b := range f.Blocks {
+        for !merged[b] && b.Kind == BlockJump && len(b.Succs[0].Preds) == 1 && b.Succs[0] != b {
+            merged[b.Succs[0]] = true
+            b.merge(b.Succs[0], m)
+        }
+    }
+    f.replace(m)
+    f.Renumber()
+}
+
+// appends s to b, its phis are replaced by their only argument
+func (b *Block) merge(s *Block, m map[*Value]*Value) {
+    for _, v := range s.Values {
+        if v.Op == OpPhi {
+            m[v] = v.Args[0]
+            continue
+        }
+        v.Block = b
+        b.Values = append(b.Values, v)
+    }
+    b.Kind, b.Control, b.Message, b.Pos = s.Kind, s.Control, s.Message, s.Pos
+    b.Succs = s.Succs
+    for _, t := range b.Succs {
+        for i, p := range t.Preds {
+            if p == s {
+                t.Preds[i] = b
+            }
+        }
+    }
+    s.Values, s.Succs, s.Preds = nil, nil, nil
+}
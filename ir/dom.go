@@ -0,0 +1,107 @@
+package ir
+
+// the blocks reachable from the entry, each after all of its successors
+// unless a loop gets in the way
+func (f *Function) Postorder() []*Block {
+    order := make([]*Block, 0, len(f.Blocks))
+    seen := make(map[*Block]bool)
+    var visit func(b *Block)
+    visit = func(b *Block) {
+        seen[b] = true
+        for _, s := range b.Succs {
+            if !seen[s] {
+                visit(s)
+            }
+        }
+        order = append(order, b)
+    }
+    if len(f.Blocks) > 0 {
+        visit(f.Blocks[0])
+    }
+    return order
+}
+
+type DomTree struct {
+    idom map[*Block]*Block // the entry is its own
+    rpo map[*Block]int
+}
+
+// computes the dominator tree of the reachable blocks as described in
+// "A Simple, Fast Dominance Algorithm" by Cooper, Harvey and Kennedy
+func (f *Function) Dominators() *DomTree {
+    post := f.Postorder()
+    d := &DomTree{make(map[*Block]*Block), make(map[*Block]int)}
+    for i, b := range post {
+        d.rpo[b] = len(post) - 1 - i
+    }
+    if len(post) == 0 {
+        return d
+    }
+    entry := f.Blocks[0]
+    d.idom[entry] = entry
+
+    for changed := true; changed; {
+        changed = false
+        for i := len(post) - 2; i >= 0; i-- {
+            b := post[i]
+            var idom *Block
+            for _, p := range b.Preds {
+                if _, done := d.idom[p]; !done {
+                    continue
+                }
+                if idom == nil {
+                    idom = p
+                } else {
+                    idom = d.intersect(p, idom)
+                }
+            }
+            if d.idom[b] != idom {
+                d.idom[b] = idom
+                changed = true
+            }
+        }
+    }
+    return d
+}
+
+func (d *DomTree) intersect(a, b *Block) *Block {
+    for a != b {
+        for d.rpo[a] > d.rpo[b] {
+            a = d.idom[a]
+        }
+        for d.rpo[b] > d.rpo[a] {
+            b = d.idom[b]
+        }
+    }
+    return a
+}
+
+// nil for the entry and unreachable blocks
+func (d *DomTree) Idom(b *Block) *Block {
+    if idom := d.idom[b]; idom != b {
+        return idom
+    }
+    return nil
+}
+
+func (d *DomTree) Reachable(b *Block) bool {
+    _, ok := d.idom[b]
+    return ok
+}
+
+// every block dominates itself
+func (d *DomTree) Dominates(a, b *Block) bool {
+    if !d.Reachable(b) {
+        return false
+    }
+    for {
+        if a == b {
+            return true
+        }
+        next := d.idom[b]
+        if next == b {
+            return false
+        }
+        b = next
+    }
+}
@@ -0,0 +1,165 @@
+package ir
+
+import "github.com/ibex-lang/ibex/parser"
+
+// Constant folding evaluates operations on constants, propagating the
+// results, and follows values through the aggregates they were put in.
+// Branches on constants become jumps, dropping the blocks that are no
+// longer reachable. Operations that would trap are left alone.
+func fold(f *Function) {
+    for changed := true; changed; {
+        changed = false
+        m := make(map[*Value]*Value)
+        for _, b := range f.Blocks {
+            for _, v := range b.Values {
+                for i, arg := range v.Args {
+                    v.Args[i] = resolve(m, arg)
+                }
+                if r := simplify(v); r != nil {
+                    m[v] = r
+                }
+            }
+            if b.Kind == BlockIf {
+                if c := resolve(m, b.Control); c.Op == OpConst {
+                    untaken := 0
+                    if c.Aux.(bool) {
+                        untaken = 1
+                    }
+                    b.removeEdge(untaken)
+                    b.Kind, b.Control = BlockJump, nil
+                    changed = true
+                }
+            }
+        }
+        f.replace(m)
+        f.Renumber()
+    }
+}
+
+func (v *Value) setConst(aux interface{}) {
+    v.Op, v.Aux, v.Args, v.Pos = OpConst, aux, nil, parser.Pos{}
+}
+
+func isConst(v *Value, aux interface{}) bool {
+    return v.Op == OpConst && v.Aux == aux
+}
+
+// either rewrites v in place or returns the value that replaces it
+func simplify(v *Value) *Value {
+    var x, y *Value
+    if len(v.Args) > 0 {
+        x = v.Args[0]
+    }
+    if len(v.Args) > 1 {
+        y = v.Args[1]
+    }
+    switch v.Op {
+    case OpAdd, OpSub, OpMul, OpDiv, OpMod:
+        if v.Type != Int {
+            return nil
+        }
+        if x.Op == OpConst && y.Op == OpConst {
+            if r, ok := arithmetic(v.Op, x.Aux.(int64), y.Aux.(int64)); ok {
+                v.setConst(r)
+            }
+            return nil
+        }
+        return identity(v.Op, x, y, v)
+
+    case OpNeg:
+        if x.Op == OpConst && v.Type == Int {
+            v.setConst(-x.Aux.(int64))
+        } else if x.Op == OpNeg {
+            return x.Args[0]
+        }
+    case OpNot:
+        if x.Op == OpConst {
+            v.setConst(!x.Aux.(bool))
+        } else if x.Op == OpNot {
+            return x.Args[0]
+        }
+    case OpEq:
+        switch {
+        case x.Op == OpConst && y.Op == OpConst, x.Op == OpString && y.Op == OpString:
+            v.setConst(x.Aux == y.Aux)
+        case x == y && x.Type != F64:
+            v.setConst(true)
+        }
+
+    case OpTag:
+        if x.Op == OpVariant {
+            v.setConst(int64(x.Aux.(int)))
+        }
+    case OpPayload:
+        if x.Op == OpVariant && x.Aux == v.Aux && len(x.Args) == 1 {
+            return x.Args[0]
+        }
+    case OpElem:
+        if x.Op == OpTuple {
+            return x.Args[v.Aux.(int)]
+        }
+    case OpIndex:
+        if x.Op == OpArray && y.Op == OpConst {
+            if i := y.Aux.(int64); i >= 0 && i < int64(len(x.Args)) {
+                return x.Args[i]
+            }
+        }
+
+    case OpCallInd:
+        if x.Op == OpFunc {
+            v.Op, v.Aux, v.Args = OpCall, x.Aux, v.Args[1:]
+        }
+    case OpPhi:
+        var same *Value
+        for _, arg := range v.Args {
+            if arg == v || arg == same {
+                continue
+            }
+            if same != nil {
+                return nil
+            }
+            same = arg
+        }
+        return same
+    }
+    return nil
+}
+
+// ok is false when the operation traps
+func arithmetic(op Op, x, y int64) (int64, bool) {
+    switch op {
+    case OpAdd:
+        return x + y, true
+    case OpSub:
+        return x - y, true
+    case OpMul:
+        return x * y, true
+    case OpDiv:
+        if y == 0 {
+            return 0, false
+        }
+        return x / y, true
+    }
+    if y == 0 {
+        return 0, false
+    }
+    return x % y, true
+}
+
+// x + 0, 0 + x, x - 0, x * 1, 1 * x, x / 1 and x * 0, 0 * x, x % 1
+func identity(op Op, x, y *Value, v *Value) *Value {
+    zero, one := int64(0), int64(1)
+    switch {
+    case op == OpAdd && isConst(x, zero):
+        return y
+    case (op == OpAdd || op == OpSub) && isConst(y, zero):
+        return x
+    case op == OpMul && isConst(x, one):
+        return y
+    case (op == OpMul || op == OpDiv) && isConst(y, one):
+        return x
+    case op == OpMul && (isConst(x, zero) || isConst(y, zero)), op == OpMod && isConst(y, one):
+        v.setConst(zero)
+    }
+    return nil
+}
@@ -0,0 +1,126 @@
+package ir
+
+// functions with at most this many values are inlined
+const inlineLimit = 16
+
+// small functions that return at all
+func (f *Function) inlinable() bool {
+    n, returns := 0, false
+    for _, b := range f.Blocks {
+        n += len(b.Values)
+        returns = returns || b.Kind == BlockReturn
+    }
+    return returns && n <= inlineLimit
+}
+
+// Inlining replaces the direct calls of small functions by a copy of
+// their body. Calls in the copies are left for the next run, so that
+// recursive functions are unrolled only once.
+func inline(p *Program) {
+    for _, f := range p.Functions {
+        calls := make([]*Value, 0)
+        for _, b := range f.Blocks {
+            for _, v := range b.Values {
+                if v.Op != OpCall {
+                    continue
+                }
+                callee := p.Lookup(v.Aux.(string))
+                if callee != f && callee.inlinable() {
+                    calls = append(calls, v)
+                }
+            }
+        }
+        if len(calls) == 0 {
+            continue
+        }
+        m := make(map[*Value]*Value)
+        for _, call := range calls {
+            m[call] = f.inlineCall(call, p.Lookup(call.Aux.(string)))
+        }
+        f.replace(m)
+        f.Renumber()
+    }
+}
+
+// splits the block of the call after it and puts a copy of callee in
+// between, returns the value the call results in
+func (f *Function) inlineCall(call *Value, callee *Function) *Value {
+    b := call.Block
+    after := f.NewBlock()
+    for i, v := range b.Values {
+        if v == call {
+            after.Values = append(after.Values, b.Values[i + 1:]...)
+            b.Values = b.Values[:i]
+            break
+        }
+    }
+    for _, v := range after.Values {
+        v.Block = after
+    }
+    after.Kind, after.Control, after.Message, after.Pos = b.Kind, b.Control, b.Message, b.Pos
+    after.Succs = b.Succs
+    for _, s := range after.Succs {
+        for i, p := range s.Preds {
+            if p == b {
+                s.Preds[i] = after
+            }
+        }
+    }
+    b.Succs, b.Control = nil, nil
+
+    // the copies, params are replaced by the arguments
+    blocks := make(map[*Block]*Block)
+    values := make(map[*Value]*Value)
+    for _, cb := range callee.Blocks {
+        blocks[cb] = f.NewBlock()
+    }
+    for _, cb := range callee.Blocks {
+        nb := blocks[cb]
+        for _, v := range cb.Values {
+            if v.Op == OpParam {
+                values[v] = call.Args[v.Aux.(int)]
+                continue
+            }
+            nv := &Value{ID: f.nextValue, Op: v.Op, Type: v.Type, Aux: v.Aux, Block: nb, Pos: v.Pos,
+                Source: v.Source}
+            f.nextValue++
+            nb.Values = append(nb.Values, nv)
+            values[v] = nv
+        }
+    }
+    results := make([]*Value, 0)
+    for _, cb := range callee.Blocks {
+        nb := blocks[cb]
+        for _, v := range cb.Values {
+            if nv := values[v]; v.Op != OpParam {
+                nv.Args = make([]*Value, len(v.Args))
+                for i, arg := range v.Args {
+                    nv.Args[i] = values[arg]
+                }
+            }
+        }
+        for _, p := range cb.Preds {
+            nb.Preds = append(nb.Preds, blocks[p])
+        }
+        for _, s := range cb.Succs {
+            nb.Succs = append(nb.Succs, blocks[s])
+        }
+        nb.Kind, nb.Message, nb.Pos = cb.Kind, cb.Message, cb.Pos
+        if cb.Control != nil {
+            nb.Control = values[cb.Control]
+        }
+        if nb.Kind == BlockReturn {
+            results = append(results, nb.Control)
+            nb.Control = nil
+            nb.Jump(after)
+        }
+    }
+    b.Jump(blocks[callee.Blocks[0]])
+
+    if len(results) == 1 {
+        return results[0]
+    }
+    phi := after.NewValue(OpPhi, call.Type, nil, results...)
+    phi.Source = call.Source
+    return phi
+}
@@ -0,0 +1,245 @@
+package ir
+
+import (
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// Type is the representation of a value. Every Ibex type maps to one of
+// them, see Repr in types.go.
+type Type int
+
+const (
+    Unit Type = iota
+    Int  // 64 bit signed
+    F64
+    Bool
+    Ptr  // a string, tuple, named tuple, array or variant on the heap
+    Func // a function taking its parameters flattened like Lower does
+)
+
+var typeNames = [...]string{"Unit", "Int", "F64", "Bool", "Ptr", "Func"}
+
+func (t Type) String() string {
+    return typeNames[t]
+}
+
+type Op int
+
+// The meaning of Value.Aux depends on the op, see the comment of each.
+// Ops marked as trapping carry the position they trap at in Value.Pos,
+// calls the position of their arrow.
+const (
+    OpParam  Op = iota // index
+    OpConst            // int64
+    OpUnit
+    OpString // string
+    OpFunc   // name of the function
+
+    OpAdd
+    OpSub
+    OpMul
+    OpDiv // traps on zero
+    OpMod // traps on zero
+    OpNeg
+    OpNot
+    OpEq // compares strings by content when its arguments are Ptr
+
+    OpTuple   // elements, named tuples store theirs in the order of their type
+    OpArray   // elements
+    OpVariant // tag index, the payload is the argument if any
+    OpElem    // index, of a tuple
+    OpIndex   // traps when out of range
+    OpTag     // index of the tag of a variant
+    OpPayload // tag index of the case, of a variant
+
+    OpCall    // name of the function
+    OpCallInd // calls the first argument with the others
+    OpPhi     // one argument per predecessor of the block, in order
+)
+
+var opNames = [...]string{
+    "param", "const", "unit", "string", "func",
+    "add", "sub", "mul", "div", "mod", "neg", "not", "eq",
+    "tuple", "array", "variant", "elem", "index", "tag", "payload",
+    "call", "callind", "phi",
+}
+
+func (op Op) String() string {
+    return opNames[op]
+}
+
+func (op Op) Traps() bool {
+    return op == OpDiv || op == OpMod || op == OpIndex
+}
+
+type Value struct {
+    ID int
+    Op Op
+    Type Type
+    Aux interface{}
+    Args []*Value
+    Block *Block
+    Pos parser.Pos
+    // the checked type, for backends that keep apart the types sharing a
+    // representation; nil for values not made by Lower
+    Source core.IbexType
+}
+
+type BlockKind int
+
+const (
+    BlockJump BlockKind = iota // to Succs[0]
+    BlockIf                    // to Succs[0] if Control is true, else to Succs[1]
+    BlockReturn                // Control
+    BlockTrap                  // with Message at Pos
+)
+
+type Block struct {
+    ID int
+    Func *Function
+    Values []*Value // phis first
+    Kind BlockKind
+    Control *Value
+    Succs []*Block
+    Preds []*Block
+    Message string
+    Pos parser.Pos
+}
+
+// Function is one monomorphic function, a generic one is lowered once per
+// instance and named like check.Instance.String.
+type Function struct {
+    Name string
+    Params []Type
+    Return Type
+    Signature core.IbexFunctionType // the checked type, see Value.Source
+    Pos parser.Pos // of the name, zero if not lowered from source
+    Blocks []*Block // Blocks[0] is the entry, none for a declaration
+    nextValue int
+    nextBlock int
+}
+
+type Program struct {
+    Functions []*Function
+    index map[string]*Function
+}
+
+func NewProgram() *Program {
+    return &Program{index: make(map[string]*Function)}
+}
+
+func (p *Program) Add(f *Function) {
+    p.Functions = append(p.Functions, f)
+    p.index[f.Name] = f
+}
+
+func (p *Program) Lookup(name string) *Function {
+    return p.index[name]
+}
+
+func NewFunction(name string, params []Type, ret Type) *Function {
+    return &Function{Name: name, Params: params, Return: ret}
+}
+
+func (f *Function) NewBlock() *Block {
+    b := &Block{ID: f.nextBlock, Func: f}
+    f.nextBlock++
+    f.Blocks = append(f.Blocks, b)
+    return b
+}
+
+// appends a value to b, phis go before the other values
+func (b *Block) NewValue(op Op, ty Type, aux interface{}, args ...*Value) *Value {
+    v := &Value{ID: b.Func.nextValue, Op: op, Type: ty, Aux: aux, Args: args, Block: b}
+    b.Func.nextValue++
+    if op != OpPhi {
+        b.Values = append(b.Values, v)
+        return v
+    }
+    i := 0
+    for i < len(b.Values) && b.Values[i].Op == OpPhi {
+        i++
+    }
+    b.Values = append(b.Values[:i], append([]*Value{v}, b.Values[i:]...)...)
+    return v
+}
+
+func (b *Block) addSucc(s *Block) {
+    b.Succs = append(b.Succs, s)
+    s.Preds = append(s.Preds, b)
+}
+
+func (b *Block) Jump(to *Block) {
+    b.Kind = BlockJump
+    b.addSucc(to)
+}
+
+func (b *Block) If(cond *Value, then *Block, els *Block) {
+    b.Kind, b.Control = BlockIf, cond
+    b.addSucc(then)
+    b.addSucc(els)
+}
+
+func (b *Block) Return(v *Value) {
+    b.Kind, b.Control = BlockReturn, v
+}
+
+func (b *Block) Trap(message string, pos parser.Pos) {
+    b.Kind, b.Message, b.Pos = BlockTrap, message, pos
+}
+
+// lays out the reachable blocks in reverse postorder and numbers blocks
+// and values in that order, dropping the unreachable blocks
+func (f *Function) Renumber() {
+    post := f.Postorder()
+    reachable := make(map[*Block]bool)
+    for _, b := range post {
+        reachable[b] = true
+    }
+    for _, b := range f.Blocks {
+        if reachable[b] {
+            continue
+        }
+        for len(b.Succs) > 0 {
+            b.removeEdge(len(b.Succs) - 1)
+        }
+    }
+
+    f.Blocks = f.Blocks[:0]
+    f.nextBlock, f.nextValue = 0, 0
+    for i := len(post) - 1; i >= 0; i-- {
+        b := post[i]
+        b.ID = f.nextBlock
+        f.nextBlock++
+        f.Blocks = append(f.Blocks, b)
+        for _, v := range b.Values {
+            v.ID = f.nextValue
+            f.nextValue++
+        }
+    }
+}
+
+// removes the edge to b.Succs[i] along with the arguments the phis of
+// the successor have for it
+func (b *Block) removeEdge(i int) {
+    s := b.Succs[i]
+    nth := count(b.Succs[:i], s)
+    b.Succs = append(b.Succs[:i], b.Succs[i + 1:]...)
+    for j, p := range s.Preds {
+        if p != b {
+            continue
+        }
+        if nth > 0 {
+            nth--
+            continue
+        }
+        s.Preds = append(s.Preds[:j], s.Preds[j + 1:]...)
+        for _, v := range s.Values {
+            if v.Op == OpPhi {
+                v.Args = append(v.Args[:j], v.Args[j + 1:]...)
+            }
+        }
+        return
+    }
+}
@@ -0,0 +1,200 @@
+package ir
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/check"
+	"github.com/ibex-lang/ibex/core"
+	"github.com/ibex-lang/ibex/loader"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+func lowerSource(t *testing.T, src string) *Program {
+	unit, err := parser.ParseFile("test.ibex", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods := []*loader.Module{{Unit: unit}}
+	info, err := check.CheckModules(mods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Lower(mods, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLowerCalls(t *testing.T) {
+	p := lowerSource(t, `fn sub (a: Int, b: Int) -> Int
+    a - b
+fn main -> Int
+    (b: 1, a: 2) -> sub`)
+	assert.Equal(t, `fn sub(Int, Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = param 1 : Int
+    v2 = sub v0, v1 : Int
+    ret v2
+
+fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    v1 = const 2 : Int
+    v2 = call @sub v1, v0 : Int
+    ret v2
+`, p.String())
+}
+
+func TestLowerInstances(t *testing.T) {
+	p := lowerSource(t, `fn id[T] x: T -> T
+    x
+fn main -> Int
+    3 -> id`)
+	assert.Equal(t, `fn main() -> Int
+b0:
+    v0 = const 3 : Int
+    v1 = call @id[Int] v0 : Int
+    ret v1
+`, p.Functions[0].String())
+	assert.Equal(t, []Type{Int}, p.Lookup("id[Int]").Params)
+}
+
+func TestLowerMatch(t *testing.T) {
+	p := lowerSource(t, `fn sign n: Int -> Int
+    match n
+        0 => 0
+        _ => n / n`)
+	assert.Equal(t, `fn sign(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = const 0 : Int
+    v2 = eq v0, v1 : Bool
+    if v2 b2 b1
+b1: <- b0
+    v3 = div v0, v0 : Int @ test.ibex:4:16
+    jump b3
+b2: <- b0
+    v4 = const 0 : Int
+    jump b3
+b3: <- b2 b1
+    v5 = phi v4, v3 : Int
+    ret v5
+`, p.String())
+
+	p = lowerSource(t, `fn f x: Int -> Int
+    match x
+        0 => 1`)
+	assert.Equal(t, `fn f(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = const 0 : Int
+    v2 = eq v0, v1 : Bool
+    if v2 b2 b1
+b1: <- b0
+    trap "No arm matches" @ test.ibex:2:5
+b2: <- b0
+    v3 = const 1 : Int
+    jump b3
+b3: <- b2
+    ret v3
+`, p.String())
+}
+
+func TestLowerPrograms(t *testing.T) {
+	for _, src := range []string{
+		`type Shape = Circle (r: Int) | Square (side: Int) | Empty
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a
+        Empty => 0
+fn first xs: []?Int -> Int
+    xs[0] ? xs[1]!
+fn main -> []Int
+    [Circle (r: 2) -> area, Square (side: 3) -> area, Empty -> area, [None, Some (7)] -> first]`,
+		`fn apply (f: fn Int -> Int, x: Int) -> Int
+    x -> f
+fn inc x: Int -> Int
+    x + 1
+fn main -> (Int, (x: Int, y: Int))
+    ((f: inc, x: 1) -> apply, (x: 1, y: 2))`,
+	} {
+		assert.Nil(t, Verify(lowerSource(t, src)))
+	}
+}
+
+// fn f(Int) -> Int returning its parameter plus one
+func buildFunction() (*Program, *Function, *Block, *Value) {
+	p := NewProgram()
+	f := NewFunction("f", []Type{Int}, Int)
+	p.Add(f)
+	b := f.NewBlock()
+	x := b.NewValue(OpParam, Int, 0)
+	one := b.NewValue(OpConst, Int, int64(1))
+	sum := b.NewValue(OpAdd, Int, nil, x, one)
+	b.Return(sum)
+	return p, f, b, sum
+}
+
+func TestVerify(t *testing.T) {
+	p, _, _, _ := buildFunction()
+	assert.Nil(t, Verify(p))
+
+	p, _, b, sum := buildFunction()
+	b.Values[0], b.Values[2] = b.Values[2], b.Values[0]
+	assert.EqualError(t, Verify(p), "Invalid IR in fn f: b0: v0 is used before it is defined")
+
+	p, _, b, _ = buildFunction()
+	b.Values[1].Type, b.Values[1].Aux = Bool, true
+	assert.EqualError(t, Verify(p),
+		"Invalid IR in fn f: v2 = add v0, v1 : Int: argument 1 should be Int")
+
+	p, _, b, sum = buildFunction()
+	b.Control = b.NewValue(OpUnit, Unit, nil)
+	assert.EqualError(t, Verify(p), "Invalid IR in fn f: b0: returns Unit, expected Int")
+
+	p, f, b, sum := buildFunction()
+	b.Return(nil)
+	b.Kind = BlockJump
+	join := f.NewBlock()
+	b.Jump(join)
+	join.NewValue(OpPhi, Int, nil, sum, sum)
+	join.Return(sum)
+	assert.EqualError(t, Verify(p), "Invalid IR in fn f: v3 has 2 arguments for 1 predecessors")
+
+	p, f, _, _ = buildFunction()
+	f.NewBlock().Trap("Unreachable", parser.Pos{})
+	assert.EqualError(t, Verify(p), "Invalid IR in fn f: b1 is unreachable")
+
+	p, _, _, sum = buildFunction()
+	sum.Op, sum.Aux = OpCall, "g"
+	assert.EqualError(t, Verify(p),
+		"Invalid IR in fn f: v2 = call @g v0, v1 : Int: unknown function")
+}
+
+func TestReachable(t *testing.T) {
+	p := lowerSource(t, `fn unused -> Int
+    1
+fn inc x: Int -> Int
+    x + 1
+fn apply f: fn Int -> Int -> Int
+    2 -> f
+fn main -> Int
+    inc -> apply`)
+	names := make([]string, 0)
+	for _, f := range Reachable(p, p.Lookup("main")) {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"inc", "apply", "main"}, names)
+}
+
+func TestErase(t *testing.T) {
+	lex := parser.NewLexer("fn (n: [2]Int, s: String) -> (a: [][3]Int)")
+	lex.Run()
+	ty, err := parser.ParseType(lex)
+	assert.Nil(t, err)
+	assert.Equal(t, "fn ([]Int, String) -> (a: [][]Int)", core.TypeString(Erase(ty)))
+}
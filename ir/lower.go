@@ -0,0 +1,629 @@
+package ir
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type env struct {
+    vars map[string]*Value
+    parent *env
+}
+
+func newEnv(parent *env) *env {
+    return &env{make(map[string]*Value), parent}
+}
+
+func (e *env) lookup(name string) *Value {
+    for ; e != nil; e = e.parent {
+        if v, ok := e.vars[name]; ok {
+            return v
+        }
+    }
+    return nil
+}
+
+type lowerer struct {
+    info *check.Info
+    p *Program
+    f *Function
+    b *Block // the values of the expression being lowered go here
+    m map[string]core.IbexType // type arguments of the instance being lowered
+    env *env
+}
+
+// a block created only when some test can fail
+type lazyBlock struct {
+    f *Function
+    block *Block
+}
+
+func (l *lazyBlock) get() *Block {
+    if l.block == nil {
+        l.block = l.f.NewBlock()
+    }
+    return l.block
+}
+
+// lowers every non-generic function of a checked program and every
+// instance of the generic ones
+func Lower(mods []*loader.Module, info *check.Info) (*Program, error) {
+    l := &lowerer{info: info, p: NewProgram()}
+
+    type job struct {
+        fn *parser.ASTFunction
+        canonical string
+        m map[string]core.IbexType
+        f *Function
+    }
+    decls := make(map[string]*parser.ASTFunction)
+    jobs := make([]*job, 0)
+    for _, m := range mods {
+        for _, d := range m.Unit.Declarations {
+            if fn, ok := d.(*parser.ASTFunction); ok {
+                name := check.Canonical(m, fn.Name)
+                decls[name] = fn
+                if len(fn.TypeParams) == 0 {
+                    jobs = append(jobs, &job{fn: fn, canonical: name})
+                }
+            }
+        }
+    }
+    for _, inst := range info.Instances {
+        fn := decls[inst.Function]
+        jobs = append(jobs, &job{fn, inst.Function, check.Bind(fn.TypeParams, inst.TypeArgs), nil})
+    }
+
+    for _, j := range jobs {
+        sig := check.Substitute(info.Functions[j.canonical], j.m).(core.IbexFunctionType)
+        name := j.canonical
+        if j.m != nil {
+            name = instanceName(j.canonical, j.fn.TypeParams, j.m)
+        }
+        j.f = NewFunction(name, reprs(Flatten(sig.Argument)), Repr(ReturnOf(sig)))
+        j.f.Signature, j.f.Pos = sig, j.fn.Pos
+        l.p.Add(j.f)
+    }
+
+    for _, j := range jobs {
+        if j.fn.Body == nil {
+            continue
+        }
+        if err := l.lowerFunction(j.f, j.fn, j.canonical, j.m); err != nil {
+            return nil, err
+        }
+        j.f.Renumber()
+    }
+    return l.p, Verify(l.p)
+}
+
+func instanceName(name string, params []string, m map[string]core.IbexType) string {
+    args := make([]core.IbexType, len(params))
+    for i, p := range params {
+        args[i] = m[p]
+    }
+    return (&check.Instance{Function: name, TypeArgs: args}).String()
+}
+
+func (l *lowerer) lowerFunction(f *Function, fn *parser.ASTFunction,
+    canonical string, m map[string]core.IbexType) error {
+
+    l.f, l.m, l.env = f, m, newEnv(nil)
+    l.b = f.NewBlock()
+
+    sig := check.Substitute(l.info.Functions[canonical], m).(core.IbexFunctionType)
+    flat := Flatten(sig.Argument)
+    params := make([]*Value, len(flat))
+    for i, ty := range flat {
+        params[i] = l.value(OpParam, ty, i)
+    }
+    if len(fn.Parameters) == len(params) {
+        for i, p := range fn.Parameters {
+            l.env.vars[p.Name] = params[i]
+        }
+    } else {
+        // a single parameter of a flattened named tuple or of type ()
+        l.env.vars[fn.Parameters[0].Name] = l.pack(params, sig.Argument)
+    }
+
+    v, err := l.lowerBody(fn.Body)
+    if err != nil {
+        return err
+    }
+    if f.Return == Unit && v.Type != Unit {
+        v = l.value(OpUnit, check.Unit, nil)
+    }
+    l.b.Return(v)
+    return nil
+}
+
+func (l *lowerer) pack(values []*Value, ty core.IbexType) *Value {
+    if Repr(ty) == Unit {
+        return l.value(OpUnit, ty, nil)
+    }
+    return l.value(OpTuple, ty, nil, values...)
+}
+
+// the value of a body is the value of its last line
+func (l *lowerer) lowerBody(body *parser.ASTBody) (*Value, error) {
+    if len(body.Children) == 0 {
+        return l.value(OpUnit, check.Unit, nil), nil
+    }
+    var v *Value
+    for _, node := range body.Children {
+        result, err := l.lowerExpr(node)
+        if err != nil {
+            return nil, err
+        }
+        v = result
+    }
+    return v, nil
+}
+
+// a value of the checked type ty
+func (l *lowerer) value(op Op, ty core.IbexType, aux interface{}, args ...*Value) *Value {
+    v := l.b.NewValue(op, Repr(ty), aux, args...)
+    v.Source = ty
+    return v
+}
+
+func (l *lowerer) recorded(pos parser.Pos) core.IbexType {
+    return check.Substitute(l.info.ExprTypes[pos], l.m)
+}
+
+// the concrete type of an expression of the function being lowered
+func (l *lowerer) typeOf(expr parser.Expression) core.IbexType {
+    switch e := expr.(type) {
+    case parser.IdentExpr:
+        return l.recorded(e.Pos)
+    case parser.ConstructorExpr:
+        return l.recorded(e.Pos)
+    case parser.ArrayExpr:
+        return l.recorded(e.Pos)
+    case parser.StringExpr:
+        return check.String
+    case parser.NumberExpr:
+        return check.Int
+    case parser.NotExpr:
+        return check.Bool
+    case parser.NegateExpr:
+        return l.typeOf(e.Expr)
+    case parser.AddExpr:
+        return l.typeOf(e.Left)
+    case parser.SubExpr:
+        return l.typeOf(e.Left)
+    case parser.MulExpr:
+        return l.typeOf(e.Left)
+    case parser.DivExpr:
+        return l.typeOf(e.Left)
+    case parser.ModExpr:
+        return l.typeOf(e.Left)
+    case parser.FunctionCallExpr:
+        return ReturnOf(l.typeOf(e.Target).(core.IbexFunctionType))
+    case parser.ArrayAccessExpr:
+        return l.typeOf(e.Target).(core.IbexArrayType).Elem()
+    case parser.TupleExpr:
+        elems := make([]core.IbexType, len(e.Elements))
+        for i, elem := range e.Elements {
+            elems[i] = l.typeOf(elem)
+        }
+        return core.IbexTupleType{elems}
+    case parser.NamedTupleExpr:
+        entries := make([]*core.IbexNamedTupleEntry, len(e.Elements))
+        for i, elem := range e.Elements {
+            entries[i] = &core.IbexNamedTupleEntry{elem.Tag, l.typeOf(elem.Expr)}
+        }
+        return core.IbexNamedTupleType{entries}
+    case parser.MatchExpr:
+        body := e.Arms[0].Body.Children
+        if len(body) == 0 {
+            return check.Unit
+        }
+        return l.typeOf(body[len(body) - 1])
+    case parser.UnsafeAccessExpr:
+        return l.typeOf(e.Expr).(core.IbexSimpleType).Args[0]
+    case parser.DefaultExpr:
+        return l.typeOf(e.Expr).(core.IbexSimpleType).Args[0]
+    }
+    return check.Unit
+}
+
+func (l *lowerer) lowerExpr(expr parser.Expression) (*Value, error) {
+    switch e := expr.(type) {
+    case parser.IdentExpr:
+        if sym := l.info.Symbols[e.Pos]; sym.Kind == check.SymbolFunction {
+            return l.value(OpFunc, l.typeOf(e), l.calleeName(sym.Name, e.Pos)), nil
+        }
+        return l.env.lookup(e.Ident), nil
+
+    case parser.StringExpr:
+        return l.value(OpString, check.String, e.String), nil
+
+    case parser.NumberExpr:
+        n, err := strconv.ParseInt(e.Number, 10, 64)
+        if err != nil {
+            return nil, fmt.Errorf("Invalid number %s", e.Number)
+        }
+        return l.value(OpConst, check.Int, n), nil
+
+    case parser.NotExpr:
+        return l.lowerUnary(OpNot, e.Expr)
+    case parser.NegateExpr:
+        return l.lowerUnary(OpNeg, e.Expr)
+
+    case parser.AddExpr:
+        return l.lowerBinary(OpAdd, e.Left, e.Right, parser.Pos{})
+    case parser.SubExpr:
+        return l.lowerBinary(OpSub, e.Left, e.Right, parser.Pos{})
+    case parser.MulExpr:
+        return l.lowerBinary(OpMul, e.Left, e.Right, parser.Pos{})
+    case parser.DivExpr:
+        return l.lowerBinary(OpDiv, e.Left, e.Right, e.Pos)
+    case parser.ModExpr:
+        return l.lowerBinary(OpMod, e.Left, e.Right, e.Pos)
+
+    case parser.FunctionCallExpr:
+        return l.lowerCall(e)
+
+    case parser.ArrayAccessExpr:
+        target, err := l.lowerExpr(e.Target)
+        if err != nil {
+            return nil, err
+        }
+        index, err := l.lowerExpr(e.Index)
+        if err != nil {
+            return nil, err
+        }
+        v := l.value(OpIndex, l.typeOf(e), nil, target, index)
+        v.Pos = e.Pos
+        return v, nil
+
+    case parser.ArrayExpr:
+        elems, err := l.lowerAll(e.Elements)
+        if err != nil {
+            return nil, err
+        }
+        return l.value(OpArray, l.typeOf(e), nil, elems...), nil
+
+    case parser.TupleExpr:
+        elems, err := l.lowerAll(e.Elements)
+        if err != nil {
+            return nil, err
+        }
+        return l.pack(elems, l.typeOf(e)), nil
+
+    case parser.NamedTupleExpr:
+        elems := make([]*Value, len(e.Elements))
+        for i, elem := range e.Elements {
+            v, err := l.lowerExpr(elem.Expr)
+            if err != nil {
+                return nil, err
+            }
+            elems[i] = v
+        }
+        return l.value(OpTuple, l.typeOf(e), nil, elems...), nil
+
+    case parser.ConstructorExpr:
+        ty := l.typeOf(e)
+        tag := l.tagIndex(ty, e.Tag)
+        if e.Payload == nil {
+            return l.value(OpVariant, ty, tag), nil
+        }
+        payload, err := l.lowerExpr(e.Payload)
+        if err != nil {
+            return nil, err
+        }
+        return l.value(OpVariant, ty, tag, payload), nil
+
+    case parser.MatchExpr:
+        return l.lowerMatch(e)
+
+    case parser.UnsafeAccessExpr:
+        return l.lowerUnwrap(e)
+
+    case parser.DefaultExpr:
+        return l.lowerDefault(e)
+    }
+
+    return nil, fmt.Errorf("Unsupported expression %T", expr)
+}
+
+func (l *lowerer) lowerAll(exprs []parser.Expression) ([]*Value, error) {
+    values := make([]*Value, len(exprs))
+    for i, expr := range exprs {
+        v, err := l.lowerExpr(expr)
+        if err != nil {
+            return nil, err
+        }
+        values[i] = v
+    }
+    return values, nil
+}
+
+func (l *lowerer) lowerUnary(op Op, expr parser.Expression) (*Value, error) {
+    v, err := l.lowerExpr(expr)
+    if err != nil {
+        return nil, err
+    }
+    return l.value(op, v.Source, nil, v), nil
+}
+
+// a zero pos marks operations that cannot trap
+func (l *lowerer) lowerBinary(op Op, left, right parser.Expression,
+    pos parser.Pos) (*Value, error) {
+
+    x, err := l.lowerExpr(left)
+    if err != nil {
+        return nil, err
+    }
+    y, err := l.lowerExpr(right)
+    if err != nil {
+        return nil, err
+    }
+    v := l.value(op, x.Source, nil, x, y)
+    v.Pos = pos
+    return v, nil
+}
+
+// the IR name of the function a reference at pos refers to
+func (l *lowerer) calleeName(name string, pos parser.Pos) string {
+    args, ok := l.info.TypeArgs[pos]
+    if !ok {
+        return name
+    }
+    concrete := make([]core.IbexType, len(args))
+    for i, arg := range args {
+        concrete[i] = check.Substitute(arg, l.m)
+    }
+    return (&check.Instance{Function: name, TypeArgs: concrete}).String()
+}
+
+// calls of functions named directly are direct, all others indirect
+func (l *lowerer) lowerCall(e parser.FunctionCallExpr) (*Value, error) {
+    fn := l.typeOf(e.Target).(core.IbexFunctionType)
+    params := Flatten(fn.Argument)
+    args, err := l.lowerArguments(e, params)
+    if err != nil {
+        return nil, err
+    }
+    ret := ReturnOf(fn)
+
+    var v *Value
+    if ident, ok := e.Target.(parser.IdentExpr); ok {
+        if sym := l.info.Symbols[ident.Pos]; sym.Kind == check.SymbolFunction {
+            v = l.value(OpCall, ret, l.calleeName(sym.Name, ident.Pos), args...)
+        }
+    }
+    if v == nil {
+        target, err := l.lowerExpr(e.Target)
+        if err != nil {
+            return nil, err
+        }
+        v = l.value(OpCallInd, ret, nil, append([]*Value{target}, args...)...)
+    }
+    v.Pos = e.Pos
+    return v, nil
+}
+
+// splits the input of a call into the flattened parameters, reordering
+// named arguments as check.Info.Calls says
+func (l *lowerer) lowerArguments(e parser.FunctionCallExpr,
+    params []core.IbexType) ([]*Value, error) {
+
+    if len(params) < 2 {
+        v, err := l.lowerExpr(e.Input)
+        if err != nil || len(params) == 0 {
+            return nil, err
+        }
+        return []*Value{v}, nil
+    }
+
+    order := func(i int) int { return i }
+    if call := l.info.Calls[e.Pos]; call != nil && call.Args == check.ArgsNamed {
+        order = func(i int) int { return call.Order[i] }
+    }
+
+    var elems []parser.Expression
+    switch input := e.Input.(type) {
+    case parser.TupleExpr:
+        elems = input.Elements
+    case parser.NamedTupleExpr:
+        for _, entry := range input.Elements {
+            elems = append(elems, entry.Expr)
+        }
+    }
+
+    args := make([]*Value, len(params))
+    if len(elems) == len(params) {
+        values, err := l.lowerAll(elems)
+        if err != nil {
+            return nil, err
+        }
+        for i := range args {
+            args[i] = values[order(i)]
+        }
+        return args, nil
+    }
+
+    v, err := l.lowerExpr(e.Input)
+    if err != nil {
+        return nil, err
+    }
+    for i, p := range params {
+        args[i] = l.value(OpElem, p, order(i), v)
+    }
+    return args, nil
+}
+
+func (l *lowerer) tagIndex(ty core.IbexType, tag string) int {
+    if i := strings.LastIndex(tag, "::"); i >= 0 {
+        tag = tag[i + 2:]
+    }
+    for i, c := range l.info.Cases(ty) {
+        if c.Tag == tag {
+            return i
+        }
+    }
+    return -1
+}
+
+func (l *lowerer) payloadType(ty core.IbexType, tag int) core.IbexType {
+    return l.info.Cases(ty)[tag].Payload
+}
+
+// branches to fail unless cond holds
+func (l *lowerer) test(cond *Value, fail *lazyBlock) {
+    next := l.f.NewBlock()
+    l.b.If(cond, next, fail.get())
+    l.b = next
+}
+
+func (l *lowerer) testTag(v *Value, ty core.IbexType, tag int, fail *lazyBlock) {
+    t := l.value(OpTag, check.Int, nil, v)
+    c := l.value(OpConst, check.Int, int64(tag))
+    l.test(l.value(OpEq, check.Bool, nil, t, c), fail)
+}
+
+// The arms are tried in order, each branching to the next one on the
+// first test of its pattern that fails. The arms join in a block with a
+// phi of their values.
+func (l *lowerer) lowerMatch(e parser.MatchExpr) (*Value, error) {
+    subject, err := l.lowerExpr(e.Subject)
+    if err != nil {
+        return nil, err
+    }
+    ty := l.typeOf(e.Subject)
+    result := l.typeOf(e)
+
+    join := &lazyBlock{f: l.f}
+    values := make([]*Value, 0)
+    var fail *lazyBlock
+    for _, arm := range e.Arms {
+        fail = &lazyBlock{f: l.f}
+        outer := l.env
+        l.env = newEnv(outer)
+        if err := l.lowerPattern(arm.Pattern, subject, ty, fail); err != nil {
+            return nil, err
+        }
+        v, err := l.lowerBody(arm.Body)
+        if err != nil {
+            return nil, err
+        }
+        l.env = outer
+
+        values = append(values, v)
+        l.b.Jump(join.get())
+        if fail.block == nil {
+            break // the remaining arms are unreachable
+        }
+        l.b = fail.block
+    }
+    if fail.block != nil {
+        l.b.Trap("No arm matches", e.Pos)
+    }
+
+    l.b = join.block
+    if len(values) == 1 {
+        return values[0], nil
+    }
+    return l.value(OpPhi, result, nil, values...), nil
+}
+
+func (l *lowerer) lowerPattern(p parser.Pattern, v *Value, ty core.IbexType,
+    fail *lazyBlock) error {
+
+    switch p := p.(type) {
+    case parser.WildcardPattern:
+
+    case parser.BindingPattern:
+        l.env.vars[p.Name] = v
+
+    case parser.LiteralPattern:
+        lit, err := l.lowerExpr(p.Literal)
+        if err != nil {
+            return err
+        }
+        l.test(l.value(OpEq, check.Bool, nil, v, lit), fail)
+
+    case parser.ConstructorPattern:
+        tag := l.tagIndex(ty, p.Tag)
+        if len(l.info.Cases(ty)) > 1 {
+            l.testTag(v, ty, tag, fail)
+        }
+        if p.Payload != nil {
+            payloadTy := l.payloadType(ty, tag)
+            payload := l.value(OpPayload, payloadTy, tag, v)
+            return l.lowerPattern(p.Payload, payload, payloadTy, fail)
+        }
+
+    case parser.TuplePattern:
+        fields := FieldsOf(ty)
+        for i, elem := range p.Elements {
+            field := l.value(OpElem, fields[i], i, v)
+            if err := l.lowerPattern(elem, field, fields[i], fail); err != nil {
+                return err
+            }
+        }
+
+    case parser.NamedTuplePattern:
+        fields := FieldsOf(ty)
+        for _, entry := range p.Elements {
+            i := fieldIndex(ty, entry.Tag)
+            field := l.value(OpElem, fields[i], i, v)
+            if err := l.lowerPattern(entry.Pattern, field, fields[i], fail); err != nil {
+                return err
+            }
+        }
+
+    default:
+        return fmt.Errorf("Unsupported pattern %T", p)
+    }
+    return nil
+}
+
+// opt! branches to a trap on None
+func (l *lowerer) lowerUnwrap(e parser.UnsafeAccessExpr) (*Value, error) {
+    opt, err := l.lowerExpr(e.Expr)
+    if err != nil {
+        return nil, err
+    }
+    ty := l.typeOf(e.Expr)
+    some := l.tagIndex(ty, "Some")
+
+    trap := &lazyBlock{f: l.f}
+    l.testTag(opt, ty, some, trap)
+    trap.block.Trap("Unwrapped None", e.Pos)
+    return l.value(OpPayload, l.payloadType(ty, some), some, opt), nil
+}
+
+// opt ? default evaluates default only on None
+func (l *lowerer) lowerDefault(e parser.DefaultExpr) (*Value, error) {
+    opt, err := l.lowerExpr(e.Expr)
+    if err != nil {
+        return nil, err
+    }
+    ty := l.typeOf(e.Expr)
+    some := l.tagIndex(ty, "Some")
+
+    none := &lazyBlock{f: l.f}
+    l.testTag(opt, ty, some, none)
+    payload := l.value(OpPayload, l.payloadType(ty, some), some, opt)
+    join := l.f.NewBlock()
+    l.b.Jump(join)
+
+    l.b = none.block
+    def, err := l.lowerExpr(e.Default)
+    if err != nil {
+        return nil, err
+    }
+    l.b.Jump(join)
+
+    l.b = join
+    return l.value(OpPhi, payload.Source, nil, payload, def), nil
+}
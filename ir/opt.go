@@ -0,0 +1,83 @@
+package ir
+
+import "fmt"
+
+// a Pass transforms a program into an equivalent one, leaving it valid
+// for Verify
+type Pass struct {
+    Name string
+    Run func(p *Program)
+}
+
+var (
+    Fold = Pass{"fold", eachFunction(fold)}
+    CSE = Pass{"cse", eachFunction(cse)}
+    DCE = Pass{"dce", eachFunction(dce)}
+    Inline = Pass{"inline", inline}
+)
+
+func eachFunction(run func(f *Function)) func(p *Program) {
+    return func(p *Program) {
+        for _, f := range p.Functions {
+            if len(f.Blocks) > 0 {
+                run(f)
+            }
+        }
+    }
+}
+
+// the passes of -O0, -O1 and -O2, higher levels are the same as -O2
+func Pipeline(level int) []Pass {
+    switch level {
+    case 0:
+        return nil
+    case 1:
+        return []Pass{Fold, CSE, DCE}
+    }
+    return []Pass{Inline, Fold, CSE, DCE}
+}
+
+// runs the passes of the given level, verifying the program after each
+func Optimize(p *Program, level int) error {
+    for _, pass := range Pipeline(level) {
+        pass.Run(p)
+        if err := Verify(p); err != nil {
+            return fmt.Errorf("After pass %s: %s", pass.Name, err)
+        }
+    }
+    return nil
+}
+
+func resolve(m map[*Value]*Value, v *Value) *Value {
+    for {
+        r, ok := m[v]
+        if !ok {
+            return v
+        }
+        v = r
+    }
+}
+
+// rewrites every use of a value in m to its replacement, which may be
+// replaced itself, and removes the replaced values
+func (f *Function) replace(m map[*Value]*Value) {
+    if len(m) == 0 {
+        return
+    }
+    for _, b := range f.Blocks {
+        values := b.Values[:0]
+        for _, v := range b.Values {
+            if _, replaced := m[v]; replaced {
+                continue
+            }
+            for i, arg := range v.Args {
+                v.Args[i] = resolve(m, arg)
+            }
+            values = append(values, v)
+        }
+        b.Values = values
+        if b.Control != nil {
+            b.Control = resolve(m, b.Control)
+        }
+    }
+}
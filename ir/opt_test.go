@@ -0,0 +1,273 @@
+package ir
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// runs prior on src, then pass, comparing the IR before and after pass
+func testPass(t *testing.T, src string, prior []Pass, pass Pass, before, after string) {
+	p := lowerSource(t, src)
+	for _, other := range prior {
+		other.Run(p)
+	}
+	assert.Equal(t, before, p.String())
+	pass.Run(p)
+	assert.Nil(t, Verify(p))
+	assert.Equal(t, after, p.String())
+}
+
+const constants = `fn main -> Int
+    match 1 + 2
+        3 => 10 / 2
+        _ => 4 / 0`
+
+func TestFold(t *testing.T) {
+	testPass(t, constants, nil, Fold, `fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    v1 = const 2 : Int
+    v2 = add v0, v1 : Int
+    v3 = const 3 : Int
+    v4 = eq v2, v3 : Bool
+    if v4 b2 b1
+b1: <- b0
+    v5 = const 4 : Int
+    v6 = const 0 : Int
+    v7 = div v5, v6 : Int @ test.ibex:4:16
+    jump b3
+b2: <- b0
+    v8 = const 10 : Int
+    v9 = const 2 : Int
+    v10 = div v8, v9 : Int @ test.ibex:3:17
+    jump b3
+b3: <- b2 b1
+    v11 = phi v10, v7 : Int
+    ret v11
+`, `fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    v1 = const 2 : Int
+    v2 = const 3 : Int
+    v3 = const 3 : Int
+    v4 = const true : Bool
+    jump b1
+b1: <- b0
+    v5 = const 10 : Int
+    v6 = const 2 : Int
+    v7 = const 5 : Int
+    jump b2
+b2: <- b1
+    ret v7
+`)
+}
+
+func TestFoldTraps(t *testing.T) {
+	p := lowerSource(t, `fn main -> Int
+    7 / (1 - 1)`)
+	Fold.Run(p)
+	assert.Equal(t, `fn main() -> Int
+b0:
+    v0 = const 7 : Int
+    v1 = const 1 : Int
+    v2 = const 1 : Int
+    v3 = const 0 : Int
+    v4 = div v0, v3 : Int @ test.ibex:2:7
+    ret v4
+`, p.String())
+}
+
+func TestCSE(t *testing.T) {
+	testPass(t, `fn f (a: Int, b: Int) -> Int
+    (a + b) * (b + a) - a * 1`, nil, CSE, `fn f(Int, Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = param 1 : Int
+    v2 = add v0, v1 : Int
+    v3 = add v1, v0 : Int
+    v4 = mul v2, v3 : Int
+    v5 = const 1 : Int
+    v6 = mul v0, v5 : Int
+    v7 = sub v4, v6 : Int
+    ret v7
+`, `fn f(Int, Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = param 1 : Int
+    v2 = add v0, v1 : Int
+    v3 = mul v2, v2 : Int
+    v4 = const 1 : Int
+    v5 = mul v0, v4 : Int
+    v6 = sub v3, v5 : Int
+    ret v6
+`)
+}
+
+// a Nil of List[Int] is not one of List[String] to backends keeping
+// the checked types
+func TestCSESource(t *testing.T) {
+	p := lowerSource(t, `type List[T] = Cons (head: T, tail: List[T]) | Nil
+fn main -> (List[String], List[Int])
+    (Nil, Nil)`)
+	CSE.Run(p)
+	nils := make([]*Value, 0)
+	for _, v := range p.Lookup("main").Blocks[0].Values {
+		if v.Op == OpVariant {
+			nils = append(nils, v)
+		}
+	}
+	assert.Len(t, nils, 2)
+}
+
+func TestDCE(t *testing.T) {
+	testPass(t, constants, []Pass{Fold}, DCE, `fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    v1 = const 2 : Int
+    v2 = const 3 : Int
+    v3 = const 3 : Int
+    v4 = const true : Bool
+    jump b1
+b1: <- b0
+    v5 = const 10 : Int
+    v6 = const 2 : Int
+    v7 = const 5 : Int
+    jump b2
+b2: <- b1
+    ret v7
+`, `fn main() -> Int
+b0:
+    v0 = const 5 : Int
+    ret v0
+`)
+}
+
+const square = `fn square x: Int -> Int
+    x * x
+fn main -> Int
+    (1 + 2 -> square) + (3 -> square)`
+
+func TestInline(t *testing.T) {
+	testPass(t, square, nil, Inline, `fn square(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = mul v0, v0 : Int
+    ret v1
+
+fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    v1 = const 2 : Int
+    v2 = add v0, v1 : Int
+    v3 = call @square v2 : Int
+    v4 = const 3 : Int
+    v5 = call @square v4 : Int
+    v6 = add v3, v5 : Int
+    ret v6
+`, `fn square(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = mul v0, v0 : Int
+    ret v1
+
+fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    v1 = const 2 : Int
+    v2 = add v0, v1 : Int
+    jump b1
+b1: <- b0
+    v3 = mul v2, v2 : Int
+    jump b2
+b2: <- b1
+    v4 = const 3 : Int
+    jump b3
+b3: <- b2
+    v5 = mul v4, v4 : Int
+    jump b4
+b4: <- b3
+    v6 = add v3, v5 : Int
+    ret v6
+`)
+}
+
+const sign = `fn sign n: Int -> Int
+    match n
+        0 => 0
+        _ => n / n
+fn main -> Int
+    (0 -> sign) + (5 -> sign)`
+
+func TestOptimize(t *testing.T) {
+	for level, expected := range []string{`fn sign(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = const 0 : Int
+    v2 = eq v0, v1 : Bool
+    if v2 b2 b1
+b1: <- b0
+    v3 = div v0, v0 : Int @ test.ibex:4:16
+    jump b3
+b2: <- b0
+    v4 = const 0 : Int
+    jump b3
+b3: <- b2 b1
+    v5 = phi v4, v3 : Int
+    ret v5
+
+fn main() -> Int
+b0:
+    v0 = const 0 : Int
+    v1 = call @sign v0 : Int
+    v2 = const 5 : Int
+    v3 = call @sign v2 : Int
+    v4 = add v1, v3 : Int
+    ret v4
+`, `fn sign(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = const 0 : Int
+    v2 = eq v0, v1 : Bool
+    if v2 b2 b1
+b1: <- b0
+    v3 = div v0, v0 : Int @ test.ibex:4:16
+    jump b3
+b2: <- b0
+    jump b3
+b3: <- b2 b1
+    v4 = phi v1, v3 : Int
+    ret v4
+
+fn main() -> Int
+b0:
+    v0 = const 0 : Int
+    v1 = call @sign v0 : Int
+    v2 = const 5 : Int
+    v3 = call @sign v2 : Int
+    v4 = add v1, v3 : Int
+    ret v4
+`, `fn sign(Int) -> Int
+b0:
+    v0 = param 0 : Int
+    v1 = const 0 : Int
+    v2 = eq v0, v1 : Bool
+    if v2 b2 b1
+b1: <- b0
+    v3 = div v0, v0 : Int @ test.ibex:4:16
+    jump b3
+b2: <- b0
+    jump b3
+b3: <- b2 b1
+    v4 = phi v1, v3 : Int
+    ret v4
+
+fn main() -> Int
+b0:
+    v0 = const 1 : Int
+    ret v0
+`} {
+		p := lowerSource(t, sign)
+		assert.Nil(t, Optimize(p, level))
+		assert.Equal(t, expected, p.String())
+	}
+}
@@ -0,0 +1,109 @@
+package ir
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// The dump format lists each function with its blocks, e.g.
+//
+//     fn double(Int) -> Int
+//     b0:
+//         v0 = param 0 : Int
+//         v1 = const 2 : Int
+//         v2 = mul v0, v1 : Int
+//         ret v2
+//
+// Blocks list their predecessors after <-, trapping values and blocks
+// their position after @.
+
+func (p *Program) String() string {
+    fns := make([]string, len(p.Functions))
+    for i, f := range p.Functions {
+        fns[i] = f.String()
+    }
+    return strings.Join(fns, "\n")
+}
+
+func (f *Function) String() string {
+    var b strings.Builder
+    params := make([]string, len(f.Params))
+    for i, p := range f.Params {
+        params[i] = p.String()
+    }
+    fmt.Fprintf(&b, "fn %s(%s) -> %s", f.Name, strings.Join(params, ", "), f.Return)
+    if len(f.Blocks) == 0 {
+        b.WriteString(" extern\n")
+        return b.String()
+    }
+    b.WriteString("\n")
+    for _, block := range f.Blocks {
+        b.WriteString(block.String())
+    }
+    return b.String()
+}
+
+func (b *Block) Name() string {
+    return fmt.Sprintf("b%d", b.ID)
+}
+
+func (b *Block) String() string {
+    var s strings.Builder
+    s.WriteString(b.Name() + ":")
+    if len(b.Preds) > 0 {
+        s.WriteString(" <-")
+        for _, p := range b.Preds {
+            s.WriteString(" " + p.Name())
+        }
+    }
+    s.WriteString("\n")
+    for _, v := range b.Values {
+        s.WriteString("    " + v.LongString() + "\n")
+    }
+
+    switch b.Kind {
+    case BlockJump:
+        if len(b.Succs) > 0 {
+            fmt.Fprintf(&s, "    jump %s\n", b.Succs[0].Name())
+        }
+    case BlockIf:
+        fmt.Fprintf(&s, "    if %s %s %s\n", b.Control.Name(), b.Succs[0].Name(), b.Succs[1].Name())
+    case BlockReturn:
+        fmt.Fprintf(&s, "    ret %s\n", b.Control.Name())
+    case BlockTrap:
+        fmt.Fprintf(&s, "    trap %s @ %s\n", strconv.Quote(b.Message), b.Pos)
+    }
+    return s.String()
+}
+
+func (v *Value) Name() string {
+    return fmt.Sprintf("v%d", v.ID)
+}
+
+func (v *Value) LongString() string {
+    var s strings.Builder
+    fmt.Fprintf(&s, "%s = %s", v.Name(), v.Op)
+    switch aux := v.Aux.(type) {
+    case nil:
+    case string:
+        if v.Op == OpString {
+            s.WriteString(" " + strconv.Quote(aux))
+        } else {
+            s.WriteString(" @" + aux)
+        }
+    default:
+        fmt.Fprintf(&s, " %v", aux)
+    }
+    for i, arg := range v.Args {
+        if i > 0 {
+            s.WriteString(",")
+        }
+        s.WriteString(" " + arg.Name())
+    }
+    s.WriteString(" : " + v.Type.String())
+    if v.Op.Traps() {
+        fmt.Fprintf(&s, " @ %s", v.Pos)
+    }
+    return s.String()
+}
@@ -0,0 +1,30 @@
+package ir
+
+// Reachable gives the functions main calls or refers to, directly or not,
+// main included, in the order of the program.
+func Reachable(p *Program, main *Function) []*Function {
+    seen := map[*Function]bool{main: true}
+    work := []*Function{main}
+    for len(work) > 0 {
+        f := work[len(work) - 1]
+        work = work[:len(work) - 1]
+        for _, b := range f.Blocks {
+            for _, v := range b.Values {
+                if v.Op != OpCall && v.Op != OpFunc {
+                    continue
+                }
+                if callee := p.Lookup(v.Aux.(string)); !seen[callee] {
+                    seen[callee] = true
+                    work = append(work, callee)
+                }
+            }
+        }
+    }
+    funcs := make([]*Function, 0, len(seen))
+    for _, f := range p.Functions {
+        if seen[f] {
+            funcs = append(funcs, f)
+        }
+    }
+    return funcs
+}
@@ -0,0 +1,126 @@
+package ir
+
+import "github.com/ibex-lang/ibex/core"
+
+// Repr gives the representation of a checked Ibex type without type
+// parameters.
+func Repr(ty core.IbexType) Type {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        switch t.Name {
+        case "Int":
+            return Int
+        case "F64":
+            return F64
+        case "Bool":
+            return Bool
+        }
+    case core.IbexTupleType:
+        if len(t.ElementTypes) == 0 {
+            return Unit
+        }
+    case core.IbexFunctionType:
+        return Func
+    }
+    return Ptr
+}
+
+// Flatten gives the parameters of a function in the IR from its
+// argument type: () means none, a tuple or named tuple of several
+// elements one per element and any other type a single one. A function
+// with a single parameter of such a tuple type takes the elements as
+// well, so functions of types that unify take the same parameters, also
+// when called indirectly.
+func Flatten(arg core.IbexType) []core.IbexType {
+    switch t := arg.(type) {
+    case core.IbexTupleType:
+        if len(t.ElementTypes) != 1 {
+            return t.ElementTypes
+        }
+    case core.IbexNamedTupleType:
+        if len(t.Types) > 1 {
+            types := make([]core.IbexType, len(t.Types))
+            for i, entry := range t.Types {
+                types[i] = entry.Type
+            }
+            return types
+        }
+    }
+    return []core.IbexType{arg}
+}
+
+func reprs(types []core.IbexType) []Type {
+    result := make([]Type, len(types))
+    for i, ty := range types {
+        result[i] = Repr(ty)
+    }
+    return result
+}
+
+// the return type, () when there is none
+func ReturnOf(fn core.IbexFunctionType) core.IbexType {
+    if fn.Return == nil {
+        return core.IbexTupleType{[]core.IbexType{}}
+    }
+    return fn.Return
+}
+
+// Erase gives the type with what does not matter to a representation
+// left out: sizes of arrays, a [2]Int may be passed where a []Int is
+// expected, and names of parameters.
+func Erase(ty core.IbexType) core.IbexType {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        args := make([]core.IbexType, len(t.Args))
+        for i, arg := range t.Args {
+            args[i] = Erase(arg)
+        }
+        return core.IbexSimpleType{Name: t.Name, Args: args}
+    case core.IbexTupleType:
+        elems := make([]core.IbexType, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            elems[i] = Erase(elem)
+        }
+        return core.IbexTupleType{elems}
+    case core.IbexNamedTupleType:
+        entries := make([]*core.IbexNamedTupleEntry, len(t.Types))
+        for i, entry := range t.Types {
+            entries[i] = &core.IbexNamedTupleEntry{entry.Name, Erase(entry.Type)}
+        }
+        return core.IbexNamedTupleType{entries}
+    case core.IbexArrayType:
+        return core.NewArrayType(Erase(t.ElementType), make([]int, t.Dimensions))
+    case core.IbexFunctionType:
+        params := Flatten(t.Argument)
+        if len(params) == 1 {
+            return core.IbexFunctionType{Erase(params[0]), Erase(ReturnOf(t))}
+        }
+        return core.IbexFunctionType{Erase(core.IbexTupleType{params}), Erase(ReturnOf(t))}
+    }
+    return ty
+}
+
+// FieldsOf gives the element types of a tuple or named tuple, by
+// position.
+func FieldsOf(ty core.IbexType) []core.IbexType {
+    switch t := ty.(type) {
+    case core.IbexTupleType:
+        return t.ElementTypes
+    case core.IbexNamedTupleType:
+        types := make([]core.IbexType, len(t.Types))
+        for i, entry := range t.Types {
+            types[i] = entry.Type
+        }
+        return types
+    }
+    return nil
+}
+
+func fieldIndex(ty core.IbexType, tag string) int {
+    for i, entry := range ty.(core.IbexNamedTupleType).Types {
+        if entry.Name == tag {
+            return i
+        }
+    }
+    return -1
+}
@@ -0,0 +1,298 @@
+package ir
+
+import "fmt"
+
+type VerifyError struct {
+    fn string
+    message string
+}
+
+func (e *VerifyError) Error() string {
+    return fmt.Sprintf("Invalid IR in fn %s: %s", e.fn, e.message)
+}
+
+type verifier struct {
+    p *Program
+    f *Function
+    dom *DomTree
+    index map[*Value]int // of each value in its block
+}
+
+func (v *verifier) errorf(format string, args ...interface{}) error {
+    return &VerifyError{v.f.Name, fmt.Sprintf(format, args...)}
+}
+
+// checks the invariants every pass may rely on and has to preserve
+func Verify(p *Program) error {
+    for _, f := range p.Functions {
+        if p.Lookup(f.Name) != f {
+            return &VerifyError{f.Name, "Function is not indexed by its name"}
+        }
+        v := &verifier{p: p, f: f, index: make(map[*Value]int)}
+        if err := v.function(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (v *verifier) function() error {
+    f := v.f
+    if len(f.Blocks) == 0 {
+        return nil
+    }
+    if len(f.Blocks[0].Preds) > 0 {
+        return v.errorf("Entry block has predecessors")
+    }
+    v.dom = f.Dominators()
+
+    blocks := make(map[*Block]bool)
+    ids := make(map[int]bool)
+    for _, b := range f.Blocks {
+        blocks[b] = true
+        for i, val := range b.Values {
+            if ids[val.ID] {
+                return v.errorf("%s defined twice", val.Name())
+            }
+            ids[val.ID] = true
+            v.index[val] = i
+        }
+    }
+
+    for _, b := range f.Blocks {
+        if b.Func != f {
+            return v.errorf("%s belongs to fn %s", b.Name(), b.Func.Name)
+        }
+        if !v.dom.Reachable(b) {
+            return v.errorf("%s is unreachable", b.Name())
+        }
+        if err := v.edges(b, blocks); err != nil {
+            return err
+        }
+        for i, val := range b.Values {
+            if val.Block != b {
+                return v.errorf("%s is listed in %s but belongs to %s",
+                    val.Name(), b.Name(), val.Block.Name())
+            }
+            if val.Op == OpPhi && i > 0 && b.Values[i - 1].Op != OpPhi {
+                return v.errorf("%s: phi %s after other values", b.Name(), val.Name())
+            }
+            if err := v.value(val); err != nil {
+                return err
+            }
+        }
+        if err := v.terminator(b); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (v *verifier) edges(b *Block, blocks map[*Block]bool) error {
+    succs := map[BlockKind]int{BlockJump: 1, BlockIf: 2, BlockReturn: 0, BlockTrap: 0}
+    if n, ok := succs[b.Kind]; !ok || n != len(b.Succs) {
+        return v.errorf("%s has %d successors", b.Name(), len(b.Succs))
+    }
+    for _, s := range b.Succs {
+        if !blocks[s] {
+            return v.errorf("%s jumps to a block of another function", b.Name())
+        }
+        if count(s.Preds, b) != count(b.Succs, s) {
+            return v.errorf("%s is missing from the predecessors of %s", b.Name(), s.Name())
+        }
+    }
+    for _, p := range b.Preds {
+        if count(p.Succs, b) == 0 {
+            return v.errorf("%s lists %s as predecessor", b.Name(), p.Name())
+        }
+    }
+    return nil
+}
+
+func count(blocks []*Block, b *Block) int {
+    n := 0
+    for _, other := range blocks {
+        if other == b {
+            n++
+        }
+    }
+    return n
+}
+
+func (v *verifier) terminator(b *Block) error {
+    switch b.Kind {
+    case BlockIf:
+        if err := v.use(b.Control, b, len(b.Values)); err != nil {
+            return err
+        }
+        if b.Control.Type != Bool {
+            return v.errorf("%s: condition %s is %s", b.Name(), b.Control.Name(), b.Control.Type)
+        }
+    case BlockReturn:
+        if err := v.use(b.Control, b, len(b.Values)); err != nil {
+            return err
+        }
+        if b.Control.Type != v.f.Return {
+            return v.errorf("%s: returns %s, expected %s", b.Name(), b.Control.Type, v.f.Return)
+        }
+    }
+    return nil
+}
+
+// arg is used in b before the value at index i
+func (v *verifier) use(arg *Value, b *Block, i int) error {
+    if arg == nil {
+        return v.errorf("%s: missing argument", b.Name())
+    }
+    j, ok := v.index[arg]
+    if !ok || arg.Block.Func != v.f {
+        return v.errorf("%s: %s is not defined in this function", b.Name(), arg.Name())
+    }
+    if arg.Block == b && j >= i || !v.dom.Dominates(arg.Block, b) {
+        return v.errorf("%s: %s is used before it is defined", b.Name(), arg.Name())
+    }
+    return nil
+}
+
+func (v *verifier) value(val *Value) error {
+    b := val.Block
+    if val.Op == OpPhi {
+        if len(val.Args) != len(b.Preds) {
+            return v.errorf("%s has %d arguments for %d predecessors",
+                val.Name(), len(val.Args), len(b.Preds))
+        }
+        for i, arg := range val.Args {
+            pred := b.Preds[i]
+            if err := v.use(arg, pred, len(pred.Values)); err != nil {
+                return err
+            }
+        }
+    } else {
+        for _, arg := range val.Args {
+            if err := v.use(arg, b, v.index[val]); err != nil {
+                return err
+            }
+        }
+    }
+    if err := v.types(val); err != nil {
+        return v.errorf("%s: %s", val.LongString(), err.Error())
+    }
+    return nil
+}
+
+func (v *verifier) types(val *Value) error {
+    args := make([]Type, len(val.Args))
+    for i, arg := range val.Args {
+        args[i] = arg.Type
+    }
+    expect := func(ty Type, params ...Type) error {
+        if val.Type != ty {
+            return fmt.Errorf("expected type %s", ty)
+        }
+        if len(args) != len(params) {
+            return fmt.Errorf("expected %d arguments", len(params))
+        }
+        for i, p := range params {
+            if args[i] != p {
+                return fmt.Errorf("argument %d should be %s", i, p)
+            }
+        }
+        return nil
+    }
+
+    switch val.Op {
+    case OpParam:
+        i, ok := val.Aux.(int)
+        if !ok || i < 0 || i >= len(v.f.Params) || val.Block != v.f.Blocks[0] {
+            return fmt.Errorf("invalid parameter")
+        }
+        return expect(v.f.Params[i])
+    case OpConst:
+        switch val.Aux.(type) {
+        case int64:
+            return expect(Int)
+        case bool:
+            return expect(Bool)
+        case float64:
+            return expect(F64)
+        }
+        return fmt.Errorf("invalid constant")
+    case OpUnit:
+        return expect(Unit)
+    case OpString:
+        if _, ok := val.Aux.(string); !ok {
+            return fmt.Errorf("invalid string")
+        }
+        return expect(Ptr)
+    case OpFunc:
+        name, _ := val.Aux.(string)
+        if v.p.Lookup(name) == nil {
+            return fmt.Errorf("unknown function")
+        }
+        return expect(Func)
+
+    case OpAdd, OpSub, OpMul, OpDiv:
+        if val.Type != Int && val.Type != F64 {
+            return fmt.Errorf("arithmetic on %s", val.Type)
+        }
+        return expect(val.Type, val.Type, val.Type)
+    case OpMod:
+        return expect(Int, Int, Int)
+    case OpNeg:
+        if val.Type != Int && val.Type != F64 {
+            return fmt.Errorf("arithmetic on %s", val.Type)
+        }
+        return expect(val.Type, val.Type)
+    case OpNot:
+        return expect(Bool, Bool)
+    case OpEq:
+        if len(args) != 2 {
+            return fmt.Errorf("expected 2 arguments")
+        }
+        return expect(Bool, args[0], args[0])
+
+    case OpTuple, OpArray:
+        if val.Type != Ptr {
+            return fmt.Errorf("expected type Ptr")
+        }
+    case OpVariant:
+        if i, ok := val.Aux.(int); !ok || i < 0 || len(args) > 1 || val.Type != Ptr {
+            return fmt.Errorf("invalid variant")
+        }
+    case OpElem:
+        if i, ok := val.Aux.(int); !ok || i < 0 {
+            return fmt.Errorf("invalid index")
+        }
+        return expect(val.Type, Ptr)
+    case OpIndex:
+        return expect(val.Type, Ptr, Int)
+    case OpTag:
+        return expect(Int, Ptr)
+    case OpPayload:
+        if i, ok := val.Aux.(int); !ok || i < 0 {
+            return fmt.Errorf("invalid tag")
+        }
+        return expect(val.Type, Ptr)
+
+    case OpCall:
+        name, _ := val.Aux.(string)
+        callee := v.p.Lookup(name)
+        if callee == nil {
+            return fmt.Errorf("unknown function")
+        }
+        return expect(callee.Return, callee.Params...)
+    case OpCallInd:
+        if len(args) == 0 || args[0] != Func {
+            return fmt.Errorf("callee should be Func")
+        }
+    case OpPhi:
+        for i, arg := range args {
+            if arg != val.Type {
+                return fmt.Errorf("argument %d should be %s", i, val.Type)
+            }
+        }
+    default:
+        return fmt.Errorf("unknown op")
+    }
+    return nil
+}
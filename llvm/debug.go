@@ -0,0 +1,74 @@
+package llvm
+
+import (
+    "fmt"
+    "path/filepath"
+    "strings"
+
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// debugInfo collects the metadata of the line tables: a compile unit for
+// the file of fn main, a subprogram per function and a location per
+// position instructions come from. Nodes are numbered in the order they
+// are made, the unit is !0.
+type debugInfo struct {
+    nodes []string
+    index map[string]int // of the nodes that are not distinct
+}
+
+func newDebugInfo(file string) *debugInfo {
+    d := &debugInfo{index: make(map[string]int)}
+    d.nodes = append(d.nodes, "")
+    d.nodes[0] = fmt.Sprintf("distinct !DICompileUnit(language: DW_LANG_C99, file: %s, " +
+        "producer: \"ibex\", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)",
+        d.file(file))
+    return d
+}
+
+// the reference to a node equal to the node given, made if there is none
+func (d *debugInfo) node(node string) string {
+    if i, ok := d.index[node]; ok {
+        return fmt.Sprintf("!%d", i)
+    }
+    d.index[node] = len(d.nodes)
+    return d.distinct(node)
+}
+
+// the reference to a new node
+func (d *debugInfo) distinct(node string) string {
+    d.nodes = append(d.nodes, node)
+    return fmt.Sprintf("!%d", len(d.nodes) - 1)
+}
+
+func (d *debugInfo) file(name string) string {
+    return d.node(fmt.Sprintf("!DIFile(filename: %s, directory: %s)",
+        quote(filepath.Base(name)), quote(filepath.Dir(name))))
+}
+
+// the subprogram of the function of the given name and symbol whose name
+// starts at pos
+func (d *debugInfo) subprogram(name string, symbol string, pos parser.Pos) string {
+    file := d.file(pos.File)
+    ty := d.node(fmt.Sprintf("!DISubroutineType(types: %s)", d.node("!{}")))
+    return d.distinct(fmt.Sprintf("distinct !DISubprogram(name: %s, linkageName: %s, scope: %s, file: %s, " +
+        "line: %d, type: %s, scopeLine: %d, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)",
+        quote(name), quote(symbol), file, file, pos.Line, ty, pos.Line))
+}
+
+func (d *debugInfo) location(pos parser.Pos, scope string) string {
+    return d.node(fmt.Sprintf("!DILocation(line: %d, column: %d, scope: %s)", pos.Line, pos.Col, scope))
+}
+
+func (d *debugInfo) String() string {
+    var b strings.Builder
+    flags := []string{
+        d.node("!{i32 7, !\"Dwarf Version\", i32 4}"),
+        d.node("!{i32 2, !\"Debug Info Version\", i32 3}"),
+    }
+    fmt.Fprintf(&b, "!llvm.dbg.cu = !{!0}\n!llvm.module.flags = !{%s}\n\n", strings.Join(flags, ", "))
+    for i, node := range d.nodes {
+        fmt.Fprintf(&b, "!%d = %s\n", i, node)
+    }
+    return b.String()
+}
@@ -0,0 +1,392 @@
+package llvm
+
+import (
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type generator struct {
+    p *ir.Program
+    info *check.Info
+    reachable []*ir.Function // from main, the others are left out
+    defined map[string]bool // named types
+    strs map[string]string // globals holding string constants
+    cstrs map[string]string // the same with a NUL for the runtime
+    declared map[string]bool // runtime functions
+    printers map[string]string // by name of the LLVM type
+    debug *debugInfo // nil without positions
+
+    types strings.Builder
+    globals strings.Builder
+    funcs strings.Builder
+    prints strings.Builder
+}
+
+// Generate translates a lowered program to textual LLVM IR with line
+// tables for its positions. The runtime functions it declares are in
+// Runtime. Its main prints the result of fn main formatted like
+// interp.Format.
+func Generate(p *ir.Program, info *check.Info) (string, error) {
+    main := p.Lookup("main")
+    if main == nil {
+        return "", errors.New("No fn main")
+    }
+    if len(main.Params) > 0 {
+        return "", errors.New("fn main must not take parameters")
+    }
+
+    g := &generator{
+        p: p,
+        info: info,
+        defined: make(map[string]bool),
+        strs: make(map[string]string),
+        cstrs: make(map[string]string),
+        declared: make(map[string]bool),
+        printers: make(map[string]string),
+    }
+    g.reachable = ir.Reachable(p, main)
+    for _, f := range g.reachable {
+        if len(f.Blocks) == 0 {
+            return "", fmt.Errorf("fn %s has no body", f.Name)
+        }
+    }
+    if main.Pos.Line > 0 {
+        g.debug = newDebugInfo(main.Pos.File)
+    }
+
+    for _, f := range g.reachable {
+        g.function(f)
+    }
+    g.entry(main)
+
+    var out strings.Builder
+    fmt.Fprintf(&out, "source_filename = %s\n\n", quote(main.Pos.File))
+    for _, section := range []*strings.Builder{&g.types, &g.globals} {
+        if section.Len() > 0 {
+            out.WriteString(section.String() + "\n")
+        }
+    }
+    for _, d := range runtime {
+        if g.declared[d.name] {
+            out.WriteString(d.decl + "\n")
+        }
+    }
+    out.WriteString("\n" + g.funcs.String() + g.prints.String())
+    if g.debug != nil {
+        out.WriteString(g.debug.String())
+    }
+    return out.String(), nil
+}
+
+// an LLVM name, quoted unless it only has the characters of a plain one
+func ident(name string) string {
+    for i, c := range name {
+        if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '$' || c == '.' ||
+            c == '_' || c >= '0' && c <= '9' && i > 0 {
+            continue
+        }
+        return quote(name)
+    }
+    return name
+}
+
+// a string in double quotes with the bytes other than printable ASCII,
+// '"' and '\' escaped by their hex code
+func quote(s string) string {
+    var b strings.Builder
+    b.WriteByte('"')
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+            fmt.Fprintf(&b, "\\%02X", c)
+        } else {
+            b.WriteByte(c)
+        }
+    }
+    b.WriteByte('"')
+    return b.String()
+}
+
+// the symbol of an Ibex function, prefixed so that main is left to the C
+// entry point
+func funcName(f *ir.Function) string {
+    return "@" + ident("ibex." + f.Name)
+}
+
+// a global holding the bytes of s, interned
+func (g *generator) str(s string) string {
+    return g.constant(g.strs, ".str", s)
+}
+
+// the same for a C string of s
+func (g *generator) cstr(s string) string {
+    return g.constant(g.cstrs, ".cstr", s + "\x00")
+}
+
+func (g *generator) constant(pool map[string]string, prefix string, s string) string {
+    if name, ok := pool[s]; ok {
+        return name
+    }
+    name := fmt.Sprintf("@%s.%d", prefix, len(pool))
+    pool[s] = name
+    fmt.Fprintf(&g.globals, "%s = private unnamed_addr constant [%d x i8] c%s\n", name, len(s), quote(s))
+    return name
+}
+
+// the symbol of a runtime function, declaring it
+func (g *generator) rt(name string) string {
+    g.declared[name] = true
+    return "@" + name
+}
+
+type funcGen struct {
+    g *generator
+    f *ir.Function
+    w *strings.Builder
+    scope string // of the subprogram, empty without debug info
+}
+
+func (g *generator) function(f *ir.Function) {
+    params := g.llTypes(ir.Flatten(f.Signature.Argument))
+    decls := make([]string, len(params))
+    for i, p := range params {
+        decls[i] = fmt.Sprintf("%s %%p%d", p, i)
+    }
+    fg := &funcGen{g: g, f: f, w: &g.funcs}
+    attach := ""
+    if g.debug != nil && f.Pos.Line > 0 {
+        fg.scope = g.debug.subprogram(f.Name, "ibex." + f.Name, f.Pos)
+        attach = " !dbg " + fg.scope
+    }
+
+    w := fg.w
+    fmt.Fprintf(w, "; fn %s\ndefine internal %s %s(%s)%s {\n", f.Name,
+        g.llType(ir.ReturnOf(f.Signature)), funcName(f), strings.Join(decls, ", "), attach)
+    for i, b := range f.Blocks {
+        if i > 0 {
+            w.WriteString("\n")
+        }
+        fmt.Fprintf(w, "%s:\n", b.Name())
+        for _, v := range b.Values {
+            fg.value(v)
+        }
+        fg.terminator(b)
+    }
+    w.WriteString("}\n\n")
+}
+
+// whether v is not computed by an instruction but written where it is
+// used, see operand
+func inline(v *ir.Value) bool {
+    switch v.Op {
+    case ir.OpParam, ir.OpConst, ir.OpUnit, ir.OpString, ir.OpFunc:
+        return true
+    case ir.OpEq:
+        return v.Args[0].Type == ir.Unit
+    }
+    return false
+}
+
+func (fg *funcGen) operand(v *ir.Value) string {
+    switch v.Op {
+    case ir.OpParam:
+        return fmt.Sprintf("%%p%d", v.Aux.(int))
+    case ir.OpConst:
+        return constant(v.Aux)
+    case ir.OpUnit:
+        return "zeroinitializer"
+    case ir.OpString:
+        s := v.Aux.(string)
+        return fmt.Sprintf("{ i64 %d, ptr %s }", len(s), fg.g.str(s))
+    case ir.OpFunc:
+        return funcName(fg.g.p.Lookup(v.Aux.(string)))
+    case ir.OpEq:
+        if v.Args[0].Type == ir.Unit {
+            return "true"
+        }
+    }
+    return "%" + v.Name()
+}
+
+func constant(aux interface{}) string {
+    switch c := aux.(type) {
+    case int64:
+        return fmt.Sprint(c)
+    case bool:
+        return fmt.Sprint(c)
+    case float64:
+        return fmt.Sprintf("0x%016X", math.Float64bits(c))
+    }
+    return "0"
+}
+
+// the operand preceded by its type
+func (fg *funcGen) typed(v *ir.Value) string {
+    return fg.g.valueType(v) + " " + fg.operand(v)
+}
+
+// the attachment of the location pos, the function's own if pos is
+// unknown or in another file after inlining
+func (fg *funcGen) at(pos parser.Pos) string {
+    if fg.scope == "" {
+        return ""
+    }
+    if pos.Line == 0 || pos.File != fg.f.Pos.File {
+        pos = fg.f.Pos
+    }
+    return ", !dbg " + fg.g.debug.location(pos, fg.scope)
+}
+
+// writes an instruction located at pos
+func (fg *funcGen) emit(pos parser.Pos, format string, a ...interface{}) {
+    fmt.Fprintf(fg.w, "  %s%s\n", fmt.Sprintf(format, a...), fg.at(pos))
+}
+
+func (fg *funcGen) value(v *ir.Value) {
+    if inline(v) {
+        return
+    }
+    g := fg.g
+    ty := g.valueType(v)
+    name := "%" + v.Name()
+    args := make([]string, len(v.Args))
+    for i, arg := range v.Args {
+        args[i] = fg.operand(arg)
+    }
+    set := func(format string, a ...interface{}) {
+        fg.emit(v.Pos, "%s = %s", name, fmt.Sprintf(format, a...))
+    }
+    // a temporary named after v
+    tmp := func(suffix string, format string, a ...interface{}) string {
+        t := name + "." + suffix
+        fg.emit(v.Pos, "%s = %s", t, fmt.Sprintf(format, a...))
+        return t
+    }
+
+    switch v.Op {
+    case ir.OpAdd, ir.OpSub, ir.OpMul:
+        op := map[ir.Op]string{ir.OpAdd: "add", ir.OpSub: "sub", ir.OpMul: "mul"}[v.Op]
+        if v.Type == ir.F64 {
+            op = "f" + op
+        }
+        set("%s %s %s, %s", op, ty, args[0], args[1])
+    case ir.OpNeg:
+        if v.Type == ir.F64 {
+            set("fneg double %s", args[0])
+        } else {
+            set("sub i64 0, %s", args[0])
+        }
+    case ir.OpDiv, ir.OpMod:
+        if v.Type == ir.F64 {
+            set("%s double %s, %s", map[ir.Op]string{ir.OpDiv: "fdiv", ir.OpMod: "frem"}[v.Op], args[0], args[1])
+            return
+        }
+        set("call i64 %s(i64 %s, i64 %s, ptr %s)", g.rt("ibex_" + v.Op.String()), args[0], args[1],
+            g.cstr(v.Pos.String()))
+    case ir.OpNot:
+        set("xor i1 %s, true", args[0])
+    case ir.OpEq:
+        switch v.Args[0].Type {
+        case ir.Ptr:
+            a := []string{
+                tmp("alen", "extractvalue %%string %s, 0", args[0]),
+                tmp("a", "extractvalue %%string %s, 1", args[0]),
+                tmp("blen", "extractvalue %%string %s, 0", args[1]),
+                tmp("b", "extractvalue %%string %s, 1", args[1]),
+            }
+            set("call zeroext i1 %s(i64 %s, ptr %s, i64 %s, ptr %s)", g.rt("ibex_str_eq"), a[0], a[1], a[2], a[3])
+        case ir.F64:
+            set("fcmp oeq double %s, %s", args[0], args[1])
+        default:
+            set("icmp eq %s %s, %s", g.valueType(v.Args[0]), args[0], args[1])
+        }
+
+    case ir.OpTuple:
+        agg := "undef"
+        for i, arg := range v.Args {
+            dst := fmt.Sprintf("%s.%d", name, i)
+            if i == len(v.Args) - 1 {
+                dst = name
+            }
+            fg.emit(v.Pos, "%s = insertvalue %s %s, %s, %d", dst, ty, agg, fg.typed(arg), i)
+            agg = dst
+        }
+    case ir.OpArray:
+        elem := g.llType(v.Source.(core.IbexArrayType).Elem())
+        end := tmp("end", "getelementptr %s, ptr null, i64 %d", elem, len(args))
+        size := tmp("size", "ptrtoint ptr %s to i64", end)
+        data := tmp("data", "call ptr %s(i64 %s)", g.rt("ibex_alloc"), size)
+        for i, arg := range v.Args {
+            addr := tmp(fmt.Sprint(i), "getelementptr %s, ptr %s, i64 %d", elem, data, i)
+            fg.emit(v.Pos, "store %s, ptr %s", fg.typed(arg), addr)
+        }
+        set("insertvalue %s { i64 %d, ptr undef }, ptr %s, 1", ty, len(args), data)
+    case ir.OpVariant:
+        cs := g.caseType(v.Source, v.Aux.(int))
+        end := tmp("end", "getelementptr %s, ptr null, i64 1", cs)
+        size := tmp("size", "ptrtoint ptr %s to i64", end)
+        set("call ptr %s(i64 %s)", g.rt("ibex_alloc"), size)
+        fg.emit(v.Pos, "store i64 %d, ptr %s", v.Aux.(int), name)
+        if len(args) > 0 {
+            addr := tmp("payload", "getelementptr %s, ptr %s, i32 0, i32 1", cs, name)
+            fg.emit(v.Pos, "store %s, ptr %s", fg.typed(v.Args[0]), addr)
+        }
+    case ir.OpElem:
+        set("extractvalue %s, %d", fg.typed(v.Args[0]), v.Aux.(int))
+    case ir.OpIndex:
+        n := tmp("len", "extractvalue %s, 0", fg.typed(v.Args[0]))
+        fg.emit(v.Pos, "call void %s(i64 %s, i64 %s, ptr %s)", g.rt("ibex_check_index"), args[1], n,
+            g.cstr(v.Pos.String()))
+        data := tmp("data", "extractvalue %s, 1", fg.typed(v.Args[0]))
+        addr := tmp("addr", "getelementptr %s, ptr %s, i64 %s", ty, data, args[1])
+        set("load %s, ptr %s", ty, addr)
+    case ir.OpTag:
+        set("load i64, ptr %s", args[0])
+    case ir.OpPayload:
+        addr := tmp("addr", "getelementptr %s, ptr %s, i32 0, i32 1", g.caseType(v.Args[0].Source, v.Aux.(int)),
+            args[0])
+        set("load %s, ptr %s", ty, addr)
+
+    case ir.OpCall:
+        set("call %s %s(%s)", ty, funcName(g.p.Lookup(v.Aux.(string))), fg.typedAll(v.Args))
+    case ir.OpCallInd:
+        set("call %s %s(%s)", ty, args[0], fg.typedAll(v.Args[1:]))
+    case ir.OpPhi:
+        incoming := make([]string, len(v.Args))
+        for i, pred := range v.Block.Preds {
+            incoming[i] = fmt.Sprintf("[ %s, %%%s ]", args[i], pred.Name())
+        }
+        fmt.Fprintf(fg.w, "  %s = phi %s %s\n", name, ty, strings.Join(incoming, ", "))
+    }
+}
+
+func (fg *funcGen) typedAll(vs []*ir.Value) string {
+    args := make([]string, len(vs))
+    for i, v := range vs {
+        args[i] = fg.typed(v)
+    }
+    return strings.Join(args, ", ")
+}
+
+func (fg *funcGen) terminator(b *ir.Block) {
+    switch b.Kind {
+    case ir.BlockJump:
+        fmt.Fprintf(fg.w, "  br label %%%s\n", b.Succs[0].Name())
+    case ir.BlockIf:
+        fmt.Fprintf(fg.w, "  br i1 %s, label %%%s, label %%%s\n", fg.operand(b.Control),
+            b.Succs[0].Name(), b.Succs[1].Name())
+    case ir.BlockReturn:
+        fmt.Fprintf(fg.w, "  ret %s\n", fg.typed(b.Control))
+    case ir.BlockTrap:
+        fg.emit(b.Pos, "call void %s(ptr %s, ptr %s)", fg.g.rt("ibex_trap"), fg.g.cstr(b.Message),
+            fg.g.cstr(b.Pos.String()))
+        fg.w.WriteString("  unreachable\n")
+    }
+}
@@ -0,0 +1,89 @@
+package llvm
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/internal/backendtest"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func generate(t *testing.T, l *backendtest.Lowered) string {
+	ll, err := Generate(l.Program, l.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ll
+}
+
+// compiles ll with the local llc and links it with the runtime by the
+// local C compiler, then runs it
+func compileAndRun(t *testing.T, ll string) (string, error) {
+	llc, err := exec.LookPath("llc")
+	if err != nil {
+		t.Skip("no llc")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, RuntimeFile), []byte(Runtime), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "main.ll"), []byte(ll), 0644))
+
+	args := []string{"-filetype=obj", "-relocation-model=pic", "-o", filepath.Join(dir, "main.o"),
+		filepath.Join(dir, "main.ll")}
+	// opaque pointers are the default from LLVM 15 on
+	version, _ := exec.Command(llc, "--version").Output()
+	if m := regexp.MustCompile(`LLVM version (\d+)`).FindSubmatch(version); m != nil {
+		if major, _ := strconv.Atoi(string(m[1])); major < 15 {
+			args = append([]string{"-opaque-pointers"}, args...)
+		}
+	}
+	out, err := exec.Command(llc, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s\n%s", err, out, ll)
+	}
+	out, err = exec.Command(cc, "-o", filepath.Join(dir, "main"), filepath.Join(dir, "main.o"),
+		filepath.Join(dir, RuntimeFile)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	out, err = exec.Command(filepath.Join(dir, "main")).CombinedOutput()
+	return string(out), err
+}
+
+func TestGenerateGolden(t *testing.T) {
+	for _, prog := range backendtest.Programs {
+		ll := generate(t, backendtest.Lower(t, prog.Source, 1))
+		golden := filepath.Join("testdata", prog.Name + ".ll")
+		if *update {
+			assert.Nil(t, os.WriteFile(golden, []byte(ll), 0644))
+			continue
+		}
+		expected, err := os.ReadFile(golden)
+		assert.Nil(t, err)
+		assert.Equal(t, string(expected), ll, prog.Name)
+	}
+}
+
+func run(t *testing.T, l *backendtest.Lowered) (string, error) {
+	return compileAndRun(t, generate(t, l))
+}
+
+func TestGenerateMatchesInterpreter(t *testing.T) {
+	backendtest.MatchesInterpreter(t, run)
+}
+
+func TestGenerateTraps(t *testing.T) {
+	backendtest.FailsOnTraps(t, run, func(message string, pos string) string {
+		return "Runtime error: " + message + "\n    at " + pos + "\n"
+	})
+}
@@ -0,0 +1,170 @@
+package llvm
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// printFunc writes the body of a function printing a value
+type printFunc struct {
+    g *generator
+    w strings.Builder
+    temps int
+}
+
+func (pf *printFunc) tmp() string {
+    pf.temps++
+    return fmt.Sprintf("%%t%d", pf.temps)
+}
+
+func (pf *printFunc) emit(format string, a ...interface{}) {
+    fmt.Fprintf(&pf.w, "  %s\n", fmt.Sprintf(format, a...))
+}
+
+func (pf *printFunc) text(s string) {
+    pf.emit("call void %s(ptr %s)", pf.g.rt("ibex_print_cstr"), pf.g.cstr(s))
+}
+
+// writes the calls printing x of type ty like interp.Format
+func (pf *printFunc) print(ty core.IbexType, x string) {
+    g := pf.g
+    switch t := g.llType(ty); t {
+    case "i64":
+        pf.emit("call void %s(i64 %s)", g.rt("ibex_print_int"), x)
+    case "double":
+        pf.emit("call void %s(double %s)", g.rt("ibex_print_f64"), x)
+    case "i1":
+        pf.emit("call void %s(i1 zeroext %s)", g.rt("ibex_print_bool"), x)
+    case "{}":
+        pf.text("()")
+    case "%string":
+        n, data := pf.tmp(), pf.tmp()
+        pf.emit("%s = extractvalue %%string %s, 0", n, x)
+        pf.emit("%s = extractvalue %%string %s, 1", data, x)
+        pf.emit("call void %s(i64 %s, ptr %s)", g.rt("ibex_print_string"), n, data)
+    default:
+        pf.emit("call void %s(%s %s)", g.printer(ty), t, x)
+    }
+}
+
+// the name of a function printing a value of an aggregate type ty,
+// generated on first use
+func (g *generator) printer(ty core.IbexType) string {
+    ty = ir.Erase(ty)
+    key := core.TypeString(ty)
+    if name, ok := g.printers[key]; ok {
+        return name
+    }
+    name := "@" + ident("print." + key)
+    g.printers[key] = name
+    t := g.llType(ty)
+
+    pf := &printFunc{g: g}
+    switch ty := ty.(type) {
+    case core.IbexTupleType:
+        pf.text("(")
+        for i, elem := range ty.ElementTypes {
+            if i > 0 {
+                pf.text(", ")
+            }
+            x := pf.tmp()
+            pf.emit("%s = extractvalue %s %%v, %d", x, t, i)
+            pf.print(elem, x)
+        }
+        pf.text(")")
+    case core.IbexNamedTupleType:
+        for i, entry := range ty.Types {
+            sep := ", "
+            if i == 0 {
+                sep = "("
+            }
+            pf.text(sep + entry.Name + ": ")
+            x := pf.tmp()
+            pf.emit("%s = extractvalue %s %%v, %d", x, t, i)
+            pf.print(entry.Type, x)
+        }
+        pf.text(")")
+    case core.IbexArrayType:
+        elem := g.llType(ty.Elem())
+        pf.text("[")
+        pf.emit("%%len = extractvalue %%array %%v, 0")
+        pf.emit("%%data = extractvalue %%array %%v, 1")
+        pf.emit("br label %%loop")
+        pf.w.WriteString("\nloop:\n")
+        pf.emit("%%i = phi i64 [ 0, %%entry ], [ %%next, %%elem ]")
+        pf.emit("%%more = icmp slt i64 %%i, %%len")
+        pf.emit("br i1 %%more, label %%body, label %%done")
+        pf.w.WriteString("\nbody:\n")
+        pf.emit("%%first = icmp eq i64 %%i, 0")
+        pf.emit("br i1 %%first, label %%elem, label %%sep")
+        pf.w.WriteString("\nsep:\n")
+        pf.text(", ")
+        pf.emit("br label %%elem")
+        pf.w.WriteString("\nelem:\n")
+        pf.emit("%%addr = getelementptr %s, ptr %%data, i64 %%i", elem)
+        x := pf.tmp()
+        pf.emit("%s = load %s, ptr %%addr", x, elem)
+        pf.print(ty.Elem(), x)
+        pf.emit("%%next = add i64 %%i, 1")
+        pf.emit("br label %%loop")
+        pf.w.WriteString("\ndone:\n")
+        pf.text("]")
+    case core.IbexSimpleType:
+        cases := g.info.Cases(ty)
+        labels := make([]string, len(cases))
+        for i := range cases {
+            labels[i] = fmt.Sprintf("i64 %d, label %%case%d", i, i)
+        }
+        pf.emit("%%tag = load i64, ptr %%v")
+        pf.emit("switch i64 %%tag, label %%done [ %s ]", strings.Join(labels, " "))
+        for i, cs := range cases {
+            fmt.Fprintf(&pf.w, "\ncase%d:\n", i)
+            pf.text(cs.Tag)
+            if cs.Payload != nil {
+                addr, x := pf.tmp(), pf.tmp()
+                pf.emit("%s = getelementptr %s, ptr %%v, i32 0, i32 1", addr, g.caseType(ty, i))
+                pf.emit("%s = load %s, ptr %s", x, g.llType(cs.Payload), addr)
+                switch cs.Payload.(type) {
+                case core.IbexTupleType, core.IbexNamedTupleType:
+                    pf.text(" ")
+                    pf.print(cs.Payload, x)
+                default:
+                    pf.text(" (")
+                    pf.print(cs.Payload, x)
+                    pf.text(")")
+                }
+            }
+            pf.emit("br label %%done")
+        }
+        pf.w.WriteString("\ndone:\n")
+    case core.IbexFunctionType:
+        // the name of the function v points to, empty if it is not one
+        // of the program
+        name := g.cstr("")
+        for _, f := range g.reachable {
+            display := f.Name
+            if i := strings.Index(display, "["); i >= 0 {
+                display = display[:i]
+            }
+            is, next := pf.tmp(), pf.tmp()
+            pf.emit("%s = icmp eq ptr %%v, %s", is, funcName(f))
+            pf.emit("%s = select i1 %s, ptr %s, ptr %s", next, is, g.cstr("fn " + display), name)
+            name = next
+        }
+        pf.emit("call void %s(ptr %s)", g.rt("ibex_print_cstr"), name)
+    }
+    fmt.Fprintf(&g.prints, "define internal void %s(%s %%v) {\nentry:\n%s  ret void\n}\n\n", name, t, pf.w.String())
+    return name
+}
+
+// the C entry point, printing the result of fn main and a newline
+func (g *generator) entry(main *ir.Function) {
+    pf := &printFunc{g: g}
+    pf.emit("%%result = call %s %s()", g.llType(ir.ReturnOf(main.Signature)), funcName(main))
+    pf.print(ir.ReturnOf(main.Signature), "%result")
+    pf.text("\n")
+    fmt.Fprintf(&g.funcs, "define i32 @main() {\nentry:\n%s  ret i32 0\n}\n\n", pf.w.String())
+}
@@ -0,0 +1,114 @@
+package llvm
+
+// the name main.go writes the runtime by next to the generated IR
+const RuntimeFile = "ibex_rt.c"
+
+// the declarations of the runtime functions, in the order they are
+// written
+var runtime = []struct {
+    name string
+    decl string
+}{
+    {"ibex_trap", "declare void @ibex_trap(ptr, ptr) noreturn"},
+    {"ibex_alloc", "declare ptr @ibex_alloc(i64)"},
+    {"ibex_str_eq", "declare zeroext i1 @ibex_str_eq(i64, ptr, i64, ptr)"},
+    {"ibex_div", "declare i64 @ibex_div(i64, i64, ptr)"},
+    {"ibex_mod", "declare i64 @ibex_mod(i64, i64, ptr)"},
+    {"ibex_check_index", "declare void @ibex_check_index(i64, i64, ptr)"},
+    {"ibex_print_int", "declare void @ibex_print_int(i64)"},
+    {"ibex_print_f64", "declare void @ibex_print_f64(double)"},
+    {"ibex_print_bool", "declare void @ibex_print_bool(i1 zeroext)"},
+    {"ibex_print_string", "declare void @ibex_print_string(i64, ptr)"},
+    {"ibex_print_cstr", "declare void @ibex_print_cstr(ptr)"},
+}
+
+// Runtime is the C source of the functions the generated IR declares,
+// to be compiled and linked with it. Strings are passed as their length
+// and a pointer to their bytes, aggregates are never freed.
+const Runtime = `#include <stdbool.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+void ibex_trap(const char *message, const char *pos) {
+    fflush(stdout);
+    fprintf(stderr, "Runtime error: %s\n    at %s\n", message, pos);
+    exit(1);
+}
+
+void *ibex_alloc(int64_t size) {
+    void *p = malloc(size > 0 ? (size_t)size : 1);
+    if (p == NULL) {
+        fputs("Out of memory\n", stderr);
+        exit(1);
+    }
+    return p;
+}
+
+bool ibex_str_eq(int64_t alen, const char *a, int64_t blen, const char *b) {
+    return alen == blen && memcmp(a, b, (size_t)alen) == 0;
+}
+
+int64_t ibex_div(int64_t x, int64_t y, const char *pos) {
+    if (y == 0) {
+        ibex_trap("Division by zero", pos);
+    }
+    return y == -1 ? (int64_t)(0 - (uint64_t)x) : x / y;
+}
+
+int64_t ibex_mod(int64_t x, int64_t y, const char *pos) {
+    if (y == 0) {
+        ibex_trap("Division by zero", pos);
+    }
+    return y == -1 ? 0 : x % y;
+}
+
+void ibex_check_index(int64_t i, int64_t len, const char *pos) {
+    char message[96];
+    if (i < 0 || i >= len) {
+        sprintf(message, "Index %lld is out of range for an array of length %lld",
+            (long long)i, (long long)len);
+        ibex_trap(message, pos);
+    }
+}
+
+void ibex_print_int(int64_t x) {
+    printf("%lld", (long long)x);
+}
+
+void ibex_print_f64(double x) {
+    printf("%.17g", x);
+}
+
+void ibex_print_bool(bool x) {
+    fputs(x ? "true" : "false", stdout);
+}
+
+/* quoted like Go's strconv.Quote for ASCII */
+void ibex_print_string(int64_t len, const char *data) {
+    int64_t i;
+    putchar('"');
+    for (i = 0; i < len; i++) {
+        unsigned char c = (unsigned char)data[i];
+        switch (c) {
+        case '"': fputs("\\\"", stdout); break;
+        case '\\': fputs("\\\\", stdout); break;
+        case '\n': fputs("\\n", stdout); break;
+        case '\t': fputs("\\t", stdout); break;
+        case '\r': fputs("\\r", stdout); break;
+        default:
+            if (c < 0x20 || c == 0x7f) {
+                printf("\\x%02x", c);
+            } else {
+                putchar(c);
+            }
+        }
+    }
+    putchar('"');
+}
+
+void ibex_print_cstr(const char *s) {
+    fputs(s, stdout);
+}
+`
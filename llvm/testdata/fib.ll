@@ -0,0 +1,66 @@
+source_filename = "test.ibex"
+
+@.cstr.0 = private unnamed_addr constant [2 x i8] c"\0A\00"
+
+declare void @ibex_print_int(i64)
+declare void @ibex_print_cstr(ptr)
+
+; fn fib
+define internal i64 @ibex.fib(i64 %p0) !dbg !4 {
+b0:
+  %v2 = icmp eq i64 %p0, 0, !dbg !5
+  br i1 %v2, label %b4, label %b1
+
+b1:
+  %v4 = icmp eq i64 %p0, 1, !dbg !5
+  br i1 %v4, label %b3, label %b2
+
+b2:
+  %v5 = sub i64 %p0, 1, !dbg !5
+  %v6 = call i64 @ibex.fib(i64 %v5), !dbg !6
+  %v8 = sub i64 %p0, 2, !dbg !5
+  %v9 = call i64 @ibex.fib(i64 %v8), !dbg !7
+  %v10 = add i64 %v6, %v9, !dbg !5
+  br label %b5
+
+b3:
+  br label %b5
+
+b4:
+  br label %b5
+
+b5:
+  %v11 = phi i64 [ 0, %b4 ], [ 1, %b3 ], [ %v10, %b2 ]
+  ret i64 %v11
+}
+
+; fn main
+define internal i64 @ibex.main() !dbg !8 {
+b0:
+  %v1 = call i64 @ibex.fib(i64 20), !dbg !9
+  ret i64 %v1
+}
+
+define i32 @main() {
+entry:
+  %result = call i64 @ibex.main()
+  call void @ibex_print_int(i64 %result)
+  call void @ibex_print_cstr(ptr @.cstr.0)
+  ret i32 0
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!10, !11}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "ibex", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!1 = !DIFile(filename: "test.ibex", directory: ".")
+!2 = !{}
+!3 = !DISubroutineType(types: !2)
+!4 = distinct !DISubprogram(name: "fib", linkageName: "ibex.fib", scope: !1, file: !1, line: 1, type: !3, scopeLine: 1, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!5 = !DILocation(line: 1, column: 4, scope: !4)
+!6 = !DILocation(line: 5, column: 21, scope: !4)
+!7 = !DILocation(line: 5, column: 38, scope: !4)
+!8 = distinct !DISubprogram(name: "main", linkageName: "ibex.main", scope: !1, file: !1, line: 6, type: !3, scopeLine: 6, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!9 = !DILocation(line: 7, column: 8, scope: !8)
+!10 = !{i32 7, !"Dwarf Version", i32 4}
+!11 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,343 @@
+source_filename = "test.ibex"
+
+%string = type { i64, ptr }
+%array = type { i64, ptr }
+%"((), String)" = type { {}, %string }
+%"(List[String], Int, [][]Int, Int, ((), String))" = type { ptr, i64, %array, i64, %"((), String)" }
+%"List[String].Nil" = type { i64 }
+%"(head: String, tail: List[String])" = type { %string, ptr }
+%"List[String].Cons" = type { i64, %"(head: String, tail: List[String])" }
+%"List[Int].Nil" = type { i64 }
+%"(head: Int, tail: List[Int])" = type { i64, ptr }
+%"List[Int].Cons" = type { i64, %"(head: Int, tail: List[Int])" }
+
+@.str.0 = private unnamed_addr constant [5 x i8] c"world"
+@.str.1 = private unnamed_addr constant [13 x i8] c"hello, world?"
+@.str.2 = private unnamed_addr constant [1 x i8] c"x"
+@.str.3 = private unnamed_addr constant [1 x i8] c"a"
+@.cstr.0 = private unnamed_addr constant [15 x i8] c"No arm matches\00"
+@.cstr.1 = private unnamed_addr constant [14 x i8] c"test.ibex:5:5\00"
+@.cstr.2 = private unnamed_addr constant [2 x i8] c"(\00"
+@.cstr.3 = private unnamed_addr constant [5 x i8] c"Cons\00"
+@.cstr.4 = private unnamed_addr constant [2 x i8] c" \00"
+@.cstr.5 = private unnamed_addr constant [8 x i8] c"(head: \00"
+@.cstr.6 = private unnamed_addr constant [9 x i8] c", tail: \00"
+@.cstr.7 = private unnamed_addr constant [2 x i8] c")\00"
+@.cstr.8 = private unnamed_addr constant [4 x i8] c"Nil\00"
+@.cstr.9 = private unnamed_addr constant [3 x i8] c", \00"
+@.cstr.10 = private unnamed_addr constant [2 x i8] c"[\00"
+@.cstr.11 = private unnamed_addr constant [2 x i8] c"]\00"
+@.cstr.12 = private unnamed_addr constant [3 x i8] c"()\00"
+@.cstr.13 = private unnamed_addr constant [2 x i8] c"\0A\00"
+
+declare void @ibex_trap(ptr, ptr) noreturn
+declare ptr @ibex_alloc(i64)
+declare zeroext i1 @ibex_str_eq(i64, ptr, i64, ptr)
+declare void @ibex_print_int(i64)
+declare void @ibex_print_string(i64, ptr)
+declare void @ibex_print_cstr(ptr)
+
+; fn greet
+define internal %string @ibex.greet(%string %p0) !dbg !4 {
+b0:
+  %v2.alen = extractvalue %string %p0, 0, !dbg !5
+  %v2.a = extractvalue %string %p0, 1, !dbg !5
+  %v2.blen = extractvalue %string { i64 5, ptr @.str.0 }, 0, !dbg !5
+  %v2.b = extractvalue %string { i64 5, ptr @.str.0 }, 1, !dbg !5
+  %v2 = call zeroext i1 @ibex_str_eq(i64 %v2.alen, ptr %v2.a, i64 %v2.blen, ptr %v2.b), !dbg !5
+  br i1 %v2, label %b2, label %b1
+
+b1:
+  br label %b3
+
+b2:
+  br label %b3
+
+b3:
+  %v4 = phi %string [ { i64 13, ptr @.str.1 }, %b2 ], [ %p0, %b1 ]
+  ret %string %v4
+}
+
+; fn main
+define internal %"(List[String], Int, [][]Int, Int, ((), String))" @ibex.main() !dbg !6 {
+b0:
+  %v1 = call %string @ibex.greet(%string { i64 5, ptr @.str.0 }), !dbg !7
+  %v3 = call %string @"ibex.id[String]"(%string { i64 1, ptr @.str.2 }), !dbg !8
+  %v4.end = getelementptr %"List[String].Nil", ptr null, i64 1, !dbg !9
+  %v4.size = ptrtoint ptr %v4.end to i64, !dbg !9
+  %v4 = call ptr @ibex_alloc(i64 %v4.size), !dbg !9
+  store i64 1, ptr %v4, !dbg !9
+  %v5.0 = insertvalue %"(head: String, tail: List[String])" undef, %string %v3, 0, !dbg !9
+  %v5 = insertvalue %"(head: String, tail: List[String])" %v5.0, ptr %v4, 1, !dbg !9
+  %v6.end = getelementptr %"List[String].Cons", ptr null, i64 1, !dbg !9
+  %v6.size = ptrtoint ptr %v6.end to i64, !dbg !9
+  %v6 = call ptr @ibex_alloc(i64 %v6.size), !dbg !9
+  store i64 0, ptr %v6, !dbg !9
+  %v6.payload = getelementptr %"List[String].Cons", ptr %v6, i32 0, i32 1, !dbg !9
+  store %"(head: String, tail: List[String])" %v5, ptr %v6.payload, !dbg !9
+  %v7.0 = insertvalue %"(head: String, tail: List[String])" undef, %string %v1, 0, !dbg !9
+  %v7 = insertvalue %"(head: String, tail: List[String])" %v7.0, ptr %v6, 1, !dbg !9
+  %v8.end = getelementptr %"List[String].Cons", ptr null, i64 1, !dbg !9
+  %v8.size = ptrtoint ptr %v8.end to i64, !dbg !9
+  %v8 = call ptr @ibex_alloc(i64 %v8.size), !dbg !9
+  store i64 0, ptr %v8, !dbg !9
+  %v8.payload = getelementptr %"List[String].Cons", ptr %v8, i32 0, i32 1, !dbg !9
+  store %"(head: String, tail: List[String])" %v7, ptr %v8.payload, !dbg !9
+  %v10 = call i64 @"ibex.id[Int]"(i64 7), !dbg !10
+  %v13.end = getelementptr i64, ptr null, i64 2, !dbg !9
+  %v13.size = ptrtoint ptr %v13.end to i64, !dbg !9
+  %v13.data = call ptr @ibex_alloc(i64 %v13.size), !dbg !9
+  %v13.0 = getelementptr i64, ptr %v13.data, i64 0, !dbg !9
+  store i64 1, ptr %v13.0, !dbg !9
+  %v13.1 = getelementptr i64, ptr %v13.data, i64 1, !dbg !9
+  store i64 4, ptr %v13.1, !dbg !9
+  %v13 = insertvalue %array { i64 2, ptr undef }, ptr %v13.data, 1, !dbg !9
+  %v16.end = getelementptr i64, ptr null, i64 2, !dbg !9
+  %v16.size = ptrtoint ptr %v16.end to i64, !dbg !9
+  %v16.data = call ptr @ibex_alloc(i64 %v16.size), !dbg !9
+  %v16.0 = getelementptr i64, ptr %v16.data, i64 0, !dbg !9
+  store i64 2, ptr %v16.0, !dbg !9
+  %v16.1 = getelementptr i64, ptr %v16.data, i64 1, !dbg !9
+  store i64 3, ptr %v16.1, !dbg !9
+  %v16 = insertvalue %array { i64 2, ptr undef }, ptr %v16.data, 1, !dbg !9
+  %v17.end = getelementptr %array, ptr null, i64 2, !dbg !9
+  %v17.size = ptrtoint ptr %v17.end to i64, !dbg !9
+  %v17.data = call ptr @ibex_alloc(i64 %v17.size), !dbg !9
+  %v17.0 = getelementptr %array, ptr %v17.data, i64 0, !dbg !9
+  store %array %v13, ptr %v17.0, !dbg !9
+  %v17.1 = getelementptr %array, ptr %v17.data, i64 1, !dbg !9
+  store %array %v16, ptr %v17.1, !dbg !9
+  %v17 = insertvalue %array { i64 2, ptr undef }, ptr %v17.data, 1, !dbg !9
+  %v18.end = getelementptr %"List[Int].Nil", ptr null, i64 1, !dbg !9
+  %v18.size = ptrtoint ptr %v18.end to i64, !dbg !9
+  %v18 = call ptr @ibex_alloc(i64 %v18.size), !dbg !9
+  store i64 1, ptr %v18, !dbg !9
+  %v19.0 = insertvalue %"(head: Int, tail: List[Int])" undef, i64 1, 0, !dbg !9
+  %v19 = insertvalue %"(head: Int, tail: List[Int])" %v19.0, ptr %v18, 1, !dbg !9
+  %v20.end = getelementptr %"List[Int].Cons", ptr null, i64 1, !dbg !9
+  %v20.size = ptrtoint ptr %v20.end to i64, !dbg !9
+  %v20 = call ptr @ibex_alloc(i64 %v20.size), !dbg !9
+  store i64 0, ptr %v20, !dbg !9
+  %v20.payload = getelementptr %"List[Int].Cons", ptr %v20, i32 0, i32 1, !dbg !9
+  store %"(head: Int, tail: List[Int])" %v19, ptr %v20.payload, !dbg !9
+  %v21 = call i64 @"ibex.len[Int]"(ptr %v20), !dbg !11
+  %v24 = call %string @ibex.greet(%string { i64 1, ptr @.str.3 }), !dbg !12
+  %v25.0 = insertvalue %"((), String)" undef, {} zeroinitializer, 0, !dbg !9
+  %v25 = insertvalue %"((), String)" %v25.0, %string %v24, 1, !dbg !9
+  %v26.0 = insertvalue %"(List[String], Int, [][]Int, Int, ((), String))" undef, ptr %v8, 0, !dbg !9
+  %v26.1 = insertvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v26.0, i64 %v10, 1, !dbg !9
+  %v26.2 = insertvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v26.1, %array %v17, 2, !dbg !9
+  %v26.3 = insertvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v26.2, i64 %v21, 3, !dbg !9
+  %v26 = insertvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v26.3, %"((), String)" %v25, 4, !dbg !9
+  ret %"(List[String], Int, [][]Int, Int, ((), String))" %v26
+}
+
+; fn id[String]
+define internal %string @"ibex.id[String]"(%string %p0) !dbg !13 {
+b0:
+  ret %string %p0
+}
+
+; fn id[Int]
+define internal i64 @"ibex.id[Int]"(i64 %p0) !dbg !14 {
+b0:
+  ret i64 %p0
+}
+
+; fn len[Int]
+define internal i64 @"ibex.len[Int]"(ptr %p0) !dbg !15 {
+b0:
+  %v1 = load i64, ptr %p0, !dbg !16
+  %v3 = icmp eq i64 %v1, 0, !dbg !16
+  br i1 %v3, label %b4, label %b1
+
+b1:
+  %v5 = icmp eq i64 %v1, 1, !dbg !16
+  br i1 %v5, label %b3, label %b2
+
+b2:
+  call void @ibex_trap(ptr @.cstr.0, ptr @.cstr.1), !dbg !17
+  unreachable
+
+b3:
+  br label %b5
+
+b4:
+  %v6.addr = getelementptr %"List[Int].Cons", ptr %p0, i32 0, i32 1, !dbg !16
+  %v6 = load %"(head: Int, tail: List[Int])", ptr %v6.addr, !dbg !16
+  %v7 = extractvalue %"(head: Int, tail: List[Int])" %v6, 1, !dbg !16
+  %v9 = call i64 @"ibex.len[Int]"(ptr %v7), !dbg !18
+  %v10 = add i64 1, %v9, !dbg !16
+  br label %b5
+
+b5:
+  %v11 = phi i64 [ %v10, %b4 ], [ 0, %b3 ]
+  ret i64 %v11
+}
+
+define i32 @main() {
+entry:
+  %result = call %"(List[String], Int, [][]Int, Int, ((), String))" @ibex.main()
+  call void @"print.(List[String], Int, [][]Int, Int, ((), String))"(%"(List[String], Int, [][]Int, Int, ((), String))" %result)
+  call void @ibex_print_cstr(ptr @.cstr.13)
+  ret i32 0
+}
+
+define internal void @"print.(head: String, tail: List[String])"(%"(head: String, tail: List[String])" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.5)
+  %t1 = extractvalue %"(head: String, tail: List[String])" %v, 0
+  %t2 = extractvalue %string %t1, 0
+  %t3 = extractvalue %string %t1, 1
+  call void @ibex_print_string(i64 %t2, ptr %t3)
+  call void @ibex_print_cstr(ptr @.cstr.6)
+  %t4 = extractvalue %"(head: String, tail: List[String])" %v, 1
+  call void @"print.List[String]"(ptr %t4)
+  call void @ibex_print_cstr(ptr @.cstr.7)
+  ret void
+}
+
+define internal void @"print.List[String]"(ptr %v) {
+entry:
+  %tag = load i64, ptr %v
+  switch i64 %tag, label %done [ i64 0, label %case0 i64 1, label %case1 ]
+
+case0:
+  call void @ibex_print_cstr(ptr @.cstr.3)
+  %t1 = getelementptr %"List[String].Cons", ptr %v, i32 0, i32 1
+  %t2 = load %"(head: String, tail: List[String])", ptr %t1
+  call void @ibex_print_cstr(ptr @.cstr.4)
+  call void @"print.(head: String, tail: List[String])"(%"(head: String, tail: List[String])" %t2)
+  br label %done
+
+case1:
+  call void @ibex_print_cstr(ptr @.cstr.8)
+  br label %done
+
+done:
+  ret void
+}
+
+define internal void @"print.[]Int"(%array %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.10)
+  %len = extractvalue %array %v, 0
+  %data = extractvalue %array %v, 1
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %next, %elem ]
+  %more = icmp slt i64 %i, %len
+  br i1 %more, label %body, label %done
+
+body:
+  %first = icmp eq i64 %i, 0
+  br i1 %first, label %elem, label %sep
+
+sep:
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  br label %elem
+
+elem:
+  %addr = getelementptr i64, ptr %data, i64 %i
+  %t1 = load i64, ptr %addr
+  call void @ibex_print_int(i64 %t1)
+  %next = add i64 %i, 1
+  br label %loop
+
+done:
+  call void @ibex_print_cstr(ptr @.cstr.11)
+  ret void
+}
+
+define internal void @"print.[][]Int"(%array %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.10)
+  %len = extractvalue %array %v, 0
+  %data = extractvalue %array %v, 1
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %next, %elem ]
+  %more = icmp slt i64 %i, %len
+  br i1 %more, label %body, label %done
+
+body:
+  %first = icmp eq i64 %i, 0
+  br i1 %first, label %elem, label %sep
+
+sep:
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  br label %elem
+
+elem:
+  %addr = getelementptr %array, ptr %data, i64 %i
+  %t1 = load %array, ptr %addr
+  call void @"print.[]Int"(%array %t1)
+  %next = add i64 %i, 1
+  br label %loop
+
+done:
+  call void @ibex_print_cstr(ptr @.cstr.11)
+  ret void
+}
+
+define internal void @"print.((), String)"(%"((), String)" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.2)
+  %t1 = extractvalue %"((), String)" %v, 0
+  call void @ibex_print_cstr(ptr @.cstr.12)
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  %t2 = extractvalue %"((), String)" %v, 1
+  %t3 = extractvalue %string %t2, 0
+  %t4 = extractvalue %string %t2, 1
+  call void @ibex_print_string(i64 %t3, ptr %t4)
+  call void @ibex_print_cstr(ptr @.cstr.7)
+  ret void
+}
+
+define internal void @"print.(List[String], Int, [][]Int, Int, ((), String))"(%"(List[String], Int, [][]Int, Int, ((), String))" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.2)
+  %t1 = extractvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v, 0
+  call void @"print.List[String]"(ptr %t1)
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  %t2 = extractvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v, 1
+  call void @ibex_print_int(i64 %t2)
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  %t3 = extractvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v, 2
+  call void @"print.[][]Int"(%array %t3)
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  %t4 = extractvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v, 3
+  call void @ibex_print_int(i64 %t4)
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  %t5 = extractvalue %"(List[String], Int, [][]Int, Int, ((), String))" %v, 4
+  call void @"print.((), String)"(%"((), String)" %t5)
+  call void @ibex_print_cstr(ptr @.cstr.7)
+  ret void
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!19, !20}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "ibex", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!1 = !DIFile(filename: "test.ibex", directory: ".")
+!2 = !{}
+!3 = !DISubroutineType(types: !2)
+!4 = distinct !DISubprogram(name: "greet", linkageName: "ibex.greet", scope: !1, file: !1, line: 8, type: !3, scopeLine: 8, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!5 = !DILocation(line: 8, column: 4, scope: !4)
+!6 = distinct !DISubprogram(name: "main", linkageName: "ibex.main", scope: !1, file: !1, line: 12, type: !3, scopeLine: 12, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!7 = !DILocation(line: 13, column: 26, scope: !6)
+!8 = !DILocation(line: 13, column: 58, scope: !6)
+!9 = !DILocation(line: 12, column: 4, scope: !6)
+!10 = !DILocation(line: 13, column: 80, scope: !6)
+!11 = !DILocation(line: 13, column: 131, scope: !6)
+!12 = !DILocation(line: 13, column: 148, scope: !6)
+!13 = distinct !DISubprogram(name: "id[String]", linkageName: "ibex.id[String]", scope: !1, file: !1, line: 2, type: !3, scopeLine: 2, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!14 = distinct !DISubprogram(name: "id[Int]", linkageName: "ibex.id[Int]", scope: !1, file: !1, line: 2, type: !3, scopeLine: 2, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!15 = distinct !DISubprogram(name: "len[Int]", linkageName: "ibex.len[Int]", scope: !1, file: !1, line: 4, type: !3, scopeLine: 4, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!16 = !DILocation(line: 4, column: 4, scope: !15)
+!17 = !DILocation(line: 5, column: 5, scope: !15)
+!18 = !DILocation(line: 6, column: 49, scope: !15)
+!19 = !{i32 7, !"Dwarf Version", i32 4}
+!20 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,378 @@
+source_filename = "test.ibex"
+
+%"(side: Int)" = type { i64 }
+%Shape.Square = type { i64, %"(side: Int)" }
+%"(r: Int)" = type { i64 }
+%Shape.Circle = type { i64, %"(r: Int)" }
+%array = type { i64, ptr }
+%"Option[Int].Some" = type { i64, i64 }
+%"([]Int, []Shape, Option[Int])" = type { %array, %array, ptr }
+%Shape.Empty = type { i64 }
+%"Option[Int].None" = type { i64 }
+
+@.cstr.0 = private unnamed_addr constant [15 x i8] c"No arm matches\00"
+@.cstr.1 = private unnamed_addr constant [14 x i8] c"test.ibex:3:5\00"
+@.cstr.2 = private unnamed_addr constant [14 x i8] c"test.ibex:8:7\00"
+@.cstr.3 = private unnamed_addr constant [15 x i8] c"test.ibex:8:15\00"
+@.cstr.4 = private unnamed_addr constant [15 x i8] c"Unwrapped None\00"
+@.cstr.5 = private unnamed_addr constant [15 x i8] c"test.ibex:8:18\00"
+@.cstr.6 = private unnamed_addr constant [2 x i8] c"(\00"
+@.cstr.7 = private unnamed_addr constant [2 x i8] c"[\00"
+@.cstr.8 = private unnamed_addr constant [3 x i8] c", \00"
+@.cstr.9 = private unnamed_addr constant [2 x i8] c"]\00"
+@.cstr.10 = private unnamed_addr constant [7 x i8] c"Circle\00"
+@.cstr.11 = private unnamed_addr constant [2 x i8] c" \00"
+@.cstr.12 = private unnamed_addr constant [5 x i8] c"(r: \00"
+@.cstr.13 = private unnamed_addr constant [2 x i8] c")\00"
+@.cstr.14 = private unnamed_addr constant [7 x i8] c"Square\00"
+@.cstr.15 = private unnamed_addr constant [8 x i8] c"(side: \00"
+@.cstr.16 = private unnamed_addr constant [6 x i8] c"Empty\00"
+@.cstr.17 = private unnamed_addr constant [5 x i8] c"None\00"
+@.cstr.18 = private unnamed_addr constant [5 x i8] c"Some\00"
+@.cstr.19 = private unnamed_addr constant [3 x i8] c" (\00"
+@.cstr.20 = private unnamed_addr constant [2 x i8] c"\0A\00"
+
+declare void @ibex_trap(ptr, ptr) noreturn
+declare ptr @ibex_alloc(i64)
+declare void @ibex_check_index(i64, i64, ptr)
+declare void @ibex_print_int(i64)
+declare void @ibex_print_cstr(ptr)
+
+; fn area
+define internal i64 @ibex.area(ptr %p0) !dbg !4 {
+b0:
+  %v1 = load i64, ptr %p0, !dbg !5
+  %v3 = icmp eq i64 %v1, 0, !dbg !5
+  br i1 %v3, label %b6, label %b1
+
+b1:
+  %v5 = icmp eq i64 %v1, 1, !dbg !5
+  br i1 %v5, label %b5, label %b2
+
+b2:
+  %v7 = icmp eq i64 %v1, 2, !dbg !5
+  br i1 %v7, label %b4, label %b3
+
+b3:
+  call void @ibex_trap(ptr @.cstr.0, ptr @.cstr.1), !dbg !6
+  unreachable
+
+b4:
+  br label %b7
+
+b5:
+  %v8.addr = getelementptr %Shape.Square, ptr %p0, i32 0, i32 1, !dbg !5
+  %v8 = load %"(side: Int)", ptr %v8.addr, !dbg !5
+  %v9 = extractvalue %"(side: Int)" %v8, 0, !dbg !5
+  %v10 = mul i64 %v9, %v9, !dbg !5
+  br label %b7
+
+b6:
+  %v11.addr = getelementptr %Shape.Circle, ptr %p0, i32 0, i32 1, !dbg !5
+  %v11 = load %"(r: Int)", ptr %v11.addr, !dbg !5
+  %v12 = extractvalue %"(r: Int)" %v11, 0, !dbg !5
+  %v13 = mul i64 %v12, %v12, !dbg !5
+  %v15 = mul i64 %v13, 3, !dbg !5
+  br label %b7
+
+b7:
+  %v16 = phi i64 [ %v15, %b6 ], [ %v10, %b5 ], [ 0, %b4 ]
+  ret i64 %v16
+}
+
+; fn first
+define internal i64 @ibex.first(%array %p0) !dbg !7 {
+b0:
+  %v2.len = extractvalue %array %p0, 0, !dbg !8
+  call void @ibex_check_index(i64 0, i64 %v2.len, ptr @.cstr.2), !dbg !8
+  %v2.data = extractvalue %array %p0, 1, !dbg !8
+  %v2.addr = getelementptr ptr, ptr %v2.data, i64 0, !dbg !8
+  %v2 = load ptr, ptr %v2.addr, !dbg !8
+  %v3 = load i64, ptr %v2, !dbg !9
+  %v5 = icmp eq i64 %v3, 1, !dbg !9
+  br i1 %v5, label %b4, label %b1
+
+b1:
+  %v6.len = extractvalue %array %p0, 0, !dbg !10
+  call void @ibex_check_index(i64 1, i64 %v6.len, ptr @.cstr.3), !dbg !10
+  %v6.data = extractvalue %array %p0, 1, !dbg !10
+  %v6.addr = getelementptr ptr, ptr %v6.data, i64 1, !dbg !10
+  %v6 = load ptr, ptr %v6.addr, !dbg !10
+  %v7 = load i64, ptr %v6, !dbg !9
+  %v8 = icmp eq i64 %v7, 1, !dbg !9
+  br i1 %v8, label %b3, label %b2
+
+b2:
+  call void @ibex_trap(ptr @.cstr.4, ptr @.cstr.5), !dbg !11
+  unreachable
+
+b3:
+  %v9.addr = getelementptr %"Option[Int].Some", ptr %v6, i32 0, i32 1, !dbg !9
+  %v9 = load i64, ptr %v9.addr, !dbg !9
+  br label %b5
+
+b4:
+  %v10.addr = getelementptr %"Option[Int].Some", ptr %v2, i32 0, i32 1, !dbg !9
+  %v10 = load i64, ptr %v10.addr, !dbg !9
+  br label %b5
+
+b5:
+  %v11 = phi i64 [ %v10, %b4 ], [ %v9, %b3 ]
+  ret i64 %v11
+}
+
+; fn main
+define internal %"([]Int, []Shape, Option[Int])" @ibex.main() !dbg !12 {
+b0:
+  %v1 = insertvalue %"(r: Int)" undef, i64 2, 0, !dbg !13
+  %v2.end = getelementptr %Shape.Circle, ptr null, i64 1, !dbg !13
+  %v2.size = ptrtoint ptr %v2.end to i64, !dbg !13
+  %v2 = call ptr @ibex_alloc(i64 %v2.size), !dbg !13
+  store i64 0, ptr %v2, !dbg !13
+  %v2.payload = getelementptr %Shape.Circle, ptr %v2, i32 0, i32 1, !dbg !13
+  store %"(r: Int)" %v1, ptr %v2.payload, !dbg !13
+  %v3 = call i64 @ibex.area(ptr %v2), !dbg !14
+  %v5 = insertvalue %"(side: Int)" undef, i64 3, 0, !dbg !13
+  %v6.end = getelementptr %Shape.Square, ptr null, i64 1, !dbg !13
+  %v6.size = ptrtoint ptr %v6.end to i64, !dbg !13
+  %v6 = call ptr @ibex_alloc(i64 %v6.size), !dbg !13
+  store i64 1, ptr %v6, !dbg !13
+  %v6.payload = getelementptr %Shape.Square, ptr %v6, i32 0, i32 1, !dbg !13
+  store %"(side: Int)" %v5, ptr %v6.payload, !dbg !13
+  %v7 = call i64 @ibex.area(ptr %v6), !dbg !15
+  %v8.end = getelementptr %Shape.Empty, ptr null, i64 1, !dbg !13
+  %v8.size = ptrtoint ptr %v8.end to i64, !dbg !13
+  %v8 = call ptr @ibex_alloc(i64 %v8.size), !dbg !13
+  store i64 2, ptr %v8, !dbg !13
+  %v9 = call i64 @ibex.area(ptr %v8), !dbg !16
+  %v10.end = getelementptr %"Option[Int].None", ptr null, i64 1, !dbg !13
+  %v10.size = ptrtoint ptr %v10.end to i64, !dbg !13
+  %v10 = call ptr @ibex_alloc(i64 %v10.size), !dbg !13
+  store i64 0, ptr %v10, !dbg !13
+  %v12.end = getelementptr %"Option[Int].Some", ptr null, i64 1, !dbg !13
+  %v12.size = ptrtoint ptr %v12.end to i64, !dbg !13
+  %v12 = call ptr @ibex_alloc(i64 %v12.size), !dbg !13
+  store i64 1, ptr %v12, !dbg !13
+  %v12.payload = getelementptr %"Option[Int].Some", ptr %v12, i32 0, i32 1, !dbg !13
+  store i64 7, ptr %v12.payload, !dbg !13
+  %v13.end = getelementptr ptr, ptr null, i64 2, !dbg !13
+  %v13.size = ptrtoint ptr %v13.end to i64, !dbg !13
+  %v13.data = call ptr @ibex_alloc(i64 %v13.size), !dbg !13
+  %v13.0 = getelementptr ptr, ptr %v13.data, i64 0, !dbg !13
+  store ptr %v10, ptr %v13.0, !dbg !13
+  %v13.1 = getelementptr ptr, ptr %v13.data, i64 1, !dbg !13
+  store ptr %v12, ptr %v13.1, !dbg !13
+  %v13 = insertvalue %array { i64 2, ptr undef }, ptr %v13.data, 1, !dbg !13
+  %v14 = call i64 @ibex.first(%array %v13), !dbg !17
+  %v15.end = getelementptr i64, ptr null, i64 4, !dbg !13
+  %v15.size = ptrtoint ptr %v15.end to i64, !dbg !13
+  %v15.data = call ptr @ibex_alloc(i64 %v15.size), !dbg !13
+  %v15.0 = getelementptr i64, ptr %v15.data, i64 0, !dbg !13
+  store i64 %v3, ptr %v15.0, !dbg !13
+  %v15.1 = getelementptr i64, ptr %v15.data, i64 1, !dbg !13
+  store i64 %v7, ptr %v15.1, !dbg !13
+  %v15.2 = getelementptr i64, ptr %v15.data, i64 2, !dbg !13
+  store i64 %v9, ptr %v15.2, !dbg !13
+  %v15.3 = getelementptr i64, ptr %v15.data, i64 3, !dbg !13
+  store i64 %v14, ptr %v15.3, !dbg !13
+  %v15 = insertvalue %array { i64 4, ptr undef }, ptr %v15.data, 1, !dbg !13
+  %v17 = insertvalue %"(r: Int)" undef, i64 1, 0, !dbg !13
+  %v18.end = getelementptr %Shape.Circle, ptr null, i64 1, !dbg !13
+  %v18.size = ptrtoint ptr %v18.end to i64, !dbg !13
+  %v18 = call ptr @ibex_alloc(i64 %v18.size), !dbg !13
+  store i64 0, ptr %v18, !dbg !13
+  %v18.payload = getelementptr %Shape.Circle, ptr %v18, i32 0, i32 1, !dbg !13
+  store %"(r: Int)" %v17, ptr %v18.payload, !dbg !13
+  %v19.end = getelementptr ptr, ptr null, i64 2, !dbg !13
+  %v19.size = ptrtoint ptr %v19.end to i64, !dbg !13
+  %v19.data = call ptr @ibex_alloc(i64 %v19.size), !dbg !13
+  %v19.0 = getelementptr ptr, ptr %v19.data, i64 0, !dbg !13
+  store ptr %v8, ptr %v19.0, !dbg !13
+  %v19.1 = getelementptr ptr, ptr %v19.data, i64 1, !dbg !13
+  store ptr %v18, ptr %v19.1, !dbg !13
+  %v19 = insertvalue %array { i64 2, ptr undef }, ptr %v19.data, 1, !dbg !13
+  %v20.0 = insertvalue %"([]Int, []Shape, Option[Int])" undef, %array %v15, 0, !dbg !13
+  %v20.1 = insertvalue %"([]Int, []Shape, Option[Int])" %v20.0, %array %v19, 1, !dbg !13
+  %v20 = insertvalue %"([]Int, []Shape, Option[Int])" %v20.1, ptr %v10, 2, !dbg !13
+  ret %"([]Int, []Shape, Option[Int])" %v20
+}
+
+define i32 @main() {
+entry:
+  %result = call %"([]Int, []Shape, Option[Int])" @ibex.main()
+  call void @"print.([]Int, []Shape, Option[Int])"(%"([]Int, []Shape, Option[Int])" %result)
+  call void @ibex_print_cstr(ptr @.cstr.20)
+  ret i32 0
+}
+
+define internal void @"print.[]Int"(%array %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.7)
+  %len = extractvalue %array %v, 0
+  %data = extractvalue %array %v, 1
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %next, %elem ]
+  %more = icmp slt i64 %i, %len
+  br i1 %more, label %body, label %done
+
+body:
+  %first = icmp eq i64 %i, 0
+  br i1 %first, label %elem, label %sep
+
+sep:
+  call void @ibex_print_cstr(ptr @.cstr.8)
+  br label %elem
+
+elem:
+  %addr = getelementptr i64, ptr %data, i64 %i
+  %t1 = load i64, ptr %addr
+  call void @ibex_print_int(i64 %t1)
+  %next = add i64 %i, 1
+  br label %loop
+
+done:
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  ret void
+}
+
+define internal void @"print.(r: Int)"(%"(r: Int)" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.12)
+  %t1 = extractvalue %"(r: Int)" %v, 0
+  call void @ibex_print_int(i64 %t1)
+  call void @ibex_print_cstr(ptr @.cstr.13)
+  ret void
+}
+
+define internal void @"print.(side: Int)"(%"(side: Int)" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.15)
+  %t1 = extractvalue %"(side: Int)" %v, 0
+  call void @ibex_print_int(i64 %t1)
+  call void @ibex_print_cstr(ptr @.cstr.13)
+  ret void
+}
+
+define internal void @print.Shape(ptr %v) {
+entry:
+  %tag = load i64, ptr %v
+  switch i64 %tag, label %done [ i64 0, label %case0 i64 1, label %case1 i64 2, label %case2 ]
+
+case0:
+  call void @ibex_print_cstr(ptr @.cstr.10)
+  %t1 = getelementptr %Shape.Circle, ptr %v, i32 0, i32 1
+  %t2 = load %"(r: Int)", ptr %t1
+  call void @ibex_print_cstr(ptr @.cstr.11)
+  call void @"print.(r: Int)"(%"(r: Int)" %t2)
+  br label %done
+
+case1:
+  call void @ibex_print_cstr(ptr @.cstr.14)
+  %t3 = getelementptr %Shape.Square, ptr %v, i32 0, i32 1
+  %t4 = load %"(side: Int)", ptr %t3
+  call void @ibex_print_cstr(ptr @.cstr.11)
+  call void @"print.(side: Int)"(%"(side: Int)" %t4)
+  br label %done
+
+case2:
+  call void @ibex_print_cstr(ptr @.cstr.16)
+  br label %done
+
+done:
+  ret void
+}
+
+define internal void @"print.[]Shape"(%array %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.7)
+  %len = extractvalue %array %v, 0
+  %data = extractvalue %array %v, 1
+  br label %loop
+
+loop:
+  %i = phi i64 [ 0, %entry ], [ %next, %elem ]
+  %more = icmp slt i64 %i, %len
+  br i1 %more, label %body, label %done
+
+body:
+  %first = icmp eq i64 %i, 0
+  br i1 %first, label %elem, label %sep
+
+sep:
+  call void @ibex_print_cstr(ptr @.cstr.8)
+  br label %elem
+
+elem:
+  %addr = getelementptr ptr, ptr %data, i64 %i
+  %t1 = load ptr, ptr %addr
+  call void @print.Shape(ptr %t1)
+  %next = add i64 %i, 1
+  br label %loop
+
+done:
+  call void @ibex_print_cstr(ptr @.cstr.9)
+  ret void
+}
+
+define internal void @"print.Option[Int]"(ptr %v) {
+entry:
+  %tag = load i64, ptr %v
+  switch i64 %tag, label %done [ i64 0, label %case0 i64 1, label %case1 ]
+
+case0:
+  call void @ibex_print_cstr(ptr @.cstr.17)
+  br label %done
+
+case1:
+  call void @ibex_print_cstr(ptr @.cstr.18)
+  %t1 = getelementptr %"Option[Int].Some", ptr %v, i32 0, i32 1
+  %t2 = load i64, ptr %t1
+  call void @ibex_print_cstr(ptr @.cstr.19)
+  call void @ibex_print_int(i64 %t2)
+  call void @ibex_print_cstr(ptr @.cstr.13)
+  br label %done
+
+done:
+  ret void
+}
+
+define internal void @"print.([]Int, []Shape, Option[Int])"(%"([]Int, []Shape, Option[Int])" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.6)
+  %t1 = extractvalue %"([]Int, []Shape, Option[Int])" %v, 0
+  call void @"print.[]Int"(%array %t1)
+  call void @ibex_print_cstr(ptr @.cstr.8)
+  %t2 = extractvalue %"([]Int, []Shape, Option[Int])" %v, 1
+  call void @"print.[]Shape"(%array %t2)
+  call void @ibex_print_cstr(ptr @.cstr.8)
+  %t3 = extractvalue %"([]Int, []Shape, Option[Int])" %v, 2
+  call void @"print.Option[Int]"(ptr %t3)
+  call void @ibex_print_cstr(ptr @.cstr.13)
+  ret void
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!18, !19}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "ibex", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!1 = !DIFile(filename: "test.ibex", directory: ".")
+!2 = !{}
+!3 = !DISubroutineType(types: !2)
+!4 = distinct !DISubprogram(name: "area", linkageName: "ibex.area", scope: !1, file: !1, line: 2, type: !3, scopeLine: 2, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!5 = !DILocation(line: 2, column: 4, scope: !4)
+!6 = !DILocation(line: 3, column: 5, scope: !4)
+!7 = distinct !DISubprogram(name: "first", linkageName: "ibex.first", scope: !1, file: !1, line: 7, type: !3, scopeLine: 7, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!8 = !DILocation(line: 8, column: 7, scope: !7)
+!9 = !DILocation(line: 7, column: 4, scope: !7)
+!10 = !DILocation(line: 8, column: 15, scope: !7)
+!11 = !DILocation(line: 8, column: 18, scope: !7)
+!12 = distinct !DISubprogram(name: "main", linkageName: "ibex.main", scope: !1, file: !1, line: 9, type: !3, scopeLine: 9, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!13 = !DILocation(line: 9, column: 4, scope: !12)
+!14 = !DILocation(line: 10, column: 21, scope: !12)
+!15 = !DILocation(line: 10, column: 47, scope: !12)
+!16 = !DILocation(line: 10, column: 62, scope: !12)
+!17 = !DILocation(line: 10, column: 88, scope: !12)
+!18 = !{i32 7, !"Dwarf Version", i32 4}
+!19 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,154 @@
+source_filename = "test.ibex"
+
+%"(Int, Int)" = type { i64, i64 }
+%"(x: Int, y: Int)" = type { i64, i64 }
+%"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" = type { i64, i64, %"(x: Int, y: Int)", i64, ptr, i64 }
+
+@.cstr.0 = private unnamed_addr constant [2 x i8] c"(\00"
+@.cstr.1 = private unnamed_addr constant [3 x i8] c", \00"
+@.cstr.2 = private unnamed_addr constant [5 x i8] c"(x: \00"
+@.cstr.3 = private unnamed_addr constant [6 x i8] c", y: \00"
+@.cstr.4 = private unnamed_addr constant [2 x i8] c")\00"
+@.cstr.5 = private unnamed_addr constant [1 x i8] c"\00"
+@.cstr.6 = private unnamed_addr constant [7 x i8] c"fn sub\00"
+@.cstr.7 = private unnamed_addr constant [8 x i8] c"fn swap\00"
+@.cstr.8 = private unnamed_addr constant [9 x i8] c"fn first\00"
+@.cstr.9 = private unnamed_addr constant [9 x i8] c"fn apply\00"
+@.cstr.10 = private unnamed_addr constant [8 x i8] c"fn main\00"
+@.cstr.11 = private unnamed_addr constant [2 x i8] c"\0A\00"
+
+declare void @ibex_print_int(i64)
+declare void @ibex_print_cstr(ptr)
+
+; fn sub
+define internal i64 @ibex.sub(i64 %p0, i64 %p1) !dbg !4 {
+b0:
+  %v2 = sub i64 %p0, %p1, !dbg !5
+  ret i64 %v2
+}
+
+; fn swap
+define internal %"(Int, Int)" @ibex.swap(i64 %p0, i64 %p1) !dbg !6 {
+b0:
+  %v2.0 = insertvalue %"(Int, Int)" undef, i64 %p1, 0, !dbg !7
+  %v2 = insertvalue %"(Int, Int)" %v2.0, i64 %p0, 1, !dbg !7
+  ret %"(Int, Int)" %v2
+}
+
+; fn first
+define internal i64 @ibex.first(i64 %p0, i64 %p1) !dbg !8 {
+b0:
+  %v2 = call %"(Int, Int)" @ibex.swap(i64 %p0, i64 %p1), !dbg !9
+  %v3 = extractvalue %"(Int, Int)" %v2, 0, !dbg !10
+  ret i64 %v3
+}
+
+; fn apply
+define internal i64 @ibex.apply(ptr %p0, i64 %p1) !dbg !11 {
+b0:
+  %v3 = call i64 %p0(i64 %p1, i64 10), !dbg !12
+  ret i64 %v3
+}
+
+; fn main
+define internal %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" @ibex.main() !dbg !13 {
+b0:
+  %v2 = call i64 @ibex.sub(i64 3, i64 1), !dbg !14
+  %v3 = call i64 @ibex.sub(i64 1, i64 3), !dbg !15
+  %v5.0 = insertvalue %"(x: Int, y: Int)" undef, i64 1, 0, !dbg !16
+  %v5 = insertvalue %"(x: Int, y: Int)" %v5.0, i64 2, 1, !dbg !16
+  %v6 = call i64 @ibex.first(i64 1, i64 2), !dbg !17
+  %v9 = call i64 @ibex.apply(ptr @ibex.sub, i64 4), !dbg !18
+  %v10.0 = insertvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" undef, i64 %v2, 0, !dbg !16
+  %v10.1 = insertvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v10.0, i64 %v3, 1, !dbg !16
+  %v10.2 = insertvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v10.1, %"(x: Int, y: Int)" %v5, 2, !dbg !16
+  %v10.3 = insertvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v10.2, i64 %v6, 3, !dbg !16
+  %v10.4 = insertvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v10.3, ptr @ibex.sub, 4, !dbg !16
+  %v10 = insertvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v10.4, i64 %v9, 5, !dbg !16
+  ret %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v10
+}
+
+define i32 @main() {
+entry:
+  %result = call %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" @ibex.main()
+  call void @"print.(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)"(%"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %result)
+  call void @ibex_print_cstr(ptr @.cstr.11)
+  ret i32 0
+}
+
+define internal void @"print.(x: Int, y: Int)"(%"(x: Int, y: Int)" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.2)
+  %t1 = extractvalue %"(x: Int, y: Int)" %v, 0
+  call void @ibex_print_int(i64 %t1)
+  call void @ibex_print_cstr(ptr @.cstr.3)
+  %t2 = extractvalue %"(x: Int, y: Int)" %v, 1
+  call void @ibex_print_int(i64 %t2)
+  call void @ibex_print_cstr(ptr @.cstr.4)
+  ret void
+}
+
+define internal void @"print.fn (Int, Int) -> Int"(ptr %v) {
+entry:
+  %t1 = icmp eq ptr %v, @ibex.sub
+  %t2 = select i1 %t1, ptr @.cstr.6, ptr @.cstr.5
+  %t3 = icmp eq ptr %v, @ibex.swap
+  %t4 = select i1 %t3, ptr @.cstr.7, ptr %t2
+  %t5 = icmp eq ptr %v, @ibex.first
+  %t6 = select i1 %t5, ptr @.cstr.8, ptr %t4
+  %t7 = icmp eq ptr %v, @ibex.apply
+  %t8 = select i1 %t7, ptr @.cstr.9, ptr %t6
+  %t9 = icmp eq ptr %v, @ibex.main
+  %t10 = select i1 %t9, ptr @.cstr.10, ptr %t8
+  call void @ibex_print_cstr(ptr %t10)
+  ret void
+}
+
+define internal void @"print.(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)"(%"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v) {
+entry:
+  call void @ibex_print_cstr(ptr @.cstr.0)
+  %t1 = extractvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v, 0
+  call void @ibex_print_int(i64 %t1)
+  call void @ibex_print_cstr(ptr @.cstr.1)
+  %t2 = extractvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v, 1
+  call void @ibex_print_int(i64 %t2)
+  call void @ibex_print_cstr(ptr @.cstr.1)
+  %t3 = extractvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v, 2
+  call void @"print.(x: Int, y: Int)"(%"(x: Int, y: Int)" %t3)
+  call void @ibex_print_cstr(ptr @.cstr.1)
+  %t4 = extractvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v, 3
+  call void @ibex_print_int(i64 %t4)
+  call void @ibex_print_cstr(ptr @.cstr.1)
+  %t5 = extractvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v, 4
+  call void @"print.fn (Int, Int) -> Int"(ptr %t5)
+  call void @ibex_print_cstr(ptr @.cstr.1)
+  %t6 = extractvalue %"(Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int, Int)" %v, 5
+  call void @ibex_print_int(i64 %t6)
+  call void @ibex_print_cstr(ptr @.cstr.4)
+  ret void
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!19, !20}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "ibex", isOptimized: false, runtimeVersion: 0, emissionKind: LineTablesOnly)
+!1 = !DIFile(filename: "test.ibex", directory: ".")
+!2 = !{}
+!3 = !DISubroutineType(types: !2)
+!4 = distinct !DISubprogram(name: "sub", linkageName: "ibex.sub", scope: !1, file: !1, line: 1, type: !3, scopeLine: 1, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!5 = !DILocation(line: 1, column: 4, scope: !4)
+!6 = distinct !DISubprogram(name: "swap", linkageName: "ibex.swap", scope: !1, file: !1, line: 3, type: !3, scopeLine: 3, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!7 = !DILocation(line: 3, column: 4, scope: !6)
+!8 = distinct !DISubprogram(name: "first", linkageName: "ibex.first", scope: !1, file: !1, line: 6, type: !3, scopeLine: 6, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!9 = !DILocation(line: 7, column: 13, scope: !8)
+!10 = !DILocation(line: 6, column: 4, scope: !8)
+!11 = distinct !DISubprogram(name: "apply", linkageName: "ibex.apply", scope: !1, file: !1, line: 9, type: !3, scopeLine: 9, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!12 = !DILocation(line: 10, column: 13, scope: !11)
+!13 = distinct !DISubprogram(name: "main", linkageName: "ibex.main", scope: !1, file: !1, line: 11, type: !3, scopeLine: 11, spFlags: DISPFlagLocalToUnit | DISPFlagDefinition, unit: !0)
+!14 = !DILocation(line: 12, column: 13, scope: !13)
+!15 = !DILocation(line: 12, column: 34, scope: !13)
+!16 = !DILocation(line: 11, column: 4, scope: !13)
+!17 = !DILocation(line: 12, column: 63, scope: !13)
+!18 = !DILocation(line: 12, column: 93, scope: !13)
+!19 = !{i32 7, !"Dwarf Version", i32 4}
+!20 = !{i32 2, !"Debug Info Version", i32 3}
@@ -0,0 +1,98 @@
+package llvm
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// Tuples and named tuples become struct types passed by value, named
+// after the Ibex type. Arrays and strings are a struct of their length
+// and a pointer to the elements. Variants may be recursive, so they are
+// pointers to the tag followed by the payload of their case, laid out by
+// a struct type per case. Function values are pointers to functions
+// taking the parameters flattened as in the IR.
+
+// defines the named type name on first use
+func (g *generator) define(name string, body string) string {
+    if !g.defined[name] {
+        g.defined[name] = true
+        fmt.Fprintf(&g.types, "%s = type %s\n", name, body)
+    }
+    return name
+}
+
+// the LLVM type of an Ibex type, defining it on first use
+func (g *generator) llType(ty core.IbexType) string {
+    switch t := ty.(type) {
+    case core.IbexSimpleType:
+        switch t.Name {
+        case "Int":
+            return "i64"
+        case "F64":
+            return "double"
+        case "Bool":
+            return "i1"
+        case "String":
+            return g.define("%string", "{ i64, ptr }")
+        }
+        return "ptr"
+    case core.IbexTupleType:
+        if len(t.ElementTypes) == 0 {
+            return "{}"
+        }
+    case core.IbexArrayType:
+        return g.define("%array", "{ i64, ptr }")
+    case core.IbexFunctionType:
+        return "ptr"
+    }
+
+    ty = ir.Erase(ty)
+    name := "%" + ident(core.TypeString(ty))
+    if g.defined[name] {
+        return name
+    }
+    // the fields are defined first, none of them can be this type
+    fields := g.llTypes(ir.FieldsOf(ty))
+    return g.define(name, "{ " + strings.Join(fields, ", ") + " }")
+}
+
+func (g *generator) llTypes(types []core.IbexType) []string {
+    names := make([]string, len(types))
+    for i, ty := range types {
+        names[i] = g.llType(ty)
+    }
+    return names
+}
+
+// the LLVM type of the value v, the representation if it was not
+// lowered from a checked type
+func (g *generator) valueType(v *ir.Value) string {
+    if v.Source != nil {
+        return g.llType(v.Source)
+    }
+    switch v.Type {
+    case ir.Int:
+        return "i64"
+    case ir.F64:
+        return "double"
+    case ir.Bool:
+        return "i1"
+    case ir.Unit:
+        return "{}"
+    }
+    return "ptr"
+}
+
+// the struct type of case i of a variant, its tag and payload
+func (g *generator) caseType(ty core.IbexType, i int) string {
+    ty = ir.Erase(ty)
+    cs := g.info.Cases(ty)[i]
+    fields := "i64"
+    if cs.Payload != nil {
+        fields += ", " + g.llType(cs.Payload)
+    }
+    return g.define("%" + ident(core.TypeString(ty) + "." + cs.Tag), "{ " + fields + " }")
+}
@@ -0,0 +1,160 @@
+package loader
+
+import (
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+
+    "github.com/ibex-lang/ibex/parser"
+)
+
+const Extension = ".ibex"
+
+type Module struct {
+    Name string // a::b::c, empty for the root module
+    File string
+    Unit *parser.ASTCompilationUnit
+    Imports []*Import
+}
+
+func (m *Module) String() string {
+    if m.Name == "" {
+        return m.File
+    }
+    return m.Name
+}
+
+type Import struct {
+    Use *parser.ASTUseStmt
+    Module *Module
+}
+
+type CycleError struct {
+    Cycle []*Module // starts and ends with the same module
+}
+
+func (e *CycleError) Error() string {
+    names := make([]string, len(e.Cycle))
+    for i, m := range e.Cycle {
+        names[i] = m.String()
+    }
+    return "Import cycle: " + strings.Join(names, " -> ")
+}
+
+// NotFoundError is a module used that no search root contains
+type NotFoundError struct {
+    Pos parser.Pos // of the use, zero if there is none
+    Path []string
+    Roots []string
+}
+
+func (e *NotFoundError) Error() string {
+    if e.Pos.Line == 0 {
+        return e.Message()
+    }
+    return fmt.Sprintf("%s: %s", e.Pos, e.Message())
+}
+
+func (e *NotFoundError) Message() string {
+    return fmt.Sprintf("Cannot find module %s in %s", strings.Join(e.Path, "::"), strings.Join(e.Roots, ", "))
+}
+
+// Loader maps use a::b::c to the file a/b/c.ibex below the first search
+// root containing it and parses every module once.
+type Loader struct {
+    Roots []string
+
+    modules map[string]*Module // by absolute file name
+    order []*Module
+    loading []*Module // stack of modules being loaded
+}
+
+func NewLoader(roots []string) *Loader {
+    return &Loader{
+        Roots: roots,
+        modules: make(map[string]*Module),
+    }
+}
+
+// loads file as the root module, together with all modules it uses
+func (l *Loader) LoadFile(file string) (*Module, error) {
+    return l.load("", file)
+}
+
+// loads the already parsed unit as the root module, as if read from
+// file, together with all modules it uses
+func (l *Loader) LoadUnit(file string, unit *parser.ASTCompilationUnit) (*Module, error) {
+    key, err := filepath.Abs(file)
+    if err != nil {
+        return nil, err
+    }
+    return l.add("", file, key, unit)
+}
+
+// all loaded modules, each after the modules it uses
+func (l *Loader) Modules() []*Module {
+    return l.order
+}
+
+func (l *Loader) Find(path []string) (string, error) {
+    rel := filepath.Join(path...) + Extension
+    for _, root := range l.Roots {
+        file := filepath.Join(root, rel)
+        if info, err := os.Stat(file); err == nil && !info.IsDir() {
+            return file, nil
+        }
+    }
+    return "", &NotFoundError{Path: path, Roots: l.Roots}
+}
+
+func (l *Loader) load(name string, file string) (*Module, error) {
+    key, err := filepath.Abs(file)
+    if err != nil {
+        return nil, err
+    }
+
+    if m, exists := l.modules[key]; exists {
+        for i, loading := range l.loading {
+            if loading == m {
+                cycle := append([]*Module{}, l.loading[i:]...)
+                return nil, &CycleError{append(cycle, m)}
+            }
+        }
+        return m, nil
+    }
+
+    src, err := ioutil.ReadFile(file)
+    if err != nil {
+        return nil, err
+    }
+    unit, err := parser.ParseFile(file, string(src))
+    if err != nil {
+        return nil, err
+    }
+    return l.add(name, file, key, unit)
+}
+
+// key is the absolute file name
+func (l *Loader) add(name string, file string, key string, unit *parser.ASTCompilationUnit) (*Module, error) {
+    m := &Module{Name: name, File: file, Unit: unit}
+    l.modules[key] = m
+    l.loading = append(l.loading, m)
+
+    for _, use := range unit.Uses {
+        dep, err := l.Find(use.Path)
+        if err != nil {
+            return nil, &NotFoundError{use.Pos, use.Path, l.Roots}
+        }
+        imported, err := l.load(strings.Join(use.Path, "::"), dep)
+        if err != nil {
+            return nil, err
+        }
+        m.Imports = append(m.Imports, &Import{use, imported})
+    }
+
+    l.loading = l.loading[:len(l.loading) - 1]
+    l.order = append(l.order, m)
+    return m, nil
+}
@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "ibex")
+	assert.Nil(t, err)
+	for name, src := range files {
+		file := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.Nil(t, ioutil.WriteFile(file, []byte(src), 0644))
+	}
+	return dir
+}
+
+func TestLoadModules(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ibex":         "use geo::shapes\nuse util\n",
+		"lib/geo/shapes.ibex": "use util\ntype Shape = Circle (r: Int)\n",
+		"lib/util.ibex":     "fn id x: Int -> Int\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := NewLoader([]string{dir, filepath.Join(dir, "lib")})
+	root, err := l.LoadFile(filepath.Join(dir, "main.ibex"))
+	assert.Nil(t, err)
+
+	assert.Len(t, root.Imports, 2)
+	shapes := root.Imports[0].Module
+	assert.Equal(t, "geo::shapes", shapes.Name)
+	assert.Equal(t, filepath.Join(dir, "lib/geo/shapes.ibex"), shapes.File)
+	util := root.Imports[1].Module
+	assert.Equal(t, util, shapes.Imports[0].Module, "util is parsed once")
+
+	names := []string{}
+	for _, m := range l.Modules() {
+		names = append(names, m.Name)
+	}
+	assert.Equal(t, []string{"util", "geo::shapes", ""}, names)
+}
+
+func TestLoadCycle(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ibex": "use a\n",
+		"a.ibex":    "use b\n",
+		"b.ibex":    "use a\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := NewLoader([]string{dir})
+	_, err := l.LoadFile(filepath.Join(dir, "main.ibex"))
+	assert.EqualError(t, err, "Import cycle: a -> b -> a")
+}
+
+func TestLoadMissing(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.ibex": "use nowhere\n",
+	})
+	defer os.RemoveAll(dir)
+
+	l := NewLoader([]string{dir})
+	_, err := l.LoadFile(filepath.Join(dir, "main.ibex"))
+	assert.EqualError(t, err, filepath.Join(dir, "main.ibex") + ":1:1: Cannot find module nowhere in " + dir)
+}
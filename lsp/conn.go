@@ -0,0 +1,94 @@
+package lsp
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/textproto"
+    "strconv"
+)
+
+// JSON-RPC error codes
+const (
+    codeParseError = -32700
+    codeInvalidRequest = -32600
+    codeMethodNotFound = -32601
+    codeInvalidParams = -32602
+    codeServerNotInitialized = -32002
+    codeRequestFailed = -32803
+)
+
+// a request, or a notification if ID is nil
+type request struct {
+    JSONRPC string `json:"jsonrpc"`
+    ID *json.RawMessage `json:"id,omitempty"`
+    Method string `json:"method"`
+    Params json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+    JSONRPC string `json:"jsonrpc"`
+    ID *json.RawMessage `json:"id"`
+    Result json.RawMessage `json:"result,omitempty"` // left out on errors only
+    Error *responseError `json:"error,omitempty"`
+}
+
+type responseError struct {
+    Code int `json:"code"`
+    Message string `json:"message"`
+}
+
+func (e *responseError) Error() string {
+    return e.Message
+}
+
+type notification struct {
+    JSONRPC string `json:"jsonrpc"`
+    Method string `json:"method"`
+    Params interface{} `json:"params"`
+}
+
+// conn reads and writes messages framed by a Content-Length header, as
+// LSP sends them over stdio
+type conn struct {
+    in *textproto.Reader
+    out io.Writer
+}
+
+func newConn(in io.Reader, out io.Writer) *conn {
+    return &conn{textproto.NewReader(bufio.NewReader(in)), out}
+}
+
+// the content of the next message, io.EOF once the input ends between
+// messages
+func (c *conn) read() ([]byte, error) {
+    header, err := c.in.ReadMIMEHeader()
+    if err == io.EOF && len(header) == 0 {
+        return nil, io.EOF
+    }
+    if err != nil {
+        return nil, err
+    }
+    length, err := strconv.Atoi(header.Get("Content-Length"))
+    if err != nil || length < 0 {
+        return nil, fmt.Errorf("Invalid Content-Length %q", header.Get("Content-Length"))
+    }
+    content := make([]byte, length)
+    if _, err := io.ReadFull(c.in.R, content); err != nil {
+        return nil, err
+    }
+    return content, nil
+}
+
+func (c *conn) write(msg interface{}) error {
+    content, err := json.Marshal(msg)
+    if err != nil {
+        return err
+    }
+    if _, err := fmt.Fprintf(c.out, "Content-Length: %d\r\n\r\n", len(content)); err != nil {
+        return err
+    }
+    _, err = c.out.Write(content)
+    return err
+}
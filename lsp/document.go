@@ -0,0 +1,233 @@
+package lsp
+
+import (
+    "fmt"
+    "net/url"
+    "path/filepath"
+    "strings"
+    "unicode/utf16"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// document is an open file with the result of analysing its text. The
+// modules it uses are read from disk, not from the open documents.
+type document struct {
+    uri string
+    file string // the path of the uri, the file of the positions
+    text string
+    lines []string
+    source *parser.Document // reparses only the blocks an edit changes
+
+    unit *parser.ASTCompilationUnit // nil if the text does not parse
+    parsed *parser.ASTCompilationUnit // the last text that parsed
+    mods []*loader.Module // of the last text that loaded
+    // nil unless the text loads, without the function bodies that do not
+    // check if it does not, see check.CheckModules
+    info *check.Info
+    diagnostics []Diagnostic
+}
+
+func uriFile(uri string) (string, error) {
+    u, err := url.Parse(uri)
+    if err != nil {
+        return "", err
+    }
+    if u.Scheme != "file" {
+        return "", fmt.Errorf("Unsupported document %s, only file URIs are", uri)
+    }
+    return filepath.FromSlash(u.Path), nil
+}
+
+func fileURI(file string) string {
+    if abs, err := filepath.Abs(file); err == nil {
+        file = abs
+    }
+    return (&url.URL{Scheme: "file", Path: filepath.ToSlash(file)}).String()
+}
+
+// analyses text, roots are searched for used modules after the
+// directory of the document
+func (d *document) update(text string, roots []string) {
+    d.text, d.lines = text, strings.Split(text, "\n")
+    d.unit, d.info, d.diagnostics = nil, nil, make([]Diagnostic, 0)
+
+    if d.source == nil {
+        d.source = parser.NewDocument(d.file, "")
+    }
+    unit, err := d.source.Replace(text)
+    if err != nil {
+        d.fail(err)
+        return
+    }
+    d.unit, d.parsed = unit, unit
+
+    l := loader.NewLoader(append([]string{filepath.Dir(d.file)}, roots...))
+    if _, err := l.LoadUnit(d.file, unit); err != nil {
+        d.fail(err)
+        return
+    }
+    d.mods = l.Modules()
+
+    info, err := check.CheckModules(d.mods)
+    if err != nil {
+        d.fail(err)
+        if info == nil {
+            return
+        }
+    }
+    d.info = info
+    for _, w := range info.Warnings {
+        if w.Pos.File != d.file {
+            continue
+        }
+        r := d.word(w.Pos)
+        for _, use := range unit.Uses {
+            if use.Pos == w.Pos {
+                r = d.line(w.Pos.Line)
+            }
+        }
+        d.diagnostics = append(d.diagnostics, Diagnostic{r, SeverityWarning, "ibex", w.Message})
+    }
+}
+
+// adds the diagnostic for err, placed as well as the error tells
+func (d *document) fail(err error) {
+    diag := Diagnostic{Severity: SeverityError, Source: "ibex", Message: err.Error()}
+    switch e := err.(type) {
+    case *parser.ParseError:
+        pos := e.Pos()
+        if pos.File == d.file {
+            diag.Range = Range{d.position(pos), d.position(parser.Pos{Line: pos.Line, Col: e.EndCol()})}
+            diag.Message = e.Message()
+        }
+    case *check.TypeError:
+        pos := e.Pos()
+        if pos.File == d.file {
+            diag.Range, diag.Message = d.word(pos), e.Message()
+        }
+    case *loader.NotFoundError:
+        diag.Message = e.Message()
+        if e.Pos.File == d.file {
+            diag.Range = d.line(e.Pos.Line)
+        }
+    default:
+        // loading failed, placed at the use of the module named
+        diag.Message = strings.TrimPrefix(diag.Message, d.file + ": ")
+        if d.unit == nil {
+            break
+        }
+        for _, use := range d.unit.Uses {
+            if strings.Contains(err.Error(), strings.Join(use.Path, "::")) {
+                diag.Range = d.line(use.Pos.Line)
+                break
+            }
+        }
+    }
+    d.diagnostics = append(d.diagnostics, diag)
+}
+
+// the LSP position of p, which must be in this document
+func (d *document) position(p parser.Pos) Position {
+    if p.Line < 1 || p.Line > len(d.lines) {
+        return Position{}
+    }
+    line := d.lines[p.Line - 1]
+    end := p.Col - 1
+    if end > len(line) {
+        end = len(line)
+    }
+    if end < 0 {
+        end = 0
+    }
+    character := 0
+    for _, r := range line[:end] {
+        character += utf16.RuneLen(r)
+    }
+    return Position{p.Line - 1, character}
+}
+
+// the Ibex position of an LSP position, past the end of the line if the
+// line is shorter
+func (d *document) pos(p Position) parser.Pos {
+    if p.Line < 0 || p.Line >= len(d.lines) {
+        return parser.Pos{File: d.file, Line: p.Line + 1, Col: 1}
+    }
+    line := d.lines[p.Line]
+    character := 0
+    for i, r := range line {
+        if character >= p.Character {
+            return parser.Pos{File: d.file, Line: p.Line + 1, Col: i + 1}
+        }
+        character += utf16.RuneLen(r)
+    }
+    return parser.Pos{File: d.file, Line: p.Line + 1, Col: len(line) + 1}
+}
+
+func identByte(b byte) bool {
+    return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// the length of the name, qualified or not, at the start of s
+func nameLength(s string) int {
+    n := 0
+    for n < len(s) {
+        switch {
+        case identByte(s[n]):
+            n++
+        case strings.HasPrefix(s[n:], "::") && n + 2 < len(s) && identByte(s[n + 2]):
+            n += 2
+        default:
+            return n
+        }
+    }
+    return n
+}
+
+// the range of the name starting at p, of one character if there is none
+func (d *document) word(p parser.Pos) Range {
+    start := d.position(p)
+    if p.Line < 1 || p.Line > len(d.lines) {
+        return Range{start, start}
+    }
+    line := d.lines[p.Line - 1]
+    if p.Col < 1 || p.Col > len(line) + 1 {
+        return Range{start, start}
+    }
+    end := p.Col - 1 + nameLength(line[p.Col - 1:])
+    if end == p.Col - 1 && end < len(line) {
+        end++
+    }
+    return Range{start, d.position(parser.Pos{Line: p.Line, Col: end + 1})}
+}
+
+// the range of the 1-based line n without its line break
+func (d *document) line(n int) Range {
+    if n < 1 || n > len(d.lines) {
+        return Range{}
+    }
+    return Range{Position{n - 1, 0}, d.position(parser.Pos{Line: n, Col: len(d.lines[n - 1]) + 1})}
+}
+
+// the range of the declaration on line n: the line and the lines
+// indented below it, without trailing blank or comment lines
+func (d *document) block(n int) Range {
+    last := n
+    for i := n; i < len(d.lines); i++ {
+        text := d.lines[i]
+        if strings.TrimSpace(text) != "" && text[0] != ' ' && text[0] != '\t' {
+            break
+        }
+        if start := parser.CommentStart(text); start >= 0 {
+            text = text[:start]
+        }
+        if strings.TrimSpace(text) != "" {
+            last = i + 1
+        }
+    }
+    r := d.line(n)
+    r.End = d.line(last).End
+    return r
+}
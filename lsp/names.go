@@ -0,0 +1,522 @@
+package lsp
+
+import (
+    "sort"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type occurrenceKind int
+
+const (
+    occIdent occurrenceKind = iota
+    occConstructor
+    occBinding // declared by a pattern
+    occParameter
+    occFunction // the name of a declaration
+    occType // the name of a declaration
+    occUse // the whole line of the statement
+    occUseItem
+)
+
+// a name written in the source
+type occurrence struct {
+    kind occurrenceKind
+    pos parser.Pos
+    name string
+    param *parser.FunctionParameter // of occParameter
+    use *parser.ASTUseStmt // of occUse and occUseItem
+    item *parser.UseItem // of occUseItem
+}
+
+// every name of unit, in no particular order
+func occurrences(unit *parser.ASTCompilationUnit) []*occurrence {
+    occs := make([]*occurrence, 0)
+    add := func(o *occurrence) {
+        occs = append(occs, o)
+    }
+    for _, use := range unit.Uses {
+        add(&occurrence{kind: occUse, pos: use.Pos, name: strings.Join(use.Path, "::"), use: use})
+        for _, item := range use.Items {
+            add(&occurrence{kind: occUseItem, pos: item.Pos, name: item.Name, use: use, item: item})
+        }
+    }
+    for _, decl := range unit.Declarations {
+        switch d := decl.(type) {
+        case *parser.ASTFunction:
+            add(&occurrence{kind: occFunction, pos: d.Pos, name: d.Name})
+            for _, p := range d.Parameters {
+                add(&occurrence{kind: occParameter, pos: p.Pos, name: p.Name, param: p})
+            }
+            if d.Body != nil {
+                for _, x := range d.Body.Children {
+                    walkExpr(x, add)
+                }
+            }
+        case *parser.ASTTypeDeclaration:
+            add(&occurrence{kind: occType, pos: d.Pos, name: d.Name})
+        }
+    }
+    return occs
+}
+
+func walkExpr(x parser.Expression, add func(*occurrence)) {
+    switch x := x.(type) {
+    case parser.IdentExpr:
+        add(&occurrence{kind: occIdent, pos: x.Pos, name: x.Ident})
+    case parser.NotExpr:
+        walkExpr(x.Expr, add)
+    case parser.NegateExpr:
+        walkExpr(x.Expr, add)
+    case parser.AddExpr:
+        walkExpr(x.Left, add)
+        walkExpr(x.Right, add)
+    case parser.SubExpr:
+        walkExpr(x.Left, add)
+        walkExpr(x.Right, add)
+    case parser.MulExpr:
+        walkExpr(x.Left, add)
+        walkExpr(x.Right, add)
+    case parser.DivExpr:
+        walkExpr(x.Left, add)
+        walkExpr(x.Right, add)
+    case parser.ModExpr:
+        walkExpr(x.Left, add)
+        walkExpr(x.Right, add)
+    case parser.FunctionCallExpr:
+        walkExpr(x.Input, add)
+        walkExpr(x.Target, add)
+    case parser.UnsafeAccessExpr:
+        walkExpr(x.Expr, add)
+    case parser.DefaultExpr:
+        walkExpr(x.Expr, add)
+        walkExpr(x.Default, add)
+    case parser.ArrayAccessExpr:
+        walkExpr(x.Target, add)
+        walkExpr(x.Index, add)
+    case parser.ArrayExpr:
+        for _, elem := range x.Elements {
+            walkExpr(elem, add)
+        }
+    case parser.TupleExpr:
+        for _, elem := range x.Elements {
+            walkExpr(elem, add)
+        }
+    case parser.NamedTupleExpr:
+        for _, entry := range x.Elements {
+            walkExpr(entry.Expr, add)
+        }
+    case parser.ConstructorExpr:
+        add(&occurrence{kind: occConstructor, pos: x.Pos, name: x.Tag})
+        if x.Payload != nil {
+            walkExpr(x.Payload, add)
+        }
+    case parser.MatchExpr:
+        walkExpr(x.Subject, add)
+        for _, arm := range x.Arms {
+            walkPattern(arm.Pattern, add)
+            for _, child := range arm.Body.Children {
+                walkExpr(child, add)
+            }
+        }
+    }
+}
+
+func walkPattern(p parser.Pattern, add func(*occurrence)) {
+    switch p := p.(type) {
+    case parser.BindingPattern:
+        add(&occurrence{kind: occBinding, pos: p.Pos, name: p.Name})
+    case parser.ConstructorPattern:
+        walkPattern(p.Payload, add)
+    case parser.TuplePattern:
+        for _, elem := range p.Elements {
+            walkPattern(elem, add)
+        }
+    case parser.NamedTuplePattern:
+        for _, entry := range p.Elements {
+            walkPattern(entry.Pattern, add)
+        }
+    }
+}
+
+// the name at p, touching its end included; nil if there is none. The
+// items of a use come before the statement around them.
+func (d *document) at(p parser.Pos) *occurrence {
+    if d.unit == nil {
+        return nil
+    }
+    var found *occurrence
+    for _, o := range occurrences(d.unit) {
+        if o.pos.Line != p.Line || p.Col < o.pos.Col {
+            continue
+        }
+        if o.kind == occUse && found == nil ||
+            o.kind != occUse && p.Col <= o.pos.Col + len(o.name) {
+            found = o
+        }
+    }
+    return found
+}
+
+// the module the root module imports by use, nil if it is not loaded
+func (d *document) imported(use *parser.ASTUseStmt) *loader.Module {
+    for _, m := range d.mods {
+        if m.Name != "" {
+            continue
+        }
+        for _, imp := range m.Imports {
+            if imp.Use == use {
+                return imp.Module
+            }
+        }
+    }
+    return nil
+}
+
+// the name of the function or type declared at pos, empty if there is
+// none
+func (d *document) declaredName(pos parser.Pos) string {
+    for _, m := range d.mods {
+        for _, decl := range m.Unit.Declarations {
+            switch decl := decl.(type) {
+            case *parser.ASTFunction:
+                if decl.Pos == pos {
+                    return decl.Name
+                }
+            case *parser.ASTTypeDeclaration:
+                if decl.Pos == pos {
+                    return decl.Name
+                }
+            }
+        }
+    }
+    return ""
+}
+
+// the position of the function or type of m declared by name
+func declaration(m *loader.Module, name string) (parser.Pos, bool) {
+    for _, decl := range m.Unit.Declarations {
+        switch decl := decl.(type) {
+        case *parser.ASTFunction:
+            if decl.Name == name {
+                return decl.Pos, true
+            }
+        case *parser.ASTTypeDeclaration:
+            if decl.Name == name {
+                return decl.Pos, true
+            }
+        }
+    }
+    return parser.Pos{}, false
+}
+
+// the location of the name at pos, which may be in another file and is
+// then the name of a declaration, as names of other scopes are not seen
+func (d *document) location(pos parser.Pos) Location {
+    if pos.File == d.file {
+        return Location{d.uri, d.word(pos)}
+    }
+    // declared names are ASCII, so they take a UTF-16 unit per byte
+    start := Position{pos.Line - 1, pos.Col - 1}
+    end := Position{start.Line, start.Character + len(d.declaredName(pos))}
+    return Location{fileURI(pos.File), Range{start, end}}
+}
+
+// where the name at p is declared, nil if nowhere known
+func (d *document) definition(p parser.Pos) *Location {
+    o := d.at(p)
+    if o == nil {
+        return nil
+    }
+    var pos parser.Pos
+    switch o.kind {
+    case occBinding, occParameter, occFunction, occType:
+        pos = o.pos
+    case occIdent:
+        if d.info == nil || d.info.Symbols[o.pos] == nil {
+            return nil
+        }
+        pos = d.info.Symbols[o.pos].Pos
+    case occConstructor:
+        if d.info == nil {
+            return nil
+        }
+        ty, ok := d.info.ExprTypes[o.pos].(core.IbexSimpleType)
+        if !ok {
+            return nil
+        }
+        for _, m := range d.mods {
+            for _, decl := range m.Unit.Declarations {
+                if td, ok := decl.(*parser.ASTTypeDeclaration); ok && check.Canonical(m, td.Name) == ty.Name {
+                    pos = td.Pos
+                }
+            }
+        }
+    case occUse, occUseItem:
+        m := d.imported(o.use)
+        if m == nil {
+            return nil
+        }
+        if o.kind == occUseItem {
+            if decl, ok := declaration(m, o.item.Name); ok {
+                loc := d.location(decl)
+                return &loc
+            }
+        }
+        return &Location{fileURI(m.File), Range{}}
+    }
+    if pos.Line == 0 {
+        return nil // in the prelude
+    }
+    loc := d.location(pos)
+    return &loc
+}
+
+// the type of the name at p as source, empty if it is not known
+func (d *document) describe(p parser.Pos) (string, *occurrence) {
+    o := d.at(p)
+    if o == nil || d.info == nil {
+        return "", o
+    }
+    info := d.info
+    typed := func(ty core.IbexType) string {
+        if ty == nil {
+            return ""
+        }
+        return o.name + " : " + core.TypeString(ty)
+    }
+    switch o.kind {
+    case occIdent, occConstructor:
+        return typed(info.ExprTypes[o.pos]), o
+    case occParameter:
+        return typed(o.param.Type), o
+    case occBinding:
+        // typed where it is used
+        for pos, sym := range info.Symbols {
+            if sym.Pos == o.pos {
+                return typed(info.ExprTypes[pos]), o
+            }
+        }
+    case occFunction:
+        return "fn " + typed(d.signature(o.name)), o
+    case occType:
+        return d.typeText(o.name, o.name), o
+    case occUse:
+        if m := d.imported(o.use); m != nil {
+            return "module " + m.Name + " (" + m.File + ")", o
+        }
+    case occUseItem:
+        m := d.imported(o.use)
+        if m == nil {
+            return "", o
+        }
+        name := check.Canonical(m, o.item.Name)
+        if _, ok := info.Functions[name]; ok {
+            return "fn " + typed(d.signature(name)), o
+        }
+        return d.typeText(name, o.item.Name), o
+    }
+    return "", o
+}
+
+// the type of the function by canonical name, with the inferred return
+// type if it declares none
+func (d *document) signature(name string) core.IbexType {
+    ty, ok := d.info.Functions[name]
+    if !ok {
+        return nil
+    }
+    if inferred, ok := d.info.Inferred[name]; ok {
+        ty.Return = inferred
+    }
+    return ty
+}
+
+func (d *document) typeText(name string, short string) string {
+    ty, ok := d.info.Types[name]
+    if !ok {
+        return ""
+    }
+    if params := d.info.TypeParams[name]; len(params) > 0 {
+        short += "[" + strings.Join(params, ", ") + "]"
+    }
+    return "type " + short + " = " + core.TypeString(ty)
+}
+
+// the names in scope at p, found without checking so that they are
+// offered while the text does not check. After qualifier:: only the
+// public names of the module used as qualifier are.
+func (d *document) completions(p parser.Pos) []CompletionItem {
+    unit := d.parsed
+    if unit == nil {
+        return []CompletionItem{}
+    }
+    items := make(map[string]CompletionItem)
+    add := func(label string, kind int) {
+        if _, ok := items[label]; !ok {
+            items[label] = CompletionItem{Label: label, Kind: kind}
+        }
+    }
+
+    line := ""
+    if p.Line >= 1 && p.Line <= len(d.lines) && p.Col - 1 <= len(d.lines[p.Line - 1]) {
+        line = d.lines[p.Line - 1][:p.Col - 1]
+    }
+    start := len(line)
+    for start > 0 && (identByte(line[start - 1]) || line[start - 1] == ':') {
+        start--
+    }
+    if word := line[start:]; strings.Contains(word, "::") {
+        qualifier := word[:strings.LastIndex(word, "::")]
+        for _, use := range unit.Uses {
+            if use.Alias == qualifier && use.Items == nil && !use.Glob {
+                if m := d.loaded(use); m != nil {
+                    publicNames(m, func(name string, kind int) {
+                        add(qualifier + "::" + name, kind)
+                    })
+                }
+            }
+        }
+        return sorted(items)
+    }
+
+    for _, decl := range unit.Declarations {
+        switch decl := decl.(type) {
+        case *parser.ASTFunction:
+            add(decl.Name, CompletionFunction)
+            if r := d.block(decl.Pos.Line); r.Start.Line <= p.Line - 1 && p.Line - 1 <= r.End.Line {
+                for _, param := range decl.Parameters {
+                    add(param.Name, CompletionVariable)
+                }
+                if decl.Body != nil {
+                    for _, x := range decl.Body.Children {
+                        walkExpr(x, func(o *occurrence) {
+                            if o.kind == occBinding {
+                                add(o.name, CompletionVariable)
+                            }
+                        })
+                    }
+                }
+            }
+        case *parser.ASTTypeDeclaration:
+            constructors(decl, func(tag string) {
+                add(tag, CompletionEnumMember)
+            })
+        }
+    }
+    add("Some", CompletionEnumMember)
+    add("None", CompletionEnumMember)
+    for _, use := range unit.Uses {
+        m := d.loaded(use)
+        switch {
+        case use.Items != nil:
+            for _, item := range use.Items {
+                kind := CompletionFunction
+                if m != nil {
+                    publicNames(m, func(name string, k int) {
+                        if name == item.Name {
+                            kind = k
+                        }
+                    })
+                }
+                add(item.Alias, kind)
+            }
+        case use.Glob:
+            if m != nil {
+                publicNames(m, add)
+            }
+        default:
+            add(use.Alias, CompletionModule)
+        }
+    }
+    return sorted(items)
+}
+
+// the declarations of the document, as far as it parsed
+func (d *document) symbols() []DocumentSymbol {
+    symbols := make([]DocumentSymbol, 0)
+    if d.parsed == nil {
+        return symbols
+    }
+    for _, decl := range d.parsed.Declarations {
+        sym := DocumentSymbol{}
+        switch decl := decl.(type) {
+        case *parser.ASTFunction:
+            sym.Name, sym.Kind = decl.Name, SymbolFunction
+            sym.Range, sym.SelectionRange = d.block(decl.Pos.Line), d.word(decl.Pos)
+            if d.info != nil {
+                if ty := d.signature(decl.Name); ty != nil {
+                    sym.Detail = core.TypeString(ty)
+                }
+            }
+        case *parser.ASTTypeDeclaration:
+            sym.Name, sym.Kind = decl.Name, SymbolStruct
+            if _, ok := decl.Type.(core.IbexVariantType); ok {
+                sym.Kind = SymbolEnum
+            }
+            sym.Range, sym.SelectionRange = d.block(decl.Pos.Line), d.word(decl.Pos)
+            if d.info != nil {
+                if ty, ok := d.info.Types[decl.Name]; ok {
+                    sym.Detail = core.TypeString(ty)
+                }
+            }
+        default:
+            continue
+        }
+        symbols = append(symbols, sym)
+    }
+    return symbols
+}
+
+// the module loaded for a use with the path of use, which may be of an
+// earlier text
+func (d *document) loaded(use *parser.ASTUseStmt) *loader.Module {
+    name := strings.Join(use.Path, "::")
+    for _, m := range d.mods {
+        if m.Name == name {
+            return m
+        }
+    }
+    return nil
+}
+
+// the public functions and constructors of m
+func publicNames(m *loader.Module, add func(string, int)) {
+    for _, decl := range m.Unit.Declarations {
+        switch decl := decl.(type) {
+        case *parser.ASTFunction:
+            if decl.Public {
+                add(decl.Name, CompletionFunction)
+            }
+        case *parser.ASTTypeDeclaration:
+            if decl.Public {
+                constructors(decl, func(tag string) {
+                    add(tag, CompletionEnumMember)
+                })
+            }
+        }
+    }
+}
+
+func constructors(decl *parser.ASTTypeDeclaration, add func(string)) {
+    if variant, ok := decl.Type.(core.IbexVariantType); ok {
+        for _, c := range variant.Cases {
+            add(c.Tag)
+        }
+    }
+}
+
+func sorted(items map[string]CompletionItem) []CompletionItem {
+    list := make([]CompletionItem, 0, len(items))
+    for _, item := range items {
+        list = append(list, item)
+    }
+    sort.Slice(list, func(i, j int) bool {
+        return list[i].Label < list[j].Label
+    })
+    return list
+}
@@ -0,0 +1,135 @@
+package lsp
+
+// The parts of the protocol the server uses, named and shaped as in the
+// LSP specification
+
+// Position is 0-based, Character counts UTF-16 code units
+type Position struct {
+    Line int `json:"line"`
+    Character int `json:"character"`
+}
+
+type Range struct {
+    Start Position `json:"start"`
+    End Position `json:"end"`
+}
+
+type Location struct {
+    URI string `json:"uri"`
+    Range Range `json:"range"`
+}
+
+type TextDocumentIdentifier struct {
+    URI string `json:"uri"`
+}
+
+type TextDocumentItem struct {
+    URI string `json:"uri"`
+    LanguageID string `json:"languageId"`
+    Version int `json:"version"`
+    Text string `json:"text"`
+}
+
+type DidOpenTextDocumentParams struct {
+    TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+// the server only syncs full documents, so a change is the new text
+type TextDocumentContentChangeEvent struct {
+    Text string `json:"text"`
+}
+
+type DidChangeTextDocumentParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+    ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+type DidCloseTextDocumentParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type TextDocumentPositionParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+    Position Position `json:"position"`
+}
+
+type DocumentSymbolParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentFormattingParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+const (
+    SeverityError = 1
+    SeverityWarning = 2
+)
+
+type Diagnostic struct {
+    Range Range `json:"range"`
+    Severity int `json:"severity"`
+    Source string `json:"source"`
+    Message string `json:"message"`
+}
+
+type PublishDiagnosticsParams struct {
+    URI string `json:"uri"`
+    Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+type MarkupContent struct {
+    Kind string `json:"kind"` // plaintext or markdown
+    Value string `json:"value"`
+}
+
+type Hover struct {
+    Contents MarkupContent `json:"contents"`
+    Range *Range `json:"range,omitempty"`
+}
+
+// symbol kinds
+const (
+    SymbolModule = 2
+    SymbolStruct = 23
+    SymbolEnum = 10
+    SymbolFunction = 12
+)
+
+type DocumentSymbol struct {
+    Name string `json:"name"`
+    Detail string `json:"detail,omitempty"`
+    Kind int `json:"kind"`
+    Range Range `json:"range"` // of the whole declaration
+    SelectionRange Range `json:"selectionRange"` // of the name
+}
+
+// completion item kinds
+const (
+    CompletionFunction = 3
+    CompletionVariable = 6
+    CompletionModule = 9
+    CompletionEnumMember = 20
+)
+
+type CompletionItem struct {
+    Label string `json:"label"`
+    Kind int `json:"kind"`
+    Detail string `json:"detail,omitempty"`
+}
+
+type TextEdit struct {
+    Range Range `json:"range"`
+    NewText string `json:"newText"`
+}
+
+type SemanticTokensParams struct {
+    TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+// SemanticTokens holds five numbers a token: the line and the start
+// character, both relative to the token before, the length, the index of
+// the type in the legend and the modifiers, of which there are none
+type SemanticTokens struct {
+    Data []int `json:"data"`
+}
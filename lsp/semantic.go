@@ -0,0 +1,30 @@
+package lsp
+
+import (
+    "github.com/ibex-lang/ibex/highlight"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// the legend of semantic token types, indexed by highlight.Class
+var tokenTypes = []string{
+    "keyword", "type", "function", "parameter", "variable", "enumMember",
+    "namespace", "number", "string", "operator", "comment",
+}
+
+// the semantic tokens of the text, classified with the names the last
+// analysis resolved
+func (d *document) semanticTokens() *SemanticTokens {
+    data := make([]int, 0)
+    line, character := 0, 0
+    for _, span := range highlight.Classify(d.text, d.unit, d.info) {
+        start := d.position(parser.Pos{Line: span.Line, Col: span.Col})
+        end := d.position(parser.Pos{Line: span.Line, Col: span.End})
+        if start.Line != line {
+            character = 0
+        }
+        data = append(data, start.Line - line, start.Character - character, end.Character - start.Character,
+            int(span.Class), 0)
+        line, character = start.Line, start.Character
+    }
+    return &SemanticTokens{data}
+}
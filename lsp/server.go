@@ -0,0 +1,257 @@
+package lsp
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+
+    "github.com/ibex-lang/ibex/format"
+)
+
+// Server speaks LSP over a stream, as an editor starts it on stdio. It
+// keeps the open documents, syncing them in full, and analyses them on
+// every change, publishing the errors and warnings of the parser, the
+// loader and the type checker as diagnostics. It answers hover,
+// definition, documentSymbol, completion and formatting requests.
+type Server struct {
+    conn *conn
+    roots []string // searched for modules after the directory of a document
+    docs map[string]*document // by uri
+
+    initialized bool
+    shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer, roots []string) *Server {
+    return &Server{
+        conn: newConn(in, out),
+        roots: roots,
+        docs: make(map[string]*document),
+    }
+}
+
+// serves until the exit notification or the end of the input. The
+// error is nil only if the client asked to shut down before.
+func (s *Server) Run() error {
+    for {
+        content, err := s.conn.read()
+        if err == io.EOF {
+            return fmt.Errorf("Input ended without exit")
+        }
+        if err != nil {
+            return err
+        }
+        var req request
+        if err := json.Unmarshal(content, &req); err != nil {
+            if err := s.respond(nil, nil, &responseError{codeParseError, err.Error()}); err != nil {
+                return err
+            }
+            continue
+        }
+        if req.Method == "exit" {
+            if !s.shutdown {
+                return fmt.Errorf("Exit without shutdown")
+            }
+            return nil
+        }
+        if err := s.handle(&req); err != nil {
+            return err
+        }
+    }
+}
+
+// answers a request, or acts on a notification; the error is about
+// writing only
+func (s *Server) handle(req *request) error {
+    if req.ID == nil {
+        return s.notified(req)
+    }
+    var result interface{}
+    var err error
+    switch {
+    case req.Method == "initialize":
+        s.initialized = true
+        result = map[string]interface{}{
+            "capabilities": map[string]interface{}{
+                "textDocumentSync": 1, // full
+                "hoverProvider": true,
+                "definitionProvider": true,
+                "documentSymbolProvider": true,
+                "completionProvider": map[string]interface{}{"triggerCharacters": []string{":"}},
+                "documentFormattingProvider": true,
+                "semanticTokensProvider": map[string]interface{}{
+                    "legend": map[string]interface{}{"tokenTypes": tokenTypes, "tokenModifiers": []string{}},
+                    "full": true,
+                },
+            },
+            "serverInfo": map[string]string{"name": "ibex"},
+        }
+    case !s.initialized:
+        err = &responseError{codeServerNotInitialized, "Server not initialized"}
+    case s.shutdown:
+        err = &responseError{codeInvalidRequest, "Server is shutting down"}
+    case req.Method == "shutdown":
+        s.shutdown = true
+    default:
+        result, err = s.answer(req)
+    }
+    if err != nil {
+        rerr, ok := err.(*responseError)
+        if !ok {
+            rerr = &responseError{codeRequestFailed, err.Error()}
+        }
+        return s.respond(req.ID, nil, rerr)
+    }
+    return s.respond(req.ID, result, nil)
+}
+
+func (s *Server) answer(req *request) (interface{}, error) {
+    switch req.Method {
+    case "textDocument/hover":
+        var params TextDocumentPositionParams
+        d, err := s.document(req, &params, &params.TextDocument)
+        if err != nil {
+            return nil, err
+        }
+        text, o := d.describe(d.pos(params.Position))
+        if text == "" {
+            return nil, nil
+        }
+        r := d.word(o.pos)
+        if o.kind == occUse {
+            r = d.line(o.pos.Line)
+        }
+        return &Hover{MarkupContent{"markdown", "```ibex\n" + text + "\n```"}, &r}, nil
+
+    case "textDocument/definition":
+        var params TextDocumentPositionParams
+        d, err := s.document(req, &params, &params.TextDocument)
+        if err != nil {
+            return nil, err
+        }
+        if loc := d.definition(d.pos(params.Position)); loc != nil {
+            return loc, nil
+        }
+        return nil, nil
+
+    case "textDocument/documentSymbol":
+        var params DocumentSymbolParams
+        d, err := s.document(req, &params, &params.TextDocument)
+        if err != nil {
+            return nil, err
+        }
+        return d.symbols(), nil
+
+    case "textDocument/completion":
+        var params TextDocumentPositionParams
+        d, err := s.document(req, &params, &params.TextDocument)
+        if err != nil {
+            return nil, err
+        }
+        return d.completions(d.pos(params.Position)), nil
+
+    case "textDocument/formatting":
+        var params DocumentFormattingParams
+        d, err := s.document(req, &params, &params.TextDocument)
+        if err != nil {
+            return nil, err
+        }
+        formatted, err := format.Source(d.file, d.text)
+        if err != nil {
+            return nil, err
+        }
+        if formatted == d.text {
+            return []TextEdit{}, nil
+        }
+        whole := Range{End: d.line(len(d.lines)).End}
+        return []TextEdit{{whole, formatted}}, nil
+
+    case "textDocument/semanticTokens/full":
+        var params SemanticTokensParams
+        d, err := s.document(req, &params, &params.TextDocument)
+        if err != nil {
+            return nil, err
+        }
+        return d.semanticTokens(), nil
+    }
+    return nil, &responseError{codeMethodNotFound, "Unsupported method " + req.Method}
+}
+
+// decodes the params of req and gives the open document they name
+func (s *Server) document(req *request, params interface{}, id *TextDocumentIdentifier) (*document, error) {
+    if err := json.Unmarshal(req.Params, params); err != nil {
+        return nil, &responseError{codeInvalidParams, err.Error()}
+    }
+    d, ok := s.docs[id.URI]
+    if !ok {
+        return nil, &responseError{codeInvalidParams, "Document " + id.URI + " is not open"}
+    }
+    return d, nil
+}
+
+// acts on a notification, ignoring those it does not know as the
+// protocol asks
+func (s *Server) notified(req *request) error {
+    if !s.initialized {
+        return nil
+    }
+    switch req.Method {
+    case "textDocument/didOpen":
+        var params DidOpenTextDocumentParams
+        if err := json.Unmarshal(req.Params, &params); err != nil {
+            return nil
+        }
+        file, err := uriFile(params.TextDocument.URI)
+        if err != nil {
+            return s.notify("window/showMessage", map[string]interface{}{"type": 1, "message": err.Error()})
+        }
+        d := &document{uri: params.TextDocument.URI, file: file}
+        s.docs[d.uri] = d
+        return s.analyse(d, params.TextDocument.Text)
+
+    case "textDocument/didChange":
+        var params DidChangeTextDocumentParams
+        if err := json.Unmarshal(req.Params, &params); err != nil {
+            return nil
+        }
+        d, ok := s.docs[params.TextDocument.URI]
+        if !ok || len(params.ContentChanges) == 0 {
+            return nil
+        }
+        return s.analyse(d, params.ContentChanges[len(params.ContentChanges) - 1].Text)
+
+    case "textDocument/didClose":
+        var params DidCloseTextDocumentParams
+        if err := json.Unmarshal(req.Params, &params); err != nil {
+            return nil
+        }
+        if _, ok := s.docs[params.TextDocument.URI]; !ok {
+            return nil
+        }
+        delete(s.docs, params.TextDocument.URI)
+        return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{params.TextDocument.URI,
+            []Diagnostic{}})
+    }
+    return nil
+}
+
+func (s *Server) analyse(d *document, text string) error {
+    d.update(text, s.roots)
+    return s.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{d.uri, d.diagnostics})
+}
+
+func (s *Server) respond(id *json.RawMessage, result interface{}, rerr *responseError) error {
+    resp := &response{JSONRPC: "2.0", ID: id, Error: rerr}
+    if rerr == nil {
+        data, err := json.Marshal(result)
+        if err != nil {
+            return err
+        }
+        resp.Result = data
+    }
+    return s.conn.write(resp)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+    return s.conn.write(&notification{"2.0", method, params})
+}
@@ -0,0 +1,261 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// a message from the server
+type incoming struct {
+	ID *json.RawMessage `json:"id"`
+	Method string `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error *responseError `json:"error"`
+}
+
+// client drives a server in process as an editor would
+type client struct {
+	t *testing.T
+	conn *conn
+	in chan *incoming
+	notes []*incoming // not yet looked at
+	next int
+	done chan error // the result of Run
+}
+
+func newClient(t *testing.T, roots []string) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, conn: newConn(clientIn, clientOut), in: make(chan *incoming, 100), done: make(chan error, 1)}
+	go func() {
+		c.done <- NewServer(serverIn, serverOut, roots).Run()
+		serverOut.Close()
+	}()
+	// reads as the server writes, so that it never blocks
+	go func() {
+		for {
+			content, err := c.conn.read()
+			if err != nil {
+				close(c.in)
+				return
+			}
+			msg := &incoming{}
+			assert.Nil(t, json.Unmarshal(content, msg))
+			c.in <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) notify(method string, params interface{}) {
+	assert.Nil(c.t, c.conn.write(&notification{"2.0", method, params}))
+}
+
+// sends a request and decodes its result into result, giving the error
+// of the response
+func (c *client) call(method string, params interface{}, result interface{}) *responseError {
+	c.next++
+	id := json.RawMessage(fmtID(c.next))
+	assert.Nil(c.t, c.conn.write(&request{"2.0", &id, method, marshal(c.t, params)}))
+	for msg := range c.in {
+		if msg.ID == nil {
+			c.notes = append(c.notes, msg)
+			continue
+		}
+		assert.Equal(c.t, string(id), string(*msg.ID))
+		if msg.Error == nil && result != nil {
+			assert.Nil(c.t, json.Unmarshal(msg.Result, result))
+		}
+		return msg.Error
+	}
+	c.t.Fatal("server stopped")
+	return nil
+}
+
+// the diagnostics published next for uri
+func (c *client) diagnostics(uri string) []Diagnostic {
+	for {
+		var msg *incoming
+		if len(c.notes) > 0 {
+			msg, c.notes = c.notes[0], c.notes[1:]
+		} else if msg = <-c.in; msg == nil {
+			c.t.Fatal("server stopped")
+		}
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		assert.Nil(c.t, json.Unmarshal(msg.Params, &params))
+		if params.URI == uri {
+			return params.Diagnostics
+		}
+	}
+}
+
+func fmtID(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func marshal(t *testing.T, v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	assert.Nil(t, err)
+	return b
+}
+
+func at(uri string, line int, character int) *TextDocumentPositionParams {
+	return &TextDocumentPositionParams{TextDocumentIdentifier{uri}, Position{line, character}}
+}
+
+const mainSource = `use util
+type Color = Red | Green
+fn pick c: Color -> Int
+    match c
+        Red => 1 -> util::double
+        Green => 2
+
+fn main -> Int
+    Red -> pick`
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "util.ibex"),
+		[]byte("pub fn double x: Int -> Int\n    x * 2\npub type Shape = Dot | Line (len: Int)"), 0644))
+	file := filepath.Join(dir, "main.ibex")
+	uri := fileURI(file)
+	c := newClient(t, nil)
+
+	err := c.call("textDocument/hover", at(uri, 0, 0), nil)
+	assert.Equal(t, codeServerNotInitialized, err.Code)
+
+	var init struct {
+		Capabilities map[string]interface{}
+	}
+	assert.Nil(t, c.call("initialize", map[string]interface{}{}, &init))
+	assert.Equal(t, true, init.Capabilities["hoverProvider"])
+	assert.Contains(t, init.Capabilities, "semanticTokensProvider")
+	c.notify("initialized", map[string]interface{}{})
+
+	c.notify("textDocument/didOpen", &DidOpenTextDocumentParams{TextDocumentItem{uri, "ibex", 1, mainSource}})
+	assert.Equal(t, []Diagnostic{}, c.diagnostics(uri))
+
+	hover := func(line int, character int) string {
+		var h *Hover
+		assert.Nil(t, c.call("textDocument/hover", at(uri, line, character), &h))
+		if h == nil {
+			return ""
+		}
+		return h.Contents.Value
+	}
+	assert.Equal(t, "```ibex\nc : Color\n```", hover(3, 10))
+	assert.Equal(t, "```ibex\npick : fn Color -> Int\n```", hover(8, 11))
+	assert.Equal(t, "```ibex\nfn pick : fn Color -> Int\n```", hover(2, 4))
+	assert.Equal(t, "```ibex\nc : Color\n```", hover(2, 8))
+	assert.Equal(t, "```ibex\ntype Color = Red | Green\n```", hover(1, 6))
+	assert.Equal(t, "```ibex\nutil::double : fn Int -> Int\n```", hover(4, 25))
+	assert.Equal(t, "```ibex\nRed : Color\n```", hover(8, 5))
+	assert.Equal(t, "", hover(5, 0))
+
+	definition := func(line int, character int) *Location {
+		var loc *Location
+		assert.Nil(t, c.call("textDocument/definition", at(uri, line, character), &loc))
+		return loc
+	}
+	utilURI := fileURI(filepath.Join(dir, "util.ibex"))
+	assert.Equal(t, &Location{uri, Range{Position{2, 3}, Position{2, 7}}}, definition(8, 12))
+	assert.Equal(t, &Location{uri, Range{Position{2, 8}, Position{2, 9}}}, definition(3, 10))
+	assert.Equal(t, &Location{uri, Range{Position{1, 5}, Position{1, 10}}}, definition(8, 5))
+	assert.Equal(t, &Location{utilURI, Range{Position{0, 7}, Position{0, 13}}}, definition(4, 20))
+	assert.Equal(t, &Location{utilURI, Range{}}, definition(0, 6))
+	assert.Nil(t, definition(5, 0))
+
+	var symbols []DocumentSymbol
+	assert.Nil(t, c.call("textDocument/documentSymbol", &DocumentSymbolParams{TextDocumentIdentifier{uri}}, &symbols))
+	assert.Equal(t, []DocumentSymbol{
+		{"Color", "Red | Green", SymbolEnum, Range{Position{1, 0}, Position{1, 24}}, Range{Position{1, 5}, Position{1, 10}}},
+		{"pick", "fn Color -> Int", SymbolFunction, Range{Position{2, 0}, Position{5, 18}},
+			Range{Position{2, 3}, Position{2, 7}}},
+		{"main", "fn () -> Int", SymbolFunction, Range{Position{7, 0}, Position{8, 15}},
+			Range{Position{7, 3}, Position{7, 7}}},
+	}, symbols)
+
+	var tokens SemanticTokens
+	assert.Nil(t, c.call("textDocument/semanticTokens/full", &SemanticTokensParams{TextDocumentIdentifier{uri}}, &tokens))
+	assert.Equal(t, []int{
+		0, 0, 3, 0, 0, // use
+		0, 4, 4, 6, 0, // util
+		1, 0, 4, 0, 0, // type
+		0, 5, 5, 1, 0, // Color
+		0, 6, 1, 9, 0, // =
+		0, 2, 3, 5, 0, // Red
+		0, 4, 1, 9, 0, // |
+		0, 2, 5, 5, 0, // Green
+	}, tokens.Data[:40])
+	assert.Equal(t, []int{0, 3, 4, 2, 0}, tokens.Data[len(tokens.Data) - 5:]) // pick
+
+	complete := func(line int, character int) []string {
+		var items []CompletionItem
+		assert.Nil(t, c.call("textDocument/completion", at(uri, line, character), &items))
+		labels := make([]string, len(items))
+		for i, item := range items {
+			labels[i] = item.Label
+		}
+		return labels
+	}
+	assert.Equal(t, []string{"Green", "None", "Red", "Some", "c", "main", "pick", "util"}, complete(5, 18))
+	assert.Equal(t, []string{"Green", "None", "Red", "Some", "main", "pick", "util"}, complete(8, 4))
+	assert.Equal(t, []string{"util::Dot", "util::Line", "util::double"}, complete(4, 26))
+
+	change := func(text string) []Diagnostic {
+		c.notify("textDocument/didChange", &DidChangeTextDocumentParams{TextDocumentIdentifier{uri},
+			[]TextDocumentContentChangeEvent{{text}}})
+		return c.diagnostics(uri)
+	}
+	assert.Equal(t, []Diagnostic{{Range{Position{1, 4}, Position{1, 5}}, SeverityError, "ibex", "Unexpected token"}},
+		change("fn main -> Int\n    )"))
+	assert.Equal(t, []Diagnostic{{Range{Position{1, 0}, Position{1, 2}}, SeverityError, "ibex", "Invalid indentation"}},
+		change("fn main -> Int\n  1"))
+	assert.Equal(t, []Diagnostic{{Range{Position{1, 4}, Position{1, 11}}, SeverityError, "ibex",
+		"Undefined name missing"}}, change("fn main -> Int\n    missing"))
+	assert.Equal(t, []Diagnostic{{Range{Position{1, 4}, Position{1, 5}}, SeverityError, "ibex",
+		"Type mismatch: expected Int, found String"}}, change("fn main -> Int\n    \"a\""))
+	// the functions that check are described while another does not
+	assert.Len(t, change("fn bad y: Int -> String\n    y\nfn inc x: Int -> Int\n    x + 1"), 1)
+	assert.Equal(t, "```ibex\nx : Int\n```", hover(3, 4))
+	assert.Equal(t, "```ibex\nfn inc : fn Int -> Int\n```", hover(2, 4))
+	assert.Equal(t, "", hover(1, 4), "not the types of the function that does not check")
+	assert.Equal(t, []Diagnostic{{Range{Position{0, 0}, Position{0, 9}}, SeverityError, "ibex",
+		"Cannot find module other in " + dir}}, change("use other\nfn main -> Int\n    1")[:1])
+	assert.Equal(t, []Diagnostic{{Range{Position{0, 0}, Position{0, 8}}, SeverityWarning, "ibex",
+		"Unused import util"}}, change("use util\nfn main -> Int\n    1"))
+	// names are still offered from the last text that parsed
+	change("use util\nfn main -> Int\n    1 +")
+	assert.Equal(t, []string{"None", "Some", "main", "util"}, complete(2, 4))
+
+	change("fn main->Int\n    1+2")
+	var edits []TextEdit
+	assert.Nil(t, c.call("textDocument/formatting", &DocumentFormattingParams{TextDocumentIdentifier{uri}}, &edits))
+	assert.Equal(t, []TextEdit{{Range{End: Position{1, 7}}, "fn main -> Int\n    1 + 2\n"}}, edits)
+
+	err = c.call("textDocument/rename", at(uri, 0, 0), nil)
+	assert.Equal(t, codeMethodNotFound, err.Code)
+	err = c.call("textDocument/hover", at(fileURI(filepath.Join(dir, "closed.ibex")), 0, 0), nil)
+	assert.Equal(t, codeInvalidParams, err.Code)
+
+	c.notify("textDocument/didClose", &DidCloseTextDocumentParams{TextDocumentIdentifier{uri}})
+	assert.Equal(t, []Diagnostic{}, c.diagnostics(uri))
+	assert.Nil(t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	assert.Nil(t, <-c.done)
+}
+
+func TestExitWithoutShutdown(t *testing.T) {
+	c := newClient(t, nil)
+	c.notify("exit", nil)
+	assert.EqualError(t, <-c.done, "Exit without shutdown")
+}
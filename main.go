@@ -1,38 +1,114 @@
 package main
 
 import (
+    "flag"
+    "fmt"
+    "io"
     "os"
-    "io/ioutil"
-    "log"
+    "path/filepath"
+    "sort"
+)
 
-	"github.com/ibex-lang/ibex/parser"
+// exit statuses
+const (
+    exitOK = 0
+    exitFailed = 1 // some file could not be read, compiled or run
+    exitUsage = 2
 )
 
+type command struct {
+    summary string
+    args string // after the flags, for the usage, empty if it takes no files
+    // defines the flags of the command on fs and gives the function
+    // running it on the files left after them
+    flags func(fs *flag.FlagSet) func(c *cli, files []string) int
+}
+
+var commands = map[string]*command{
+    "lex": {"print the tokens of files", "files...", lexFlags},
+    "parse": {"print the syntax trees of files", "files...", parseFlags},
+    "check": {"type check programs", "files...", checkFlags},
+    "run": {"run the fn main of programs", "files...", runFlags},
+    "build": {"compile programs with a backend", "files...", buildFlags},
+    "fmt": {"format files", "files...", fmtFlags},
+    "repl": {"evaluate expressions and declarations interactively", "", replFlags},
+    "lsp": {"serve the Language Server Protocol on stdio", "", lspFlags},
+    "grammar": {"print a TextMate grammar of Ibex for editors", "", grammarFlags},
+}
+
+// cli is what a command runs with
+type cli struct {
+    stdin io.Reader
+    stdout io.Writer
+    stderr io.Writer
+    errors string // format of errors, text or json
+}
+
 func main() {
-    args := os.Args[1:]
+    os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-    for _, arg := range args {
-        file, err := ioutil.ReadFile(arg)
-        if err != nil {
-            log.Print("Could not read file", arg)
-            log.Print("Reason:", err)
-        }
+func usage(w io.Writer) {
+    fmt.Fprintf(w, "Usage: ibex <command> [flags] files...\n\nCommands:\n")
+    names := make([]string, 0, len(commands))
+    for name := range commands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        fmt.Fprintf(w, "    %-8s %s\n", name, commands[name].summary)
+    }
+    fmt.Fprintf(w, "\nRun ibex <command> -h for the flags of a command.\n")
+}
+
+// runs the command line args, giving the exit status
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+    if len(args) == 0 {
+        usage(stderr)
+        return exitUsage
+    }
+    switch args[0] {
+    case "help", "-h", "-help", "--help":
+        usage(stdout)
+        return exitOK
+    }
+    cmd, ok := commands[args[0]]
+    if !ok {
+        fmt.Fprintf(stderr, "ibex: unknown command %s\n\n", args[0])
+        usage(stderr)
+        return exitUsage
+    }
 
-        compile(string(file), arg)
+    c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+    fs := flag.NewFlagSet("ibex " + args[0], flag.ContinueOnError)
+    fs.SetOutput(stderr)
+    fs.StringVar(&c.errors, "errors", "text", "format of errors: text, or json for one object per line")
+    runCmd := cmd.flags(fs)
+    fs.Usage = func() {
+        fmt.Fprintf(stderr, "Usage: ibex %s [flags] %s\n\nFlags:\n", args[0], cmd.args)
+        fs.PrintDefaults()
+    }
+    if err := fs.Parse(args[1:]); err != nil {
+        if err == flag.ErrHelp {
+            return exitOK
+        }
+        return exitUsage
+    }
+    if c.errors != "text" && c.errors != "json" {
+        fmt.Fprintf(stderr, "ibex %s: unknown error format %s\n", args[0], c.errors)
+        return exitUsage
+    }
+    if fs.NArg() == 0 && cmd.args != "" {
+        fmt.Fprintf(stderr, "ibex %s: no files\n", args[0])
+        fs.Usage()
+        return exitUsage
     }
+    return runCmd(c, fs.Args())
 }
 
-func compile(src string, name string) {
-    parser.InitExpressionParsing()
-
-	body, err := parser.Blockify(src)
-	if err != nil {
-		log.Fatal(err)
-	}
-	structure := parser.NewStructure(body)
-	ast, err := parser.Parse(structure)
-	if err != nil {
-		log.Fatal(err)
-	}
-	log.Printf("%#v\n", ast)
+// modules are looked up next to the compiled file, then in the
+// directories listed in IBEXPATH
+func searchRoots(name string) []string {
+    roots := []string{filepath.Dir(name)}
+    return append(roots, filepath.SplitList(os.Getenv("IBEXPATH"))...)
 }
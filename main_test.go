@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/dump"
+	"github.com/ibex-lang/ibex/format"
+)
+
+// writes the files given by name and content to a temporary directory,
+// giving their paths
+func writeFiles(t *testing.T, files ...string) []string {
+	dir := t.TempDir()
+	paths := make([]string, 0)
+	for i := 0; i < len(files); i += 2 {
+		path := filepath.Join(dir, files[i])
+		assert.Nil(t, os.WriteFile(path, []byte(files[i + 1]), 0644))
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func runArgs(args ...string) (int, string, string) {
+	return runInput("", args...)
+}
+
+func runInput(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	status, _, stderr := runArgs()
+	assert.Equal(t, exitUsage, status)
+	assert.Contains(t, stderr, "Usage: ibex <command>")
+
+	status, _, stderr = runArgs("frobnicate", "a.ibex")
+	assert.Equal(t, exitUsage, status)
+	assert.Contains(t, stderr, "unknown command frobnicate")
+
+	status, stdout, _ := runArgs("help")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stdout, "build    compile programs with a backend")
+
+	status, _, stderr = runArgs("run")
+	assert.Equal(t, exitUsage, status)
+	assert.Contains(t, stderr, "ibex run: no files")
+
+	status, _, _ = runArgs("build", "-O", "3", "a.ibex")
+	assert.Equal(t, exitUsage, status)
+	status, _, _ = runArgs("run", "-errors", "xml", "a.ibex")
+	assert.Equal(t, exitUsage, status)
+	status, _, _ = runArgs("lex", "-nope", "a.ibex")
+	assert.Equal(t, exitUsage, status)
+}
+
+func TestLex(t *testing.T) {
+	files := writeFiles(t, "a.ibex", "fn main -> Int\n    1 + 2")
+	status, stdout, _ := runArgs("lex", files[0])
+	assert.Equal(t, exitOK, status)
+	lines := strings.Split(stdout, "\n")
+	assert.Equal(t, files[0] + ":1:1\tfn\t\"fn\"", lines[0])
+	assert.Equal(t, files[0] + ":2:5\tnumber\t\"1\"", lines[4])
+	assert.Equal(t, files[0] + ":2:9\tnumber\t\"2\"", lines[6])
+	assert.Equal(t, files[0] + ":2:1\tEOF\t\"\"", lines[7])
+
+	status, stdout, _ = runArgs("lex", "--format=json", files[0])
+	assert.Equal(t, exitOK, status)
+	assert.True(t, strings.HasPrefix(stdout, "{\n  \"file\": "), stdout)
+	assert.Contains(t, stdout, `"kind": "number"`)
+
+	status, _, _ = runArgs("lex", "-format", "sexp", files[0])
+	assert.Equal(t, exitUsage, status)
+}
+
+func TestParse(t *testing.T) {
+	files := writeFiles(t, "a.ibex", "fn main->Int\n    (1+2)*3 // nine")
+	status, stdout, _ := runArgs("parse", "-format", "ibex", files[0])
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, "fn main -> Int\n    (1 + 2) * 3\n", stdout)
+
+	status, stdout, _ = runArgs("parse", files[0])
+	assert.Equal(t, exitOK, status)
+	assert.True(t, strings.HasPrefix(stdout, "&parser.ASTCompilationUnit{"), stdout)
+
+	status, stdout, _ = runArgs("parse", "--format=json", files[0])
+	assert.Equal(t, exitOK, status)
+	unit, err := dump.Decode([]byte(stdout))
+	assert.Nil(t, err)
+	text, _ := format.Node(unit)
+	assert.Equal(t, "fn main -> Int\n    (1 + 2) * 3", text)
+
+	status, stdout, _ = runArgs("parse", "-format", "sexp", files[0])
+	assert.Equal(t, exitOK, status)
+	assert.True(t, strings.HasPrefix(stdout, "(ibex\n :file "), stdout)
+
+	status, _, _ = runArgs("parse", "-format", "yaml", files[0])
+	assert.Equal(t, exitUsage, status)
+}
+
+func TestRun(t *testing.T) {
+	files := writeFiles(t, "main.ibex", `use util
+fn main -> (Int, String)
+    (2 -> util::double, "ok")`, "util.ibex", `pub fn double x: Int -> Int
+    x * 2`)
+	for _, engine := range []string{"interp", "vm"} {
+		status, stdout, stderr := runArgs("run", "-engine", engine, files[0])
+		assert.Equal(t, exitOK, status, stderr)
+		assert.Equal(t, "(4, \"ok\")\n", stdout)
+	}
+}
+
+// a file failing gives a failing status but does not stop the others
+func TestFailingFile(t *testing.T) {
+	files := writeFiles(t, "good.ibex", "fn main -> Int\n    1")
+	missing := filepath.Join(filepath.Dir(files[0]), "missing.ibex")
+	status, stdout, stderr := runArgs("run", missing, files[0])
+	assert.Equal(t, exitFailed, status)
+	assert.Equal(t, "1\n", stdout)
+	assert.Contains(t, stderr, "missing.ibex: no such file or directory")
+
+	status, _, _ = runArgs("lex", missing, files[0])
+	assert.Equal(t, exitFailed, status)
+	status, _, _ = runArgs("check", files[0])
+	assert.Equal(t, exitOK, status)
+}
+
+func TestErrorsJSON(t *testing.T) {
+	files := writeFiles(t,
+		"syntax.ibex", "fn main -> Int\n    (1",
+		"type.ibex", "fn main -> Int\n    \"no\"",
+		"trap.ibex", "fn div x: Int -> Int\n    10 / x\nfn main -> Int\n    0 -> div",
+		"import.ibex", "\nuse nowhere\nfn main -> Int\n    1",
+		"deep.ibex", "fn loop n: Int -> Int\n    n + 1 -> loop\nfn main -> Int\n    0 -> loop")
+
+	decode := func(stderr string) map[string]interface{} {
+		var d map[string]interface{}
+		assert.Nil(t, json.Unmarshal([]byte(stderr), &d), stderr)
+		return d
+	}
+
+	status, _, stderr := runArgs("parse", "-errors", "json", files[0])
+	assert.Equal(t, exitFailed, status)
+	d := decode(stderr)
+	assert.Equal(t, "syntax", d["kind"])
+	assert.Equal(t, files[0], d["file"])
+	assert.Equal(t, 2.0, d["line"])
+
+	status, _, stderr = runArgs("check", "-errors", "json", files[1])
+	assert.Equal(t, exitFailed, status)
+	d = decode(stderr)
+	assert.Equal(t, "type", d["kind"])
+	assert.Equal(t, files[1], d["file"])
+	assert.Equal(t, 2.0, d["line"])
+	assert.Equal(t, 5.0, d["column"])
+	assert.Equal(t, "Type mismatch: expected Int, found String", d["message"])
+
+	status, _, stderr = runArgs("check", "-errors", "json", files[3])
+	assert.Equal(t, exitFailed, status)
+	d = decode(stderr)
+	assert.Equal(t, "import", d["kind"])
+	assert.Equal(t, 2.0, d["line"])
+
+	status, _, stderr = runArgs("parse", "-errors", "json", files[0] + ".missing")
+	assert.Equal(t, exitFailed, status)
+	assert.Equal(t, "read", decode(stderr)["kind"])
+
+	status, _, stderr = runArgs("run", "-errors", "json", files[2])
+	assert.Equal(t, exitFailed, status)
+	d = decode(stderr)
+	assert.Equal(t, "runtime", d["kind"])
+	assert.Equal(t, "Division by zero", d["message"])
+	trace := d["trace"].([]interface{})
+	assert.Equal(t, 2, len(trace))
+	assert.Equal(t, "div", trace[0].(map[string]interface{})["function"])
+	assert.Equal(t, 2.0, trace[0].(map[string]interface{})["line"])
+
+	status, _, stderr = runArgs("run", "-errors", "json", files[4])
+	assert.Equal(t, exitFailed, status)
+	d = decode(stderr)
+	assert.Equal(t, "Stack overflow", d["message"])
+	trace = d["trace"].([]interface{})
+	assert.Equal(t, 2, len(trace))
+	assert.Equal(t, 9998.0, trace[0].(map[string]interface{})["repeats"])
+	_, repeats := trace[1].(map[string]interface{})["repeats"]
+	assert.False(t, repeats)
+
+	status, _, stderr = runArgs("run", files[2])
+	assert.Equal(t, exitFailed, status)
+	assert.True(t, strings.HasPrefix(stderr, "Runtime error: Division by zero\n    in fn div at "), stderr)
+}
+
+func TestBuild(t *testing.T) {
+	files := writeFiles(t, "prog.ibex", "fn main -> Int\n    1 + 2")
+	status, stdout, _ := runArgs("build", "-target", "ir", "-O", "0", "-o", "-", files[0])
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stdout, "fn main")
+
+	status, _, stderr := runArgs("build", files[0])
+	assert.Equal(t, exitOK, status, stderr)
+	dir := filepath.Dir(files[0])
+	for _, name := range []string{"prog.c", "ibex.h"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.Nil(t, err)
+	}
+
+	out := filepath.Join(dir, "out.wasm")
+	status, _, _ = runArgs("build", "-target", "wasm", "-o", out, files[0])
+	assert.Equal(t, exitOK, status)
+	b, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "\x00asm", string(b[:4]))
+
+	status, _, _ = runArgs("build", "-target", "go", "-o", "-", files[0])
+	assert.Equal(t, exitFailed, status)
+
+	status, _, stderr = runArgs("build", "-target", "go", files[0])
+	assert.Equal(t, exitOK, status, stderr)
+	b, err = os.ReadFile(filepath.Join(dir, "prog", "go.mod"))
+	assert.Nil(t, err)
+	assert.Equal(t, "module prog\n\ngo 1.18\n", string(b))
+
+	status, _, _ = runArgs("build", "-target", "go", "-go-module", "a", "-go-import", "a/b", files[0])
+	assert.Equal(t, exitUsage, status)
+}
+
+func TestFmt(t *testing.T) {
+	files := writeFiles(t, "messy.ibex", "fn main->Int // answer\n    (1+2)*14", "tidy.ibex", "fn main -> Int\n    1\n")
+	status, stdout, _ := runArgs("fmt", "-check", files[0], files[1])
+	assert.Equal(t, exitFailed, status)
+	assert.Equal(t, files[0] + "\n", stdout)
+
+	status, _, _ = runArgs("fmt", files[0], files[1])
+	assert.Equal(t, exitOK, status)
+	b, err := os.ReadFile(files[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "fn main -> Int // answer\n    (1 + 2) * 14\n", string(b))
+
+	status, stdout, _ = runArgs("fmt", "--check", files[0], files[1])
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, "", stdout)
+}
+
+func TestFmtUnparsed(t *testing.T) {
+	for src, msg := range map[string]string{
+		"type Shape = Circle (r: Int)\n    | Square (side: Int)\nfn main -> Int\n    1\n": "2:1...5: Unexpected indentation",
+		"fn main -> Int\n    1\n        2\nfn other -> Int\n    3\n": "3:1...9: Unexpected indentation",
+		"fn main -> Int\n    match 1\n        1 => 5\n            6\n        _ => 0\n": "4:1...13: Unexpected indentation",
+		"zz qq\nfn main -> Int\n    1\n": "1:1...3: Expected 'fn', 'type' or 'use'",
+	} {
+		files := writeFiles(t, "bad.ibex", src)
+		status, _, stderr := runArgs("check", files[0])
+		assert.Equal(t, exitFailed, status, src)
+		assert.Contains(t, stderr, "bad.ibex:" + msg, src)
+
+		status, _, _ = runArgs("fmt", files[0])
+		assert.Equal(t, exitFailed, status, src)
+		b, err := os.ReadFile(files[0])
+		assert.Nil(t, err)
+		assert.Equal(t, src, string(b), "fmt leaves files it cannot parse alone")
+	}
+}
+
+func TestRepl(t *testing.T) {
+	status, stdout, stderr := runInput(`fn double x: Int -> Int
+    x * 2
+
+3 -> double
+match 3 -> double
+    6 => "six"
+    _ => "other"
+
+1 / 0
+:history
+:quit
+4`, "repl")
+	assert.Equal(t, exitOK, status)
+	assert.Equal(t, `> ... ... double : fn Int -> Int
+> 6 : Int
+> ... ... ... "six" : String
+> > 1	fn double x: Int -> Int
+	    x * 2
+2	3 -> double
+3	match 3 -> double
+	    6 => "six"
+	    _ => "other"
+4	1 / 0
+> `, stdout)
+	assert.Equal(t, "Runtime error: Division by zero\n    in fn <input 4> at <input 4>:1:3\n", stderr)
+
+	status, _, stderr = runInput("fn f -> Int\n   1\n(", "repl", "-errors", "json")
+	assert.Equal(t, exitOK, status)
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"line":2,"column":1,"endColumn":4,"message":"Invalid indentation"`)
+	assert.Contains(t, lines[1], `"kind":"syntax","file":"\u003cinput 1\u003e"`)
+
+	status, _, stderr = runInput("1 + \"a\"\nuse nowhere", "repl", "-errors", "json")
+	assert.Equal(t, exitOK, status)
+	lines = strings.Split(strings.TrimSpace(stderr), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Contains(t, lines[0], `"kind":"type","file":"\u003cinput 1\u003e","line":1,"column":3`)
+	assert.Contains(t, lines[1], `"kind":"import","file":"\u003cinput 2\u003e","line":1,"column":1`)
+
+	status, _, _ = runArgs("repl", "a.ibex")
+	assert.Equal(t, exitUsage, status)
+}
+
+// frames messages as LSP sends them
+func lspInput(messages ...string) string {
+	var b strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+	return b.String()
+}
+
+func TestLsp(t *testing.T) {
+	status, stdout, _ := runInput(lspInput(
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "shutdown"}`,
+		`{"jsonrpc": "2.0", "method": "exit"}`), "lsp")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stdout, `"hoverProvider":true`)
+	assert.True(t, strings.HasSuffix(stdout, `{"jsonrpc":"2.0","id":2,"result":null}`), stdout)
+
+	status, _, stderr := runInput(lspInput(`{"jsonrpc": "2.0", "method": "exit"}`), "lsp")
+	assert.Equal(t, exitFailed, status)
+	assert.Equal(t, "Exit without shutdown\n", stderr)
+}
+
+func TestGrammar(t *testing.T) {
+	status, stdout, _ := runArgs("grammar")
+	assert.Equal(t, exitOK, status)
+	assert.Contains(t, stdout, `"scopeName": "source.ibex"`)
+
+	status, _, _ = runArgs("grammar", "a.ibex")
+	assert.Equal(t, exitUsage, status)
+}
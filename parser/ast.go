@@ -7,10 +7,22 @@ type ASTNode interface {}
 type ASTCompilationUnit struct {
     Uses []*ASTUseStmt
     Declarations []ASTMemberDeclaration
+    Comments []*Comment // in source order
 }
 
+// use a::b::c, use a::b as c, use a::b::{x, y as z} or use a::b::*
 type ASTUseStmt struct {
-    Path []string
+    Pos Pos
+    Path []string // of the module
+    Alias string // qualifier for the module, the last segment unless renamed
+    Items []*UseItem // nil unless importing selected items
+    Glob bool
+}
+
+type UseItem struct {
+    Pos Pos
+    Name string
+    Alias string // same as Name unless renamed
 }
 
 type ASTMemberDeclaration interface {}
@@ -20,87 +32,130 @@ type ASTBody struct {
 }
 
 type ASTFunction struct {
+    Public bool
+    Pos Pos // of the name
     Name string
+    TypeParams []string
     Parameters []*FunctionParameter
     Return core.IbexType
     Body *ASTBody
 }
 
 type ASTTypeDeclaration struct {
+    Public bool
+    Pos Pos // of the name
     Name string
+    Params []string
     Type core.IbexType
 }
 
 type FunctionParameter struct {
     Name string
     Type core.IbexType
+    Pos Pos // of the name
 }
 
 type Expression interface {
     ASTNode
 }
 
+// Pos is the position of the first segment of a qualified name and
+// identifies the expression in check.Info.Symbols
 type IdentExpr struct {
     Ident string
+    Pos Pos
 }
 
 type StringExpr struct {
     String string
+    Pos Pos
 }
 
 type NumberExpr struct {
     Number string
+    Pos Pos
 }
 
+// !x, Pos is the position of the operator as in the other operators
 type NotExpr struct {
     Expr Expression
+    Pos Pos
 }
 
 type NegateExpr struct {
     Expr Expression
+    Pos Pos
 }
 
 type AddExpr struct {
     Left Expression
     Right Expression
+    Pos Pos
 }
 
 type SubExpr struct {
     Left Expression
     Right Expression
+    Pos Pos
 }
 
+// Input -> Target, Pos is the position of the arrow
 type FunctionCallExpr struct {
     Input Expression
     Target Expression
+    Pos Pos
 }
 
 type MulExpr struct {
     Left Expression
     Right Expression
+    Pos Pos
 }
 
+// dividing by zero traps at Pos, the position of the operator
 type DivExpr struct {
     Left Expression
     Right Expression
+    Pos Pos
 }
 
 type ModExpr struct {
     Left Expression
     Right Expression
+    Pos Pos
 }
 
+// opt! unwraps an Option, trapping at Pos when it is None
 type UnsafeAccessExpr struct {
     Expr Expression
+    Pos Pos
 }
 
+// opt ? default, Pos is the position of the '?'
+type DefaultExpr struct {
+    Expr Expression
+    Default Expression
+    Pos Pos
+}
+
+// an index outside the array traps at Pos, the position of the '['.
+// m[i, j] is parsed as m[i][j]
 type ArrayAccessExpr struct {
     Target Expression
     Index Expression
+    Pos Pos
+}
+
+// [a, b, c], Pos is the position of the '['
+type ArrayExpr struct {
+    Elements []Expression
+    Pos Pos
 }
 
+// (a, b), Pos is the position of the '(' as in named tuples
 type TupleExpr struct {
     Elements []Expression
+    Pos Pos
 }
 
 type NamedTupleEntry struct {
@@ -109,4 +164,120 @@ type NamedTupleEntry struct {
 }
 type NamedTupleExpr struct {
     Elements []*NamedTupleEntry
+    Pos Pos
+}
+
+// Tag starts with an uppercase letter, Payload is nil when absent
+type ConstructorExpr struct {
+    Tag string
+    Payload Expression
+    Pos Pos
+}
+
+type MatchArm struct {
+    Pattern Pattern
+    Body *ASTBody
+}
+// a match without an applicable arm traps at Pos, the position of the
+// match keyword
+type MatchExpr struct {
+    Subject Expression
+    Arms []*MatchArm
+    Pos Pos
+}
+
+type Pattern interface {}
+
+// _
+type WildcardPattern struct {
+    Pos Pos
+}
+
+type BindingPattern struct {
+    Name string
+    Pos Pos
+}
+
+// number or string literal
+type LiteralPattern struct {
+    Literal Expression
+}
+
+type ConstructorPattern struct {
+    Tag string
+    Payload Pattern
+    Pos Pos
+}
+
+type TuplePattern struct {
+    Elements []Pattern
+    Pos Pos // of the '('
+}
+
+type NamedTuplePatternEntry struct {
+    Tag string
+    Pattern Pattern
+}
+type NamedTuplePattern struct {
+    Elements []*NamedTuplePatternEntry
+    Pos Pos // of the '('
+}
+
+// the position of an expression or pattern, of its first segment or its
+// operator as its Pos field tells; zero for wildcards and for literal
+// patterns without one
+func NodePos(node ASTNode) Pos {
+    switch n := node.(type) {
+    case IdentExpr:
+        return n.Pos
+    case StringExpr:
+        return n.Pos
+    case NumberExpr:
+        return n.Pos
+    case NotExpr:
+        return n.Pos
+    case NegateExpr:
+        return n.Pos
+    case AddExpr:
+        return n.Pos
+    case SubExpr:
+        return n.Pos
+    case MulExpr:
+        return n.Pos
+    case DivExpr:
+        return n.Pos
+    case ModExpr:
+        return n.Pos
+    case FunctionCallExpr:
+        return n.Pos
+    case UnsafeAccessExpr:
+        return n.Pos
+    case DefaultExpr:
+        return n.Pos
+    case ArrayAccessExpr:
+        return n.Pos
+    case ArrayExpr:
+        return n.Pos
+    case TupleExpr:
+        return n.Pos
+    case NamedTupleExpr:
+        return n.Pos
+    case ConstructorExpr:
+        return n.Pos
+    case MatchExpr:
+        return n.Pos
+    case WildcardPattern:
+        return n.Pos
+    case BindingPattern:
+        return n.Pos
+    case LiteralPattern:
+        return NodePos(n.Literal)
+    case ConstructorPattern:
+        return n.Pos
+    case TuplePattern:
+        return n.Pos
+    case NamedTuplePattern:
+        return n.Pos
+    }
+    return Pos{}
 }
@@ -3,6 +3,7 @@ package parser
 const (
     _ = iota // ignore 0
     AssignmentPrecedence     // =
+    DefaultPrecedence        // ?
     FunctionCallPrecedence   // ->
     AdditivePrecedence       // +, -
     MultiplicativePrecedence // *, /, %
@@ -22,6 +23,8 @@ func InitExpressionParsing() {
         TokenBang:      ParseUnaryPrefix,
         TokenSub:       ParseUnaryPrefix,
         TokenLParen:    ParseGrouping,
+        TokenMatch:     ParseMatch,
+        TokenLBracket:  ParseArrayLiteral,
     }
 
     additive := InfixParser{ParseAdditive, AdditivePrecedence}
@@ -34,6 +37,7 @@ func InitExpressionParsing() {
         TokenDiv:   multiplicative,
         TokenMod:   multiplicative,
         TokenArrow: InfixParser{ParseFunctionCall, FunctionCallPrecedence},
+        TokenQuestion: InfixParser{ParseDefault, DefaultPrecedence},
     }
 
     postfixParsers = map[TokenType]PostfixParser{
@@ -96,15 +100,22 @@ func nextPrecedence(lex *Lexer) int {
 type PrefixParser func (*Lexer, *Token) (Expression, error)
 
 func ParseIdent(lex *Lexer, tok *Token) (Expression, error) {
-    return IdentExpr{tok.Value}, nil
+    name, _, err := parseQualifiedName(tok, lex)
+    if err != nil {
+        return nil, err
+    }
+    if isTag(name) {
+        return parseConstructor(lex, tok, name)
+    }
+    return IdentExpr{name, tok.Pos()}, nil
 }
 
 func ParseString(lex *Lexer, tok *Token) (Expression, error) {
-    return StringExpr{tok.Value}, nil
+    return StringExpr{tok.Value, tok.Pos()}, nil
 }
 
 func ParseNumber(lex *Lexer, tok *Token) (Expression, error) {
-    return NumberExpr{tok.Value}, nil
+    return NumberExpr{tok.Value, tok.Pos()}, nil
 }
 
 func ParseUnaryPrefix(lex *Lexer, tok *Token) (Expression, error) {
@@ -114,16 +125,21 @@ func ParseUnaryPrefix(lex *Lexer, tok *Token) (Expression, error) {
     }
 
     if tok.Ty == TokenBang {
-        return NotExpr{expr}, nil
+        return NotExpr{expr, tok.Pos()}, nil
     } else if tok.Ty == TokenSub {
-        return NegateExpr{expr}, nil
+        return NegateExpr{expr, tok.Pos()}, nil
     } else {
         return nil, ErrorAtToken(tok, "Unexpected token")
     }
 }
 
-// parses a grouping/tuple/named tuple
+// parses a grouping/unit/tuple/named tuple
 func ParseGrouping(lex *Lexer, tok *Token) (Expression, error) {
+    if lex.PeekToken().Ty == TokenRParen {
+        lex.NextToken()
+        return TupleExpr{[]Expression{}, tok.Pos()}, nil // ()
+    }
+
     expr, err := ParseExpression(lex)
     if err != nil {
         return nil, err
@@ -134,15 +150,16 @@ func ParseGrouping(lex *Lexer, tok *Token) (Expression, error) {
 		lex.NextToken()
         return expr, nil
     } else if peek.Ty == TokenComma {
-        return parseTupleLiteral(expr, lex)
+        return parseTupleLiteral(tok, expr, lex)
     } else if peek.Ty == TokenColon {
-        return parseNamedTupleLiteral(expr, lex)
+        return parseNamedTupleLiteral(tok, expr, lex)
     } else {
         return nil, ErrorAtToken(peek, "Expected ')'")
     }
 }
 
-func parseTupleLiteral(first Expression, lex *Lexer) (Expression, error) {
+// paren is the '(' opening the tuple
+func parseTupleLiteral(paren *Token, first Expression, lex *Lexer) (Expression, error) {
     elems := []Expression{first}
     tok := lex.NextToken()
     for tok.Ty == TokenComma {
@@ -158,10 +175,10 @@ func parseTupleLiteral(first Expression, lex *Lexer) (Expression, error) {
         return nil, ErrorAtToken(tok, "Expected ')'")
     }
 
-    return TupleExpr{elems}, nil
+    return TupleExpr{elems, paren.Pos()}, nil
 }
 
-func parseNamedTupleLiteral(firstTag Expression,
+func parseNamedTupleLiteral(paren *Token, firstTag Expression,
     lex *Lexer) (Expression, error) {
 
     lex.NextToken()
@@ -204,7 +221,7 @@ func parseNamedTupleLiteral(firstTag Expression,
         return nil, ErrorAtToken(tok, "Expected ')'")
     }
 
-    return NamedTupleExpr{elems}, nil
+    return NamedTupleExpr{elems, paren.Pos()}, nil
 }
 
 type InfixParser struct {
@@ -223,9 +240,9 @@ func ParseAdditive(left Expression, lex *Lexer,
     }
 
     if tok.Ty == TokenAdd {
-        return AddExpr{left, right}, nil
+        return AddExpr{left, right, tok.Pos()}, nil
     } else if tok.Ty == TokenSub {
-        return SubExpr{left, right}, nil
+        return SubExpr{left, right, tok.Pos()}, nil
     } else {
         return nil, ErrorAtToken(tok, "Unexpected token")
     }
@@ -239,7 +256,7 @@ func ParseFunctionCall(left Expression, lex *Lexer,
         return nil, err
     }
 
-    return FunctionCallExpr{left, right}, nil
+    return FunctionCallExpr{left, right, tok.Pos()}, nil
 }
 
 func ParseMultiplicative(left Expression, lex *Lexer,
@@ -251,11 +268,11 @@ func ParseMultiplicative(left Expression, lex *Lexer,
     }
 
     if tok.Ty == TokenMul {
-        return MulExpr{left, right}, nil
+        return MulExpr{left, right, tok.Pos()}, nil
     } else if tok.Ty == TokenDiv {
-        return DivExpr{left, right}, nil
+        return DivExpr{left, right, tok.Pos()}, nil
     } else if tok.Ty == TokenMod {
-        return ModExpr{left, right}, nil
+        return ModExpr{left, right, tok.Pos()}, nil
     } else {
         return nil, ErrorAtToken(tok, "Unexpected token")
     }
@@ -264,21 +281,60 @@ func ParseMultiplicative(left Expression, lex *Lexer,
 func ParseUnsafeAccess(left Expression, lex *Lexer,
     tok *Token) (Expression, error) {
 
-    return UnsafeAccessExpr{left}, nil
+    return UnsafeAccessExpr{left, tok.Pos()}, nil
 }
 
-func ParseArrayAccess(left Expression, lex *Lexer,
+func ParseDefault(left Expression, lex *Lexer,
     tok *Token) (Expression, error) {
 
-    idx, err := ParseExpression(lex)
+    // right associative, a ? b ? c falls back twice
+    right, err := ParseExpressionP(DefaultPrecedence - 1, lex)
     if err != nil {
         return nil, err
     }
 
-    tok = lex.NextToken()
-    if tok.Ty != TokenRBracket {
-        return nil, ErrorAtToken(tok, "Expected ']'")
+    return DefaultExpr{left, right, tok.Pos()}, nil
+}
+
+func ParseArrayAccess(left Expression, lex *Lexer,
+    tok *Token) (Expression, error) {
+
+    pos := tok.Pos()
+    for {
+        idx, err := ParseExpression(lex)
+        if err != nil {
+            return nil, err
+        }
+        left = ArrayAccessExpr{left, idx, pos}
+
+        tok = lex.NextToken()
+        if tok.Ty == TokenRBracket {
+            return left, nil
+        } else if tok.Ty != TokenComma {
+            return nil, ErrorAtToken(tok, "Expected ']'")
+        }
+    }
+}
+
+func ParseArrayLiteral(lex *Lexer, tok *Token) (Expression, error) {
+    elems, pos := []Expression{}, tok.Pos()
+    if lex.PeekToken().Ty == TokenRBracket {
+        lex.NextToken()
+        return ArrayExpr{elems, pos}, nil
     }
 
-    return ArrayAccessExpr{left, idx}, nil
+    for {
+        expr, err := ParseExpression(lex)
+        if err != nil {
+            return nil, err
+        }
+        elems = append(elems, expr)
+
+        tok = lex.NextToken()
+        if tok.Ty == TokenRBracket {
+            return ArrayExpr{elems, pos}, nil
+        } else if tok.Ty != TokenComma {
+            return nil, ErrorAtToken(tok, "Expected ']'")
+        }
+    }
 }
@@ -0,0 +1,207 @@
+package parser
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Document is a source parsed a block at a time, a block being a line of
+// the top level with the lines below it up to the next one. Parsing a
+// new text blockifies only the blocks whose text is new and parses only
+// those and the blocks that moved to other lines, for their positions;
+// the others keep their declarations. The unit and error are always
+// those ParseFile gives for the text.
+type Document struct {
+    file string
+    text string
+    blocks map[string][]*block // by text, those of the last parse
+    unit *ASTCompilationUnit
+    err error
+}
+
+type block struct {
+    start int // the index of its first line
+    body *GeneralBody // with the numbers of the lines in the document
+    parsed bool // whether the fields below are set
+    uses []*ASTUseStmt
+    decls []ASTMemberDeclaration
+    whole bool // whether the parse read every line, else it stopped there
+}
+
+func NewDocument(file string, src string) *Document {
+    d := &Document{file: file, blocks: make(map[string][]*block)}
+    d.parse(src)
+    return d
+}
+
+func (d *Document) Text() string {
+    return d.text
+}
+
+// the unit of the text, nil with the error if it does not parse
+func (d *Document) Unit() (*ASTCompilationUnit, error) {
+    return d.unit, d.err
+}
+
+// Replace parses text in place of the text of the document
+func (d *Document) Replace(text string) (*ASTCompilationUnit, error) {
+    d.parse(text)
+    return d.unit, d.err
+}
+
+// Edit replaces the text from start to end, positions as those of the
+// parser, by text and parses the result
+func (d *Document) Edit(start Pos, end Pos, text string) (*ASTCompilationUnit, error) {
+    from, err := d.offset(start)
+    if err != nil {
+        return nil, err
+    }
+    to, err := d.offset(end)
+    if err != nil {
+        return nil, err
+    }
+    if to < from {
+        return nil, fmt.Errorf("Edit ends at %d:%d before its start %d:%d", end.Line, end.Col, start.Line, start.Col)
+    }
+    return d.Replace(d.text[:from] + text + d.text[to:])
+}
+
+// the index in the text of p
+func (d *Document) offset(p Pos) (int, error) {
+    lines := strings.Split(d.text, "\n")
+    if p.Line < 1 || p.Line > len(lines) || p.Col < 1 || p.Col > len(lines[p.Line - 1]) + 1 {
+        return 0, fmt.Errorf("Position %d:%d is outside the document", p.Line, p.Col)
+    }
+    offset := p.Col - 1
+    for _, line := range lines[:p.Line - 1] {
+        offset += len(line) + 1
+    }
+    return offset, nil
+}
+
+func (d *Document) parse(text string) {
+    InitExpressionParsing()
+
+    d.text = text
+    lines := strings.Split(text, "\n")
+    starts := blockStarts(lines)
+    blocks := make(map[string][]*block)
+    order := make([]*block, 0, len(starts))
+    for i, start := range starts {
+        end := len(lines)
+        if i + 1 < len(starts) {
+            end = starts[i + 1]
+        }
+        // blank lines at the end make nothing, keeping them out lets a
+        // block stay as it is when lines are added after it
+        for end > start && blank(lines[end - 1]) {
+            end--
+        }
+        if end == start {
+            continue
+        }
+        key := strings.Join(lines[start:end], "\n")
+        b := d.reuse(key, start)
+        if b == nil {
+            body, whole, err := blockify(append([]string(nil), lines[start:end]...))
+            if err != nil || !whole {
+                // the whole source tells which error comes first
+                d.blocks = blocks
+                d.unit, d.err = ParseFile(d.file, text)
+                return
+            }
+            b = &block{start: start, body: body.shifted(start)}
+        }
+        blocks[key] = append(blocks[key], b)
+        order = append(order, b)
+    }
+    d.blocks = blocks
+
+    unit := &ASTCompilationUnit{
+        Uses: make([]*ASTUseStmt, 0),
+        Declarations: make([]ASTMemberDeclaration, 0),
+        Comments: make([]*Comment, 0),
+    }
+    for _, b := range order {
+        for _, c := range b.body.comments {
+            c.Pos.File = d.file
+            unit.Comments = append(unit.Comments, c)
+        }
+    }
+    for _, b := range order {
+        if !b.parsed {
+            s := NewStructure(b.body)
+            s.file = d.file
+            u, err := parse(s)
+            if err != nil {
+                d.unit, d.err = nil, err
+                return
+            }
+            b.parsed, b.uses, b.decls = true, u.Uses, u.Declarations
+            b.whole = s.idx >= len(b.body.children)
+        }
+        unit.Uses = append(unit.Uses, b.uses...)
+        unit.Declarations = append(unit.Declarations, b.decls...)
+        if !b.whole {
+            break
+        }
+    }
+    d.unit, d.err = unit, nil
+}
+
+// a block of the last parse with the text key, as it is if it starts at
+// the same line, else moved there to be parsed again; nil if there is
+// none
+func (d *Document) reuse(key string, start int) *block {
+    candidates := d.blocks[key]
+    for i, b := range candidates {
+        if b.start == start {
+            d.blocks[key] = append(candidates[:i:i], candidates[i + 1:]...)
+            return b
+        }
+    }
+    if len(candidates) == 0 {
+        return nil
+    }
+    b := candidates[0]
+    d.blocks[key] = candidates[1:]
+    return &block{start: start, body: b.body.shifted(start - b.start)}
+}
+
+// the indices of the lines starting blocks: the first line, for what
+// comes before any line of the top level, and those of the top level
+func blockStarts(lines []string) []int {
+    starts := []int{0}
+    for i, line := range lines {
+        if at := CommentStart(line); at >= 0 {
+            line = line[:at]
+        }
+        if i > 0 && !blank(line) && line[0] != ' ' {
+            starts = append(starts, i)
+        }
+    }
+    return starts
+}
+
+// a copy of g with its lines and comments moved down by delta lines
+func (g *GeneralBody) shifted(delta int) *GeneralBody {
+    body := &GeneralBody{children: make([]GeneralNode, len(g.children))}
+    for i, child := range g.children {
+        switch c := child.(type) {
+        case GeneralLine:
+            c.number += delta
+            body.children[i] = c
+        case *GeneralBody:
+            body.children[i] = c.shifted(delta)
+        }
+    }
+    if g.comments != nil {
+        body.comments = make([]*Comment, len(g.comments))
+        for i, c := range g.comments {
+            moved := *c
+            moved.Pos.Line += delta
+            body.comments[i] = &moved
+        }
+    }
+    return body
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+const incrementalSource = `use util::{double}
+// a shape
+type Shape = Circle (r: Int) | Dot
+
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Dot => 0
+
+fn main -> Int
+    Circle (r: 2) -> area // 12`
+
+func TestDocumentReuse(t *testing.T) {
+	d := NewDocument("a.ibex", incrementalSource)
+	before, err := d.Unit()
+	assert.Nil(t, err)
+
+	// within the body of main, the other declarations stay as they were
+	after, err := d.Edit(Pos{Line: 11, Col: 16}, Pos{Line: 11, Col: 17}, "3")
+	assert.Nil(t, err)
+	assert.True(t, before.Declarations[0] == after.Declarations[0])
+	assert.True(t, before.Declarations[1] == after.Declarations[1])
+	assert.True(t, before.Declarations[2] != after.Declarations[2])
+	assert.True(t, before.Uses[0] == after.Uses[0])
+	full, _ := ParseFile("a.ibex", d.Text())
+	assert.Equal(t, full, after)
+
+	// lines added above move the declarations below, which are parsed again
+	before = after
+	after, err = d.Edit(Pos{Line: 4, Col: 1}, Pos{Line: 4, Col: 1}, "\n\n")
+	assert.Nil(t, err)
+	assert.True(t, before.Declarations[0] == after.Declarations[0])
+	assert.True(t, before.Declarations[1] != after.Declarations[1])
+	assert.Equal(t, 7, after.Declarations[1].(*ASTFunction).Pos.Line)
+	full, _ = ParseFile("a.ibex", d.Text())
+	assert.Equal(t, full, after)
+
+	_, err = d.Edit(Pos{Line: 1, Col: 1}, Pos{Line: 1, Col: 100}, "")
+	assert.EqualError(t, err, "Position 1:100 is outside the document")
+	_, err = d.Edit(Pos{Line: 2, Col: 1}, Pos{Line: 1, Col: 1}, "")
+	assert.EqualError(t, err, "Edit ends at 1:1 before its start 2:1")
+}
+
+// what random edits insert, to make blocks, break them and join them
+var fragments = []string{
+	"\n", "\n    ", "\n        ", "  ", " ", "fn ", "type ", "use ", "pub ", "match ", "// c", "\"s\"",
+	"x", "Int", "->", "=>", " + 1", "(", ")", "|", ":", "::", "\nfn f -> Int\n    1",
+	"\ntype T = A | B", "\nuse m", "\n  // odd", "\n    Dot => 1",
+}
+
+// after every random edit the document gives what a full parse does
+func TestDocumentMatchesFullParse(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 50; round++ {
+		d := NewDocument("a.ibex", incrementalSource)
+		for step := 0; step < 40; step++ {
+			text := d.Text()
+			from := r.Intn(len(text) + 1)
+			to := from
+			if r.Intn(3) == 0 {
+				to += r.Intn(len(text) - from + 1)
+			}
+			insert := ""
+			if r.Intn(4) != 0 {
+				insert = fragments[r.Intn(len(fragments))]
+			}
+			unit, err := d.Edit(position(text, from), position(text, to), insert)
+			full, fullErr := ParseFile("a.ibex", d.Text())
+			if fullErr != nil {
+				if assert.Error(t, err, d.Text()) {
+					assert.Equal(t, fullErr.Error(), err.Error(), d.Text())
+				}
+				continue
+			}
+			assert.Nil(t, err, d.Text())
+			assert.Equal(t, full, unit, d.Text())
+		}
+	}
+}
+
+// the position of the index i in text
+func position(text string, i int) Pos {
+	line := strings.Count(text[:i], "\n") + 1
+	return Pos{Line: line, Col: i - strings.LastIndex(text[:i], "\n")}
+}
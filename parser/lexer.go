@@ -2,6 +2,7 @@ package parser
 
 import (
     "fmt"
+    "strings"
     "unicode/utf8"
 
 	"github.com/ibex-lang/ibex/util"
@@ -21,6 +22,8 @@ const (
     TokenMatch    // match
     TokenUse      // use
     TokenTypeKW   // type
+    TokenPub      // pub
+    TokenAs       // as
 
     TokenAdd // +
     TokenSub // -
@@ -28,15 +31,17 @@ const (
     TokenMul // *
     TokenMod // %
 
-    TokenBang   // !
-    TokenPipe   // |
+    TokenBang     // !
+    TokenQuestion // ?
+    TokenPipe     // |
     TokenDot    // .
     TokenComma  // ,
     TokenColon  // :
     TokenModSep // ::
 
-    TokenAssign // =
-    TokenArrow  // ->
+    TokenAssign   // =
+    TokenArrow    // ->
+    TokenFatArrow // =>
 
     TokenGT  // >
     TokenGTE // >=
@@ -49,29 +54,80 @@ const (
     TokenRBracket // ]
     TokenLParen // (
     TokenRParen // )
+    TokenLBrace // {
+    TokenRBrace // }
 )
 
+var tokenNames = [...]string{
+    "error", "EOF", "ident", "number", "string",
+    "fn", "match", "use", "type", "pub", "as",
+    "+", "-", "/", "*", "%",
+    "!", "?", "|", ".", ",", ":", "::",
+    "=", "->", "=>",
+    ">", ">=", "<", "<=", "==", "!=",
+    "[", "]", "(", ")", "{", "}",
+}
+
+func (t TokenType) String() string {
+    return tokenNames[t]
+}
+
+// whether t is an operator, as + or ->, rather than punctuation
+func (t TokenType) IsOperator() bool {
+    switch t {
+    case TokenDot, TokenComma, TokenColon, TokenModSep:
+        return false
+    }
+    return t >= TokenAdd && t <= TokenNE
+}
+
+// the words the lexer reads as keywords rather than identifiers, in the
+// order of their token types
+func Keywords() []string {
+    words := make([]string, 0, len(keywords))
+    for t := TokenFunction; t <= TokenAs; t++ {
+        words = append(words, t.String())
+    }
+    return words
+}
+
 var keywords map[string]TokenType = map[string]TokenType{
     "fn": TokenFunction,
     "match": TokenMatch,
     "use": TokenUse,
     "type": TokenTypeKW,
+    "pub": TokenPub,
+    "as": TokenAs,
 }
 
 type Token struct {
     Value string
     Ty    TokenType
-    Start int
+    Start int // columns within the source line
     End   int
+    Line  int
+    File  string
+}
+
+func (t *Token) Pos() Pos {
+    return Pos{t.File, t.Line, t.Start + 1}
 }
 
 type Lexer struct {
     src string
     start int
     pos int
-    tokens chan *Token
+    tokens []*Token // lexed by Run, those not taken yet
 
     peekTok *Token // LL(1)
+
+    file string
+    line int
+    offset int // indentation stripped by Blockify
+
+    // structure the line came from, so constructs like match can
+    // claim the block nested under it
+    s *Structure
 }
 
 func NewLexer(src string) *Lexer {
@@ -79,13 +135,14 @@ func NewLexer(src string) *Lexer {
         src: src,
         start: 0,
         pos: 0,
-        tokens: make(chan *Token),
+        tokens: make([]*Token, 0),
     }
 }
 
+// the next token, nil past the last one
 func (l *Lexer) NextToken() *Token {
     if l.peekTok == nil {
-        return <-l.tokens
+        return l.take()
     } else {
         tok := l.peekTok
         l.peekTok = nil
@@ -95,13 +152,22 @@ func (l *Lexer) NextToken() *Token {
 
 func (l *Lexer) PeekToken() *Token {
     if l.peekTok == nil {
-        l.peekTok = <-l.tokens
+        l.peekTok = l.take()
         return l.peekTok
     } else {
         return l.peekTok
     }
 }
 
+func (l *Lexer) take() *Token {
+    if len(l.tokens) == 0 {
+        return nil
+    }
+    tok := l.tokens[0]
+    l.tokens = l.tokens[1:]
+    return tok
+}
+
 func (l *Lexer) peek() rune {
     if l.pos < len(l.src) {
         chr, _ := utf8.DecodeRuneInString(l.src[l.pos:])
@@ -139,34 +205,38 @@ func (l *Lexer) acceptAny(runes string) bool {
 }
 
 func (l *Lexer) emitError(msg string) {
-    l.tokens <- &Token{
+    l.tokens = append(l.tokens, &Token{
         Value: msg,
         Ty: TokenError,
-        Start: l.start,
-        End: l.pos,
-    }
+        Start: l.offset + l.start,
+        End: l.offset + l.pos,
+        Line: l.line,
+        File: l.file,
+    })
     l.start = l.pos
 }
 
 func (l *Lexer) emitToken(ty TokenType) {
-    l.tokens <- &Token{
+    l.tokens = append(l.tokens, &Token{
         Value: l.src[l.start:l.pos],
         Ty: ty,
-        Start: l.start,
-        End: l.pos,
-    }
+        Start: l.offset + l.start,
+        End: l.offset + l.pos,
+        Line: l.line,
+        File: l.file,
+    })
     l.start = l.pos
 }
 
+// lexes the whole line, up to its EOF or to the first error, before
+// the tokens are taken; parsing that stops early leaves nothing running
 func (l *Lexer) Run() {
     for l.pos < len(l.src) {
         if !l.getToken() {
-            close(l.tokens)
             return
         }
     }
     l.emitToken(TokenEOF)
-    close(l.tokens)
 }
 
 // ret = success?
@@ -179,7 +249,14 @@ func (l *Lexer) getToken() bool {
         } else {
             l.emitToken(TokenSub)
         }
-    case '/': l.emitToken(TokenDiv)
+    case '/':
+        if l.accept('/') {
+            // a comment runs to the end of the line
+            l.pos = len(l.src)
+            l.start = l.pos
+        } else {
+            l.emitToken(TokenDiv)
+        }
     case '*': l.emitToken(TokenMul)
     case '%': l.emitToken(TokenMod)
 
@@ -189,6 +266,7 @@ func (l *Lexer) getToken() bool {
         } else {
             l.emitToken(TokenBang)
         }
+    case '?': l.emitToken(TokenQuestion)
     case '|': l.emitToken(TokenPipe)
     case '.': l.emitToken(TokenDot)
     case ',': l.emitToken(TokenComma)
@@ -214,6 +292,8 @@ func (l *Lexer) getToken() bool {
     case '=':
         if l.accept('=') {
             l.emitToken(TokenEQ)
+        } else if l.accept('>') {
+            l.emitToken(TokenFatArrow)
         } else {
             l.emitToken(TokenAssign)
         }
@@ -222,8 +302,10 @@ func (l *Lexer) getToken() bool {
     case ']': l.emitToken(TokenRBracket)
     case '(': l.emitToken(TokenLParen)
     case ')': l.emitToken(TokenRParen)
+    case '{': l.emitToken(TokenLBrace)
+    case '}': l.emitToken(TokenRBrace)
 
-    case '"': l.readString()
+    case '"': return l.readString()
 
     case ' ', '\n', '\r', '\t':
         l.start++
@@ -264,13 +346,49 @@ func (l *Lexer) readNumber() {
     l.emitToken(TokenNumber)
 }
 
-func (l *Lexer) readString() {
-    for l.read() != '"' {}
-    l.tokens <- &Token{
+// false if the line ends before the string
+func (l *Lexer) readString() bool {
+    for l.read() != '"' {
+        if l.pos >= len(l.src) {
+            l.emitError("Unterminated string")
+            return false
+        }
+    }
+    l.tokens = append(l.tokens, &Token{
         Value: l.src[l.start + 1:l.pos - 1],
         Ty: TokenString,
-        Start: l.start,
-        End: l.pos,
-    }
+        Start: l.offset + l.start,
+        End: l.offset + l.pos,
+        Line: l.line,
+        File: l.file,
+    })
     l.start = l.pos
+    return true
+}
+
+// LexFile gives the tokens of every line of src, with the positions
+// ParseFile records, followed by a single EOF. A token the lexer rejects
+// is returned as a ParseError.
+func LexFile(file string, src string) ([]*Token, error) {
+    tokens := make([]*Token, 0)
+    lines := strings.Split(src, "\n")
+    for i, line := range lines {
+        if blank(line) {
+            continue
+        }
+        indent, valid := indentDepth(line)
+        if !valid {
+            return nil, inFile(file, indentationError(i + 1, line, "Invalid indentation"))
+        }
+        lex := NewLexer(line[indent * IndentWidth:])
+        lex.file, lex.line, lex.offset = file, i + 1, indent * IndentWidth
+        lex.Run()
+        for tok := lex.NextToken(); tok != nil && tok.Ty != TokenEOF; tok = lex.NextToken() {
+            if tok.Ty == TokenError {
+                return nil, ErrorAtToken(tok, tok.Value)
+            }
+            tokens = append(tokens, tok)
+        }
+    }
+    return append(tokens, &Token{Ty: TokenEOF, Line: len(lines), File: file}), nil
 }
@@ -1,26 +1,28 @@
 package parser
 
 import (
+	"runtime"
 	"testing"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestLexerValid(t *testing.T) {
-	lexStr := "4172 \"test\" + - * / % () [] ! | . , : > >= < <= = == != -> identifier"
+	lexStr := "4172 \"test\" + - * / % () [] ! ? | . , : > >= < <= = == != -> => identifier"
 
 	lex := NewLexer(lexStr)
-	go lex.Run()
+	lex.Run()
 
 	values := []string{
 		"4172", "test", "+", "-", "*", "/", "%", "(", ")",
-		"[", "]", "!", "|", ".", ",", ":", ">", ">=", "<",
-		"<=", "=", "==", "!=", "->", "identifier"}
+		"[", "]", "!", "?", "|", ".", ",", ":", ">", ">=", "<",
+		"<=", "=", "==", "!=", "->", "=>", "identifier"}
 	types := []TokenType{
 		TokenNumber, TokenString, TokenAdd, TokenSub, TokenMul,
 		TokenDiv, TokenMod, TokenLParen, TokenRParen, TokenLBracket,
-		TokenRBracket, TokenBang, TokenPipe, TokenDot, TokenComma,
+		TokenRBracket, TokenBang, TokenQuestion, TokenPipe, TokenDot, TokenComma,
 		TokenColon, TokenGT, TokenGTE, TokenLT, TokenLTE,
-		TokenAssign, TokenEQ, TokenNE, TokenArrow, TokenIdent}
+		TokenAssign, TokenEQ, TokenNE, TokenArrow, TokenFatArrow,
+		TokenIdent}
 
 	for i, val := range(values) {
 		ty := types[i]
@@ -36,9 +38,36 @@ func TestLexerValid(t *testing.T) {
 
 func TestLexerInvalid(t *testing.T) {
 	lex := NewLexer("$")
-	go lex.Run()
+	lex.Run()
 
 	tok := lex.NextToken()
 
 	assert.Equal(t, TokenError, tok.Ty, "Expected error token")
 }
+
+func TestLexerUnterminatedString(t *testing.T) {
+	for _, src := range []string{"\"abc", "x \""} {
+		lex := NewLexer(src)
+		lex.Run()
+
+		tok := lex.NextToken()
+		for tok.Ty != TokenError && tok.Ty != TokenEOF {
+			tok = lex.NextToken()
+		}
+		assert.Equal(t, TokenError, tok.Ty, src)
+		assert.Equal(t, "Unterminated string", tok.Value)
+	}
+}
+
+// parses that stop at an error before the end of a line leave no lexing
+// behind
+func TestLexerNoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		_, err := ParseFile("a.ibex", "fn main -> Int\n    ) 1 2 3 4 5")
+		assert.Error(t, err)
+		_, err = LexFile("a.ibex", "x $ y z")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, before, runtime.NumGoroutine())
+}
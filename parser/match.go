@@ -0,0 +1,224 @@
+package parser
+
+// Tag, Tag (payload) or, as payload types are declared, Tag payload for
+// a name, literal or array literal with what postfix operators follow it:
+// Some xs[0] -> f is (Some (xs[0])) -> f
+// tok is the first token of the possibly qualified tag
+func parseConstructor(lex *Lexer, tok *Token, tag string) (Expression, error) {
+    switch lex.PeekToken().Ty {
+    case TokenLParen:
+        payload, err := ParseGrouping(lex, lex.NextToken())
+        if err != nil {
+            return nil, err
+        }
+        return ConstructorExpr{tag, payload, tok.Pos()}, nil
+    case TokenIdent, TokenNumber, TokenString, TokenLBracket:
+        payload, err := ParseExpressionP(PostfixPrecedence, lex)
+        if err != nil {
+            return nil, err
+        }
+        return ConstructorExpr{tag, payload, tok.Pos()}, nil
+    }
+    return ConstructorExpr{tag, nil, tok.Pos()}, nil
+}
+
+// match subject
+//     Pattern => expr
+//     Pattern =>
+//         body
+func ParseMatch(lex *Lexer, tok *Token) (Expression, error) {
+    subject, err := ParseExpression(lex)
+    if err != nil {
+        return nil, err
+    }
+
+    if lex.s == nil {
+        return nil, ErrorAtToken(tok, "Expected match arms")
+    }
+    block, exists := lex.s.getBlock()
+    if !exists {
+        return nil, ErrorAtToken(tok, "Expected match arms")
+    }
+
+    arms := []*MatchArm{}
+    armLex, next := block.getLine()
+    for next {
+        armLex.Run()
+
+        arm, err := parseMatchArm(armLex)
+        if err != nil {
+            return nil, err
+        }
+        arms = append(arms, arm)
+
+        armLex, next = block.getLine()
+    }
+    if err := block.end(); err != nil {
+        return nil, err
+    }
+
+    return MatchExpr{subject, arms, tok.Pos()}, nil
+}
+
+func parseMatchArm(lex *Lexer) (*MatchArm, error) {
+    pattern, err := parsePattern(lex)
+    if err != nil {
+        return nil, err
+    }
+
+    tok := lex.NextToken()
+    if tok.Ty != TokenFatArrow {
+        return nil, ErrorAtToken(tok, "Expected '=>'")
+    }
+
+    if lex.PeekToken().Ty == TokenEOF {
+        block, exists := lex.s.getBlock()
+        if !exists {
+            return nil, ErrorAtToken(lex.PeekToken(), "Expected expression")
+        }
+        body, err := parseBody(block)
+        if err != nil {
+            return nil, err
+        }
+        return &MatchArm{pattern, body}, nil
+    }
+
+    expr, err := ParseExpression(lex)
+    if err != nil {
+        return nil, err
+    }
+    if tok = lex.NextToken(); tok.Ty != TokenEOF {
+        return nil, ErrorAtToken(tok, "Unexpected token")
+    }
+    return &MatchArm{pattern, &ASTBody{[]ASTNode{expr}}}, nil
+}
+
+func ParsePattern(lex *Lexer) (Pattern, error) {
+    return parsePattern(lex)
+}
+
+func parsePattern(lex *Lexer) (Pattern, error) {
+    tok := lex.NextToken()
+    switch tok.Ty {
+
+    case TokenIdent:
+        return parseIdentPattern(tok, lex)
+
+    case TokenNumber, TokenString:
+        lit, err := prefixParsers[tok.Ty](lex, tok)
+        if err != nil {
+            return nil, err
+        }
+        return LiteralPattern{lit}, nil
+
+    case TokenSub:
+        num := lex.NextToken()
+        if num.Ty != TokenNumber {
+            return nil, ErrorAtToken(num, "Expected number")
+        }
+        return LiteralPattern{NegateExpr{NumberExpr{num.Value, num.Pos()}, tok.Pos()}}, nil
+
+    case TokenLParen:
+        return parseGroupingPattern(tok, lex)
+    }
+
+    return nil, ErrorAtToken(tok, "Expected pattern")
+}
+
+func parseIdentPattern(tok *Token, lex *Lexer) (Pattern, error) {
+    if tok.Value == "_" {
+        return WildcardPattern{tok.Pos()}, nil
+    }
+    name, _, err := parseQualifiedName(tok, lex)
+    if err != nil {
+        return nil, err
+    }
+    if !isTag(name) {
+        if name != tok.Value {
+            return nil, ErrorAtToken(tok, "Expected constructor")
+        }
+        return BindingPattern{name, tok.Pos()}, nil
+    }
+    // Tag p as well as Tag (p)
+    switch lex.PeekToken().Ty {
+    case TokenLParen, TokenIdent, TokenNumber, TokenString, TokenSub:
+    default:
+        return ConstructorPattern{name, nil, tok.Pos()}, nil
+    }
+    payload, err := parsePattern(lex)
+    if err != nil {
+        return nil, err
+    }
+    return ConstructorPattern{name, payload, tok.Pos()}, nil
+}
+
+// (p), (p, q) or (a: p, b: q), paren is the '('
+func parseGroupingPattern(paren *Token, lex *Lexer) (Pattern, error) {
+    tok := lex.PeekToken()
+    if tok.Ty == TokenIdent {
+        lex.NextToken()
+        if lex.PeekToken().Ty == TokenColon {
+            return parseNamedTuplePattern(paren, tok, lex)
+        }
+        first, err := parseIdentPattern(tok, lex)
+        if err != nil {
+            return nil, err
+        }
+        return parseTuplePattern(paren, first, lex)
+    }
+
+    first, err := parsePattern(lex)
+    if err != nil {
+        return nil, err
+    }
+    return parseTuplePattern(paren, first, lex)
+}
+
+func parseTuplePattern(paren *Token, first Pattern, lex *Lexer) (Pattern, error) {
+    elems := []Pattern{first}
+    tok := lex.NextToken()
+    for tok.Ty == TokenComma {
+        p, err := parsePattern(lex)
+        if err != nil {
+            return nil, err
+        }
+        elems = append(elems, p)
+        tok = lex.NextToken()
+    }
+
+    if tok.Ty != TokenRParen {
+        return nil, ErrorAtToken(tok, "Expected ')'")
+    }
+
+    if len(elems) == 1 {
+        return first, nil
+    }
+    return TuplePattern{elems, paren.Pos()}, nil
+}
+
+// tok is the first tag, the next token is its ':'
+func parseNamedTuplePattern(paren *Token, tok *Token, lex *Lexer) (Pattern, error) {
+    elems := []*NamedTuplePatternEntry{}
+    for {
+        if tok.Ty != TokenIdent {
+            return nil, ErrorAtToken(tok, "Expected identifier")
+        }
+        colon := lex.NextToken()
+        if colon.Ty != TokenColon {
+            return nil, ErrorAtToken(colon, "Expected ':'")
+        }
+        p, err := parsePattern(lex)
+        if err != nil {
+            return nil, err
+        }
+        elems = append(elems, &NamedTuplePatternEntry{tok.Value, p})
+
+        next := lex.NextToken()
+        if next.Ty == TokenRParen {
+            return NamedTuplePattern{elems, paren.Pos()}, nil
+        } else if next.Ty != TokenComma {
+            return nil, ErrorAtToken(next, "Expected ')'")
+        }
+        tok = lex.NextToken()
+    }
+}
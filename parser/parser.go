@@ -2,21 +2,23 @@ package parser
 
 import (
     "strings"
+    "strconv"
     "fmt"
-	"errors"
 
 	"github.com/ibex-lang/ibex/core"
+	"github.com/ibex-lang/ibex/util"
 )
 
-const indentWidth int = 4
+// spaces per level of indentation
+const IndentWidth int = 4
 
 func indentDepth(line string) (int, bool) {
     for i, c := range line {
         if c != ' ' {
-            return i / indentWidth, i % indentWidth == 0
+            return i / IndentWidth, i % IndentWidth == 0
         }
     }
-    return len(line) / indentWidth, len(line) % indentWidth == 0
+    return len(line) / IndentWidth, len(line) % IndentWidth == 0
 }
 
 // ugly algebraic types
@@ -26,19 +28,68 @@ type GeneralNode interface {
 
 type GeneralBody struct {
     children []GeneralNode
+    comments []*Comment // of the whole source, in the outermost body
 }
 func (g GeneralBody) isGeneral() {}
 
 type GeneralLine struct {
     line string
+    number int
+    indent int // in columns
 }
 func (g GeneralLine) isGeneral() {}
 
+// A comment runs from // outside a string to the end of the line.
+// Blockify strips comments and skips the lines left blank, they do not
+// end blocks.
+type Comment struct {
+    Pos Pos
+    Text string // from the //, without trailing spaces
+}
+
+// the index of the // starting a comment in line, -1 if there is none
+func CommentStart(line string) int {
+    quoted := false
+    for i := 0; i < len(line); i++ {
+        switch {
+        case line[i] == '"':
+            quoted = !quoted
+        case !quoted && strings.HasPrefix(line[i:], "//"):
+            return i
+        }
+    }
+    return -1
+}
+
+func blank(line string) bool {
+    return strings.TrimSpace(line) == ""
+}
+
 func Blockify(src string) (*GeneralBody, error) {
-    lines := strings.Split(src, "\n")
+    body, _, err := blockify(strings.Split(src, "\n"))
+    return body, err
+}
+
+// blockifies lines, telling whether it read them all: it stops at a line
+// indented by more than a level below one of the top level. The comments
+// are cut from lines.
+func blockify(lines []string) (*GeneralBody, bool, error) {
+    comments := make([]*Comment, 0)
+    for i, line := range lines {
+        if at := CommentStart(line); at >= 0 {
+            text := strings.TrimRight(line[at:], " \t\r")
+            comments = append(comments, &Comment{Pos{"", i + 1, at + 1}, text})
+            lines[i] = line[:at]
+        }
+    }
     idx := 0
 
-    return parseGeneral(&idx, 0, lines)
+    body, err := parseGeneral(&idx, 0, lines)
+    if err != nil {
+        return nil, false, err
+    }
+    body.comments = comments
+    return body, idx == len(lines), nil
 }
 
 func parseGeneral(idx *int, lvl int, lines []string) (*GeneralBody, error) {
@@ -46,14 +97,20 @@ func parseGeneral(idx *int, lvl int, lines []string) (*GeneralBody, error) {
 
     for *idx < len(lines) {
         line := lines[*idx]
+        if blank(line) {
+            *idx++
+            continue
+        }
         indent, valid := indentDepth(line)
 		if !valid {
-			return nil, errors.New("Invalid indentation")
+			return nil, indentationError(*idx + 1, line, "Invalid indentation")
 		}
 
         if indent == lvl {
             child := GeneralLine{
-                line: line[indent * indentWidth:],
+                line: line[indent * IndentWidth:],
+                number: *idx + 1,
+                indent: indent * IndentWidth,
             }
             body.children = append(body.children, child)
             *idx++
@@ -72,28 +129,88 @@ func parseGeneral(idx *int, lvl int, lines []string) (*GeneralBody, error) {
 }
 
 type ParseError struct {
+    file string
+    line int
     start int
     end int
     message string
 }
 
 func (e *ParseError) Error() string {
-    return fmt.Sprintf(
-        "Error at %d...%d: %s",
-        e.start, e.end, e.message)
+    return fmt.Sprintf("Error at %s...%d: %s", e.Pos(), e.EndCol(), e.message)
+}
+
+// the position of the first character the error is about
+func (e *ParseError) Pos() Pos {
+    return Pos{e.file, e.line, e.start + 1}
+}
+
+// the column after the last character the error is about
+func (e *ParseError) EndCol() int {
+    return e.end + 1
+}
+
+func (e *ParseError) Message() string {
+    return e.message
+}
+
+// an error at the indentation of the line numbered number, in no file
+// until one is given by inFile
+func indentationError(number int, line string, msg string) *ParseError {
+    spaces := len(line) - len(strings.TrimLeft(line, " "))
+    return &ParseError{line: number, start: 0, end: spaces, message: msg}
 }
 
+// err with file recorded, if it is a ParseError without one
+func inFile(file string, err error) error {
+    if e, ok := err.(*ParseError); ok && e.file == "" {
+        e.file = file
+    }
+    return err
+}
+
+// an error token tells what the lexer rejected better than msg can
 func ErrorAtToken(tok *Token, msg string) *ParseError {
+    if tok.Ty == TokenError {
+        msg = tok.Value
+    }
     return &ParseError{
+        file: tok.File,
+        line: tok.Line,
         start: tok.Start,
         end: tok.End,
         message: msg,
     }
 }
 
+// 1-based source position, File is empty unless parsed with ParseFile
+type Pos struct {
+    File string
+    Line int
+    Col int
+}
+
+func (p Pos) String() string {
+    if p.File != "" {
+        return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+    }
+    return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// the first line of g, which has one as blockify makes no empty bodies
+func (g *GeneralBody) first() GeneralLine {
+    switch c := g.children[0].(type) {
+    case GeneralLine:
+        return c
+    default:
+        return c.(*GeneralBody).first()
+    }
+}
+
 type Structure struct {
     idx int
     body *GeneralBody
+    file string
 }
 
 func NewStructure(body *GeneralBody) *Structure {
@@ -113,7 +230,12 @@ func (s *Structure) getLine() (*Lexer, bool) {
     switch child.(type) {
     case GeneralLine:
         s.idx++
-        lex := NewLexer(child.(GeneralLine).line)
+        line := child.(GeneralLine)
+        lex := NewLexer(line.line)
+        lex.file = s.file
+        lex.line = line.number
+        lex.offset = line.indent
+        lex.s = s
         return lex, true
     default:
         return nil, false
@@ -128,15 +250,31 @@ func (s *Structure) getBlock() (*Structure, bool) {
 
     child := s.body.children[s.idx]
     switch child.(type) {
-    case GeneralBody:
+    case *GeneralBody:
         s.idx++
-        b := child.(GeneralBody)
-        return NewStructure(&b), true
+        block := NewStructure(child.(*GeneralBody))
+        block.file = s.file
+        return block, true
     default:
         return nil, false
     }
 }
 
+// an error at the first line of the block after the last line or block
+// taken, which nothing parsing s took, nil at the end of s
+func (s *Structure) end() error {
+    if s.idx >= len(s.body.children) {
+        return nil
+    }
+    block, ok := s.body.children[s.idx].(*GeneralBody)
+    if !ok {
+        return nil
+    }
+    line := block.first()
+    err := indentationError(line.number, strings.Repeat(" ", line.indent), "Unexpected indentation")
+    return inFile(s.file, err)
+}
+
 type ParsingContext int
 
 const (
@@ -180,12 +318,16 @@ func parseType(lex *Lexer) (core.IbexType, error) {
         return parseIdentType(tok, lex)
 
     case TokenLParen:
-        tok = lex.NextToken()
+        if lex.PeekToken().Ty == TokenRParen {
+            lex.NextToken() // consume )
+            return core.IbexTupleType{[]core.IbexType{}}, nil
+        }
 
         namedTypes := make([]*core.IbexNamedTupleEntry, 0)
         normalTypes := make([]core.IbexType, 0)
         named := false
-        if tok.Ty == TokenIdent {
+        if lex.PeekToken().Ty == TokenIdent {
+            tok = lex.NextToken()
             if lex.PeekToken().Ty == TokenColon {
                 // named tuple
                 lex.NextToken() // consume :
@@ -254,53 +396,174 @@ func parseType(lex *Lexer) (core.IbexType, error) {
             return core.IbexTupleType{normalTypes}, nil
         }
 
+    case TokenQuestion:
+        ty, err := parseType(lex)
+        if err != nil {
+            return nil, err
+        }
+        return core.IbexSimpleType{Name: "Option", Args: []core.IbexType{ty}}, nil
+
     case TokenLBracket:
-        tok = lex.NextToken()
-        if tok.Ty != TokenRBracket {
-            return nil, ErrorAtToken(tok, "Expected ']'")
+        size, err := parseArraySize(lex)
+        if err != nil {
+            return nil, err
         }
-        dims := 1
+        sizes := []int{size}
         for lex.PeekToken().Ty == TokenLBracket {
             lex.NextToken() // consume [
-            tok = lex.NextToken()
-            if tok.Ty != TokenRBracket {
-               return nil, ErrorAtToken(tok, "Expected ']'")
+            size, err = parseArraySize(lex)
+            if err != nil {
+                return nil, err
             }
+            sizes = append(sizes, size)
         }
         ty, err := parseType(lex)
         if err != nil {
             return nil, err
         }
-        return core.IbexArrayType{ty, dims}, nil
+        return core.NewArrayType(ty, sizes), nil
     }
 
     return nil, ErrorAtToken(tok, "Unexpected token")
 }
 
+// after [, returns 0 for ] and n for n]
+func parseArraySize(lex *Lexer) (int, error) {
+    tok := lex.NextToken()
+    size := 0
+    if tok.Ty == TokenNumber {
+        n, err := strconv.Atoi(tok.Value)
+        if err != nil || n == 0 {
+            return 0, ErrorAtToken(tok, "Invalid array size")
+        }
+        size = n
+        tok = lex.NextToken()
+    }
+    if tok.Ty != TokenRBracket {
+        return 0, ErrorAtToken(tok, "Expected ']'")
+    }
+    return size, nil
+}
+
 func parseIdentType(tok *Token, lex *Lexer) (core.IbexType, error) {
     if tok == nil {
         tok = lex.NextToken()
     }
-    return core.IbexSimpleType{tok.Value}, nil
+    name, last, err := parseQualifiedName(tok, lex)
+    if err != nil {
+        return nil, err
+    }
+    if !applied(last, lex) {
+        return core.IbexSimpleType{Name: name}, nil
+    }
+
+    lex.NextToken() // consume [
+    args := make([]core.IbexType, 0)
+    for {
+        ty, err := parseType(lex)
+        if err != nil {
+            return nil, err
+        }
+        args = append(args, ty)
+
+        next := lex.NextToken()
+        if next.Ty == TokenRBracket {
+            break
+        } else if next.Ty != TokenComma {
+            return nil, ErrorAtToken(next, "Expected ']'")
+        }
+    }
+    return core.IbexSimpleType{Name: name, Args: args}, nil
+}
+
+// type arguments must directly follow the name, List[T], so that a
+// variant payload like `Wrap []Int` stays unambiguous
+func applied(name *Token, lex *Lexer) bool {
+    peek := lex.PeekToken()
+    return peek.Ty == TokenLBracket && peek.Start == name.End
+}
+
+// [T, U]
+func parseTypeParams(lex *Lexer) ([]string, error) {
+    params := make([]string, 0)
+    if lex.PeekToken().Ty != TokenLBracket {
+        return params, nil
+    }
+    lex.NextToken() // consume [
+
+    for {
+        tok := lex.NextToken()
+        if tok.Ty != TokenIdent {
+            return nil, ErrorAtToken(tok, "Expected type parameter")
+        }
+        params = append(params, tok.Value)
+
+        tok = lex.NextToken()
+        if tok.Ty == TokenRBracket {
+            return params, nil
+        } else if tok.Ty != TokenComma {
+            return nil, ErrorAtToken(tok, "Expected ']'")
+        }
+    }
 }
 
 func Parse(s *Structure) (*ASTCompilationUnit, error) {
     return parse(s)
 }
 
+// parses src, recording file in every position
+func ParseFile(file string, src string) (*ASTCompilationUnit, error) {
+    InitExpressionParsing()
+
+    body, err := Blockify(src)
+    if err != nil {
+        return nil, inFile(file, err)
+    }
+    s := NewStructure(body)
+    s.file = file
+    return parse(s)
+}
+
+// parses src as the lines of a function body, recording file in every
+// position
+func ParseBody(file string, src string) (*ASTBody, error) {
+    InitExpressionParsing()
+
+    body, err := Blockify(src)
+    if err != nil {
+        return nil, inFile(file, err)
+    }
+    s := NewStructure(body)
+    s.file = file
+    return parseBody(s)
+}
+
 func parse(s *Structure) (*ASTCompilationUnit, error) {
     unit := &ASTCompilationUnit{
         Uses: make([]*ASTUseStmt, 0),
         Declarations: make([]ASTMemberDeclaration, 0),
+        Comments: make([]*Comment, 0),
+    }
+    for _, c := range s.body.comments {
+        c.Pos.File = s.file
+        unit.Comments = append(unit.Comments, c)
     }
 
     lex, next := s.getLine()
     for next {
-        go lex.Run()
+        lex.Run()
 
         t := lex.NextToken()
+        public := t.Ty == TokenPub
+        if public {
+            t = lex.NextToken()
+            if t.Ty != TokenFunction && t.Ty != TokenTypeKW {
+                return nil, ErrorAtToken(t, "Expected 'fn' or 'type'")
+            }
+        }
+
         if t.Ty == TokenUse {
-            use, err := parseUseStmt(lex)
+            use, err := parseUseStmt(lex, t)
             if err != nil {
                 return nil, err
             }
@@ -310,36 +573,105 @@ func parse(s *Structure) (*ASTCompilationUnit, error) {
             if err != nil {
                 return nil, err
             }
+            fn.Public = public
             unit.Declarations = append(unit.Declarations, fn)
         } else if t.Ty == TokenTypeKW {
-            decl, err := parseTypeDecl(lex)
+            decl, err := parseTypeDecl(lex, s)
             if err != nil {
                 return nil, err
             }
+            decl.Public = public
             unit.Declarations = append(unit.Declarations, decl)
+        } else {
+            return nil, ErrorAtToken(t, "Expected 'fn', 'type' or 'use'")
         }
 
         lex, next = s.getLine()
     }
 
+    if err := s.end(); err != nil {
+        return nil, err
+    }
     return unit, nil
 }
 
-func parseUseStmt(lex *Lexer) (*ASTUseStmt, error) {
-    path := make([]string, 0)
+func parseUseStmt(lex *Lexer, use *Token) (*ASTUseStmt, error) {
+    stmt := &ASTUseStmt{Pos: use.Pos(), Path: make([]string, 0)}
 
     t := lex.NextToken()
-    for t.Ty != TokenEOF {
-        if t.Ty == TokenIdent {
-            path = append(path, t.Value)
-        } else if t.Ty != TokenModSep {
-            return nil, ErrorAtToken(t, "Unexpected token")
+    if t.Ty != TokenIdent {
+        return nil, ErrorAtToken(t, "Expected module name")
+    }
+    stmt.Path = append(stmt.Path, t.Value)
+    stmt.Alias = t.Value
+
+    for lex.PeekToken().Ty == TokenModSep {
+        lex.NextToken() // consume ::
+        t = lex.NextToken()
+        switch t.Ty {
+        case TokenIdent:
+            stmt.Path = append(stmt.Path, t.Value)
+            stmt.Alias = t.Value
+        case TokenLBrace:
+            items, err := parseUseItems(lex)
+            if err != nil {
+                return nil, err
+            }
+            stmt.Items = items
+            return stmt, expectEOF(lex)
+        case TokenMul:
+            stmt.Glob = true
+            return stmt, expectEOF(lex)
+        default:
+            return nil, ErrorAtToken(t, "Expected identifier, '{' or '*'")
         }
+    }
 
+    if lex.PeekToken().Ty == TokenAs {
+        lex.NextToken() // consume as
         t = lex.NextToken()
+        if t.Ty != TokenIdent {
+            return nil, ErrorAtToken(t, "Expected identifier")
+        }
+        stmt.Alias = t.Value
     }
 
-    return &ASTUseStmt{path}, nil
+    return stmt, expectEOF(lex)
+}
+
+// after {, x, y as z}
+func parseUseItems(lex *Lexer) ([]*UseItem, error) {
+    items := make([]*UseItem, 0)
+    for {
+        t := lex.NextToken()
+        if t.Ty != TokenIdent {
+            return nil, ErrorAtToken(t, "Expected identifier")
+        }
+        item := &UseItem{Pos: t.Pos(), Name: t.Value, Alias: t.Value}
+        if lex.PeekToken().Ty == TokenAs {
+            lex.NextToken() // consume as
+            alias := lex.NextToken()
+            if alias.Ty != TokenIdent {
+                return nil, ErrorAtToken(alias, "Expected identifier")
+            }
+            item.Alias = alias.Value
+        }
+        items = append(items, item)
+
+        t = lex.NextToken()
+        if t.Ty == TokenRBrace {
+            return items, nil
+        } else if t.Ty != TokenComma {
+            return nil, ErrorAtToken(t, "Expected '}'")
+        }
+    }
+}
+
+func expectEOF(lex *Lexer) error {
+    if t := lex.NextToken(); t.Ty != TokenEOF {
+        return ErrorAtToken(t, "Unexpected token")
+    }
+    return nil
 }
 
 func parseParameter(lex *Lexer) (*FunctionParameter, error) {
@@ -347,7 +679,7 @@ func parseParameter(lex *Lexer) (*FunctionParameter, error) {
     if tok.Ty != TokenIdent {
         return nil, ErrorAtToken(tok, "Expected identifier")
     }
-    name := tok.Value
+    name, pos := tok.Value, tok.Pos()
     tok = lex.NextToken()
 
     if tok.Ty != TokenColon {
@@ -357,7 +689,7 @@ func parseParameter(lex *Lexer) (*FunctionParameter, error) {
     if err != nil {
         return nil, err
     }
-    return &FunctionParameter{name, ty}, nil
+    return &FunctionParameter{name, ty, pos}, nil
 }
 
 func parseFunction(lex *Lexer, s *Structure) (*ASTFunction, error) {
@@ -366,6 +698,11 @@ func parseFunction(lex *Lexer, s *Structure) (*ASTFunction, error) {
         return nil, ErrorAtToken(ident, "Expected identifier")
     }
 
+    typeParams, err := parseTypeParams(lex)
+    if err != nil {
+        return nil, err
+    }
+
     params := make([]*FunctionParameter, 0)
     peek := lex.PeekToken()
     if peek.Ty == TokenIdent {
@@ -406,6 +743,10 @@ func parseFunction(lex *Lexer, s *Structure) (*ASTFunction, error) {
             return nil, err
         }
         retType = ty // doesn't compile without this!?
+        tok = lex.NextToken()
+    }
+    if tok.Ty != TokenEOF {
+        return nil, ErrorAtToken(tok, "Unexpected token")
     }
 
 	var body *ASTBody = nil
@@ -419,7 +760,9 @@ func parseFunction(lex *Lexer, s *Structure) (*ASTFunction, error) {
 	}
 
     fn := ASTFunction{
+        Pos: ident.Pos(),
         Name: ident.Value,
+        TypeParams: typeParams,
         Parameters: params,
         Return: retType,
         Body: body,
@@ -431,37 +774,204 @@ func parseBody(s *Structure) (*ASTBody, error) {
 	nodes := []ASTNode{}
 	lex, exist := s.getLine()
 	for exist {
-		go lex.Run()
+		lex.Run()
 
 		expr, err := ParseExpression(lex)
 		if err != nil {
 			return nil, err
 		}
+		if tok := lex.NextToken(); tok.Ty != TokenEOF {
+			return nil, ErrorAtToken(tok, "Unexpected token")
+		}
 		nodes = append(nodes, expr)
 
 		lex, exist = s.getLine()
 	}
 
+	if err := s.end(); err != nil {
+		return nil, err
+	}
 	return &ASTBody{nodes}, nil
 }
 
-func parseTypeDecl(lex *Lexer) (*ASTTypeDeclaration, error) {
+func parseTypeDecl(lex *Lexer, s *Structure) (*ASTTypeDeclaration, error) {
     ident := lex.NextToken()
     if ident.Ty != TokenIdent {
         return nil, ErrorAtToken(ident, "Expected identifier")
     }
 
+    params, err := parseTypeParams(lex)
+    if err != nil {
+        return nil, err
+    }
+
     tok := lex.NextToken()
     if tok.Ty != TokenAssign {
         return nil, ErrorAtToken(tok, "Expected '='")
     }
 
-    ty, err := parseType(lex)
+    ty, err := parseDeclaredType(lex, s)
     if err != nil {
         return nil, err
     }
 
-    decl := ASTTypeDeclaration{ident.Value, ty}
+    decl := ASTTypeDeclaration{
+        Pos: ident.Pos(),
+        Name: ident.Value,
+        Params: params,
+        Type: ty,
+    }
     return &decl, nil
 }
 
+// right hand side of a type declaration, the only place sum types
+// may appear:
+//     type Shape = Circle (r: F64) | Rect (w: F64, h: F64)
+// or with one case per line in the block below
+//     type Shape =
+//         | Circle (r: F64)
+//         | Rect (w: F64, h: F64)
+func parseDeclaredType(lex *Lexer, s *Structure) (core.IbexType, error) {
+    peek := lex.PeekToken()
+    switch peek.Ty {
+    case TokenEOF:
+        block, exists := s.getBlock()
+        if !exists {
+            return nil, ErrorAtToken(peek, "Expected type")
+        }
+        return parseVariantBlock(block)
+
+    case TokenPipe:
+        lex.NextToken() // consume |
+        return parseVariantType(lex)
+
+    case TokenIdent:
+        tok := lex.NextToken()
+        if lex.PeekToken().Ty == TokenEOF {
+            return parseIdentType(tok, lex)
+        }
+        if applied(tok, lex) || lex.PeekToken().Ty == TokenModSep {
+            ty, err := parseIdentType(tok, lex)
+            if err != nil {
+                return nil, err
+            }
+            if tok = lex.NextToken(); tok.Ty != TokenEOF {
+                return nil, ErrorAtToken(tok, "Unexpected token")
+            }
+            return ty, nil
+        }
+        variant := core.IbexVariantType{Cases: make([]*core.IbexVariantCase, 0)}
+        return parseVariantCases(tok, variant, lex)
+    }
+
+    ty, err := parseType(lex)
+    if err != nil {
+        return nil, err
+    }
+    if tok := lex.NextToken(); tok.Ty != TokenEOF {
+        return nil, ErrorAtToken(tok, "Unexpected token")
+    }
+    return ty, nil
+}
+
+func parseVariantType(lex *Lexer) (core.IbexType, error) {
+    tok := lex.NextToken()
+    variant := core.IbexVariantType{Cases: make([]*core.IbexVariantCase, 0)}
+    return parseVariantCases(tok, variant, lex)
+}
+
+// tok is the tag of the first case
+func parseVariantCases(tok *Token, variant core.IbexVariantType,
+    lex *Lexer) (core.IbexType, error) {
+
+    for {
+        c, err := parseVariantCase(tok, lex)
+        if err != nil {
+            return nil, err
+        }
+        variant.Cases = append(variant.Cases, c)
+
+        tok = lex.NextToken()
+        if tok.Ty == TokenEOF {
+            return variant, nil
+        } else if tok.Ty != TokenPipe {
+            return nil, ErrorAtToken(tok, "Expected '|'")
+        }
+        tok = lex.NextToken()
+    }
+}
+
+func parseVariantCase(tag *Token, lex *Lexer) (*core.IbexVariantCase, error) {
+    if tag.Ty != TokenIdent || !isTag(tag.Value) {
+        return nil, ErrorAtToken(tag, "Expected variant tag")
+    }
+
+    var payload core.IbexType = nil
+    peek := lex.PeekToken()
+    if peek.Ty != TokenPipe && peek.Ty != TokenEOF {
+        ty, err := parseType(lex)
+        if err != nil {
+            return nil, err
+        }
+        // B (1) constructs B with the payload 1, as (1) is 1
+        if t, ok := ty.(core.IbexTupleType); ok && len(t.ElementTypes) == 1 {
+            return nil, ErrorAtToken(peek, "A payload of one type takes no parentheses, write " +
+                tag.Value + " " + core.TypeString(t.ElementTypes[0]))
+        }
+        payload = ty
+    }
+
+    return &core.IbexVariantCase{Tag: tag.Value, Payload: payload}, nil
+}
+
+func parseVariantBlock(s *Structure) (core.IbexType, error) {
+    variant := core.IbexVariantType{Cases: make([]*core.IbexVariantCase, 0)}
+
+    lex, next := s.getLine()
+    for next {
+        lex.Run()
+
+        tok := lex.NextToken()
+        if tok.Ty != TokenPipe {
+            return nil, ErrorAtToken(tok, "Expected '|'")
+        }
+        c, err := parseVariantCase(lex.NextToken(), lex)
+        if err != nil {
+            return nil, err
+        }
+        if tok = lex.NextToken(); tok.Ty != TokenEOF {
+            return nil, ErrorAtToken(tok, "Unexpected token")
+        }
+        variant.Cases = append(variant.Cases, c)
+
+        lex, next = s.getLine()
+    }
+
+    if err := s.end(); err != nil {
+        return nil, err
+    }
+    return variant, nil
+}
+
+// variant tags and constructors are capitalized, also when qualified
+func isTag(ident string) bool {
+    if i := strings.LastIndex(ident, "::"); i >= 0 {
+        ident = ident[i + 2:]
+    }
+    return ident != "" && util.IsUpper(rune(ident[0]))
+}
+
+// a::b::c after its first segment tok, returns the joined name and the
+// token of the last segment
+func parseQualifiedName(tok *Token, lex *Lexer) (string, *Token, error) {
+    name := tok.Value
+    for lex.PeekToken().Ty == TokenModSep {
+        lex.NextToken() // consume ::
+        tok = lex.NextToken()
+        if tok.Ty != TokenIdent {
+            return "", nil, ErrorAtToken(tok, "Expected identifier")
+        }
+        name += "::" + tok.Value
+    }
+    return name, tok, nil
+}
@@ -3,6 +3,8 @@ package parser
 import (
 	"testing"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/core"
 )
 
 func TestBlockify(t *testing.T) {
@@ -44,3 +46,255 @@ f`
 	assert.IsType(t, lineType, body.children[2])
 	assert.Equal(t, "f", body.children[2].(GeneralLine).line)
 }
+
+func TestIndentationErrors(t *testing.T) {
+	_, err := ParseFile("a.ibex", "fn f -> Int\n  1")
+	assert.EqualError(t, err, "Error at a.ibex:2:1...3: Invalid indentation")
+	assert.Equal(t, Pos{"a.ibex", 2, 1}, err.(*ParseError).Pos())
+
+	_, err = ParseBody("b.ibex", "1\n    2")
+	assert.EqualError(t, err, "Error at b.ibex:2:1...5: Unexpected indentation")
+
+	_, err = LexFile("c.ibex", "x\n   y")
+	assert.EqualError(t, err, "Error at c.ibex:2:1...4: Invalid indentation")
+}
+
+func TestComments(t *testing.T) {
+	unit, err := ParseFile("c.ibex", `// leading
+fn main -> Int // trailing
+    1 + 2
+
+  // odd indentation
+    "a // b" -> f`)
+	assert.Nil(t, err)
+
+	fn := unit.Declarations[0].(*ASTFunction)
+	assert.Len(t, fn.Body.Children, 2)
+	assert.Equal(t, FunctionCallExpr{StringExpr{"a // b", Pos{"c.ibex", 6, 5}}, IdentExpr{"f", Pos{"c.ibex", 6, 17}}, Pos{"c.ibex", 6, 14}},
+		fn.Body.Children[1])
+	assert.Equal(t, []*Comment{
+		{Pos{"c.ibex", 1, 1}, "// leading"},
+		{Pos{"c.ibex", 2, 16}, "// trailing"},
+		{Pos{"c.ibex", 5, 3}, "// odd indentation"},
+	}, unit.Comments)
+
+	tokens, err := LexFile("", "x / y // z\n  \n")
+	assert.Nil(t, err)
+	assert.Len(t, tokens, 4)
+}
+
+func parseSource(t *testing.T, src string) *ASTCompilationUnit {
+	InitExpressionParsing()
+
+	body, err := Blockify(src)
+	assert.Nil(t, err)
+	unit, err := Parse(NewStructure(body))
+	assert.Nil(t, err)
+	return unit
+}
+
+func TestParseVariantType(t *testing.T) {
+	unit := parseSource(t, `type Shape = Circle (r: F64) | Rect (w: F64, h: F64) | Empty
+type Option =
+    | Some T
+    | None
+type Alias = Int`)
+
+	assert.Len(t, unit.Declarations, 3)
+
+	shape := unit.Declarations[0].(*ASTTypeDeclaration)
+	assert.Equal(t, "Shape", shape.Name)
+	f64 := core.IbexSimpleType{Name: "F64"}
+	assert.Equal(t, core.IbexVariantType{[]*core.IbexVariantCase{
+		{"Circle", core.IbexNamedTupleType{[]*core.IbexNamedTupleEntry{
+			{"r", f64}}}},
+		{"Rect", core.IbexNamedTupleType{[]*core.IbexNamedTupleEntry{
+			{"w", f64}, {"h", f64}}}},
+		{"Empty", nil},
+	}}, shape.Type)
+
+	option := unit.Declarations[1].(*ASTTypeDeclaration)
+	assert.Equal(t, core.IbexVariantType{[]*core.IbexVariantCase{
+		{"Some", core.IbexSimpleType{Name: "T"}},
+		{"None", nil},
+	}}, option.Type)
+
+	alias := unit.Declarations[2].(*ASTTypeDeclaration)
+	assert.Equal(t, core.IbexSimpleType{Name: "Int"}, alias.Type)
+
+	body, _ := Blockify("type T = A | B (Int)")
+	_, err := Parse(NewStructure(body))
+	assert.EqualError(t, err, "Error at 1:16...17: A payload of one type takes no parentheses, write B Int")
+}
+
+func TestParseMatch(t *testing.T) {
+	unit := parseSource(t, `fn area s: Shape -> F64
+    match s
+        Circle (r: r) => r * r * 3
+        Rect (w: w, h: _) =>
+            w * 2
+        Empty => 0`)
+
+	fn := unit.Declarations[0].(*ASTFunction)
+	assert.Len(t, fn.Body.Children, 1)
+	match := fn.Body.Children[0].(MatchExpr)
+	assert.Equal(t, IdentExpr{"s", Pos{Line: 2, Col: 11}}, match.Subject)
+	assert.Len(t, match.Arms, 3)
+
+	assert.Equal(t, ConstructorPattern{"Circle", NamedTuplePattern{
+		[]*NamedTuplePatternEntry{{"r", BindingPattern{"r", Pos{Line: 3, Col: 20}}}}, Pos{Line: 3, Col: 16}},
+		Pos{Line: 3, Col: 9}},
+		match.Arms[0].Pattern)
+	assert.Len(t, match.Arms[0].Body.Children, 1)
+
+	assert.Equal(t, ConstructorPattern{"Rect", NamedTuplePattern{
+		[]*NamedTuplePatternEntry{
+			{"w", BindingPattern{"w", Pos{Line: 4, Col: 18}}}, {"h", WildcardPattern{Pos{Line: 4, Col: 24}}}}, Pos{Line: 4, Col: 14}},
+		Pos{Line: 4, Col: 9}},
+		match.Arms[1].Pattern)
+	assert.Equal(t, MulExpr{IdentExpr{"w", Pos{Line: 5, Col: 13}}, NumberExpr{"2", Pos{Line: 5, Col: 17}},
+		Pos{Line: 5, Col: 15}},
+		match.Arms[1].Body.Children[0])
+
+	assert.Equal(t, ConstructorPattern{"Empty", nil, Pos{Line: 6, Col: 9}}, match.Arms[2].Pattern)
+}
+
+func TestParseConstructor(t *testing.T) {
+	InitExpressionParsing()
+
+	lex := NewLexer("Rect (w: 1, h: 2)")
+	lex.Run()
+	expr, err := ParseExpression(lex)
+	assert.Nil(t, err)
+	assert.Equal(t, ConstructorExpr{"Rect", NamedTupleExpr{[]*NamedTupleEntry{
+		{"w", NumberExpr{"1", Pos{Col: 10}}}, {"h", NumberExpr{"2", Pos{Col: 16}}}}, Pos{Col: 6}}, Pos{Col: 1}}, expr)
+
+	lex = NewLexer("None")
+	lex.Run()
+	expr, err = ParseExpression(lex)
+	assert.Nil(t, err)
+	assert.Equal(t, ConstructorExpr{"None", nil, Pos{Col: 1}}, expr)
+
+	// bare payloads as declared, Circle Int, bind tighter than infix operators
+	lex = NewLexer("Some xs[0] -> f")
+	lex.Run()
+	expr, err = ParseExpression(lex)
+	assert.Nil(t, err)
+	assert.Equal(t, FunctionCallExpr{
+		ConstructorExpr{"Some", ArrayAccessExpr{IdentExpr{"xs", Pos{Col: 6}}, NumberExpr{"0", Pos{Col: 9}}, Pos{Col: 8}},
+			Pos{Col: 1}},
+		IdentExpr{"f", Pos{Col: 15}}, Pos{Col: 12}}, expr)
+
+	lex = NewLexer("Circle r")
+	lex.Run()
+	pattern, err := ParsePattern(lex)
+	assert.Nil(t, err)
+	assert.Equal(t, ConstructorPattern{"Circle", BindingPattern{"r", Pos{Col: 8}}, Pos{Col: 1}}, pattern)
+}
+
+func TestParseGenerics(t *testing.T) {
+	unit := parseSource(t, `type List[T] = Nil | Cons (head: T, tail: List[T])
+type Ints = List[Int]
+type Wrap = Wrap []Int
+fn map[T, U] (xs: List[T], f: fn T -> U) -> List[U]`)
+
+	list := unit.Declarations[0].(*ASTTypeDeclaration)
+	assert.Equal(t, []string{"T"}, list.Params)
+	listT := core.IbexSimpleType{Name: "List", Args: []core.IbexType{
+		core.IbexSimpleType{Name: "T"}}}
+	assert.Equal(t, listT, list.Type.(core.IbexVariantType).Cases[1].Payload.(core.IbexNamedTupleType).Types[1].Type)
+
+	ints := unit.Declarations[1].(*ASTTypeDeclaration)
+	assert.Equal(t, core.IbexSimpleType{Name: "List", Args: []core.IbexType{
+		core.IbexSimpleType{Name: "Int"}}}, ints.Type)
+
+	wrap := unit.Declarations[2].(*ASTTypeDeclaration)
+	assert.Equal(t, core.IbexArrayType{core.IbexSimpleType{Name: "Int"}, 1, nil},
+		wrap.Type.(core.IbexVariantType).Cases[0].Payload)
+
+	fn := unit.Declarations[3].(*ASTFunction)
+	assert.Equal(t, []string{"T", "U"}, fn.TypeParams)
+	assert.Len(t, fn.Parameters, 2)
+	assert.Equal(t, listT, fn.Parameters[0].Type)
+}
+
+func TestParseOption(t *testing.T) {
+	unit := parseSource(t, `fn get (xs: []?Int, i: Int) -> Int
+    xs[i] ? xs[0]!`)
+
+	fn := unit.Declarations[0].(*ASTFunction)
+	assert.Equal(t, core.IbexArrayType{core.IbexSimpleType{Name: "Option",
+		Args: []core.IbexType{core.IbexSimpleType{Name: "Int"}}}, 1, nil},
+		fn.Parameters[0].Type)
+
+	assert.Equal(t, DefaultExpr{
+		ArrayAccessExpr{IdentExpr{"xs", Pos{Line: 2, Col: 5}},
+			IdentExpr{"i", Pos{Line: 2, Col: 8}}, Pos{Line: 2, Col: 7}},
+		UnsafeAccessExpr{ArrayAccessExpr{IdentExpr{"xs", Pos{Line: 2, Col: 13}}, NumberExpr{"0", Pos{Line: 2, Col: 16}},
+			Pos{Line: 2, Col: 15}}, Pos{Line: 2, Col: 18}},
+		Pos{Line: 2, Col: 11},
+	}, fn.Body.Children[0])
+}
+
+func TestParseArrays(t *testing.T) {
+	unit := parseSource(t, `fn f (a: [][]Int, b: [3][4]Int) -> [2]Int
+    [a[0, 1], b[2][3]]`)
+
+	fn := unit.Declarations[0].(*ASTFunction)
+	intType := core.IbexSimpleType{Name: "Int"}
+	assert.Equal(t, core.IbexArrayType{intType, 2, nil}, fn.Parameters[0].Type)
+	assert.Equal(t, core.IbexArrayType{intType, 2, []int{3, 4}}, fn.Parameters[1].Type)
+	assert.Equal(t, core.IbexArrayType{intType, 1, []int{2}}, fn.Return)
+
+	assert.Equal(t, ArrayExpr{[]Expression{
+		ArrayAccessExpr{ArrayAccessExpr{IdentExpr{"a", Pos{Line: 2, Col: 6}}, NumberExpr{"0", Pos{Line: 2, Col: 8}}, Pos{Line: 2, Col: 7}},
+			NumberExpr{"1", Pos{Line: 2, Col: 11}}, Pos{Line: 2, Col: 7}},
+		ArrayAccessExpr{ArrayAccessExpr{IdentExpr{"b", Pos{Line: 2, Col: 15}}, NumberExpr{"2", Pos{Line: 2, Col: 17}}, Pos{Line: 2, Col: 16}},
+			NumberExpr{"3", Pos{Line: 2, Col: 20}}, Pos{Line: 2, Col: 19}},
+	}, Pos{Line: 2, Col: 5}}, fn.Body.Children[0])
+}
+
+func TestParsePub(t *testing.T) {
+	unit := parseSource(t, `pub fn f x: Int -> Int
+fn g x: Int -> Int
+pub type T = Int`)
+
+	assert.True(t, unit.Declarations[0].(*ASTFunction).Public)
+	assert.False(t, unit.Declarations[1].(*ASTFunction).Public)
+	assert.True(t, unit.Declarations[2].(*ASTTypeDeclaration).Public)
+	assert.Equal(t, Pos{Line: 3, Col: 10}, unit.Declarations[2].(*ASTTypeDeclaration).Pos)
+
+	body, _ := Blockify("pub use a")
+	_, err := Parse(NewStructure(body))
+	assert.EqualError(t, err, "Error at 1:5...8: Expected 'fn' or 'type'")
+}
+
+func TestParseUse(t *testing.T) {
+	unit := parseSource(t, `use a::b::c
+use a::b as d
+use a::b::{x, Y as Z}
+use a::*`)
+
+	assert.Equal(t, &ASTUseStmt{Pos: Pos{Line: 1, Col: 1}, Path: []string{"a", "b", "c"},
+		Alias: "c"}, unit.Uses[0])
+	assert.Equal(t, "d", unit.Uses[1].Alias)
+	assert.Equal(t, []*UseItem{
+		{Pos{Line: 3, Col: 12}, "x", "x"},
+		{Pos{Line: 3, Col: 15}, "Y", "Z"},
+	}, unit.Uses[2].Items)
+	assert.Equal(t, []string{"a"}, unit.Uses[3].Path)
+	assert.True(t, unit.Uses[3].Glob)
+
+	for src, msg := range map[string]string{
+		"use a b ::::":     "Error at 1:7...8: Unexpected token",
+		"use a::::b":       "Error at 1:8...10: Expected identifier, '{' or '*'",
+		"use a::{x y}":     "Error at 1:11...12: Expected '}'",
+		"use a::* as b":    "Error at 1:10...12: Unexpected token",
+		"use a::{}":        "Error at 1:9...10: Expected identifier",
+		"use a as":         "Error at 1:9...9: Expected identifier",
+	} {
+		body, _ := Blockify(src)
+		_, err := Parse(NewStructure(body))
+		assert.EqualError(t, err, msg, src)
+	}
+}
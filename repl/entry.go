@@ -0,0 +1,70 @@
+package repl
+
+import (
+    "strings"
+
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// Entry gathers the lines of one input. A line opening a block, as a fn
+// declaration or a match, continues the input until an empty line, and
+// the lines so far must keep to the indentation rules of
+// parser.Blockify.
+type Entry struct {
+    lines []string
+    block bool
+}
+
+// adds a line, giving whether the entry is complete. An error drops the
+// lines so far.
+func (e *Entry) Add(line string) (bool, error) {
+    blank := strings.TrimSpace(line) == ""
+    if blank && (e.block || len(e.lines) == 0) {
+        return len(e.lines) > 0, nil
+    }
+    e.lines = append(e.lines, line)
+    if _, err := parser.Blockify(e.Source()); err != nil {
+        e.Reset()
+        return false, err
+    }
+    e.block = e.block || opensBlock(line)
+    return !e.block, nil
+}
+
+// whether no line was added since the last reset
+func (e *Entry) Empty() bool {
+    return len(e.lines) == 0
+}
+
+func (e *Entry) Source() string {
+    return strings.Join(e.lines, "\n")
+}
+
+func (e *Entry) Reset() {
+    e.lines, e.block = nil, false
+}
+
+// whether lines indented below line may follow: it declares a function,
+// matches, or ends with the = of a type declaration with a case per line
+func opensBlock(line string) bool {
+    tokens, err := parser.LexFile("", line)
+    if err != nil {
+        return false
+    }
+    tokens = tokens[:len(tokens) - 1] // EOF
+    if len(tokens) > 1 && tokens[0].Ty == parser.TokenPub {
+        tokens = tokens[1:]
+    }
+    if len(tokens) == 0 {
+        return false
+    }
+    if tokens[0].Ty == parser.TokenFunction {
+        return true
+    }
+    for _, tok := range tokens {
+        if tok.Ty == parser.TokenMatch {
+            return true
+        }
+    }
+    return tokens[len(tokens) - 1].Ty == parser.TokenAssign
+}
@@ -0,0 +1,213 @@
+package repl
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/interp"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// the file name of the root module the entries are gathered in, modules
+// are looked up relative to it
+const rootFile = "<repl>"
+
+// Session evaluates entries one at a time. An entry is either an
+// expression, run as the body of a function without parameters, or use
+// statements and declarations, which every later entry sees. Declaring
+// a name again replaces the declaration.
+type Session struct {
+    roots []string
+    uses []*parser.ASTUseStmt
+    decls []parser.ASTMemberDeclaration
+    history []string
+}
+
+// roots are where used modules are searched, see loader.Loader
+func NewSession(roots []string) *Session {
+    return &Session{roots: roots}
+}
+
+// the source of every entry so far, in order
+func (s *Session) History() []string {
+    return s.history
+}
+
+// Result of an entry: the value of an expression with its inferred type,
+// or what a declaring entry declared
+type Result struct {
+    Value interp.Value
+    Type core.IbexType // nil if the entry declared
+    Declared []string // one line per use and declaration
+    Warnings []*check.Warning // about the entry
+}
+
+func (r *Result) String() string {
+    if r.Type == nil {
+        return strings.Join(r.Declared, "\n")
+    }
+    return interp.Format(r.Value) + " : " + core.TypeString(r.Type)
+}
+
+// evaluates an entry, as Entry gathers it. Positions in errors and
+// warnings are in the file <input n> for the nth entry. An entry that
+// fails leaves the declarations as they were.
+func (s *Session) Eval(src string) (*Result, error) {
+    s.history = append(s.history, src)
+    file := fmt.Sprintf("<input %d>", len(s.history))
+    if declares(src) {
+        return s.declare(file, src)
+    }
+    return s.evaluate(file, src)
+}
+
+// whether src starts with use, fn, type or pub
+func declares(src string) bool {
+    tokens, err := parser.LexFile("", strings.SplitN(src, "\n", 2)[0])
+    if err != nil {
+        return false
+    }
+    switch tokens[0].Ty {
+    case parser.TokenUse, parser.TokenFunction, parser.TokenTypeKW, parser.TokenPub:
+        return true
+    }
+    return false
+}
+
+func (s *Session) declare(file string, src string) (*Result, error) {
+    unit, err := parser.ParseFile(file, src)
+    if err != nil {
+        return nil, err
+    }
+
+    uses := make([]*parser.ASTUseStmt, 0, len(s.uses) + len(unit.Uses))
+    for _, use := range s.uses {
+        if !usedAgain(use, unit.Uses) {
+            uses = append(uses, use)
+        }
+    }
+    uses = append(uses, unit.Uses...)
+    decls := make([]parser.ASTMemberDeclaration, 0, len(s.decls) + len(unit.Declarations))
+    for _, d := range s.decls {
+        if !declaredAgain(d, unit.Declarations) {
+            decls = append(decls, d)
+        }
+    }
+    decls = append(decls, unit.Declarations...)
+
+    _, info, err := s.check(uses, decls)
+    if err != nil {
+        return nil, err
+    }
+    s.uses, s.decls = uses, decls
+
+    // imports and functions are only used by later entries, so they are
+    // not reported
+    later := make(map[parser.Pos]bool)
+    r := &Result{}
+    for _, use := range unit.Uses {
+        later[use.Pos] = true
+        for _, item := range use.Items {
+            later[item.Pos] = true
+        }
+        r.Declared = append(r.Declared, "use " + strings.Join(use.Path, "::"))
+    }
+    for _, d := range unit.Declarations {
+        switch d := d.(type) {
+        case *parser.ASTFunction:
+            later[d.Pos] = true
+            r.Declared = append(r.Declared, d.Name + " : " + core.TypeString(info.Functions[d.Name]))
+        case *parser.ASTTypeDeclaration:
+            name := d.Name
+            if len(d.Params) > 0 {
+                name += "[" + strings.Join(d.Params, ", ") + "]"
+            }
+            r.Declared = append(r.Declared, "type " + name + " = " + core.TypeString(info.Types[d.Name]))
+        }
+    }
+    for _, w := range info.Warnings {
+        if w.Pos.File == file && !later[w.Pos] {
+            r.Warnings = append(r.Warnings, w)
+        }
+    }
+    return r, nil
+}
+
+func (s *Session) evaluate(file string, src string) (*Result, error) {
+    body, err := parser.ParseBody(file, src)
+    if err != nil {
+        return nil, err
+    }
+    // named after the file so that it can collide with no declaration,
+    // public as the session calls it
+    fn := &parser.ASTFunction{
+        Public: true,
+        Pos: parser.Pos{File: file, Line: 1, Col: 1},
+        Name: file,
+        Parameters: make([]*parser.FunctionParameter, 0),
+        Body: body,
+    }
+    decls := append(append(make([]parser.ASTMemberDeclaration, 0, len(s.decls) + 1), s.decls...), fn)
+
+    mods, info, err := s.check(s.uses, decls)
+    if err != nil {
+        return nil, err
+    }
+    value, err := interp.New(mods, info).Call(fn.Name, interp.Unit)
+    if err != nil {
+        return nil, err
+    }
+    r := &Result{Value: value, Type: info.Inferred[fn.Name]}
+    for _, w := range info.Warnings {
+        if w.Pos.File == file {
+            r.Warnings = append(r.Warnings, w)
+        }
+    }
+    return r, nil
+}
+
+func (s *Session) check(uses []*parser.ASTUseStmt,
+    decls []parser.ASTMemberDeclaration) ([]*loader.Module, *check.Info, error) {
+
+    l := loader.NewLoader(s.roots)
+    unit := &parser.ASTCompilationUnit{Uses: uses, Declarations: decls}
+    if _, err := l.LoadUnit(rootFile, unit); err != nil {
+        return nil, nil, err
+    }
+    info, err := check.CheckModules(l.Modules())
+    if err != nil {
+        return nil, nil, err
+    }
+    return l.Modules(), info, nil
+}
+
+func usedAgain(use *parser.ASTUseStmt, uses []*parser.ASTUseStmt) bool {
+    path := strings.Join(use.Path, "::")
+    for _, u := range uses {
+        if strings.Join(u.Path, "::") == path {
+            return true
+        }
+    }
+    return false
+}
+
+// whether decls declare the function or type d declares, the names of
+// types and functions do not clash
+func declaredAgain(d parser.ASTMemberDeclaration, decls []parser.ASTMemberDeclaration) bool {
+    for _, other := range decls {
+        switch d := d.(type) {
+        case *parser.ASTFunction:
+            if fn, ok := other.(*parser.ASTFunction); ok && fn.Name == d.Name {
+                return true
+            }
+        case *parser.ASTTypeDeclaration:
+            if ty, ok := other.(*parser.ASTTypeDeclaration); ok && ty.Name == d.Name {
+                return true
+            }
+        }
+    }
+    return false
+}
@@ -0,0 +1,91 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+)
+
+// feeds the lines to an entry, giving the source of each completed one
+func entries(t *testing.T, lines ...string) []string {
+	var e Entry
+	done := make([]string, 0)
+	for _, line := range lines {
+		complete, err := e.Add(line)
+		assert.Nil(t, err)
+		if complete {
+			done = append(done, e.Source())
+			e.Reset()
+		}
+	}
+	assert.True(t, e.Empty())
+	return done
+}
+
+func TestEntry(t *testing.T) {
+	assert.Equal(t, []string{"1 + 2", "(3, 4)"}, entries(t, "", "1 + 2", "(3, 4)"))
+	assert.Equal(t, []string{"fn double x: Int -> Int\n    x * 2", "2 -> double"},
+		entries(t, "fn double x: Int -> Int", "    x * 2", "", "2 -> double"))
+	assert.Equal(t, []string{"match 3\n    0 => 1\n    n => n", "type Shape =\n    | Dot\n    | Line (len: Int)"},
+		entries(t, "match 3", "    0 => 1", "    n => n", "", "type Shape =", "    | Dot", "    | Line (len: Int)", ""))
+
+	var e Entry
+	e.Add("fn f -> Int")
+	_, err := e.Add("  1")
+	assert.EqualError(t, err, "Error at 2:1...3: Invalid indentation")
+	assert.True(t, e.Empty())
+}
+
+func TestSession(t *testing.T) {
+	s := NewSession(nil)
+	eval := func(src string) string {
+		r, err := s.Eval(src)
+		if err != nil {
+			return err.Error()
+		}
+		return r.String()
+	}
+
+	assert.Equal(t, "3 : Int", eval("1 + 2"))
+	assert.Equal(t, "type Shape = Circle (r: Int) | Empty", eval("type Shape = Circle (r: Int) | Empty"))
+	assert.Equal(t, "area : fn Shape -> Int", eval(`fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Empty => 0`))
+	assert.Equal(t, "([12, 0], None) : ([2]Int, Option[()])", eval("([Circle (r: 2) -> area, Empty -> area], None)"))
+	assert.Equal(t, "type Pair[T] = (T, T)", eval("type Pair[T] = (T, T)"))
+
+	// an entry failing to check is rolled back, a new declaration replaces
+	assert.Equal(t, "<input 6>:2:5: In fn area: Type mismatch: expected Int, found String", eval("fn area s: Shape -> Int\n    \"big\""))
+	assert.Equal(t, "3 : Int", eval("Circle (r: 1) -> area"))
+	assert.Equal(t, "area : fn Shape -> String", eval("fn area s: Shape -> String\n    \"big\""))
+	assert.Equal(t, "\"big\" : String", eval("Empty -> area"))
+
+	assert.Equal(t, "Runtime error: Division by zero\n    in fn <input 10> at <input 10>:1:3", eval("1 / 0"))
+	assert.Equal(t, "Error at <input 11>:1:5...7: Unterminated string", eval("1 + \"a"))
+	assert.Equal(t, 11, len(s.History()))
+	assert.Equal(t, "1 + 2", s.History()[0])
+}
+
+func TestSessionModules(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "util.ibex"), []byte("pub fn double x: Int -> Int\n    x * 2"), 0644))
+	s := NewSession([]string{dir})
+
+	r, err := s.Eval("use util")
+	assert.Nil(t, err)
+	assert.Equal(t, "use util", r.String())
+	assert.Equal(t, 0, len(r.Warnings))
+
+	r, err = s.Eval("21 -> util::double")
+	assert.Nil(t, err)
+	assert.Equal(t, "42 : Int", r.String())
+
+	_, err = s.Eval("use nowhere")
+	assert.True(t, strings.Contains(err.Error(), "Cannot find module nowhere"), err)
+	r, err = s.Eval("1 -> util::double")
+	assert.Nil(t, err)
+	assert.Equal(t, "2 : Int", r.String())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/interp"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+// diagnostic is an error or warning as -errors json prints it, one per
+// line. Positions are 1-based and left out when unknown.
+type diagnostic struct {
+    Severity string `json:"severity"` // error or warning
+    // read, write, syntax, import, type, runtime or compile
+    Kind string `json:"kind"`
+    File string `json:"file,omitempty"`
+    Line int `json:"line,omitempty"`
+    Column int `json:"column,omitempty"`
+    EndColumn int `json:"endColumn,omitempty"`
+    Message string `json:"message"`
+    Trace []frame `json:"trace,omitempty"` // of runtime errors, innermost call first
+}
+
+type frame struct {
+    Function string `json:"function"`
+    File string `json:"file,omitempty"`
+    Line int `json:"line"`
+    Column int `json:"column"`
+    Repeats int `json:"repeats,omitempty"` // further frames like this one, collapsed into it
+}
+
+func (c *cli) emit(d *diagnostic, text string) {
+    if c.errors == "json" {
+        b, _ := json.Marshal(d)
+        fmt.Fprintf(c.stderr, "%s\n", b)
+    } else {
+        fmt.Fprintln(c.stderr, text)
+    }
+}
+
+// reports err about file, kind is used unless the error tells better,
+// and gives the exit status for it
+func (c *cli) fail(kind string, file string, err error) int {
+    d := &diagnostic{Severity: "error", Kind: kind, File: file, Message: err.Error()}
+    switch e := err.(type) {
+    case *parser.ParseError:
+        pos := e.Pos()
+        d.Kind, d.File, d.Line, d.Column, d.EndColumn = "syntax", pos.File, pos.Line, pos.Col, e.EndCol()
+        d.Message = e.Message()
+    case *fs.PathError:
+        // files are read and written, an error opening one is either
+        if kind != "write" {
+            d.Kind = "read"
+        }
+    case *check.TypeError:
+        d.Kind = "type"
+        if pos := e.Pos(); pos.Line != 0 {
+            d.File, d.Line, d.Column, d.Message = pos.File, pos.Line, pos.Col, e.Message()
+        }
+    case *loader.NotFoundError:
+        d.Kind = "import"
+        if e.Pos.Line != 0 {
+            d.File, d.Line, d.Column, d.Message = e.Pos.File, e.Pos.Line, e.Pos.Col, e.Message()
+        }
+    case *loader.CycleError:
+        d.Kind = "import"
+    case *interp.RuntimeError:
+        d.Kind, d.Message = "runtime", e.Message
+        for _, f := range e.Trace {
+            d.Trace = append(d.Trace, frame{f.Function, f.Pos.File, f.Pos.Line, f.Pos.Col, f.Repeats})
+        }
+    }
+    c.emit(d, err.Error())
+    return exitFailed
+}
+
+func (c *cli) warn(w *check.Warning) {
+    c.emit(&diagnostic{
+        Severity: "warning",
+        Kind: "type",
+        File: w.Pos.File,
+        Line: w.Pos.Line,
+        Column: w.Pos.Col,
+        Message: w.Message,
+    }, "Warning: " + w.String())
+}
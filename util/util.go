@@ -16,3 +16,7 @@ func IsIdentStart(chr rune) bool {
 func IsIdentChar(chr rune) bool {
     return IsAlpha(chr) || IsDigit(chr) || chr == '_'
 }
+
+func IsUpper(chr rune) bool {
+    return chr >= 'A' && chr <= 'Z'
+}
@@ -0,0 +1,138 @@
+package vm
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/ibex-lang/ibex/interp"
+    "github.com/ibex-lang/ibex/parser"
+)
+
+type Op byte
+
+// Instructions are one opcode byte followed by its operands, each a big
+// endian uint16: an index into the constant pool, a local slot, a count,
+// a function or a code offset to jump to.
+const (
+    OpConst Op = iota // const
+    OpUnit
+    OpLoad  // slot
+    OpStore // slot
+    OpPop
+
+    OpAdd
+    OpSub
+    OpMul
+    OpDiv // traps
+    OpMod // traps
+    OpNeg
+    OpNot
+    OpEq
+
+    OpTuple      // count
+    OpNamedTuple // const, the tags
+    OpArray      // count
+    OpIndex      // traps
+    OpElem       // index, of a tuple or named tuple
+    OpField      // const, the tag of a named tuple field
+
+    OpVariant        // const, the tag
+    OpVariantPayload // const, the tag
+    OpHasTag         // const, the tag
+    OpPayload
+    OpUnwrap  // traps on None
+    OpDefault // offset, taken with the payload on Some
+
+    OpJump      // offset
+    OpJumpFalse // offset
+    OpNoMatch   // traps
+
+    OpClosure // function
+    OpCall    // traps on overflow
+    OpReturn
+)
+
+var opNames = [...]string{
+    "const", "unit", "load", "store", "pop",
+    "add", "sub", "mul", "div", "mod", "neg", "not", "eq",
+    "tuple", "namedtuple", "array", "index", "elem", "field",
+    "variant", "variantpayload", "hastag", "payload", "unwrap", "default",
+    "jump", "jumpfalse", "nomatch",
+    "closure", "call", "return",
+}
+
+var opOperands = [OpReturn + 1]int{
+    OpConst: 1, OpLoad: 1, OpStore: 1,
+    OpTuple: 1, OpNamedTuple: 1, OpArray: 1, OpElem: 1, OpField: 1,
+    OpVariant: 1, OpVariantPayload: 1, OpHasTag: 1, OpDefault: 1,
+    OpJump: 1, OpJumpFalse: 1, OpClosure: 1,
+}
+
+func (op Op) String() string {
+    return opNames[op]
+}
+
+// Function is the compiled form of one Ibex function
+type Function struct {
+    Name string // canonical, see check.Canonical
+    Params []string // bound to the first local slots
+    Locals int // slots including the parameters
+    Code []byte
+    Pos map[int]parser.Pos // of the instructions that trap or call, by offset
+}
+
+// Program is a compiled program, its functions share one constant pool
+type Program struct {
+    Functions []*Function
+    Index map[string]int // functions by canonical name
+    Constants []interp.Value
+}
+
+// Closure is the runtime value of a function. Ibex has no nested
+// functions yet, so closures never capture anything.
+type Closure struct {
+    Function *Function
+}
+
+func (f *Function) emit(op Op, operands ...int) int {
+    at := len(f.Code)
+    f.Code = append(f.Code, byte(op))
+    for _, operand := range operands {
+        f.Code = append(f.Code, byte(operand >> 8), byte(operand))
+    }
+    return at
+}
+
+func (f *Function) operand(at int) int {
+    return int(f.Code[at]) << 8 | int(f.Code[at + 1])
+}
+
+// points the jump at offset at to the end of the code
+func (f *Function) patch(at int) {
+    target := len(f.Code)
+    f.Code[at + 1], f.Code[at + 2] = byte(target >> 8), byte(target)
+}
+
+// lists the instructions of f, one per line
+func (p *Program) Disassemble(f *Function) string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "fn %s (%d locals)\n", f.Name, f.Locals)
+    for ip := 0; ip < len(f.Code); {
+        op := Op(f.Code[ip])
+        fmt.Fprintf(&b, "%4d %s", ip, op)
+        for i := 0; i < opOperands[op]; i++ {
+            n := f.operand(ip + 1 + 2 * i)
+            switch op {
+            case OpConst, OpNamedTuple, OpField, OpVariant, OpVariantPayload, OpHasTag:
+                fmt.Fprintf(&b, " %d (%s)", n, interp.Format(p.Constants[n]))
+            case OpClosure:
+                fmt.Fprintf(&b, " %d (%s)", n, p.Functions[n].Name)
+            default:
+                fmt.Fprintf(&b, " %d", n)
+            }
+        }
+        b.WriteString("\n")
+        ip += 1 + 2 * opOperands[op]
+    }
+    return b.String()
+}
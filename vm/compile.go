@@ -0,0 +1,364 @@
+package vm
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/ibex-lang/ibex/check"
+    "github.com/ibex-lang/ibex/loader"
+    "github.com/ibex-lang/ibex/parser"
+    "github.com/ibex-lang/ibex/interp"
+)
+
+// operands are uint16
+const maxOperand = 0xffff
+
+// the local slots of the names of one block, a function body or a match arm
+type locals struct {
+    slots map[string]int
+    parent *locals
+}
+
+func (l *locals) lookup(name string) int {
+    for ; l != nil; l = l.parent {
+        if slot, ok := l.slots[name]; ok {
+            return slot
+        }
+    }
+    return -1
+}
+
+type compiler struct {
+    program *Program
+    info *check.Info
+    fn *Function
+    scope *locals
+    constants map[interp.Value]int // pooled ints and strings
+}
+
+// compiles a checked program, every function of mods becomes one
+// Function of the program
+func Compile(mods []*loader.Module, info *check.Info) (*Program, error) {
+    c := &compiler{
+        program: &Program{Index: make(map[string]int)},
+        info: info,
+        constants: make(map[interp.Value]int),
+    }
+
+    bodies := make([]*parser.ASTFunction, 0)
+    for _, m := range mods {
+        for _, d := range m.Unit.Declarations {
+            fn, ok := d.(*parser.ASTFunction)
+            if !ok {
+                continue
+            }
+            f := &Function{Name: check.Canonical(m, fn.Name), Pos: make(map[int]parser.Pos)}
+            for _, p := range fn.Parameters {
+                f.Params = append(f.Params, p.Name)
+            }
+            c.program.Index[f.Name] = len(c.program.Functions)
+            c.program.Functions = append(c.program.Functions, f)
+            bodies = append(bodies, fn)
+        }
+    }
+
+    for i, fn := range bodies {
+        if fn.Body == nil {
+            continue
+        }
+        if err := c.compileFunction(c.program.Functions[i], fn); err != nil {
+            return nil, err
+        }
+    }
+    if len(c.program.Constants) > maxOperand {
+        return nil, fmt.Errorf("Too many constants")
+    }
+    return c.program, nil
+}
+
+func (c *compiler) compileFunction(f *Function, fn *parser.ASTFunction) error {
+    c.fn = f
+    c.scope = &locals{make(map[string]int), nil}
+    for _, p := range f.Params {
+        c.scope.slots[p] = c.newSlot()
+    }
+
+    if err := c.compileBody(fn.Body); err != nil {
+        return err
+    }
+    f.emit(OpReturn)
+
+    if len(f.Code) > maxOperand || f.Locals > maxOperand {
+        return fmt.Errorf("fn %s is too large", f.Name)
+    }
+    return nil
+}
+
+func (c *compiler) newSlot() int {
+    c.fn.Locals++
+    return c.fn.Locals - 1
+}
+
+func (c *compiler) constant(v interp.Value) int {
+    switch v.(type) {
+    case int64, string:
+        if i, ok := c.constants[v]; ok {
+            return i
+        }
+        c.constants[v] = len(c.program.Constants)
+    }
+    c.program.Constants = append(c.program.Constants, v)
+    return len(c.program.Constants) - 1
+}
+
+// records the position an instruction traps at
+func (c *compiler) at(op Op, pos parser.Pos, operands ...int) {
+    c.fn.Pos[c.fn.emit(op, operands...)] = pos
+}
+
+// the value of a body is the value of its last line
+func (c *compiler) compileBody(body *parser.ASTBody) error {
+    if len(body.Children) == 0 {
+        c.fn.emit(OpUnit)
+        return nil
+    }
+    for i, node := range body.Children {
+        if err := c.compileExpr(node); err != nil {
+            return err
+        }
+        if i < len(body.Children) - 1 {
+            c.fn.emit(OpPop)
+        }
+    }
+    return nil
+}
+
+func (c *compiler) compileExpr(expr parser.Expression) error {
+    switch e := expr.(type) {
+    case parser.IdentExpr:
+        if sym := c.info.Symbols[e.Pos]; sym.Kind == check.SymbolFunction {
+            c.fn.emit(OpClosure, c.program.Index[sym.Name])
+        } else {
+            c.fn.emit(OpLoad, c.scope.lookup(e.Ident))
+        }
+
+    case parser.StringExpr:
+        c.fn.emit(OpConst, c.constant(e.String))
+
+    case parser.NumberExpr:
+        n, err := strconv.ParseInt(e.Number, 10, 64)
+        if err != nil {
+            return fmt.Errorf("Invalid number %s", e.Number)
+        }
+        c.fn.emit(OpConst, c.constant(n))
+
+    case parser.NotExpr:
+        return c.compileUnary(e.Expr, OpNot)
+    case parser.NegateExpr:
+        return c.compileUnary(e.Expr, OpNeg)
+
+    case parser.AddExpr:
+        return c.compileBinary(e.Left, e.Right, OpAdd, parser.Pos{})
+    case parser.SubExpr:
+        return c.compileBinary(e.Left, e.Right, OpSub, parser.Pos{})
+    case parser.MulExpr:
+        return c.compileBinary(e.Left, e.Right, OpMul, parser.Pos{})
+    case parser.DivExpr:
+        return c.compileBinary(e.Left, e.Right, OpDiv, e.Pos)
+    case parser.ModExpr:
+        return c.compileBinary(e.Left, e.Right, OpMod, e.Pos)
+    case parser.FunctionCallExpr:
+        return c.compileBinary(e.Input, e.Target, OpCall, e.Pos)
+    case parser.ArrayAccessExpr:
+        return c.compileBinary(e.Target, e.Index, OpIndex, e.Pos)
+
+    case parser.ArrayExpr:
+        if err := c.compileAll(e.Elements); err != nil {
+            return err
+        }
+        c.fn.emit(OpArray, len(e.Elements))
+
+    case parser.TupleExpr:
+        if err := c.compileAll(e.Elements); err != nil {
+            return err
+        }
+        c.fn.emit(OpTuple, len(e.Elements))
+
+    case parser.NamedTupleExpr:
+        tags := make([]string, len(e.Elements))
+        for i, elem := range e.Elements {
+            if err := c.compileExpr(elem.Expr); err != nil {
+                return err
+            }
+            tags[i] = elem.Tag
+        }
+        c.fn.emit(OpNamedTuple, c.constant(tags))
+
+    case parser.ConstructorExpr:
+        tag := c.constant(unqualified(e.Tag))
+        if e.Payload == nil {
+            c.fn.emit(OpVariant, tag)
+            return nil
+        }
+        if err := c.compileExpr(e.Payload); err != nil {
+            return err
+        }
+        c.fn.emit(OpVariantPayload, tag)
+
+    case parser.MatchExpr:
+        return c.compileMatch(e)
+
+    case parser.UnsafeAccessExpr:
+        if err := c.compileExpr(e.Expr); err != nil {
+            return err
+        }
+        c.at(OpUnwrap, e.Pos)
+
+    case parser.DefaultExpr:
+        if err := c.compileExpr(e.Expr); err != nil {
+            return err
+        }
+        jump := c.fn.emit(OpDefault, 0)
+        if err := c.compileExpr(e.Default); err != nil {
+            return err
+        }
+        c.fn.patch(jump)
+
+    default:
+        return fmt.Errorf("Unsupported expression %T", expr)
+    }
+    return nil
+}
+
+func (c *compiler) compileAll(exprs []parser.Expression) error {
+    for _, expr := range exprs {
+        if err := c.compileExpr(expr); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *compiler) compileUnary(expr parser.Expression, op Op) error {
+    if err := c.compileExpr(expr); err != nil {
+        return err
+    }
+    c.fn.emit(op)
+    return nil
+}
+
+// a zero pos marks operations that cannot trap
+func (c *compiler) compileBinary(left, right parser.Expression, op Op,
+    pos parser.Pos) error {
+
+    if err := c.compileAll([]parser.Expression{left, right}); err != nil {
+        return err
+    }
+    if pos == (parser.Pos{}) {
+        c.fn.emit(op)
+    } else {
+        c.at(op, pos)
+    }
+    return nil
+}
+
+// The subject is kept in a local slot. Each arm tests its pattern against
+// it and jumps to the next arm on the first failing test, with nothing
+// left on the stack.
+func (c *compiler) compileMatch(e parser.MatchExpr) error {
+    if err := c.compileExpr(e.Subject); err != nil {
+        return err
+    }
+    subject := c.newSlot()
+    c.fn.emit(OpStore, subject)
+
+    ends := make([]int, 0)
+    for _, arm := range e.Arms {
+        c.scope = &locals{make(map[string]int), c.scope}
+        fails := make([]int, 0)
+        if err := c.compilePattern(arm.Pattern, subject, &fails); err != nil {
+            return err
+        }
+        if err := c.compileBody(arm.Body); err != nil {
+            return err
+        }
+        ends = append(ends, c.fn.emit(OpJump, 0))
+        for _, fail := range fails {
+            c.fn.patch(fail)
+        }
+        c.scope = c.scope.parent
+    }
+
+    c.fn.emit(OpLoad, subject)
+    c.at(OpNoMatch, e.Pos)
+    for _, end := range ends {
+        c.fn.patch(end)
+    }
+    return nil
+}
+
+// tests the value in slot against p, adding the jumps taken when it does
+// not match to fails
+func (c *compiler) compilePattern(p parser.Pattern, slot int, fails *[]int) error {
+    switch p := p.(type) {
+    case parser.WildcardPattern:
+
+    case parser.BindingPattern:
+        c.scope.slots[p.Name] = slot
+
+    case parser.LiteralPattern:
+        c.fn.emit(OpLoad, slot)
+        if err := c.compileExpr(p.Literal); err != nil {
+            return err
+        }
+        c.fn.emit(OpEq)
+        *fails = append(*fails, c.fn.emit(OpJumpFalse, 0))
+
+    case parser.ConstructorPattern:
+        c.fn.emit(OpLoad, slot)
+        c.fn.emit(OpHasTag, c.constant(unqualified(p.Tag)))
+        *fails = append(*fails, c.fn.emit(OpJumpFalse, 0))
+        if p.Payload != nil {
+            c.fn.emit(OpLoad, slot)
+            c.fn.emit(OpPayload)
+            return c.compileSubpattern(p.Payload, fails)
+        }
+
+    case parser.TuplePattern:
+        for i, elem := range p.Elements {
+            c.fn.emit(OpLoad, slot)
+            c.fn.emit(OpElem, i)
+            if err := c.compileSubpattern(elem, fails); err != nil {
+                return err
+            }
+        }
+
+    case parser.NamedTuplePattern:
+        for _, entry := range p.Elements {
+            c.fn.emit(OpLoad, slot)
+            c.fn.emit(OpField, c.constant(entry.Tag))
+            if err := c.compileSubpattern(entry.Pattern, fails); err != nil {
+                return err
+            }
+        }
+
+    default:
+        return fmt.Errorf("Unsupported pattern %T", p)
+    }
+    return nil
+}
+
+// matches the value on top of the stack in a slot of its own
+func (c *compiler) compileSubpattern(p parser.Pattern, fails *[]int) error {
+    slot := c.newSlot()
+    c.fn.emit(OpStore, slot)
+    return c.compilePattern(p, slot, fails)
+}
+
+func unqualified(tag string) string {
+    if i := strings.LastIndex(tag, "::"); i >= 0 {
+        return tag[i + 2:]
+    }
+    return tag
+}
@@ -0,0 +1,276 @@
+package vm
+
+import (
+    "fmt"
+
+    "github.com/ibex-lang/ibex/interp"
+)
+
+// a call deeper than this is reported as a stack overflow
+const maxDepth = 10000
+
+type frame struct {
+    fn *Function
+    ip int
+    at int // offset of the instruction being executed
+    base int // of the local slots on the stack
+}
+
+// VM runs compiled programs, the locals of every frame and the
+// operands of the frame on top share one stack
+type VM struct {
+    program *Program
+    stack []interp.Value
+    frames []frame
+}
+
+func New(p *Program) *VM {
+    return &VM{program: p}
+}
+
+// runs fn main, the value of main is the result
+func Run(p *Program) (interp.Value, error) {
+    i, ok := p.Index["main"]
+    if !ok {
+        return nil, fmt.Errorf("No fn main")
+    }
+    if len(p.Functions[i].Params) != 0 {
+        return nil, fmt.Errorf("fn main must not take parameters")
+    }
+    return New(p).Call("main", interp.Unit)
+}
+
+// calls the function with canonical name like interp.Interpreter.Call
+func (vm *VM) Call(name string, arg interp.Value) (interp.Value, error) {
+    i, ok := vm.program.Index[name]
+    if !ok {
+        return nil, fmt.Errorf("Unknown fn %s", name)
+    }
+    vm.stack, vm.frames = vm.stack[:0], vm.frames[:0]
+    if err := vm.enter(vm.program.Functions[i], arg); err != nil {
+        return nil, err
+    }
+    v, err := vm.run()
+    if err != nil {
+        return nil, err
+    }
+    return export(v), nil
+}
+
+func (vm *VM) push(v interp.Value) {
+    vm.stack = append(vm.stack, v)
+}
+
+func (vm *VM) pop() interp.Value {
+    v := vm.stack[len(vm.stack) - 1]
+    vm.stack = vm.stack[:len(vm.stack) - 1]
+    return v
+}
+
+// pushes a frame for fn, binding arg like interp does
+func (vm *VM) enter(fn *Function, arg interp.Value) error {
+    if fn.Code == nil {
+        return vm.fail("fn %s has no body", fn.Name)
+    }
+    if len(vm.frames) == maxDepth {
+        return vm.fail("Stack overflow")
+    }
+
+    base := len(vm.stack)
+    for i := 0; i < fn.Locals; i++ {
+        vm.stack = append(vm.stack, nil)
+    }
+    switch len(fn.Params) {
+    case 0:
+    case 1:
+        vm.stack[base] = arg
+    default:
+        for i, p := range fn.Params {
+            switch a := arg.(type) {
+            case interp.Tuple:
+                vm.stack[base + i] = a[i]
+            case interp.NamedTuple:
+                vm.stack[base + i], _ = a.Field(p)
+            }
+        }
+    }
+
+    vm.frames = append(vm.frames, frame{fn: fn, base: base})
+    return nil
+}
+
+func (vm *VM) fail(format string, args ...interface{}) *interp.RuntimeError {
+    trace := make([]interp.Frame, len(vm.frames))
+    for i, f := range vm.frames {
+        trace[len(vm.frames) - 1 - i] = interp.Frame{Function: f.fn.Name, Pos: f.fn.Pos[f.at]}
+    }
+    return &interp.RuntimeError{Message: fmt.Sprintf(format, args...), Trace: interp.Collapse(trace)}
+}
+
+func (vm *VM) run() (interp.Value, error) {
+    constants := vm.program.Constants
+    for {
+        f := &vm.frames[len(vm.frames) - 1]
+        code := f.fn.Code
+        f.at = f.ip
+        op := Op(code[f.ip])
+        f.ip++
+
+        operand := 0
+        if opOperands[op] > 0 {
+            operand = int(code[f.ip]) << 8 | int(code[f.ip + 1])
+            f.ip += 2
+        }
+
+        switch op {
+        case OpConst:
+            vm.push(constants[operand])
+        case OpUnit:
+            vm.push(interp.Unit)
+        case OpLoad:
+            vm.push(vm.stack[f.base + operand])
+        case OpStore:
+            vm.stack[f.base + operand] = vm.pop()
+        case OpPop:
+            vm.pop()
+
+        case OpAdd:
+            r := vm.pop().(int64)
+            vm.stack[len(vm.stack) - 1] = vm.stack[len(vm.stack) - 1].(int64) + r
+        case OpSub:
+            r := vm.pop().(int64)
+            vm.stack[len(vm.stack) - 1] = vm.stack[len(vm.stack) - 1].(int64) - r
+        case OpMul:
+            r := vm.pop().(int64)
+            vm.stack[len(vm.stack) - 1] = vm.stack[len(vm.stack) - 1].(int64) * r
+        case OpDiv, OpMod:
+            r := vm.pop().(int64)
+            if r == 0 {
+                return nil, vm.fail("Division by zero")
+            }
+            l := vm.stack[len(vm.stack) - 1].(int64)
+            if op == OpDiv {
+                vm.stack[len(vm.stack) - 1] = l / r
+            } else {
+                vm.stack[len(vm.stack) - 1] = l % r
+            }
+        case OpNeg:
+            vm.stack[len(vm.stack) - 1] = -vm.stack[len(vm.stack) - 1].(int64)
+        case OpNot:
+            vm.stack[len(vm.stack) - 1] = !vm.stack[len(vm.stack) - 1].(bool)
+        case OpEq:
+            r := vm.pop()
+            vm.stack[len(vm.stack) - 1] = vm.stack[len(vm.stack) - 1] == r
+
+        case OpTuple:
+            vm.push(interp.Tuple(vm.popN(operand)))
+        case OpArray:
+            vm.push(interp.Array(vm.popN(operand)))
+        case OpNamedTuple:
+            tags := constants[operand].([]string)
+            vm.push(interp.NamedTuple{Tags: tags, Values: vm.popN(len(tags))})
+        case OpIndex:
+            index := vm.pop().(int64)
+            array := vm.pop().(interp.Array)
+            if index < 0 || index >= int64(len(array)) {
+                return nil, vm.fail("Index %d is out of range for an array of length %d",
+                    index, len(array))
+            }
+            vm.push(array[index])
+        case OpElem:
+            switch t := vm.pop().(type) {
+            case interp.Tuple:
+                vm.push(t[operand])
+            case interp.NamedTuple:
+                vm.push(t.Values[operand])
+            }
+        case OpField:
+            field, _ := vm.pop().(interp.NamedTuple).Field(constants[operand].(string))
+            vm.push(field)
+
+        case OpVariant:
+            vm.push(interp.Variant{Tag: constants[operand].(string)})
+        case OpVariantPayload:
+            payload := vm.pop()
+            vm.push(interp.Variant{Tag: constants[operand].(string), Payload: payload})
+        case OpHasTag:
+            vm.push(vm.pop().(interp.Variant).Tag == constants[operand].(string))
+        case OpPayload:
+            vm.push(vm.pop().(interp.Variant).Payload)
+        case OpUnwrap:
+            opt := vm.pop().(interp.Variant)
+            if opt.Tag == "None" {
+                return nil, vm.fail("Unwrapped None")
+            }
+            vm.push(opt.Payload)
+        case OpDefault:
+            if opt := vm.pop().(interp.Variant); opt.Tag == "Some" {
+                vm.push(opt.Payload)
+                f.ip = operand
+            }
+
+        case OpJump:
+            f.ip = operand
+        case OpJumpFalse:
+            if !vm.pop().(bool) {
+                f.ip = operand
+            }
+        case OpNoMatch:
+            return nil, vm.fail("No arm matches %s", interp.Format(export(vm.pop())))
+
+        case OpClosure:
+            vm.push(&Closure{vm.program.Functions[operand]})
+        case OpCall:
+            target := vm.pop().(*Closure)
+            if err := vm.enter(target.Function, vm.pop()); err != nil {
+                return nil, err
+            }
+        case OpReturn:
+            result := vm.pop()
+            vm.stack = vm.stack[:f.base]
+            vm.frames = vm.frames[:len(vm.frames) - 1]
+            if len(vm.frames) == 0 {
+                return result, nil
+            }
+            vm.push(result)
+
+        default:
+            return nil, vm.fail("Invalid opcode %d", op)
+        }
+    }
+}
+
+func (vm *VM) popN(n int) []interp.Value {
+    values := make([]interp.Value, n)
+    copy(values, vm.stack[len(vm.stack) - n:])
+    vm.stack = vm.stack[:len(vm.stack) - n]
+    return values
+}
+
+// replaces closures by the interp.Function values they stand for
+func export(v interp.Value) interp.Value {
+    switch v := v.(type) {
+    case *Closure:
+        return interp.Function{Name: v.Function.Name}
+    case interp.Tuple:
+        return interp.Tuple(exportAll(v))
+    case interp.Array:
+        return interp.Array(exportAll(v))
+    case interp.NamedTuple:
+        return interp.NamedTuple{Tags: v.Tags, Values: exportAll(v.Values)}
+    case interp.Variant:
+        if v.Payload != nil {
+            v.Payload = export(v.Payload)
+        }
+        return v
+    }
+    return v
+}
+
+func exportAll(values []interp.Value) []interp.Value {
+    exported := make([]interp.Value, len(values))
+    for i, v := range values {
+        exported[i] = export(v)
+    }
+    return exported
+}
@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/check"
+	"github.com/ibex-lang/ibex/interp"
+	"github.com/ibex-lang/ibex/loader"
+	"github.com/ibex-lang/ibex/parser"
+)
+
+func compileSource(t testing.TB, src string) ([]*loader.Module, *check.Info, *Program) {
+	unit, err := parser.ParseFile("test.ibex", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mods := []*loader.Module{{Unit: unit}}
+	info, err := check.CheckModules(mods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Compile(mods, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mods, info, p
+}
+
+const fib = `fn fib n: Int -> Int
+    match n
+        0 => 0
+        1 => 1
+        _ => (n - 1 -> fib) + (n - 2 -> fib)
+fn main -> Int
+    20 -> fib`
+
+const arithmetic = `fn step (i: Int, acc: Int) -> Int
+    match i
+        0 => acc
+        _ => (i - 1, (acc * 31 + i * i) % 1000003 - i / 7) -> step
+fn main -> Int
+    (3000, 1) -> step`
+
+var programs = []string{
+	fib,
+	arithmetic,
+	`type Shape = Circle (r: Int) | Square (side: Int) | Empty
+fn area s: Shape -> Int
+    match s
+        Circle (r: r) => r * r * 3
+        Square (side: a) => a * a
+        Empty => 0
+fn first xs: []?Int -> Int
+    xs[0] ? xs[1]!
+fn main -> []Int
+    [Circle (r: 2) -> area, Square (side: 3) -> area, Empty -> area, [None, Some (7)] -> first]`,
+	`fn sub (a: Int, b: Int) -> Int
+    a - b
+fn swap p: (Int, Int) -> (Int, Int)
+    match p
+        (x, y) => (y, x)
+fn first p: (Int, Int) -> Int
+    match p -> swap
+        (a, _) => a
+fn main -> (Int, Int, (x: Int, y: Int), Int, fn (Int, Int) -> Int)
+    ((3, 1) -> sub, (b: 3, a: 1) -> sub, (x: 1, y: 2), (1, 2) -> first, sub)`,
+}
+
+func TestVMMatchesInterpreter(t *testing.T) {
+	for _, src := range programs {
+		mods, info, p := compileSource(t, src)
+		expected, err := interp.RunModules(mods, info)
+		assert.Nil(t, err)
+		actual, err := Run(p)
+		assert.Nil(t, err)
+		assert.Equal(t, interp.Format(expected), interp.Format(actual))
+	}
+}
+
+func TestVMTrace(t *testing.T) {
+	_, _, p := compileSource(t, `fn get (xs: []Int, i: Int) -> Int
+    xs[i]
+fn main -> Int
+    ([1, 2, 3], 5) -> get`)
+	_, err := Run(p)
+	assert.EqualError(t, err, `Runtime error: Index 5 is out of range for an array of length 3
+    in fn get at test.ibex:2:7
+    in fn main at test.ibex:4:20`)
+
+	_, _, p = compileSource(t, `fn f x: Int -> Int
+    match x
+        0 => 1
+fn main -> Int
+    2 -> f`)
+	_, err = Run(p)
+	assert.EqualError(t, err, `Runtime error: No arm matches 2
+    in fn f at test.ibex:2:5
+    in fn main at test.ibex:5:7`)
+
+	_, _, p = compileSource(t, `fn loop n: Int -> Int
+    n + 1 -> loop
+fn main -> Int
+    0 -> loop`)
+	_, err = Run(p)
+	assert.EqualError(t, err, `Runtime error: Stack overflow
+    in fn loop at test.ibex:2:11
+    ... 9998 more calls to loop
+    in fn main at test.ibex:4:7`)
+}
+
+func TestDisassemble(t *testing.T) {
+	_, _, p := compileSource(t, `fn add (a: Int, b: Int) -> Int
+    a + b * 2
+fn main -> Int
+    (1, 2) -> add`)
+	assert.Equal(t, `fn add (2 locals)
+   0 load 0
+   3 load 1
+   6 const 0 (2)
+   9 mul
+  10 add
+  11 return
+`, p.Disassemble(p.Functions[0]))
+	assert.Equal(t, `fn main (0 locals)
+   0 const 1 (1)
+   3 const 0 (2)
+   6 tuple 2
+   9 closure 0 (add)
+  12 call
+  13 return
+`, p.Disassemble(p.Functions[1]))
+}
+
+func benchmarkInterp(b *testing.B, src string) {
+	mods, info, _ := compileSource(b, src)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := interp.RunModules(mods, info); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkVM(b *testing.B, src string) {
+	_, _, p := compileSource(b, src)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Run(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibInterp(b *testing.B)        { benchmarkInterp(b, fib) }
+func BenchmarkFibVM(b *testing.B)            { benchmarkVM(b, fib) }
+func BenchmarkArithmeticInterp(b *testing.B) { benchmarkInterp(b, arithmetic) }
+func BenchmarkArithmeticVM(b *testing.B)     { benchmarkVM(b, arithmetic) }
@@ -0,0 +1,212 @@
+package wasm
+
+import (
+    "encoding/binary"
+    "math"
+)
+
+const (
+    sectionType = 1
+    sectionImport = 2
+    sectionFunction = 3
+    sectionTable = 4
+    sectionMemory = 5
+    sectionGlobal = 6
+    sectionExport = 7
+    sectionElement = 9
+    sectionCode = 10
+    sectionData = 11
+)
+
+const funcref = 0x70
+
+type encoder struct {
+    b []byte
+}
+
+func (e *encoder) byte(b byte) {
+    e.b = append(e.b, b)
+}
+
+func (e *encoder) u32(n uint64) {
+    for {
+        b := byte(n & 0x7f)
+        n >>= 7
+        if n == 0 {
+            e.byte(b)
+            return
+        }
+        e.byte(b | 0x80)
+    }
+}
+
+func (e *encoder) s64(n int64) {
+    for {
+        b := byte(n & 0x7f)
+        n >>= 7
+        if n == 0 && b & 0x40 == 0 || n == -1 && b & 0x40 != 0 {
+            e.byte(b)
+            return
+        }
+        e.byte(b | 0x80)
+    }
+}
+
+func (e *encoder) bytes(b []byte) {
+    e.u32(uint64(len(b)))
+    e.b = append(e.b, b...)
+}
+
+func (e *encoder) name(s string) {
+    e.bytes([]byte(s))
+}
+
+func (e *encoder) valTypes(types []ValType) {
+    e.bytes(valTypeBytes(types))
+}
+
+// an init expression of type i32
+func (e *encoder) constExpr(n int64) {
+    e.byte(byte(OpI32Const))
+    e.s64(n)
+    e.byte(byte(OpEnd))
+}
+
+func (e *encoder) instr(in Instr) {
+    e.byte(byte(in.Op))
+    switch ops[in.Op].imm {
+    case immBlock:
+        e.byte(0x40)
+    case immIndex:
+        e.u32(uint64(in.Imm[0]))
+    case immTable:
+        e.u32(uint64(len(in.Imm) - 1))
+        for _, label := range in.Imm {
+            e.u32(uint64(label))
+        }
+    case immType:
+        e.u32(uint64(in.Imm[0]))
+        e.byte(0)
+    case immMemory:
+        e.u32(uint64(in.Imm[0]))
+        e.u32(uint64(in.Imm[1]))
+    case immMemoryIndex:
+        e.byte(0)
+    case immI32, immI64:
+        e.s64(in.Imm[0])
+    case immF64:
+        e.b = binary.LittleEndian.AppendUint64(e.b, math.Float64bits(in.F))
+    }
+}
+
+// appends section id with the contents written by body, if it is
+// about any items
+func (e *encoder) section(id byte, items int, body func(s *encoder)) {
+    if items == 0 {
+        return
+    }
+    s := &encoder{}
+    s.u32(uint64(items))
+    body(s)
+    e.byte(id)
+    e.bytes(s.b)
+}
+
+// Binary encodes the module in the binary format.
+func (m *Module) Binary() []byte {
+    e := &encoder{b: []byte{0, 'a', 's', 'm', 1, 0, 0, 0}}
+    e.section(sectionType, len(m.Types), func(s *encoder) {
+        for _, t := range m.Types {
+            s.byte(0x60)
+            s.valTypes(t.Params)
+            s.valTypes(t.Results)
+        }
+    })
+    e.section(sectionImport, len(m.Imports), func(s *encoder) {
+        for _, imp := range m.Imports {
+            s.name(imp.Module)
+            s.name(imp.Name)
+            s.byte(byte(ExportFunc))
+            s.u32(uint64(imp.Type))
+        }
+    })
+    e.section(sectionFunction, len(m.Funcs), func(s *encoder) {
+        for _, f := range m.Funcs {
+            s.u32(uint64(f.Type))
+        }
+    })
+    e.section(sectionTable, 1, func(s *encoder) {
+        s.byte(funcref)
+        s.byte(0)
+        s.u32(uint64(len(m.Table)))
+    })
+    e.section(sectionMemory, 1, func(s *encoder) {
+        s.byte(0)
+        s.u32(uint64(m.MemoryPages))
+    })
+    e.section(sectionGlobal, len(m.Globals), func(s *encoder) {
+        for _, g := range m.Globals {
+            s.byte(byte(I32))
+            if g.Mutable {
+                s.byte(1)
+            } else {
+                s.byte(0)
+            }
+            s.constExpr(g.Init)
+        }
+    })
+    e.section(sectionExport, len(m.Exports), func(s *encoder) {
+        for _, exp := range m.Exports {
+            s.name(exp.Name)
+            s.byte(byte(exp.Kind))
+            s.u32(uint64(exp.Index))
+        }
+    })
+    if len(m.Table) > 0 {
+        e.section(sectionElement, 1, func(s *encoder) {
+            s.byte(0)
+            s.constExpr(0)
+            s.u32(uint64(len(m.Table)))
+            for _, f := range m.Table {
+                s.u32(uint64(f))
+            }
+        })
+    }
+    e.section(sectionCode, len(m.Funcs), func(s *encoder) {
+        for _, f := range m.Funcs {
+            s.bytes(f.code())
+        }
+    })
+    e.section(sectionData, len(m.Data), func(s *encoder) {
+        for _, d := range m.Data {
+            s.byte(0)
+            s.constExpr(int64(d.Offset))
+            s.bytes(d.Bytes)
+        }
+    })
+    return e.b
+}
+
+// the body of f in the code section, locals of a type in a row are
+// declared together
+func (f *Func) code() []byte {
+    e := &encoder{}
+    runs := make([][2]int, 0)
+    for i, t := range f.Locals {
+        if i > 0 && f.Locals[i - 1] == t {
+            runs[len(runs) - 1][0]++
+        } else {
+            runs = append(runs, [2]int{1, int(t)})
+        }
+    }
+    e.u32(uint64(len(runs)))
+    for _, run := range runs {
+        e.u32(uint64(run[0]))
+        e.byte(byte(run[1]))
+    }
+    for _, in := range f.Body {
+        e.instr(in)
+    }
+    e.byte(byte(OpEnd))
+    return e.b
+}
@@ -0,0 +1,594 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// A decoder for the binary format independent of the encoder, apart from
+// sharing the table of immediates, and a validator checking the types of
+// instructions by their own table of stack effects.
+
+type decoded struct {
+	types   []FuncType
+	imports []*Import
+	funcs   []int // types of the defined functions
+	table   int   // size
+	pages   int
+	globals []*Global
+	exports map[string]*Export
+	elems   []int
+	code    []*decodedFunc
+	data    []*Data
+}
+
+type decodedFunc struct {
+	locals []ValType // with the parameters
+	body   []Instr   // with the final end
+}
+
+func (d *decoded) funcType(f int) FuncType {
+	if f < len(d.imports) {
+		return d.types[d.imports[f].Type]
+	}
+	return d.types[d.funcs[f-len(d.imports)]]
+}
+
+func (d *decoded) numFuncs() int {
+	return len(d.imports) + len(d.funcs)
+}
+
+type reader struct {
+	b   []byte
+	pos int
+}
+
+type decodeError struct {
+	message string
+}
+
+func (r *reader) fail(format string, a ...interface{}) {
+	panic(decodeError{fmt.Sprintf("At byte %d: %s", r.pos, fmt.Sprintf(format, a...))})
+}
+
+func (r *reader) byte() byte {
+	if r.pos >= len(r.b) {
+		r.fail("unexpected end")
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *reader) u32() int {
+	var n uint64
+	for shift := 0; ; shift += 7 {
+		if shift > 28 {
+			r.fail("u32 too long")
+		}
+		b := r.byte()
+		n |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if n > math.MaxUint32 {
+		r.fail("u32 out of range")
+	}
+	return int(n)
+}
+
+func (r *reader) signed(bits uint) int64 {
+	var n int64
+	var shift uint
+	for {
+		if shift >= bits+7 {
+			r.fail("s%d too long", bits)
+		}
+		b := r.byte()
+		n |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				n |= -1 << shift
+			}
+			break
+		}
+	}
+	if bits == 32 && (n < math.MinInt32 || n > math.MaxInt32) {
+		r.fail("s32 out of range")
+	}
+	return n
+}
+
+func (r *reader) bytes() []byte {
+	n := r.u32()
+	if r.pos+n > len(r.b) {
+		r.fail("unexpected end")
+	}
+	r.pos += n
+	return r.b[r.pos-n : r.pos]
+}
+
+func (r *reader) valType() ValType {
+	t := ValType(r.byte())
+	if t != I32 && t != I64 && t != F64 {
+		r.fail("unknown value type %#x", byte(t))
+	}
+	return t
+}
+
+func (r *reader) valTypes() []ValType {
+	types := make([]ValType, r.u32())
+	for i := range types {
+		types[i] = r.valType()
+	}
+	return types
+}
+
+// an init expression, only i32.const is used
+func (r *reader) constExpr() int64 {
+	if op := r.byte(); op != byte(OpI32Const) {
+		r.fail("unexpected init expression %#x", op)
+	}
+	n := r.signed(32)
+	if op := r.byte(); op != byte(OpEnd) {
+		r.fail("init expression not terminated")
+	}
+	return n
+}
+
+func (r *reader) instr() Instr {
+	in := Instr{Op: Op(r.byte())}
+	info, ok := ops[in.Op]
+	if !ok {
+		r.fail("unknown opcode %#x", byte(in.Op))
+	}
+	switch info.imm {
+	case immBlock:
+		if t := r.byte(); t != 0x40 {
+			r.fail("unexpected block type %#x", t)
+		}
+	case immIndex:
+		in.Imm = []int64{int64(r.u32())}
+	case immTable:
+		n := r.u32()
+		for i := 0; i <= n; i++ {
+			in.Imm = append(in.Imm, int64(r.u32()))
+		}
+	case immType:
+		in.Imm = []int64{int64(r.u32())}
+		if r.byte() != 0 {
+			r.fail("call_indirect of a table other than 0")
+		}
+	case immMemory:
+		in.Imm = []int64{int64(r.u32()), int64(r.u32())}
+	case immMemoryIndex:
+		if r.byte() != 0 {
+			r.fail("memory other than 0")
+		}
+	case immI32:
+		in.Imm = []int64{r.signed(32)}
+	case immI64:
+		in.Imm = []int64{r.signed(64)}
+	case immF64:
+		if r.pos+8 > len(r.b) {
+			r.fail("unexpected end")
+		}
+		in.F = math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos:]))
+		r.pos += 8
+	}
+	return in
+}
+
+func (r *reader) limits() int {
+	flags := r.byte()
+	min := r.u32()
+	if flags == 1 {
+		r.u32()
+	} else if flags != 0 {
+		r.fail("unexpected limits %#x", flags)
+	}
+	return min
+}
+
+func decode(b []byte) (d *decoded, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			de, ok := e.(decodeError)
+			if !ok {
+				panic(e)
+			}
+			d, err = nil, errors.New(de.message)
+		}
+	}()
+
+	r := &reader{b: b}
+	if len(b) < 8 || string(b[:4]) != "\x00asm" || binary.LittleEndian.Uint32(b[4:]) != 1 {
+		r.fail("no module of version 1")
+	}
+	r.pos = 8
+	d = &decoded{exports: make(map[string]*Export)}
+	last := 0
+	for r.pos < len(b) {
+		id := int(r.byte())
+		if id <= last {
+			r.fail("section %d out of order", id)
+		}
+		last = id
+		s := &reader{b: r.bytes()}
+		s.decodeSection(d, id)
+		if s.pos != len(s.b) {
+			s.fail("%d bytes left in section %d", len(s.b)-s.pos, id)
+		}
+	}
+	if len(d.code) != len(d.funcs) {
+		r.fail("%d bodies for %d functions", len(d.code), len(d.funcs))
+	}
+	return d, nil
+}
+
+func (r *reader) decodeSection(d *decoded, id int) {
+	n := r.u32()
+	for i := 0; i < n; i++ {
+		switch id {
+		case sectionType:
+			if r.byte() != 0x60 {
+				r.fail("no function type")
+			}
+			d.types = append(d.types, FuncType{r.valTypes(), r.valTypes()})
+		case sectionImport:
+			imp := &Import{Module: string(r.bytes()), Name: string(r.bytes())}
+			if r.byte() != 0 {
+				r.fail("import of something other than a function")
+			}
+			imp.Type = r.u32()
+			d.imports = append(d.imports, imp)
+		case sectionFunction:
+			d.funcs = append(d.funcs, r.u32())
+		case sectionTable:
+			if r.byte() != funcref {
+				r.fail("table of something other than funcref")
+			}
+			d.table = r.limits()
+		case sectionMemory:
+			d.pages = r.limits()
+		case sectionGlobal:
+			t := r.valType()
+			mut := r.byte()
+			if t != I32 || mut > 1 {
+				r.fail("unexpected global")
+			}
+			d.globals = append(d.globals, &Global{mut == 1, r.constExpr()})
+		case sectionExport:
+			exp := &Export{Name: string(r.bytes()), Kind: ExportKind(r.byte()), Index: r.u32()}
+			if d.exports[exp.Name] != nil {
+				r.fail("export %s twice", exp.Name)
+			}
+			d.exports[exp.Name] = exp
+		case sectionElement:
+			if r.byte() != 0 || r.constExpr() != 0 {
+				r.fail("unexpected element segment")
+			}
+			for j := r.u32(); j > 0; j-- {
+				d.elems = append(d.elems, r.u32())
+			}
+		case sectionCode:
+			body := &reader{b: r.bytes()}
+			f := &decodedFunc{}
+			if len(d.code) < len(d.funcs) && d.funcs[len(d.code)] < len(d.types) {
+				f.locals = append(f.locals, d.types[d.funcs[len(d.code)]].Params...)
+			}
+			for j := body.u32(); j > 0; j-- {
+				count := body.u32()
+				t := body.valType()
+				for ; count > 0; count-- {
+					f.locals = append(f.locals, t)
+				}
+			}
+			for body.pos < len(body.b) {
+				f.body = append(f.body, body.instr())
+			}
+			d.code = append(d.code, f)
+		case sectionData:
+			if r.byte() != 0 {
+				r.fail("unexpected data segment")
+			}
+			offset := r.constExpr()
+			d.data = append(d.data, &Data{int(offset), r.bytes()})
+		default:
+			r.fail("unexpected section %d", id)
+		}
+	}
+}
+
+// stack effects of the instructions without immediates that matter
+var effects = map[Op][2][]ValType{
+	OpI32Eqz:        {{I32}, {I32}},
+	OpI32Eq:         {{I32, I32}, {I32}},
+	OpI32Ne:         {{I32, I32}, {I32}},
+	OpI32GtU:        {{I32, I32}, {I32}},
+	OpI32GeU:        {{I32, I32}, {I32}},
+	OpI64Eqz:        {{I64}, {I32}},
+	OpI64Eq:         {{I64, I64}, {I32}},
+	OpI64LtS:        {{I64, I64}, {I32}},
+	OpI64GeS:        {{I64, I64}, {I32}},
+	OpF64Eq:         {{F64, F64}, {I32}},
+	OpI32Add:        {{I32, I32}, {I32}},
+	OpI32Sub:        {{I32, I32}, {I32}},
+	OpI32Mul:        {{I32, I32}, {I32}},
+	OpI32And:        {{I32, I32}, {I32}},
+	OpI32Or:         {{I32, I32}, {I32}},
+	OpI32Shl:        {{I32, I32}, {I32}},
+	OpI32ShrU:       {{I32, I32}, {I32}},
+	OpI64Add:        {{I64, I64}, {I64}},
+	OpI64Sub:        {{I64, I64}, {I64}},
+	OpI64Mul:        {{I64, I64}, {I64}},
+	OpI64DivS:       {{I64, I64}, {I64}},
+	OpI64RemS:       {{I64, I64}, {I64}},
+	OpF64Neg:        {{F64}, {F64}},
+	OpF64Trunc:      {{F64}, {F64}},
+	OpF64Add:        {{F64, F64}, {F64}},
+	OpF64Sub:        {{F64, F64}, {F64}},
+	OpF64Mul:        {{F64, F64}, {F64}},
+	OpF64Div:        {{F64, F64}, {F64}},
+	OpI32WrapI64:    {{I64}, {I32}},
+	OpI64ExtendI32U: {{I32}, {I64}},
+	OpI32Const:      {nil, {I32}},
+	OpI64Const:      {nil, {I64}},
+	OpF64Const:      {nil, {F64}},
+	OpMemorySize:    {nil, {I32}},
+	OpMemoryGrow:    {{I32}, {I32}},
+	OpI32Load:       {{I32}, {I32}},
+	OpI64Load:       {{I32}, {I64}},
+	OpF64Load:       {{I32}, {F64}},
+	OpI32Load8U:     {{I32}, {I32}},
+	OpI32Store:      {{I32, I32}, nil},
+	OpI64Store:      {{I32, I64}, nil},
+	OpF64Store:      {{I32, F64}, nil},
+}
+
+// the largest alignment allowed, as a power of two
+var naturalAlign = map[Op]int64{
+	OpI32Load: 2, OpI64Load: 3, OpF64Load: 3, OpI32Load8U: 0,
+	OpI32Store: 2, OpI64Store: 3, OpF64Store: 3,
+}
+
+const unknown ValType = 0 // on the stack after an unconditional branch
+
+type frame struct {
+	op          Op
+	height      int
+	results     []ValType
+	unreachable bool
+}
+
+type validator struct {
+	d      *decoded
+	f      *decodedFunc
+	stack  []ValType
+	frames []*frame
+}
+
+func (v *validator) push(types ...ValType) {
+	v.stack = append(v.stack, types...)
+}
+
+func (v *validator) pop(want ValType) error {
+	top := v.frames[len(v.frames)-1]
+	if len(v.stack) == top.height {
+		if top.unreachable {
+			return nil
+		}
+		return fmt.Errorf("expected %s on the stack, found nothing", want)
+	}
+	got := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	if got != want && got != unknown {
+		return fmt.Errorf("expected %s on the stack, found %s", want, got)
+	}
+	return nil
+}
+
+func (v *validator) pops(types []ValType) error {
+	for i := len(types) - 1; i >= 0; i-- {
+		if err := v.pop(types[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *validator) setUnreachable() {
+	top := v.frames[len(v.frames)-1]
+	v.stack = v.stack[:top.height]
+	top.unreachable = true
+}
+
+// the types a branch to label l carries, none for blocks but the body
+func (v *validator) label(l int64) ([]ValType, error) {
+	if l < 0 || int(l) >= len(v.frames) {
+		return nil, fmt.Errorf("unknown label %d", l)
+	}
+	f := v.frames[len(v.frames)-1-int(l)]
+	if f.op == OpLoop {
+		return nil, nil
+	}
+	return f.results, nil
+}
+
+func (v *validator) instr(in Instr, results []ValType) error {
+	if e, ok := effects[in.Op]; ok {
+		if align, ok := naturalAlign[in.Op]; ok && in.Imm[0] > align {
+			return fmt.Errorf("alignment larger than natural")
+		}
+		if err := v.pops(e[0]); err != nil {
+			return err
+		}
+		v.push(e[1]...)
+		return nil
+	}
+
+	switch in.Op {
+	case OpUnreachable:
+		v.setUnreachable()
+	case OpBlock, OpLoop, OpIf:
+		if in.Op == OpIf {
+			if err := v.pop(I32); err != nil {
+				return err
+			}
+		}
+		v.frames = append(v.frames, &frame{op: in.Op, height: len(v.stack)})
+	case OpElse, OpEnd:
+		top := v.frames[len(v.frames)-1]
+		if in.Op == OpElse && top.op != OpIf {
+			return fmt.Errorf("else outside of if")
+		}
+		if err := v.pops(top.results); err != nil {
+			return err
+		}
+		if len(v.stack) != top.height {
+			return fmt.Errorf("%d values left at the end of a block", len(v.stack)-top.height)
+		}
+		if in.Op == OpElse {
+			top.op, top.unreachable = OpElse, false
+			return nil
+		}
+		v.frames = v.frames[:len(v.frames)-1]
+		v.push(top.results...)
+	case OpBr:
+		types, err := v.label(in.Imm[0])
+		if err != nil {
+			return err
+		}
+		if err := v.pops(types); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case OpBrTable:
+		if err := v.pop(I32); err != nil {
+			return err
+		}
+		for _, l := range in.Imm {
+			types, err := v.label(l)
+			if err != nil {
+				return err
+			}
+			if len(types) > 0 {
+				return fmt.Errorf("br_table to a label with values")
+			}
+		}
+		v.setUnreachable()
+	case OpReturn:
+		if err := v.pops(results); err != nil {
+			return err
+		}
+		v.setUnreachable()
+	case OpCall, OpCallIndirect:
+		var t FuncType
+		if in.Op == OpCall {
+			if int(in.Imm[0]) >= v.d.numFuncs() {
+				return fmt.Errorf("unknown function %d", in.Imm[0])
+			}
+			t = v.d.funcType(int(in.Imm[0]))
+		} else {
+			if int(in.Imm[0]) >= len(v.d.types) {
+				return fmt.Errorf("unknown type %d", in.Imm[0])
+			}
+			t = v.d.types[in.Imm[0]]
+			if err := v.pop(I32); err != nil {
+				return err
+			}
+		}
+		if err := v.pops(t.Params); err != nil {
+			return err
+		}
+		v.push(t.Results...)
+	case OpLocalGet, OpLocalSet, OpLocalTee:
+		if int(in.Imm[0]) >= len(v.f.locals) {
+			return fmt.Errorf("unknown local %d", in.Imm[0])
+		}
+		t := v.f.locals[in.Imm[0]]
+		if in.Op != OpLocalGet {
+			if err := v.pop(t); err != nil {
+				return err
+			}
+		}
+		if in.Op != OpLocalSet {
+			v.push(t)
+		}
+	case OpGlobalGet, OpGlobalSet:
+		if int(in.Imm[0]) >= len(v.d.globals) {
+			return fmt.Errorf("unknown global %d", in.Imm[0])
+		}
+		if in.Op == OpGlobalGet {
+			v.push(I32)
+		} else if !v.d.globals[in.Imm[0]].Mutable {
+			return fmt.Errorf("global %d is immutable", in.Imm[0])
+		} else {
+			return v.pop(I32)
+		}
+	default:
+		return fmt.Errorf("unexpected instruction %s", in.Op)
+	}
+	return nil
+}
+
+func validateFunc(d *decoded, i int) error {
+	f := d.code[i]
+	t := d.types[d.funcs[i]]
+	v := &validator{d: d, f: f}
+	v.frames = []*frame{{op: OpBlock, results: t.Results}}
+	for j, in := range f.body {
+		if len(v.frames) == 0 {
+			return fmt.Errorf("instructions after the end of the body")
+		}
+		if err := v.instr(in, t.Results); err != nil {
+			return fmt.Errorf("instruction %d (%s): %s", j, in.Op, err)
+		}
+	}
+	if len(v.frames) > 0 {
+		return fmt.Errorf("body not terminated")
+	}
+	return nil
+}
+
+// checks what decode does not: that indices are in range, segments fit
+// and bodies are well typed
+func validate(d *decoded) error {
+	for _, imp := range d.imports {
+		if imp.Type >= len(d.types) {
+			return fmt.Errorf("import %s.%s of unknown type %d", imp.Module, imp.Name, imp.Type)
+		}
+	}
+	for i, t := range d.funcs {
+		if t >= len(d.types) {
+			return fmt.Errorf("function %d of unknown type %d", i, t)
+		}
+	}
+	for _, exp := range d.exports {
+		if exp.Kind == ExportFunc && exp.Index >= d.numFuncs() || exp.Kind == ExportMemory && exp.Index != 0 {
+			return fmt.Errorf("export %s of an unknown index", exp.Name)
+		}
+	}
+	if len(d.elems) > d.table {
+		return fmt.Errorf("%d elements for a table of %d", len(d.elems), d.table)
+	}
+	for _, f := range d.elems {
+		if f >= d.numFuncs() {
+			return fmt.Errorf("element of unknown function %d", f)
+		}
+	}
+	for _, data := range d.data {
+		if data.Offset+len(data.Bytes) > d.pages*pageSize {
+			return fmt.Errorf("data at %d beyond the memory", data.Offset)
+		}
+	}
+	for i := range d.code {
+		if err := validateFunc(d, i); err != nil {
+			return fmt.Errorf("In function %d: %s", len(d.imports)+i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,510 @@
+package wasm
+
+import (
+    "encoding/binary"
+
+    "github.com/ibex-lang/ibex/core"
+    "github.com/ibex-lang/ibex/ir"
+)
+
+// Memory starts with the data: strings, the messages of traps among
+// them, from dataStart on. The heap follows, global 0 points to its end.
+// Nothing is freed, the memory grows as needed.
+//
+// Values of the representations Int and F64 are i64 and f64, the others
+// i32: Bool is 0 or 1, Unit 0, Func an index into the table and Ptr an
+// address in memory of
+//   - a string: its length as an i32, then the bytes
+//   - a tuple or named tuple: the elements, each aligned to its size
+//   - an array: its length as an i32 and 4 bytes of padding, then the
+//     elements
+//   - a variant: the index of its tag as an i64, then the payload
+//
+// Traps call an imported function of the host, which is not expected to
+// return: ibex.trap with the address of a string of the message and the
+// position, ibex.trap_index with the index, the length of the array and
+// the address of a string of the position for an index out of range.
+// Functions without a body are imported from env by their name.
+const (
+    dataStart = 8
+    pageSize = 65536
+    arrayHeader = 8
+    payloadOffset = 8
+)
+
+// indices of the functions every module imports
+const (
+    funcTrap = iota
+    funcTrapIndex
+)
+
+type generator struct {
+    p *ir.Program
+    m *Module
+    funcs map[*ir.Function]int // indices
+    table map[int]int // indices in the table by index of the function
+    data []byte // from dataStart on
+    strings map[string]int // addresses
+    helpers map[string]int // indices of the runtime functions
+}
+
+// Generate translates a lowered program to a module exporting its memory
+// as memory and every function by its name.
+func Generate(p *ir.Program) (*Module, error) {
+    g := &generator{
+        p: p,
+        m: &Module{},
+        funcs: make(map[*ir.Function]int),
+        table: make(map[int]int),
+        strings: make(map[string]int),
+        helpers: make(map[string]int),
+    }
+    g.m.Imports = []*Import{
+        {"ibex", "trap", g.m.typeIndex(FuncType{Params: []ValType{I32}})},
+        {"ibex", "trap_index", g.m.typeIndex(FuncType{Params: []ValType{I64, I32, I32}})},
+    }
+    defined := make([]*ir.Function, 0, len(p.Functions))
+    for _, f := range p.Functions {
+        if len(f.Blocks) == 0 {
+            g.funcs[f] = len(g.m.Imports)
+            g.m.Imports = append(g.m.Imports, &Import{"env", f.Name, g.m.typeIndex(signature(f))})
+        } else {
+            defined = append(defined, f)
+        }
+    }
+    for i, f := range defined {
+        g.funcs[f] = len(g.m.Imports) + i
+    }
+    for _, f := range defined {
+        g.m.Funcs = append(g.m.Funcs, &Func{Name: f.Name, Type: g.m.typeIndex(signature(f))})
+    }
+    for _, f := range defined {
+        g.function(f)
+    }
+
+    g.m.Exports = append(g.m.Exports, &Export{"memory", ExportMemory, 0})
+    for _, f := range defined {
+        g.m.Exports = append(g.m.Exports, &Export{f.Name, ExportFunc, g.funcs[f]})
+    }
+    if len(g.data) > 0 {
+        g.m.Data = []*Data{{dataStart, g.data}}
+    }
+    heap := align(dataStart + len(g.data), 8)
+    g.m.Globals = []*Global{{true, int64(heap)}}
+    g.m.MemoryPages = heap / pageSize + 1
+    return g.m, nil
+}
+
+func align(n int, to int) int {
+    return (n + to - 1) / to * to
+}
+
+func valType(t ir.Type) ValType {
+    switch t {
+    case ir.Int:
+        return I64
+    case ir.F64:
+        return F64
+    }
+    return I32
+}
+
+func valTypes(types []ir.Type) []ValType {
+    result := make([]ValType, len(types))
+    for i, t := range types {
+        result[i] = valType(t)
+    }
+    return result
+}
+
+func signature(f *ir.Function) FuncType {
+    return FuncType{valTypes(f.Params), []ValType{valType(f.Return)}}
+}
+
+// the size of a value of representation t in memory, which it is aligned
+// to as well
+func size(t ir.Type) int {
+    if valType(t) == I32 {
+        return 4
+    }
+    return 8
+}
+
+func load(t ir.Type, offset int) Instr {
+    switch valType(t) {
+    case I64:
+        return ins(OpI64Load, 3, int64(offset))
+    case F64:
+        return ins(OpF64Load, 3, int64(offset))
+    }
+    return ins(OpI32Load, 2, int64(offset))
+}
+
+func store(t ir.Type, offset int) Instr {
+    switch valType(t) {
+    case I64:
+        return ins(OpI64Store, 3, int64(offset))
+    case F64:
+        return ins(OpF64Store, 3, int64(offset))
+    }
+    return ins(OpI32Store, 2, int64(offset))
+}
+
+// the offsets of elements of the given representations in a tuple and
+// its size
+func layout(types []ir.Type) ([]int, int) {
+    offsets := make([]int, len(types))
+    n := 0
+    for i, t := range types {
+        n = align(n, size(t))
+        offsets[i] = n
+        n += size(t)
+    }
+    return offsets, n
+}
+
+// the representations of the elements of a tuple or named tuple type
+func elements(ty core.IbexType) []ir.Type {
+    switch t := ty.(type) {
+    case core.IbexTupleType:
+        types := make([]ir.Type, len(t.ElementTypes))
+        for i, elem := range t.ElementTypes {
+            types[i] = ir.Repr(elem)
+        }
+        return types
+    case core.IbexNamedTupleType:
+        types := make([]ir.Type, len(t.Types))
+        for i, entry := range t.Types {
+            types[i] = ir.Repr(entry.Type)
+        }
+        return types
+    }
+    return nil
+}
+
+// the address of a string in the data, added on first use
+func (g *generator) str(s string) int64 {
+    if addr, ok := g.strings[s]; ok {
+        return int64(addr)
+    }
+    g.data = append(g.data, make([]byte, align(len(g.data), 4) - len(g.data))...)
+    addr := dataStart + len(g.data)
+    g.data = binary.LittleEndian.AppendUint32(g.data, uint32(len(s)))
+    g.data = append(g.data, s...)
+    g.strings[s] = addr
+    return int64(addr)
+}
+
+// the index in the table of the function at index f, added on first use
+func (g *generator) tableIndex(f int) int64 {
+    if i, ok := g.table[f]; ok {
+        return int64(i)
+    }
+    g.table[f] = len(g.m.Table)
+    g.m.Table = append(g.m.Table, f)
+    return int64(g.table[f])
+}
+
+type funcGen struct {
+    g *generator
+    f *ir.Function
+    body []Instr
+    locals []ValType
+    pc int64 // the local holding the index of the next block
+    index map[*ir.Block]int64 // of blocks in the function
+}
+
+func (fg *funcGen) emit(in ...Instr) {
+    fg.body = append(fg.body, in...)
+}
+
+// the local of v, parameters come first
+func (fg *funcGen) local(v *ir.Value) int64 {
+    return int64(len(fg.f.Params) + v.ID)
+}
+
+func (fg *funcGen) get(v *ir.Value) Instr {
+    return ins(OpLocalGet, fg.local(v))
+}
+
+// Blocks have no structure in the IR, so the body of a function of
+// several blocks is a loop dispatching on the index of the next block:
+//
+//   loop
+//     block            ;; n - 1
+//       ...
+//         block        ;; 0
+//           local.get pc
+//           br_table 0 1 ... n - 1
+//         end
+//         ;; block 0
+//       ...
+//     end
+//     ;; block n - 1
+//   end
+//   unreachable
+//
+// Jumping to a block sets pc to its index and branches to the loop.
+func (g *generator) function(f *ir.Function) {
+    fg := &funcGen{g: g, f: f, index: make(map[*ir.Block]int64)}
+    n := 0
+    for _, b := range f.Blocks {
+        for _, v := range b.Values {
+            if v.ID >= n {
+                n = v.ID + 1
+            }
+        }
+    }
+    fg.locals = make([]ValType, n)
+    for i := range fg.locals {
+        fg.locals[i] = I32
+    }
+    for i, b := range f.Blocks {
+        fg.index[b] = int64(i)
+        for _, v := range b.Values {
+            fg.locals[v.ID] = valType(v.Type)
+        }
+    }
+
+    if len(f.Blocks) == 1 && len(f.Blocks[0].Succs) == 0 {
+        fg.block(f.Blocks[0], 0)
+    } else {
+        fg.pc = int64(len(f.Params) + len(fg.locals))
+        fg.locals = append(fg.locals, I32)
+        fg.emit(ins(OpLoop))
+        for range f.Blocks {
+            fg.emit(ins(OpBlock))
+        }
+        labels := make([]int64, len(f.Blocks) + 1)
+        for i := range f.Blocks {
+            labels[i] = int64(i)
+        }
+        fg.emit(ins(OpLocalGet, fg.pc), ins(OpBrTable, labels...))
+        for i, b := range f.Blocks {
+            fg.emit(ins(OpEnd))
+            fg.block(b, len(f.Blocks) - 1 - i)
+        }
+        fg.emit(ins(OpEnd), ins(OpUnreachable))
+    }
+    fn := g.m.Funcs[g.funcs[f] - len(g.m.Imports)]
+    fn.Locals, fn.Body = fg.locals, fg.body
+}
+
+// the code of b, depth blocks inside the loop
+func (fg *funcGen) block(b *ir.Block, depth int) {
+    for _, v := range b.Values {
+        if v.Op != ir.OpPhi {
+            fg.value(v)
+        }
+    }
+    switch b.Kind {
+    case ir.BlockJump:
+        fg.edge(b, 0, depth)
+    case ir.BlockIf:
+        fg.emit(fg.get(b.Control), ins(OpIf))
+        fg.edge(b, 0, depth + 1)
+        fg.emit(ins(OpElse))
+        fg.edge(b, 1, depth + 1)
+        fg.emit(ins(OpEnd))
+    case ir.BlockReturn:
+        fg.emit(fg.get(b.Control), ins(OpReturn))
+    case ir.BlockTrap:
+        fg.emit(ins(OpI32Const, fg.g.str(b.Message + " at " + b.Pos.String())),
+            ins(OpCall, funcTrap), ins(OpUnreachable))
+    }
+}
+
+// the copies into the phis of b.Succs[i] on that edge and the jump to it,
+// the copies at once by way of the stack as the phis may read each other
+func (fg *funcGen) edge(b *ir.Block, i int, depth int) {
+    s := b.Succs[i]
+    nth := 0
+    for _, other := range b.Succs[:i] {
+        if other == s {
+            nth++
+        }
+    }
+    for j, p := range s.Preds {
+        if p != b {
+            continue
+        }
+        if nth > 0 {
+            nth--
+            continue
+        }
+        phis := make([]*ir.Value, 0)
+        for _, v := range s.Values {
+            if v.Op == ir.OpPhi {
+                phis = append(phis, v)
+                fg.emit(fg.get(v.Args[j]))
+            }
+        }
+        for k := len(phis) - 1; k >= 0; k-- {
+            fg.emit(ins(OpLocalSet, fg.local(phis[k])))
+        }
+        break
+    }
+    fg.emit(ins(OpI32Const, fg.index[s]), ins(OpLocalSet, fg.pc), ins(OpBr, int64(depth)))
+}
+
+func (fg *funcGen) value(v *ir.Value) {
+    g := fg.g
+    if stackArgs(v.Op) {
+        for _, arg := range v.Args {
+            fg.emit(fg.get(arg))
+        }
+    }
+
+    switch v.Op {
+    case ir.OpParam:
+        fg.emit(ins(OpLocalGet, int64(v.Aux.(int))))
+    case ir.OpConst:
+        switch c := v.Aux.(type) {
+        case int64:
+            fg.emit(ins(OpI64Const, c))
+        case float64:
+            fg.emit(Instr{Op: OpF64Const, F: c})
+        case bool:
+            if c {
+                fg.emit(ins(OpI32Const, 1))
+            } else {
+                fg.emit(ins(OpI32Const, 0))
+            }
+        }
+    case ir.OpUnit:
+        fg.emit(ins(OpI32Const, 0))
+    case ir.OpString:
+        fg.emit(ins(OpI32Const, g.str(v.Aux.(string))))
+    case ir.OpFunc:
+        fg.emit(ins(OpI32Const, g.tableIndex(g.funcs[g.p.Lookup(v.Aux.(string))])))
+
+    case ir.OpAdd, ir.OpSub, ir.OpMul:
+        ops := map[ir.Op][2]Op{
+            ir.OpAdd: {OpI64Add, OpF64Add},
+            ir.OpSub: {OpI64Sub, OpF64Sub},
+            ir.OpMul: {OpI64Mul, OpF64Mul},
+        }[v.Op]
+        if v.Type == ir.F64 {
+            fg.emit(ins(ops[1]))
+        } else {
+            fg.emit(ins(ops[0]))
+        }
+    case ir.OpDiv, ir.OpMod:
+        switch {
+        case v.Type == ir.Int:
+            fg.emit(ins(OpI32Const, g.str("Division by zero at " + v.Pos.String())),
+                ins(OpCall, int64(g.helper(v.Op.String()))))
+        case v.Op == ir.OpDiv:
+            fg.emit(ins(OpF64Div))
+        default:
+            // x - trunc(x / y) * y, the sign of the result is that of x
+            fg.emit(ins(OpF64Div), ins(OpF64Trunc), fg.get(v.Args[1]), ins(OpF64Mul),
+                ins(OpLocalSet, fg.local(v)), fg.get(v.Args[0]), ins(OpLocalGet, fg.local(v)), ins(OpF64Sub))
+        }
+    case ir.OpNeg:
+        if v.Type == ir.F64 {
+            fg.emit(fg.get(v.Args[0]), ins(OpF64Neg))
+        } else {
+            fg.emit(ins(OpI64Const, 0), fg.get(v.Args[0]), ins(OpI64Sub))
+        }
+    case ir.OpNot:
+        fg.emit(ins(OpI32Eqz))
+    case ir.OpEq:
+        fg.eq(v)
+
+    case ir.OpTuple, ir.OpArray, ir.OpVariant:
+        fg.aggregate(v)
+    case ir.OpElem:
+        offsets, _ := layout(elements(v.Args[0].Source))
+        fg.emit(load(v.Type, offsets[v.Aux.(int)]))
+    case ir.OpIndex:
+        arr, i := v.Args[0], v.Args[1]
+        fg.emit(fg.get(i), fg.get(arr), ins(OpI32Const, g.str(v.Pos.String())),
+            ins(OpCall, int64(g.helper("check_index"))))
+        fg.emit(fg.get(arr), fg.get(i), ins(OpI32WrapI64), ins(OpI32Const, int64(size(v.Type))),
+            ins(OpI32Mul), ins(OpI32Add), load(v.Type, arrayHeader))
+    case ir.OpTag:
+        fg.emit(load(ir.Int, 0))
+    case ir.OpPayload:
+        fg.emit(load(v.Type, payloadOffset))
+
+    case ir.OpCall:
+        fg.emit(ins(OpCall, int64(g.funcs[g.p.Lookup(v.Aux.(string))])))
+    case ir.OpCallInd:
+        params := make([]ir.Type, len(v.Args) - 1)
+        for i, arg := range v.Args[1:] {
+            params[i] = arg.Type
+            fg.emit(fg.get(arg))
+        }
+        t := g.m.typeIndex(FuncType{valTypes(params), []ValType{valType(v.Type)}})
+        fg.emit(fg.get(v.Args[0]), ins(OpCallIndirect, int64(t)))
+    }
+    if !isAggregate(v.Op) {
+        fg.emit(ins(OpLocalSet, fg.local(v)))
+    }
+}
+
+// whether the instructions of op take the arguments in order from the
+// stack, the others get them themselves
+func stackArgs(op ir.Op) bool {
+    switch op {
+    case ir.OpAdd, ir.OpSub, ir.OpMul, ir.OpDiv, ir.OpMod, ir.OpNot,
+        ir.OpElem, ir.OpTag, ir.OpPayload, ir.OpCall:
+        return true
+    }
+    return false
+}
+
+func isAggregate(op ir.Op) bool {
+    return op == ir.OpTuple || op == ir.OpArray || op == ir.OpVariant
+}
+
+func (fg *funcGen) eq(v *ir.Value) {
+    x, y := fg.get(v.Args[0]), fg.get(v.Args[1])
+    switch v.Args[0].Type {
+    case ir.Unit:
+        fg.emit(ins(OpI32Const, 1))
+    case ir.Int:
+        fg.emit(x, y, ins(OpI64Eq))
+    case ir.F64:
+        fg.emit(x, y, ins(OpF64Eq))
+    case ir.Ptr:
+        fg.emit(x, y, ins(OpCall, int64(fg.g.helper("str_eq"))))
+    default:
+        fg.emit(x, y, ins(OpI32Eq))
+    }
+}
+
+// allocates v and stores its contents, leaving its address in its local
+func (fg *funcGen) aggregate(v *ir.Value) {
+    types := make([]ir.Type, len(v.Args))
+    for i, arg := range v.Args {
+        types[i] = arg.Type
+    }
+    var offsets []int
+    var n int
+    switch v.Op {
+    case ir.OpTuple:
+        offsets, n = layout(types)
+    case ir.OpArray:
+        elem := ir.Repr(v.Source.(core.IbexArrayType).Elem())
+        offsets = make([]int, len(v.Args))
+        for i := range offsets {
+            offsets[i] = arrayHeader + i * size(elem)
+        }
+        n = arrayHeader + len(v.Args) * size(elem)
+    case ir.OpVariant:
+        offsets, n = []int{payloadOffset}, payloadOffset + 8
+    }
+    fg.emit(ins(OpI32Const, int64(n)), ins(OpCall, int64(fg.g.helper("alloc"))),
+        ins(OpLocalSet, fg.local(v)))
+    switch v.Op {
+    case ir.OpArray:
+        fg.emit(fg.get(v), ins(OpI32Const, int64(len(v.Args))), store(ir.Bool, 0))
+    case ir.OpVariant:
+        fg.emit(fg.get(v), ins(OpI64Const, int64(v.Aux.(int))), store(ir.Int, 0))
+    }
+    for i, arg := range v.Args {
+        fg.emit(fg.get(v), fg.get(arg), store(arg.Type, offsets[i]))
+    }
+}
@@ -0,0 +1,175 @@
+package wasm
+
+// Op is an instruction by its opcode, only those the backend emits.
+type Op byte
+
+const (
+    OpUnreachable Op = 0x00
+    OpBlock Op = 0x02
+    OpLoop Op = 0x03
+    OpIf Op = 0x04
+    OpElse Op = 0x05
+    OpEnd Op = 0x0b
+    OpBr Op = 0x0c
+    OpBrTable Op = 0x0e
+    OpReturn Op = 0x0f
+    OpCall Op = 0x10
+    OpCallIndirect Op = 0x11
+
+    OpLocalGet Op = 0x20
+    OpLocalSet Op = 0x21
+    OpLocalTee Op = 0x22
+    OpGlobalGet Op = 0x23
+    OpGlobalSet Op = 0x24
+
+    OpI32Load Op = 0x28
+    OpI64Load Op = 0x29
+    OpF64Load Op = 0x2b
+    OpI32Load8U Op = 0x2d
+    OpI32Store Op = 0x36
+    OpI64Store Op = 0x37
+    OpF64Store Op = 0x39
+    OpMemorySize Op = 0x3f
+    OpMemoryGrow Op = 0x40
+
+    OpI32Const Op = 0x41
+    OpI64Const Op = 0x42
+    OpF64Const Op = 0x44
+
+    OpI32Eqz Op = 0x45
+    OpI32Eq Op = 0x46
+    OpI32Ne Op = 0x47
+    OpI32GtU Op = 0x4b
+    OpI32GeU Op = 0x4f
+    OpI64Eqz Op = 0x50
+    OpI64Eq Op = 0x51
+    OpI64LtS Op = 0x53
+    OpI64GeS Op = 0x59
+    OpF64Eq Op = 0x61
+
+    OpI32Add Op = 0x6a
+    OpI32Sub Op = 0x6b
+    OpI32Mul Op = 0x6c
+    OpI32And Op = 0x71
+    OpI32Or Op = 0x72
+    OpI32Shl Op = 0x74
+    OpI32ShrU Op = 0x76
+    OpI64Add Op = 0x7c
+    OpI64Sub Op = 0x7d
+    OpI64Mul Op = 0x7e
+    OpI64DivS Op = 0x7f
+    OpI64RemS Op = 0x81
+    OpF64Neg Op = 0x9a
+    OpF64Trunc Op = 0x9d
+    OpF64Add Op = 0xa0
+    OpF64Sub Op = 0xa1
+    OpF64Mul Op = 0xa2
+    OpF64Div Op = 0xa3
+    OpI32WrapI64 Op = 0xa7
+    OpI64ExtendI32U Op = 0xad
+)
+
+// what follows an opcode in the binary format
+type immediate int
+
+const (
+    immNone immediate = iota
+    immBlock // an empty block type, the only one used
+    immIndex // of a local, global, function or label
+    immTable // labels, the last one the default
+    immType // of call_indirect, followed by table 0
+    immMemory // alignment and offset
+    immMemoryIndex // memory 0
+    immI32
+    immI64
+    immF64
+)
+
+type opInfo struct {
+    name string
+    imm immediate
+}
+
+var ops = map[Op]opInfo{
+    OpUnreachable: {"unreachable", immNone},
+    OpBlock: {"block", immBlock},
+    OpLoop: {"loop", immBlock},
+    OpIf: {"if", immBlock},
+    OpElse: {"else", immNone},
+    OpEnd: {"end", immNone},
+    OpBr: {"br", immIndex},
+    OpBrTable: {"br_table", immTable},
+    OpReturn: {"return", immNone},
+    OpCall: {"call", immIndex},
+    OpCallIndirect: {"call_indirect", immType},
+
+    OpLocalGet: {"local.get", immIndex},
+    OpLocalSet: {"local.set", immIndex},
+    OpLocalTee: {"local.tee", immIndex},
+    OpGlobalGet: {"global.get", immIndex},
+    OpGlobalSet: {"global.set", immIndex},
+
+    OpI32Load: {"i32.load", immMemory},
+    OpI64Load: {"i64.load", immMemory},
+    OpF64Load: {"f64.load", immMemory},
+    OpI32Load8U: {"i32.load8_u", immMemory},
+    OpI32Store: {"i32.store", immMemory},
+    OpI64Store: {"i64.store", immMemory},
+    OpF64Store: {"f64.store", immMemory},
+    OpMemorySize: {"memory.size", immMemoryIndex},
+    OpMemoryGrow: {"memory.grow", immMemoryIndex},
+
+    OpI32Const: {"i32.const", immI32},
+    OpI64Const: {"i64.const", immI64},
+    OpF64Const: {"f64.const", immF64},
+
+    OpI32Eqz: {"i32.eqz", immNone},
+    OpI32Eq: {"i32.eq", immNone},
+    OpI32Ne: {"i32.ne", immNone},
+    OpI32GtU: {"i32.gt_u", immNone},
+    OpI32GeU: {"i32.ge_u", immNone},
+    OpI64Eqz: {"i64.eqz", immNone},
+    OpI64Eq: {"i64.eq", immNone},
+    OpI64LtS: {"i64.lt_s", immNone},
+    OpI64GeS: {"i64.ge_s", immNone},
+    OpF64Eq: {"f64.eq", immNone},
+
+    OpI32Add: {"i32.add", immNone},
+    OpI32Sub: {"i32.sub", immNone},
+    OpI32Mul: {"i32.mul", immNone},
+    OpI32And: {"i32.and", immNone},
+    OpI32Or: {"i32.or", immNone},
+    OpI32Shl: {"i32.shl", immNone},
+    OpI32ShrU: {"i32.shr_u", immNone},
+    OpI64Add: {"i64.add", immNone},
+    OpI64Sub: {"i64.sub", immNone},
+    OpI64Mul: {"i64.mul", immNone},
+    OpI64DivS: {"i64.div_s", immNone},
+    OpI64RemS: {"i64.rem_s", immNone},
+    OpF64Neg: {"f64.neg", immNone},
+    OpF64Trunc: {"f64.trunc", immNone},
+    OpF64Add: {"f64.add", immNone},
+    OpF64Sub: {"f64.sub", immNone},
+    OpF64Mul: {"f64.mul", immNone},
+    OpF64Div: {"f64.div", immNone},
+    OpI32WrapI64: {"i32.wrap_i64", immNone},
+    OpI64ExtendI32U: {"i64.extend_i32_u", immNone},
+}
+
+func (op Op) String() string {
+    return ops[op].name
+}
+
+// Instr is one instruction with its immediates in the order of the
+// binary format: the alignment as a power of two and the offset of a
+// memory access, the labels of br_table with the default last. F is the
+// immediate of f64.const.
+type Instr struct {
+    Op Op
+    Imm []int64
+    F float64
+}
+
+func ins(op Op, imm ...int64) Instr {
+    return Instr{Op: op, Imm: imm}
+}
@@ -0,0 +1,112 @@
+package wasm
+
+// ValType is a value type by its binary encoding.
+type ValType byte
+
+const (
+    I32 ValType = 0x7f
+    I64 ValType = 0x7e
+    F64 ValType = 0x7c
+)
+
+func (t ValType) String() string {
+    switch t {
+    case I32:
+        return "i32"
+    case I64:
+        return "i64"
+    case F64:
+        return "f64"
+    }
+    return "?"
+}
+
+type FuncType struct {
+    Params []ValType
+    Results []ValType
+}
+
+func (t FuncType) key() string {
+    return string(valTypeBytes(t.Params)) + "|" + string(valTypeBytes(t.Results))
+}
+
+func valTypeBytes(types []ValType) []byte {
+    b := make([]byte, len(types))
+    for i, t := range types {
+        b[i] = byte(t)
+    }
+    return b
+}
+
+// Import is an imported function, which come before the defined ones in
+// the index space of functions.
+type Import struct {
+    Module string
+    Name string
+    Type int
+}
+
+type Func struct {
+    Name string // its identifier in the text format
+    Type int
+    Locals []ValType // besides the parameters
+    Body []Instr // without the final end
+}
+
+type ExportKind byte
+
+const (
+    ExportFunc ExportKind = 0
+    ExportMemory ExportKind = 2
+)
+
+type Export struct {
+    Name string
+    Kind ExportKind
+    Index int
+}
+
+// Global is a global of type i32, the only type the backend needs.
+type Global struct {
+    Mutable bool
+    Init int64
+}
+
+// Data is an active data segment, copied to Offset on instantiation.
+type Data struct {
+    Offset int
+    Bytes []byte
+}
+
+// Module is a WebAssembly module with one memory and one table of
+// functions, both at index 0. Table[i] is the index of the function at
+// index i of the table.
+type Module struct {
+    Types []FuncType
+    Imports []*Import
+    Funcs []*Func
+    Table []int
+    MemoryPages int
+    Globals []*Global
+    Exports []*Export
+    Data []*Data
+}
+
+// the index of t in m.Types, adding it if needed
+func (m *Module) typeIndex(t FuncType) int {
+    for i, other := range m.Types {
+        if other.key() == t.key() {
+            return i
+        }
+    }
+    m.Types = append(m.Types, t)
+    return len(m.Types) - 1
+}
+
+// the identifier of the function at index i in the text format
+func (m *Module) funcName(i int) string {
+    if i < len(m.Imports) {
+        return m.Imports[i].Module + "." + m.Imports[i].Name
+    }
+    return m.Funcs[i - len(m.Imports)].Name
+}
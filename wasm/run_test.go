@@ -0,0 +1,340 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// A machine runs a decoded module, enough of one to compare what
+// generated code computes with the interpreter. Values are kept as
+// uint64, i32 ones zero-extended and f64 ones by their bits.
+type machine struct {
+	d       *decoded
+	mem     []byte
+	globals []uint64
+	depth   int
+}
+
+type trap struct {
+	message string
+}
+
+func (t *trap) Error() string {
+	return t.message
+}
+
+func instantiate(d *decoded) *machine {
+	mc := &machine{d: d, mem: make([]byte, d.pages*pageSize)}
+	for _, g := range d.globals {
+		mc.globals = append(mc.globals, uint64(uint32(g.Init)))
+	}
+	for _, data := range d.data {
+		copy(mc.mem[data.Offset:], data.Bytes)
+	}
+	return mc
+}
+
+func (mc *machine) fail(format string, a ...interface{}) {
+	panic(&trap{fmt.Sprintf(format, a...)})
+}
+
+// invokes the export name
+func (mc *machine) invoke(name string, args ...uint64) (result []uint64, err error) {
+	exp := mc.d.exports[name]
+	if exp == nil || exp.Kind != ExportFunc {
+		return nil, fmt.Errorf("No function %s", name)
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			t, ok := e.(*trap)
+			if !ok {
+				panic(e)
+			}
+			result, err = nil, t
+		}
+	}()
+	return mc.call(exp.Index, args), nil
+}
+
+func (mc *machine) str(addr uint64) string {
+	n := uint64(binary.LittleEndian.Uint32(mc.bytes(addr, 4)))
+	return string(mc.bytes(addr+4, n))
+}
+
+func (mc *machine) bytes(addr uint64, n uint64) []byte {
+	if addr+n > uint64(len(mc.mem)) {
+		mc.fail("Out of bounds memory access")
+	}
+	return mc.mem[addr : addr+n]
+}
+
+func (mc *machine) host(imp *Import, args []uint64) []uint64 {
+	switch imp.Module + "." + imp.Name {
+	case "ibex.trap":
+		mc.fail("Runtime error: %s", mc.str(args[0]))
+	case "ibex.trap_index":
+		mc.fail("Runtime error: Index %d is out of range for an array of length %d at %s",
+			int64(args[0]), args[1], mc.str(args[2]))
+	}
+	mc.fail("No host function %s.%s", imp.Module, imp.Name)
+	return nil
+}
+
+// the position of the else or end closing the block starting at pc
+func matching(body []Instr, pc int) (int, int) {
+	depth, els := 0, -1
+	for i := pc + 1; ; i++ {
+		switch body[i].Op {
+		case OpBlock, OpLoop, OpIf:
+			depth++
+		case OpElse:
+			if depth == 0 {
+				els = i
+			}
+		case OpEnd:
+			if depth == 0 {
+				return els, i
+			}
+			depth--
+		}
+	}
+}
+
+type label struct {
+	loop   bool
+	start  int // of the loop
+	end    int
+	height int
+}
+
+func (mc *machine) call(f int, args []uint64) []uint64 {
+	if f < len(mc.d.imports) {
+		return mc.host(mc.d.imports[f], args)
+	}
+	if mc.depth == 10000 {
+		mc.fail("Call stack exhausted")
+	}
+	mc.depth++
+	defer func() { mc.depth-- }()
+
+	code := mc.d.code[f-len(mc.d.imports)]
+	results := len(mc.d.funcType(f).Results)
+	locals := make([]uint64, len(code.locals))
+	copy(locals, args)
+	stack := make([]uint64, 0, 16)
+	labels := []label{{end: len(code.body) - 1}}
+	push := func(x uint64) { stack = append(stack, x) }
+	pop := func() uint64 {
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return x
+	}
+	branch := func(l int, pc int) int {
+		target := labels[len(labels)-1-l]
+		stack = stack[:target.height]
+		if target.loop {
+			labels = labels[:len(labels)-l]
+			return target.start
+		}
+		labels = labels[:len(labels)-1-l]
+		return target.end
+	}
+
+	for pc := 0; pc < len(code.body); pc++ {
+		in := code.body[pc]
+		switch in.Op {
+		case OpUnreachable:
+			mc.fail("Unreachable executed")
+		case OpBlock, OpLoop:
+			_, end := matching(code.body, pc)
+			labels = append(labels, label{in.Op == OpLoop, pc, end, len(stack)})
+		case OpIf:
+			els, end := matching(code.body, pc)
+			if pop() != 0 {
+				labels = append(labels, label{false, pc, end, len(stack)})
+			} else if els >= 0 {
+				labels = append(labels, label{false, pc, end, len(stack)})
+				pc = els
+			} else {
+				pc = end
+			}
+		case OpElse:
+			pc = branch(0, pc)
+		case OpEnd:
+			labels = labels[:len(labels)-1]
+		case OpBr:
+			pc = branch(int(in.Imm[0]), pc)
+		case OpBrTable:
+			i := pop()
+			if i >= uint64(len(in.Imm)-1) {
+				i = uint64(len(in.Imm) - 1)
+			}
+			pc = branch(int(in.Imm[i]), pc)
+		case OpReturn:
+			return stack[len(stack)-results:]
+		case OpCall, OpCallIndirect:
+			var callee int
+			if in.Op == OpCall {
+				callee = int(in.Imm[0])
+			} else {
+				i := pop()
+				if i >= uint64(len(mc.d.elems)) {
+					mc.fail("Undefined element %d", i)
+				}
+				callee = mc.d.elems[i]
+				if mc.d.funcType(callee).key() != mc.d.types[in.Imm[0]].key() {
+					mc.fail("Indirect call type mismatch")
+				}
+			}
+			n := len(mc.d.funcType(callee).Params)
+			args := append([]uint64(nil), stack[len(stack)-n:]...)
+			stack = stack[:len(stack)-n]
+			stack = append(stack, mc.call(callee, args)...)
+
+		case OpLocalGet:
+			push(locals[in.Imm[0]])
+		case OpLocalSet:
+			locals[in.Imm[0]] = pop()
+		case OpLocalTee:
+			locals[in.Imm[0]] = stack[len(stack)-1]
+		case OpGlobalGet:
+			push(mc.globals[in.Imm[0]])
+		case OpGlobalSet:
+			mc.globals[in.Imm[0]] = pop()
+
+		case OpI32Load, OpI64Load, OpF64Load, OpI32Load8U:
+			addr := pop() + uint64(in.Imm[1])
+			switch in.Op {
+			case OpI32Load:
+				push(uint64(binary.LittleEndian.Uint32(mc.bytes(addr, 4))))
+			case OpI32Load8U:
+				push(uint64(mc.bytes(addr, 1)[0]))
+			default:
+				push(binary.LittleEndian.Uint64(mc.bytes(addr, 8)))
+			}
+		case OpI32Store, OpI64Store, OpF64Store:
+			x := pop()
+			addr := pop() + uint64(in.Imm[1])
+			if in.Op == OpI32Store {
+				binary.LittleEndian.PutUint32(mc.bytes(addr, 4), uint32(x))
+			} else {
+				binary.LittleEndian.PutUint64(mc.bytes(addr, 8), x)
+			}
+		case OpMemorySize:
+			push(uint64(len(mc.mem) / pageSize))
+		case OpMemoryGrow:
+			n := pop()
+			push(uint64(len(mc.mem) / pageSize))
+			mc.mem = append(mc.mem, make([]byte, n*pageSize)...)
+
+		case OpI32Const:
+			push(uint64(uint32(in.Imm[0])))
+		case OpI64Const:
+			push(uint64(in.Imm[0]))
+		case OpF64Const:
+			push(math.Float64bits(in.F))
+
+		default:
+			if err := mc.numeric(in.Op, &stack); err != nil {
+				mc.fail("%s", err)
+			}
+		}
+	}
+	return stack[len(stack)-results:]
+}
+
+func b2u(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (mc *machine) numeric(op Op, stack *[]uint64) error {
+	s := *stack
+	e, ok := effects[op]
+	if !ok {
+		return fmt.Errorf("Unknown instruction %s", op)
+	}
+	n := len(e[0])
+	args := s[len(s)-n:]
+	var x, y uint64
+	x = args[0]
+	if n > 1 {
+		y = args[1]
+	}
+	fx, fy := math.Float64frombits(x), math.Float64frombits(y)
+	var r uint64
+	switch op {
+	case OpI32Eqz, OpI64Eqz:
+		r = b2u(x == 0)
+	case OpI32Eq, OpI64Eq:
+		r = b2u(x == y)
+	case OpI32Ne:
+		r = b2u(x != y)
+	case OpI32GtU:
+		r = b2u(uint32(x) > uint32(y))
+	case OpI32GeU:
+		r = b2u(uint32(x) >= uint32(y))
+	case OpI64LtS:
+		r = b2u(int64(x) < int64(y))
+	case OpI64GeS:
+		r = b2u(int64(x) >= int64(y))
+	case OpF64Eq:
+		r = b2u(fx == fy)
+	case OpI32Add:
+		r = uint64(uint32(x + y))
+	case OpI32Sub:
+		r = uint64(uint32(x - y))
+	case OpI32Mul:
+		r = uint64(uint32(x * y))
+	case OpI32And:
+		r = x & y
+	case OpI32Or:
+		r = x | y
+	case OpI32Shl:
+		r = uint64(uint32(x) << (y % 32))
+	case OpI32ShrU:
+		r = uint64(uint32(x) >> (y % 32))
+	case OpI64Add:
+		r = x + y
+	case OpI64Sub:
+		r = x - y
+	case OpI64Mul:
+		r = x * y
+	case OpI64DivS, OpI64RemS:
+		if y == 0 {
+			return errors.New("Integer divide by zero")
+		}
+		if op == OpI64DivS {
+			if int64(x) == math.MinInt64 && int64(y) == -1 {
+				return errors.New("Integer overflow")
+			}
+			r = uint64(int64(x) / int64(y))
+		} else if int64(y) != -1 {
+			r = uint64(int64(x) % int64(y))
+		}
+	case OpF64Neg:
+		r = math.Float64bits(-fx)
+	case OpF64Trunc:
+		r = math.Float64bits(math.Trunc(fx))
+	case OpF64Add:
+		r = math.Float64bits(fx + fy)
+	case OpF64Sub:
+		r = math.Float64bits(fx - fy)
+	case OpF64Mul:
+		r = math.Float64bits(fx * fy)
+	case OpF64Div:
+		r = math.Float64bits(fx / fy)
+	case OpI32WrapI64:
+		r = uint64(uint32(x))
+	case OpI64ExtendI32U:
+		r = uint64(uint32(x))
+	default:
+		return fmt.Errorf("Unknown instruction %s", op)
+	}
+	*stack = append(s[:len(s)-n], r)
+	return nil
+}
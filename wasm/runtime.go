@@ -0,0 +1,92 @@
+package wasm
+
+// the index of a runtime function, defined on first use
+func (g *generator) helper(name string) int {
+    if i, ok := g.helpers[name]; ok {
+        return i
+    }
+    f := &Func{Name: "ibex." + name}
+    i := len(g.m.Imports) + len(g.m.Funcs)
+    g.helpers[name] = i
+    g.m.Funcs = append(g.m.Funcs, f)
+
+    switch name {
+    case "alloc":
+        f.Type = g.m.typeIndex(FuncType{[]ValType{I32}, []ValType{I32}})
+        f.Locals, f.Body = []ValType{I32}, alloc
+    case "str_eq":
+        f.Type = g.m.typeIndex(FuncType{[]ValType{I32, I32}, []ValType{I32}})
+        f.Locals, f.Body = []ValType{I32, I32}, strEq
+    case "div", "mod":
+        f.Type = g.m.typeIndex(FuncType{[]ValType{I64, I64, I32}, []ValType{I64}})
+        f.Body = division(name == "div")
+    case "check_index":
+        f.Type = g.m.typeIndex(FuncType{[]ValType{I64, I32, I32}, nil})
+        f.Body = checkIndex
+    }
+    return i
+}
+
+// alloc size: the address of size new bytes, aligned to 8
+var alloc = []Instr{
+    ins(OpGlobalGet, 0),
+    ins(OpLocalSet, 1),
+    ins(OpGlobalGet, 0), ins(OpLocalGet, 0), ins(OpI32Add),
+    ins(OpI32Const, 7), ins(OpI32Add), ins(OpI32Const, -8), ins(OpI32And),
+    ins(OpGlobalSet, 0),
+    // grow the memory by the pages missing if the heap outgrew it
+    ins(OpGlobalGet, 0), ins(OpMemorySize), ins(OpI32Const, 16), ins(OpI32Shl), ins(OpI32GtU),
+    ins(OpIf),
+    ins(OpGlobalGet, 0), ins(OpMemorySize), ins(OpI32Const, 16), ins(OpI32Shl), ins(OpI32Sub),
+    ins(OpI32Const, 16), ins(OpI32ShrU), ins(OpI32Const, 1), ins(OpI32Add),
+    ins(OpMemoryGrow), ins(OpI32Const, -1), ins(OpI32Eq),
+    ins(OpIf), ins(OpUnreachable), ins(OpEnd),
+    ins(OpEnd),
+    ins(OpLocalGet, 1),
+}
+
+// str_eq a b: whether the strings at a and b have the same bytes
+var strEq = []Instr{
+    ins(OpLocalGet, 0), ins(OpI32Load, 2, 0), ins(OpLocalTee, 2),
+    ins(OpLocalGet, 1), ins(OpI32Load, 2, 0), ins(OpI32Ne),
+    ins(OpIf), ins(OpI32Const, 0), ins(OpReturn), ins(OpEnd),
+    ins(OpLoop),
+    ins(OpLocalGet, 3), ins(OpLocalGet, 2), ins(OpI32GeU),
+    ins(OpIf), ins(OpI32Const, 1), ins(OpReturn), ins(OpEnd),
+    ins(OpLocalGet, 0), ins(OpLocalGet, 3), ins(OpI32Add), ins(OpI32Load8U, 0, 4),
+    ins(OpLocalGet, 1), ins(OpLocalGet, 3), ins(OpI32Add), ins(OpI32Load8U, 0, 4),
+    ins(OpI32Ne),
+    ins(OpIf), ins(OpI32Const, 0), ins(OpReturn), ins(OpEnd),
+    ins(OpLocalGet, 3), ins(OpI32Const, 1), ins(OpI32Add), ins(OpLocalSet, 3),
+    ins(OpBr, 0),
+    ins(OpEnd),
+    ins(OpUnreachable),
+}
+
+// div x y message, mod x y message: x / y or x % y, trapping with the
+// message if y is 0. Dividing the least Int by -1 wraps around like in
+// the interpreter rather than trapping.
+func division(div bool) []Instr {
+    body := []Instr{
+        ins(OpLocalGet, 1), ins(OpI64Eqz),
+        ins(OpIf), ins(OpLocalGet, 2), ins(OpCall, funcTrap), ins(OpUnreachable), ins(OpEnd),
+    }
+    if !div {
+        return append(body, ins(OpLocalGet, 0), ins(OpLocalGet, 1), ins(OpI64RemS))
+    }
+    return append(body,
+        ins(OpLocalGet, 1), ins(OpI64Const, -1), ins(OpI64Eq),
+        ins(OpIf), ins(OpI64Const, 0), ins(OpLocalGet, 0), ins(OpI64Sub), ins(OpReturn), ins(OpEnd),
+        ins(OpLocalGet, 0), ins(OpLocalGet, 1), ins(OpI64DivS))
+}
+
+// check_index i array position: traps unless i is an index of the array
+var checkIndex = []Instr{
+    ins(OpLocalGet, 0), ins(OpI64Const, 0), ins(OpI64LtS),
+    ins(OpLocalGet, 0), ins(OpLocalGet, 1), ins(OpI32Load, 2, 0), ins(OpI64ExtendI32U), ins(OpI64GeS),
+    ins(OpI32Or),
+    ins(OpIf),
+    ins(OpLocalGet, 0), ins(OpLocalGet, 1), ins(OpI32Load, 2, 0), ins(OpLocalGet, 2),
+    ins(OpCall, funcTrapIndex), ins(OpUnreachable),
+    ins(OpEnd),
+}
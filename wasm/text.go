@@ -0,0 +1,164 @@
+package wasm
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+)
+
+// characters the text format allows in identifiers besides letters and
+// digits
+const idChars = "!#$%&'*+-./:<=>?@\\^_`|~"
+
+// identifiers of the functions in the text format by index, unique
+func (m *Module) funcIDs() []string {
+    n := len(m.Imports) + len(m.Funcs)
+    ids := make([]string, n)
+    used := make(map[string]bool)
+    for i := 0; i < n; i++ {
+        id := strings.Map(func(r rune) rune {
+            if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+                r < 0x80 && strings.ContainsRune(idChars, r) {
+                return r
+            }
+            return '_'
+        }, m.funcName(i))
+        for used[id] {
+            id += "_"
+        }
+        used[id] = true
+        ids[i] = "$" + id
+    }
+    return ids
+}
+
+func typeUse(t FuncType) string {
+    var b strings.Builder
+    for _, p := range t.Params {
+        fmt.Fprintf(&b, " (param %s)", p)
+    }
+    for _, r := range t.Results {
+        fmt.Fprintf(&b, " (result %s)", r)
+    }
+    return b.String()
+}
+
+// a string in the text format, escaping all but printable ASCII
+func quote(b []byte) string {
+    var s strings.Builder
+    s.WriteByte('"')
+    for _, c := range b {
+        if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' {
+            fmt.Fprintf(&s, "\\%02x", c)
+        } else {
+            s.WriteByte(c)
+        }
+    }
+    s.WriteByte('"')
+    return s.String()
+}
+
+// String gives the module in the text format, instructions in their
+// flat form indented by the blocks they are in.
+func (m *Module) String() string {
+    ids := m.funcIDs()
+    var b strings.Builder
+    b.WriteString("(module\n")
+    for i, t := range m.Types {
+        fmt.Fprintf(&b, "  (type (;%d;) (func%s))\n", i, typeUse(t))
+    }
+    for i, imp := range m.Imports {
+        fmt.Fprintf(&b, "  (import %s %s (func %s (type %d)))\n",
+            quote([]byte(imp.Module)), quote([]byte(imp.Name)), ids[i], imp.Type)
+    }
+    fmt.Fprintf(&b, "  (table %d funcref)\n  (memory %d)\n", len(m.Table), m.MemoryPages)
+    for _, g := range m.Globals {
+        ty := I32.String()
+        if g.Mutable {
+            ty = "(mut " + ty + ")"
+        }
+        fmt.Fprintf(&b, "  (global %s (i32.const %d))\n", ty, g.Init)
+    }
+    for _, exp := range m.Exports {
+        if exp.Kind == ExportMemory {
+            fmt.Fprintf(&b, "  (export %s (memory %d))\n", quote([]byte(exp.Name)), exp.Index)
+        } else {
+            fmt.Fprintf(&b, "  (export %s (func %s))\n", quote([]byte(exp.Name)), ids[exp.Index])
+        }
+    }
+    if len(m.Table) > 0 {
+        b.WriteString("  (elem (i32.const 0) func")
+        for _, f := range m.Table {
+            b.WriteString(" " + ids[f])
+        }
+        b.WriteString(")\n")
+    }
+    for i, f := range m.Funcs {
+        fmt.Fprintf(&b, "  (func %s (type %d)%s\n", ids[len(m.Imports) + i], f.Type, typeUse(m.Types[f.Type]))
+        if len(f.Locals) > 0 {
+            locals := make([]string, len(f.Locals))
+            for j, t := range f.Locals {
+                locals[j] = t.String()
+            }
+            fmt.Fprintf(&b, "    (local %s)\n", strings.Join(locals, " "))
+        }
+        depth := 2
+        for _, in := range f.Body {
+            if in.Op == OpEnd || in.Op == OpElse {
+                depth--
+            }
+            fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", depth), m.instrText(in, ids))
+            if ops[in.Op].imm == immBlock || in.Op == OpElse {
+                depth++
+            }
+        }
+        b.WriteString("  )\n")
+    }
+    for _, d := range m.Data {
+        fmt.Fprintf(&b, "  (data (i32.const %d) %s)\n", d.Offset, quote(d.Bytes))
+    }
+    b.WriteString(")\n")
+    return b.String()
+}
+
+func (m *Module) instrText(in Instr, ids []string) string {
+    name := in.Op.String()
+    switch ops[in.Op].imm {
+    case immIndex:
+        if in.Op == OpCall {
+            return name + " " + ids[in.Imm[0]]
+        }
+        return fmt.Sprintf("%s %d", name, in.Imm[0])
+    case immTable:
+        labels := make([]string, len(in.Imm))
+        for i, label := range in.Imm {
+            labels[i] = strconv.FormatInt(label, 10)
+        }
+        return name + " " + strings.Join(labels, " ")
+    case immType:
+        return fmt.Sprintf("%s (type %d)", name, in.Imm[0])
+    case immMemory:
+        // accesses are aligned naturally, which is the default
+        if in.Imm[1] != 0 {
+            return fmt.Sprintf("%s offset=%d", name, in.Imm[1])
+        }
+    case immI32, immI64:
+        return fmt.Sprintf("%s %d", name, in.Imm[0])
+    case immF64:
+        return name + " " + floatText(in.F)
+    }
+    return name
+}
+
+func floatText(f float64) string {
+    switch {
+    case math.IsNaN(f):
+        return "nan"
+    case math.IsInf(f, 1):
+        return "inf"
+    case math.IsInf(f, -1):
+        return "-inf"
+    }
+    return strconv.FormatFloat(f, 'g', -1, 64)
+}
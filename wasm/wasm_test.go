@@ -0,0 +1,301 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ibex-lang/ibex/check"
+	"github.com/ibex-lang/ibex/core"
+	"github.com/ibex-lang/ibex/internal/backendtest"
+	"github.com/ibex-lang/ibex/ir"
+)
+
+func generateSource(t *testing.T, src string, level int) *Module {
+	return generate(t, backendtest.Lower(t, src, level))
+}
+
+func generate(t *testing.T, l *backendtest.Lowered) *Module {
+	m, err := Generate(l.Program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// decodes and validates the binary encoding of m and runs its main
+func execute(t *testing.T, m *Module) (*machine, uint64, error) {
+	d, err := decode(m.Binary())
+	if err != nil {
+		t.Fatalf("%s\n%s", err, m)
+	}
+	if err := validate(d); err != nil {
+		t.Fatalf("%s\n%s", err, m)
+	}
+	mc := instantiate(d)
+	result, err := mc.invoke("main")
+	if err != nil {
+		return mc, 0, err
+	}
+	return mc, result[0], nil
+}
+
+// formats a value of type ty in memory like interp.Format, following the
+// layout in gen.go
+func (mc *machine) format(info *check.Info, m *Module, ty core.IbexType, x uint64) string {
+	word := func(t ir.Type, addr uint64) uint64 {
+		if size(t) == 4 {
+			return uint64(binary.LittleEndian.Uint32(mc.bytes(addr, 4)))
+		}
+		return binary.LittleEndian.Uint64(mc.bytes(addr, 8))
+	}
+	all := func(types []core.IbexType, addrs []uint64) string {
+		elems := make([]string, len(types))
+		for i, elem := range types {
+			elems[i] = mc.format(info, m, elem, word(ir.Repr(elem), addrs[i]))
+		}
+		return strings.Join(elems, ", ")
+	}
+	tuple := func(types []core.IbexType) []uint64 {
+		offsets, _ := layout(elements(ty))
+		addrs := make([]uint64, len(types))
+		for i, offset := range offsets {
+			addrs[i] = x + uint64(offset)
+		}
+		return addrs
+	}
+
+	switch t := ty.(type) {
+	case core.IbexSimpleType:
+		switch t.Name {
+		case "Int":
+			return strconv.FormatInt(int64(x), 10)
+		case "F64":
+			return strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64)
+		case "Bool":
+			return strconv.FormatBool(x != 0)
+		case "String":
+			return strconv.Quote(mc.str(x))
+		}
+		cs := info.Cases(t)[word(ir.Int, x)]
+		switch cs.Payload.(type) {
+		case nil:
+			return cs.Tag
+		case core.IbexTupleType, core.IbexNamedTupleType:
+			return cs.Tag + " " + mc.format(info, m, cs.Payload, word(ir.Repr(cs.Payload), x + payloadOffset))
+		}
+		return cs.Tag + " (" + mc.format(info, m, cs.Payload, word(ir.Repr(cs.Payload), x + payloadOffset)) + ")"
+	case core.IbexTupleType:
+		if len(t.ElementTypes) == 0 {
+			return "()"
+		}
+		return "(" + all(t.ElementTypes, tuple(t.ElementTypes)) + ")"
+	case core.IbexNamedTupleType:
+		types := ir.FieldsOf(t)
+		addrs := tuple(types)
+		fields := make([]string, len(t.Types))
+		for i, entry := range t.Types {
+			fields[i] = entry.Name + ": " + all(types[i:i + 1], addrs[i:i + 1])
+		}
+		return "(" + strings.Join(fields, ", ") + ")"
+	case core.IbexArrayType:
+		elem := t.Elem()
+		n := word(ir.Bool, x)
+		types, addrs := make([]core.IbexType, n), make([]uint64, n)
+		for i := range types {
+			types[i] = elem
+			addrs[i] = x + arrayHeader + uint64(i * size(ir.Repr(elem)))
+		}
+		return "[" + all(types, addrs) + "]"
+	case core.IbexFunctionType:
+		name := m.funcName(mc.d.elems[x])
+		if i := strings.Index(name, "["); i >= 0 {
+			name = name[:i]
+		}
+		return "fn " + name
+	}
+	return "?"
+}
+
+// runs the program, printing the value of main as the other backends do
+func run(t *testing.T, l *backendtest.Lowered) (string, error) {
+	m := generate(t, l)
+	mc, result, err := execute(t, m)
+	if err != nil {
+		return err.Error(), err
+	}
+	ret := ir.ReturnOf(l.Program.Lookup("main").Signature)
+	return mc.format(l.Info, m, ret, result) + "\n", nil
+}
+
+func TestGenerateMatchesInterpreter(t *testing.T) {
+	backendtest.MatchesInterpreter(t, run)
+}
+
+func TestGenerateTraps(t *testing.T) {
+	backendtest.FailsOnTraps(t, run, func(message string, pos string) string {
+		return "Runtime error: " + message + " at " + pos
+	})
+
+	m := generateSource(t, `fn div (a: Int, b: Int) -> Int
+    a / b
+fn main -> Int
+    (0 - 9223372036854775807 - 1, 0 - 1) -> div`, 0)
+	mc, result, err := execute(t, m)
+	assert.Nil(t, err)
+	assert.Equal(t, "-9223372036854775808", mc.format(nil, m, core.IbexSimpleType{Name: "Int"}, result))
+}
+
+func TestGenerateText(t *testing.T) {
+	m := generateSource(t, `fn pick (xs: [](Int, Int), i: Int) -> Int
+    match xs[i]
+        (x, 0) => x / i
+        (x, _) => x`, 1)
+	assert.Equal(t, `(module
+  (type (;0;) (func (param i32)))
+  (type (;1;) (func (param i64) (param i32) (param i32)))
+  (type (;2;) (func (param i32) (param i64) (result i64)))
+  (type (;3;) (func (param i64) (param i64) (param i32) (result i64)))
+  (import "ibex" "trap" (func $ibex.trap (type 0)))
+  (import "ibex" "trap_index" (func $ibex.trap_index (type 1)))
+  (table 0 funcref)
+  (memory 1)
+  (global (mut i32) (i32.const 72))
+  (export "memory" (memory 0))
+  (export "pick" (func $pick))
+  (func $pick (type 2) (param i32) (param i64) (result i64)
+    (local i32 i64 i32 i64 i64 i64 i32 i64 i64 i32)
+    loop
+      block
+        block
+          block
+            block
+              local.get 11
+              br_table 0 1 2 3 0
+            end
+            local.get 0
+            local.set 2
+            local.get 1
+            local.set 3
+            local.get 3
+            local.get 2
+            i32.const 8
+            call $ibex.check_index
+            local.get 2
+            local.get 3
+            i32.wrap_i64
+            i32.const 4
+            i32.mul
+            i32.add
+            i32.load offset=8
+            local.set 4
+            local.get 4
+            i64.load
+            local.set 5
+            local.get 4
+            i64.load offset=8
+            local.set 6
+            i64.const 0
+            local.set 7
+            local.get 6
+            local.get 7
+            i64.eq
+            local.set 8
+            local.get 8
+            if
+              i32.const 2
+              local.set 11
+              br 4
+            else
+              i32.const 1
+              local.set 11
+              br 4
+            end
+          end
+          local.get 5
+          local.set 10
+          i32.const 3
+          local.set 11
+          br 2
+        end
+        local.get 5
+        local.get 3
+        i32.const 28
+        call $ibex.div
+        local.set 9
+        local.get 9
+        local.set 10
+        i32.const 3
+        local.set 11
+        br 1
+      end
+      local.get 10
+      return
+    end
+    unreachable
+  )
+  (func $ibex.check_index (type 1) (param i64) (param i32) (param i32)
+    local.get 0
+    i64.const 0
+    i64.lt_s
+    local.get 0
+    local.get 1
+    i32.load
+    i64.extend_i32_u
+    i64.ge_s
+    i32.or
+    if
+      local.get 0
+      local.get 1
+      i32.load
+      local.get 2
+      call $ibex.trap_index
+      unreachable
+    end
+  )
+  (func $ibex.div (type 3) (param i64) (param i64) (param i32) (result i64)
+    local.get 1
+    i64.eqz
+    if
+      local.get 2
+      call $ibex.trap
+      unreachable
+    end
+    local.get 1
+    i64.const -1
+    i64.eq
+    if
+      i64.const 0
+      local.get 0
+      i64.sub
+      return
+    end
+    local.get 0
+    local.get 1
+    i64.div_s
+  )
+  (data (i32.const 8) "\0e\00\00\00test.ibex:2:13\00\00\22\00\00\00Division by zero at test.ibex:3:21")
+)
+`, m.String())
+}
+
+func TestValidateRejects(t *testing.T) {
+	m := &Module{
+		Types: []FuncType{{[]ValType{I64}, []ValType{I32}}},
+		Funcs: []*Func{{Name: "f", Type: 0, Body: []Instr{ins(OpLocalGet, 0)}}},
+	}
+	d, err := decode(m.Binary())
+	assert.Nil(t, err)
+	assert.EqualError(t, validate(d), "In function 0: instruction 1 (end): expected i32 on the stack, found i64")
+
+	m.Funcs[0].Body = []Instr{ins(OpBr, 1)}
+	d, err = decode(m.Binary())
+	assert.Nil(t, err)
+	assert.EqualError(t, validate(d), "In function 0: instruction 0 (br): unknown label 1")
+
+	_, err = decode(m.Binary()[:20])
+	assert.NotNil(t, err)
+}